@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+/* Correlación de emisiones propias con las cuentas ACME que las hacen */
+
+// Tiempo que se recuerda una emisión registrada en /ingest: de sobra para que
+// el certificado aparezca en los logs
+const issuanceRecordTTL = 30 * 24 * time.Hour
+
+var metricIssuance = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gctwatch_issuance_total",
+	Help: "Certificados de dominios propios por resultado de la correlación con las cuentas ACME.",
+}, []string{"status"})
+
+// Cuenta ACME (o automatización) y lo que se espera que emita
+type ACMEAccount struct {
+	Domains []string `json:"domains"`           // el dominio y sus subdominios
+	Issuers []string `json:"issuers,omitempty"` // organizaciones de la CA esperadas; vacío = cualquiera
+}
+
+// Resultado de la correlación
+type Issuance struct {
+	Status   string   `json:"status"`            // automated, other_account, unexpected_ca o bypassed
+	Expected []string `json:"expected"`          // cuentas que cubren los nombres del certificado
+	Account  string   `json:"account,omitempty"` // cuenta que registró la emisión
+}
+
+// Cada automatización registra lo que emite con POST /ingest usando su nombre
+// de cuenta como origen. Al llegar de los logs un certificado de un dominio
+// propio se busca ese registro (por emisor y número de serie): si falta, la
+// emisión se hizo fuera de la automatización aunque la CA sea la esperada.
+// Los registros van al almacén de estado, así que con Redis sirven entre
+// instancias y con bbolt sobreviven a un reinicio.
+type issuanceEnricher struct {
+	accounts map[string]ACMEAccount
+	store    StateStore
+}
+
+func NewIssuanceEnricher(path string, store StateStore) (*issuanceEnricher, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ACME accounts: %w", err)
+	}
+	var accounts map[string]ACMEAccount
+	if err := json.Unmarshal(data, &accounts); err != nil {
+		return nil, fmt.Errorf("failed to parse ACME accounts %s: %w", path, err)
+	}
+	for name, a := range accounts {
+		if len(a.Domains) == 0 {
+			return nil, fmt.Errorf("ACME account %s has no domains", name)
+		}
+		for i, d := range a.Domains {
+			a.Domains[i] = strings.TrimSuffix(strings.ToLower(d), ".")
+		}
+	}
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	return &issuanceEnricher{accounts: accounts, store: store}, nil
+}
+
+func (e *issuanceEnricher) Name() string { return "acme" }
+
+// Misma clave para el certificado enviado y el que llega del log
+func issuanceKey(cert *x509.Certificate) string {
+	h := cryptoProvider.Hash(cert.RawIssuer)
+	return "issued:" + hex.EncodeToString(h[:8]) + ":" + cert.SerialNumber.Text(16)
+}
+
+// Registra una emisión enviada a /ingest por la cuenta account
+func (e *issuanceEnricher) Record(ctx context.Context, account string, der []byte) error {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return err
+	}
+	_, err = e.store.SetNX(ctx, issuanceKey(cert), []byte(account), issuanceRecordTTL)
+	return err
+}
+
+// name es el dominio de la cuenta o un subdominio suyo
+func domainCovers(domain, name string) bool {
+	name = strings.TrimPrefix(strings.ToLower(name), "*.")
+	return name == domain || strings.HasSuffix(name, "."+domain)
+}
+
+func (e *issuanceEnricher) Enrich(ctx context.Context, ev *MatchEvent, in EnrichInput) error {
+	names := append([]string{in.Cert.Subject.CommonName}, in.Cert.DNSNames...)
+	var expected, issuers []string
+	anyIssuer := false
+	for account, a := range e.accounts {
+		covers := slices.ContainsFunc(a.Domains, func(d string) bool {
+			return slices.ContainsFunc(names, func(n string) bool { return n != "" && domainCovers(d, n) })
+		})
+		if !covers {
+			continue
+		}
+		expected = append(expected, account)
+		issuers = append(issuers, a.Issuers...)
+		anyIssuer = anyIssuer || len(a.Issuers) == 0
+	}
+	if len(expected) == 0 {
+		return nil
+	}
+	sort.Strings(expected)
+	value, found, err := e.store.Get(ctx, issuanceKey(in.Cert))
+	if err != nil {
+		return err
+	}
+	is := &Issuance{Expected: expected, Account: string(value)}
+	switch {
+	case found && slices.Contains(expected, is.Account):
+		is.Status = "automated"
+	case found:
+		is.Status = "other_account"
+	case !anyIssuer && !slices.ContainsFunc(in.Cert.Issuer.Organization, func(o string) bool {
+		return slices.ContainsFunc(issuers, func(i string) bool { return strings.EqualFold(i, o) })
+	}):
+		is.Status = "unexpected_ca"
+	default:
+		is.Status = "bypassed"
+	}
+	metricIssuance.WithLabelValues(is.Status).Inc()
+	ev.Enrichment.Issuance = is
+	return nil
+}
+
+// Para notificaciones, p.ej. "bypassed (expected acme-prod)"
+func issuanceSummary(is *Issuance) string {
+	s := is.Status
+	if is.Account != "" {
+		s += " by " + is.Account
+	}
+	return s + " (expected " + strings.Join(is.Expected, ", ") + ")"
+}
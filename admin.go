@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+/* Servidor HTTP de administración */
+
+func (mngr *CTLogsManager) adminMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		report := mngr.Health.Report()
+		w.Header().Set("Content-Type", "application/json")
+		if report.Status == HealthDown {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	})
+	mux.HandleFunc("GET /schema", func(w http.ResponseWriter, r *http.Request) {
+		schema, err := MatchEventSchema()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/schema+json")
+		w.Write(schema)
+	})
+	mux.Handle("GET /metrics", promhttp.Handler())
+	mux.HandleFunc("GET /stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(mngr.StatsReport())
+	})
+	mux.HandleFunc("GET /inventory", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(mngr.InventoryReport())
+	})
+	mux.HandleFunc("GET /coverage", func(w http.ResponseWriter, r *http.Request) {
+		report := mngr.CoverageReport()
+		if report == nil {
+			http.Error(w, "coverage not checked yet", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	})
+	mux.HandleFunc("GET /rules", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(mngr.RulesReport())
+	})
+	mux.HandleFunc("GET /maintenance", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(mngr.Maintenance.Status())
+	})
+	// {"enabled": true, "reason": "..."}
+	mux.HandleFunc("POST /maintenance", mngr.requireAdminToken(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Enabled bool   `json:"enabled"`
+			Reason  string `json:"reason"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+			http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		mngr.Maintenance.Set(req.Enabled, req.Reason)
+		status := mngr.Maintenance.Status()
+		status.Recent = nil
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+	}))
+	if mngr.Feed != nil {
+		mux.Handle("GET /feed/{tag}", mngr.Feed)
+	}
+	if mngr.Matches != nil {
+		mux.HandleFunc("GET /matches", mngr.serveMatches)
+		mux.HandleFunc("POST /matches/{id}/label", mngr.requireAdminToken(mngr.serveLabel))
+		mux.HandleFunc("GET /precision", mngr.servePrecision)
+	}
+	if mngr.Archive != nil {
+		mux.Handle("GET /ct/", archiveHandler{mngr.Archive})
+	}
+	if mngr.Receiver != nil {
+		mux.HandleFunc("POST /ingest", mngr.serveIngest)
+	}
+	return mux
+}
+
+// Rutas que modifican estado: piden el token de -admin-token-file y, sin él,
+// se rechazan
+func (mngr *CTLogsManager) requireAdminToken(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if mngr.AdminToken == "" {
+			http.Error(w, "forbidden: start with -admin-token-file to enable "+r.Method+" "+r.URL.Path, http.StatusForbidden)
+			return
+		}
+		if checkBearer(w, r, mngr.AdminToken) {
+			h(w, r)
+		}
+	}
+}
+
+// Arranca el servidor; devuelve la función de parada
+func (mngr *CTLogsManager) StartAdminServer(addr string) func() {
+	srv := &http.Server{Addr: addr, Handler: mngr.adminMux(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("WARNING: admin server: %v", err)
+			mngr.Health.Set("admin", false, err)
+		}
+	}()
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func adminRequest(t *testing.T, mux http.Handler, method, path, token, body string) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestAdminMaintenanceToken(t *testing.T) {
+	mngr := &CTLogsManager{Health: NewHealth(), Maintenance: &Maintenance{}}
+	const enable = `{"enabled": true, "reason": "test"}`
+
+	// Sin -admin-token-file no se puede cambiar
+	if code := adminRequest(t, mngr.adminMux(), http.MethodPost, "/maintenance", "", enable); code != http.StatusForbidden {
+		t.Errorf("POST /maintenance without admin token configured = %d; want 403", code)
+	}
+
+	mngr.AdminToken = "s3cret"
+	mux := mngr.adminMux()
+	for _, token := range []string{"", "other"} {
+		if code := adminRequest(t, mux, http.MethodPost, "/maintenance", token, enable); code != http.StatusUnauthorized {
+			t.Errorf("POST /maintenance with token %q = %d; want 401", token, code)
+		}
+	}
+	if mngr.Maintenance.Enabled() {
+		t.Fatal("maintenance enabled without a valid token")
+	}
+	if code := adminRequest(t, mux, http.MethodPost, "/maintenance", "s3cret", enable); code != http.StatusOK {
+		t.Errorf("POST /maintenance with the token = %d; want 200", code)
+	}
+	if !mngr.Maintenance.Enabled() {
+		t.Error("maintenance not enabled with the token")
+	}
+	// La lectura no pide token
+	if code := adminRequest(t, mux, http.MethodGet, "/maintenance", "", ""); code != http.StatusOK {
+		t.Errorf("GET /maintenance = %d; want 200", code)
+	}
+}
+
+func TestAdminLabelToken(t *testing.T) {
+	store, err := OpenMatchStore("sqlite:"+filepath.Join(t.TempDir(), "matches.db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	mngr := &CTLogsManager{Health: NewHealth(), Maintenance: &Maintenance{}, Matches: store}
+	const label = `{"label": "fp"}`
+
+	if code := adminRequest(t, mngr.adminMux(), http.MethodPost, "/matches/1/label", "", label); code != http.StatusForbidden {
+		t.Errorf("POST /matches/1/label without admin token configured = %d; want 403", code)
+	}
+	mngr.AdminToken = "s3cret"
+	mux := mngr.adminMux()
+	if code := adminRequest(t, mux, http.MethodPost, "/matches/1/label", "other", label); code != http.StatusUnauthorized {
+		t.Errorf("POST /matches/1/label with a wrong token = %d; want 401", code)
+	}
+	// Con el token llega al histórico, que no tiene esa coincidencia
+	if code := adminRequest(t, mux, http.MethodPost, "/matches/1/label", "s3cret", label); code != http.StatusNotFound {
+		t.Errorf("POST /matches/1/label with the token = %d; want 404", code)
+	}
+	if code := adminRequest(t, mux, http.MethodGet, "/matches", "", ""); code != http.StatusOK {
+		t.Errorf("GET /matches = %d; want 200", code)
+	}
+}
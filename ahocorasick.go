@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+/* Autómata Aho-Corasick para las reglas de palabras clave */
+
+// Busca a la vez todos los términos de una lista dentro de un valor, en un
+// solo recorrido del valor sea cual sea el número de términos. No distingue
+// mayúsculas (solo ASCII, como los nombres DNS). Es de solo lectura una vez
+// construido, así que lo comparten los workers.
+type keywordMatcher struct {
+	terms []string
+	// Aristas del estado s: labels y next en [start[s], start[s+1]),
+	// ordenadas por byte. Las de la raíz también en root, para no buscar.
+	start  []int32
+	labels []byte
+	next   []int32
+	root   [256]int32
+	fail   []int32
+	out    []int32 // término que acaba en el estado o en un sufijo suyo; -1 si ninguno
+}
+
+func newKeywordMatcher(terms []string) (*keywordMatcher, error) {
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("empty keyword list")
+	}
+	// Trie provisional
+	children := []map[byte]int32{{}}
+	out := []int32{-1}
+	for i, term := range terms {
+		if term == "" {
+			return nil, fmt.Errorf("empty keyword at position %d", i)
+		}
+		s := int32(0)
+		for j := 0; j < len(term); j++ {
+			c := lowerASCII(term[j])
+			nx, ok := children[s][c]
+			if !ok {
+				nx = int32(len(children))
+				children[s][c] = nx
+				children = append(children, map[byte]int32{})
+				out = append(out, -1)
+			}
+			s = nx
+		}
+		if out[s] < 0 {
+			out[s] = int32(i)
+		}
+	}
+
+	k := &keywordMatcher{
+		terms:  terms,
+		start:  make([]int32, len(children)+1),
+		fail:   make([]int32, len(children)),
+		out:    out,
+		labels: make([]byte, 0, len(children)-1),
+		next:   make([]int32, 0, len(children)-1),
+	}
+	for s, edges := range children {
+		k.start[s] = int32(len(k.labels))
+		for _, c := range slices.Sorted(maps.Keys(edges)) {
+			k.labels = append(k.labels, c)
+			k.next = append(k.next, edges[c])
+		}
+	}
+	k.start[len(children)] = int32(len(k.labels))
+	for c := range k.root {
+		k.root[c] = -1
+	}
+	for c, nx := range children[0] {
+		k.root[c] = nx
+	}
+
+	// Enlaces de fallo por niveles: el del hijo por c es a donde lleva c
+	// desde el fallo del padre
+	queue := make([]int32, 0, len(children))
+	for _, nx := range children[0] {
+		queue = append(queue, nx)
+	}
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+		for c, nx := range children[s] {
+			k.fail[nx] = k.step(k.fail[s], c)
+			if k.out[nx] < 0 {
+				k.out[nx] = k.out[k.fail[nx]]
+			}
+			queue = append(queue, nx)
+		}
+	}
+	return k, nil
+}
+
+// Número de términos; 0 si k es nil
+func (k *keywordMatcher) Len() int {
+	if k == nil {
+		return 0
+	}
+	return len(k.terms)
+}
+
+// Estado tras leer c desde s, siguiendo los enlaces de fallo
+func (k *keywordMatcher) step(s int32, c byte) int32 {
+	for s != 0 {
+		lo, hi := k.start[s], k.start[s+1]
+		if i, ok := slices.BinarySearch(k.labels[lo:hi], c); ok {
+			return k.next[int(lo)+i]
+		}
+		s = k.fail[s]
+	}
+	return max(k.root[c], 0)
+}
+
+// Primer término que aparece en value
+func (k *keywordMatcher) Find(value string) (string, bool) {
+	s := int32(0)
+	for i := 0; i < len(value); i++ {
+		s = k.step(s, lowerASCII(value[i]))
+		if t := k.out[s]; t >= 0 {
+			return k.terms[t], true
+		}
+	}
+	return "", false
+}
+
+func (k *keywordMatcher) MatchString(value string) bool {
+	_, ok := k.Find(value)
+	return ok
+}
+
+func lowerASCII(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
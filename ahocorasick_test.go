@@ -0,0 +1,121 @@
+package main
+
+import (
+	"math/rand/v2"
+	"strings"
+	"testing"
+)
+
+// Referencia sin autómata: el término que acaba antes en value y, entre los
+// que acaban en la misma posición, el más largo (el primero si empatan)
+func naiveKeywordFind(terms []string, value string) (string, bool) {
+	value = strings.ToLower(value)
+	for end := 1; end <= len(value); end++ {
+		best := -1
+		for i, t := range terms {
+			if strings.HasSuffix(value[:end], strings.ToLower(t)) && (best < 0 || len(t) > len(terms[best])) {
+				best = i
+			}
+		}
+		if best >= 0 {
+			return terms[best], true
+		}
+	}
+	return "", false
+}
+
+func naiveKeywordContains(terms []string, value string) bool {
+	for _, t := range terms {
+		if strings.Contains(strings.ToLower(value), strings.ToLower(t)) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestKeywordMatcher(t *testing.T) {
+	tests := []struct {
+		name  string
+		terms []string
+		value string
+		want  string // "" = sin coincidencia
+	}{
+		{"single", []string{"paypal"}, "login.paypal.com", "paypal"},
+		{"none", []string{"paypal", "bank"}, "example.com", ""},
+		{"case", []string{"PayPal"}, "LOGIN.PAYPAL.COM", "PayPal"},
+		{"at start", []string{"login"}, "login.example.com", "login"},
+		{"at end", []string{"com"}, "example.com", "com"},
+		{"whole value", []string{"example.com"}, "example.com", "example.com"},
+		{"overlapping", []string{"abcd", "bcx"}, "abcx", "bcx"},
+		{"overlapping first ends first", []string{"bcd", "abcde"}, "abcde", "bcd"},
+		{"suffix shared", []string{"secure", "cure"}, "xcure", "cure"},
+		{"suffix shared longest", []string{"cure", "secure"}, "secure-login", "secure"},
+		{"suffix through fail", []string{"she", "he", "hers"}, "ushers", "she"},
+		{"prefix of another", []string{"pay", "paypal"}, "paypa", "pay"},
+		{"nested", []string{"a", "aa", "aaa"}, "baaa", "a"},
+		{"fail chain", []string{"abab", "bac"}, "ababac", "abab"},
+		{"restart after fail", []string{"aab"}, "aaab", "aab"},
+		{"duplicates", []string{"bank", "BANK"}, "mybank.net", "bank"},
+		{"non ascii", []string{"bañco"}, "mi-bañco.es", "bañco"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := newKeywordMatcher(tt.terms)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := k.Find(tt.value)
+			if ok != (tt.want != "") || got != tt.want {
+				t.Errorf("Find(%q) = %q, %v; want %q", tt.value, got, ok, tt.want)
+			}
+			if naive, _ := naiveKeywordFind(tt.terms, tt.value); naive != tt.want {
+				t.Errorf("naive find of %q = %q; the table expects %q", tt.value, naive, tt.want)
+			}
+			if k.MatchString(tt.value) != naiveKeywordContains(tt.terms, tt.value) {
+				t.Errorf("MatchString(%q) = %v, strings.Contains disagrees", tt.value, k.MatchString(tt.value))
+			}
+		})
+	}
+}
+
+// Alfabeto pequeño para forzar solapamientos y sufijos compartidos
+func TestKeywordMatcherRandom(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	word := func(n int) string {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = "abcAB"[r.IntN(5)]
+		}
+		return string(b)
+	}
+	for range 2000 {
+		terms := make([]string, 1+r.IntN(6))
+		for i := range terms {
+			terms[i] = word(1 + r.IntN(4))
+		}
+		k, err := newKeywordMatcher(terms)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for range 10 {
+			value := word(r.IntN(12))
+			got, ok := k.Find(value)
+			want, wantOK := naiveKeywordFind(terms, value)
+			if got != want || ok != wantOK {
+				t.Fatalf("terms %q, Find(%q) = %q, %v; want %q, %v", terms, value, got, ok, want, wantOK)
+			}
+			if ok != naiveKeywordContains(terms, value) {
+				t.Fatalf("terms %q, value %q: MatchString %v disagrees with strings.Contains", terms, value, ok)
+			}
+		}
+	}
+}
+
+func TestKeywordMatcherErrors(t *testing.T) {
+	if _, err := newKeywordMatcher(nil); err == nil {
+		t.Error("empty list accepted")
+	}
+	if _, err := newKeywordMatcher([]string{"a", ""}); err == nil {
+		t.Error("empty keyword accepted")
+	}
+}
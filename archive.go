@@ -0,0 +1,331 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	CertTransp "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/tls"
+	ctx509 "github.com/google/certificate-transparency-go/x509"
+	bolt "go.etcd.io/bbolt"
+)
+
+/* Archivo local de entradas, servido como un log RFC 6962 */
+
+const (
+	DefaultArchiveMaxEntries = 1000000
+	archiveMaxGetEntries     = 1000 // por petición, como los logs
+)
+
+var (
+	boltArchiveBucket = []byte("archive")
+	archiveEntriesKey = []byte("entries")
+	archiveSTHKey     = []byte("sth")
+	archiveURLKey     = []byte("url")
+)
+
+// Guarda las entradas leídas de cada log tal como llegan (leaf_input y
+// extra_data) y el último STH del log que cubren, con su firma original. Por
+// /ct/<log>/ct/v1/get-sth y get-entries se sirven como si fuera una réplica
+// del log, así que cualquier cliente RFC 6962 puede consumirlas y verificar
+// el STH con la clave del log. Sin el árbol completo no hay pruebas.
+type EntryArchive interface {
+	Name() string
+	// Guarda entries a partir de start. Si llegan hasta el tamaño del STH
+	// con el que se leyeron, ese STH pasa a ser el que se sirve.
+	Append(logURL string, start uint64, entries []CertTransp.LeafEntry, sth *CertTransp.SignedTreeHead) error
+	Logs() ([]ArchivedLog, error)
+	// get-sth del log (por su ruta bajo /ct/); nil si no hay ninguno
+	STH(key string) ([]byte, error)
+	// Entradas consecutivas desde start hasta end como mucho; se corta en
+	// el primer hueco
+	Entries(key string, start, end uint64) ([]CertTransp.LeafEntry, error)
+	Close() error
+}
+
+// Abre el archivo a partir de su especificación, "bolt:/ruta/archive.db" o
+// "segments:/ruta/archive" (ver archive_segments.go)
+func OpenEntryArchive(spec string, maxEntries uint64) (EntryArchive, error) {
+	switch {
+	case strings.HasPrefix(spec, "bolt:"):
+		return openBoltArchive(strings.TrimPrefix(spec, "bolt:"), maxEntries)
+	case strings.HasPrefix(spec, "segments:"):
+		return openSegmentArchive(strings.TrimPrefix(spec, "segments:"), maxEntries)
+	}
+	return nil, fmt.Errorf("unknown entry archive %q (bolt:<path>, segments:<dir>)", spec)
+}
+
+// Todo en un fichero bbolt, una clave por entrada
+type boltArchive struct {
+	db         *bolt.DB
+	path       string
+	maxEntries uint64 // por log; 0 = sin límite
+}
+
+func openBoltArchive(path string, maxEntries uint64) (*boltArchive, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second, NoSync: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open entry archive %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltArchiveBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize entry archive %s: %w", path, err)
+	}
+	return &boltArchive{db: db, path: path, maxEntries: maxEntries}, nil
+}
+
+func (a *boltArchive) Name() string { return "bolt:" + a.path }
+func (a *boltArchive) Close() error { return a.db.Close() }
+
+// Nombre del log en las rutas: la URL sin esquema ni barra final
+func archiveLogKey(logURL string) string {
+	u := strings.TrimPrefix(strings.TrimPrefix(logURL, "https://"), "http://")
+	return strings.TrimSuffix(u, "/")
+}
+
+func archiveIndexKey(i uint64) []byte { return binary.BigEndian.AppendUint64(nil, i) }
+
+// leaf_input con su longitud delante y extra_data
+func encodeArchivedEntry(e CertTransp.LeafEntry) []byte {
+	buf := binary.AppendUvarint(nil, uint64(len(e.LeafInput)))
+	buf = append(buf, e.LeafInput...)
+	return append(buf, e.ExtraData...)
+}
+
+func decodeArchivedEntry(v []byte) (CertTransp.LeafEntry, error) {
+	n, size := binary.Uvarint(v)
+	if size <= 0 || uint64(len(v)-size) < n {
+		return CertTransp.LeafEntry{}, errors.New("corrupt archived entry")
+	}
+	leaf := v[size : size+int(n)]
+	return CertTransp.LeafEntry{LeafInput: leaf, ExtraData: v[size+int(n):]}, nil
+}
+
+// Como GetEntries, pero sin perder las entradas en bruto (para el archivo).
+// Si una entrada no se puede interpretar devuelve las anteriores junto con
+// el error: la que falla es start+len(entries).
+func parseLeafEntries(start uint64, raw []CertTransp.LeafEntry) ([]CertTransp.LogEntry, error) {
+	entries := make([]CertTransp.LogEntry, 0, len(raw))
+	for i := range raw {
+		e, err := CertTransp.LogEntryFromLeaf(int64(start)+int64(i), &raw[i])
+		if ctx509.IsFatal(err) {
+			return entries, fmt.Errorf("invalid entry %d: %w", start+uint64(i), err)
+		}
+		entries = append(entries, *e)
+	}
+	return entries, nil
+}
+
+func (a *boltArchive) Append(logURL string, start uint64, entries []CertTransp.LeafEntry, sth *CertTransp.SignedTreeHead) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	err := a.db.Update(func(tx *bolt.Tx) error {
+		lb, err := tx.Bucket(boltArchiveBucket).CreateBucketIfNotExists([]byte(archiveLogKey(logURL)))
+		if err != nil {
+			return err
+		}
+		if err := lb.Put(archiveURLKey, []byte(logURL)); err != nil {
+			return err
+		}
+		eb, err := lb.CreateBucketIfNotExists(archiveEntriesKey)
+		if err != nil {
+			return err
+		}
+		for i, e := range entries {
+			if err := eb.Put(archiveIndexKey(start+uint64(i)), encodeArchivedEntry(e)); err != nil {
+				return err
+			}
+		}
+		end := start + uint64(len(entries))
+		if sth != nil && end == sth.TreeSize {
+			data, err := marshalArchivedSTH(sth)
+			if err != nil {
+				return err
+			}
+			if err := lb.Put(archiveSTHKey, data); err != nil {
+				return err
+			}
+		}
+		if a.maxEntries == 0 || end < a.maxEntries {
+			return nil
+		}
+		// Retención: solo las últimas maxEntries
+		c := eb.Cursor()
+		for k, _ := c.First(); k != nil && binary.BigEndian.Uint64(k) < end-a.maxEntries; k, _ = c.First() {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to archive entries of %s: %w", logURL, err)
+	}
+	return nil
+}
+
+// Respuesta de get-sth con la firma original
+func marshalArchivedSTH(sth *CertTransp.SignedTreeHead) ([]byte, error) {
+	sig, err := tls.Marshal(sth.TreeHeadSignature)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(CertTransp.GetSTHResponse{
+		TreeSize: sth.TreeSize, Timestamp: sth.Timestamp,
+		SHA256RootHash: sth.SHA256RootHash[:], TreeHeadSignature: sig,
+	})
+}
+
+// Log archivado, para el índice de /ct/
+type ArchivedLog struct {
+	Log      string `json:"log"` // ruta bajo /ct/
+	URL      string `json:"url"`
+	First    uint64 `json:"first"`
+	Last     uint64 `json:"last"`
+	TreeSize uint64 `json:"tree_size,omitempty"` // del STH servido
+	Segments int    `json:"segments,omitempty"`  // con segments:
+	Bytes    int64  `json:"bytes,omitempty"`     // en disco, con segments:
+}
+
+func (a *boltArchive) Logs() ([]ArchivedLog, error) {
+	var out []ArchivedLog
+	err := a.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltArchiveBucket).ForEachBucket(func(k []byte) error {
+			lb := tx.Bucket(boltArchiveBucket).Bucket(k)
+			l := ArchivedLog{Log: string(k), URL: string(lb.Get(archiveURLKey))}
+			if eb := lb.Bucket(archiveEntriesKey); eb != nil {
+				c := eb.Cursor()
+				if first, _ := c.First(); first != nil {
+					last, _ := c.Last()
+					l.First, l.Last = binary.BigEndian.Uint64(first), binary.BigEndian.Uint64(last)
+				}
+			}
+			var sth CertTransp.GetSTHResponse
+			if json.Unmarshal(lb.Get(archiveSTHKey), &sth) == nil {
+				l.TreeSize = sth.TreeSize
+			}
+			out = append(out, l)
+			return nil
+		})
+	})
+	return out, err
+}
+
+// GET /ct/ (índice) y /ct/<log>/ct/v1/<método>
+type archiveHandler struct{ EntryArchive }
+
+func (a archiveHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/ct/")
+	if rest == "" {
+		logs, err := a.Logs()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(logs)
+		return
+	}
+	i := strings.LastIndex(rest, "/ct/v1/")
+	if i <= 0 {
+		http.NotFound(w, r)
+		return
+	}
+	key, method := rest[:i], rest[i+len("/ct/v1/"):]
+	switch method {
+	case "get-sth":
+		a.serveSTH(w, key)
+	case "get-entries":
+		a.serveEntries(w, r, key)
+	case "get-roots", "get-sth-consistency", "get-proof-by-hash", "get-entry-and-proof":
+		http.Error(w, "not available in an entry archive", http.StatusNotImplemented)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (a archiveHandler) serveSTH(w http.ResponseWriter, key string) {
+	data, err := a.STH(key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if data == nil {
+		http.Error(w, "no STH archived for this log yet", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// Entradas consecutivas desde start; se corta en el primer hueco, como un log
+// que devuelve menos de lo pedido
+func (a archiveHandler) serveEntries(w http.ResponseWriter, r *http.Request, key string) {
+	start, err1 := strconv.ParseUint(r.URL.Query().Get("start"), 10, 64)
+	end, err2 := strconv.ParseUint(r.URL.Query().Get("end"), 10, 64)
+	if err1 != nil || err2 != nil || end < start {
+		http.Error(w, "start and end must be integers with start <= end", http.StatusBadRequest)
+		return
+	}
+	entries, err := a.Entries(key, start, min(end, start+archiveMaxGetEntries-1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(entries) == 0 {
+		http.Error(w, "entries not archived", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CertTransp.GetEntriesResponse{Entries: entries})
+}
+
+func (a *boltArchive) STH(key string) ([]byte, error) {
+	var data []byte
+	err := a.db.View(func(tx *bolt.Tx) error {
+		if lb := tx.Bucket(boltArchiveBucket).Bucket([]byte(key)); lb != nil {
+			data = append(data, lb.Get(archiveSTHKey)...)
+		}
+		return nil
+	})
+	return data, err
+}
+
+func (a *boltArchive) Entries(key string, start, end uint64) ([]CertTransp.LeafEntry, error) {
+	var entries []CertTransp.LeafEntry
+	err := a.db.View(func(tx *bolt.Tx) error {
+		lb := tx.Bucket(boltArchiveBucket).Bucket([]byte(key))
+		if lb == nil || lb.Bucket(archiveEntriesKey) == nil {
+			return nil
+		}
+		c := lb.Bucket(archiveEntriesKey).Cursor()
+		next := start
+		for k, v := c.Seek(archiveIndexKey(start)); k != nil && next <= end; k, v = c.Next() {
+			if binary.BigEndian.Uint64(k) != next {
+				break
+			}
+			e, err := decodeArchivedEntry(v)
+			if err != nil {
+				return err
+			}
+			// Copia: los valores de bbolt solo valen dentro de la transacción
+			entries = append(entries, CertTransp.LeafEntry{
+				LeafInput: append([]byte(nil), e.LeafInput...), ExtraData: append([]byte(nil), e.ExtraData...),
+			})
+			next++
+		}
+		return nil
+	})
+	return entries, err
+}
@@ -0,0 +1,770 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	CertTransp "github.com/google/certificate-transparency-go"
+	"github.com/klauspost/compress/zstd"
+)
+
+/* Archivo de entradas en segmentos zstd con índice (-archive segments:) */
+
+const (
+	archiveSegmentEntries = 100000               // rango de índices de cada segmento
+	archiveFrameEntries   = archiveMaxGetEntries // entradas por trama: un get-entries descomprime una o dos
+	archiveManifestFile   = "manifest.json"
+	archiveLogFile        = "log.json"
+	archiveSegmentMagic   = "GCTSEG01"
+	archiveFrameSize      = 24 // primer índice, entradas, posición y tamaño de una trama en el índice
+)
+
+// Un directorio por log con un segmento por rango de índices
+// [n*100000, (n+1)*100000). El segmento abierto (<primero>.open) es un
+// fichero de registros sin comprimir al que se añaden las entradas; al
+// completarse el rango, o al pasar la lectura a otro rango, se cierra en
+// <primero>.zst: tramas zstd de hasta 1000 entradas consecutivas y, al
+// final, el índice con el primer índice y la posición de cada trama, así
+// que leer un rango descomprime solo sus tramas. La retención borra
+// segmentos cerrados enteros. manifest.json, en la raíz, resume logs,
+// segmentos y STH para las herramientas que recorren el archivo; al abrir
+// manda lo que hay en disco.
+type segmentArchive struct {
+	dir        string
+	maxEntries uint64 // por log, redondeado a segmentos enteros; 0 = sin límite
+	enc        *zstd.Encoder
+	dec        *zstd.Decoder
+
+	mu   sync.Mutex             // logs y escritura del manifiesto
+	logs map[string]*segmentLog // por ruta bajo /ct/
+}
+
+type segmentLog struct {
+	mu       sync.RWMutex
+	key, url string
+	dir      string
+	sth      []byte            // respuesta de get-sth
+	sealed   []*archiveSegment // por orden de índice
+	open     *openSegment
+	end      uint64 // índice siguiente al último archivado
+}
+
+// Segmento cerrado
+type archiveSegment struct {
+	path        string
+	first, last uint64
+	entries     uint64
+	bytes       int64
+	frames      []segmentFrame
+}
+
+type segmentFrame struct {
+	first  uint64
+	count  uint32
+	offset uint64
+	size   uint32
+}
+
+// Segmento abierto: registros de índice (8 bytes), longitud (uvarint) y
+// entrada, en orden de índice y con huecos si los hubo al leer
+type openSegment struct {
+	base    uint64 // primer índice del rango
+	path    string
+	f       *os.File
+	size    int64
+	pending []byte   // registros aún no escritos
+	index   []uint64 // índice de cada registro
+	offsets []int64  // y su posición
+}
+
+// Metadatos de log.json
+type segmentLogMeta struct {
+	Log string          `json:"log"`
+	URL string          `json:"url"`
+	STH json.RawMessage `json:"sth,omitempty"`
+}
+
+// Resumen del archivo en manifest.json
+type ArchiveManifest struct {
+	Version        int                  `json:"version"`
+	SegmentEntries uint64               `json:"segment_entries"`
+	FrameEntries   int                  `json:"frame_entries"`
+	UpdatedAt      time.Time            `json:"updated_at"`
+	Logs           []ArchiveManifestLog `json:"logs"`
+}
+
+type ArchiveManifestLog struct {
+	Log      string                   `json:"log"`
+	URL      string                   `json:"url"`
+	Dir      string                   `json:"dir"` // relativo a la raíz del archivo
+	TreeSize uint64                   `json:"tree_size,omitempty"`
+	Segments []ArchiveManifestSegment `json:"segments"`
+}
+
+type ArchiveManifestSegment struct {
+	File    string `json:"file"` // relativo a la raíz del archivo
+	First   uint64 `json:"first"`
+	Last    uint64 `json:"last"`
+	Entries uint64 `json:"entries"`
+	Bytes   int64  `json:"bytes"`
+	Open    bool   `json:"open,omitempty"` // sin comprimir, todavía recibe entradas
+}
+
+func openSegmentArchive(dir string, maxEntries uint64) (*segmentArchive, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "logs"), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create entry archive %s: %w", dir, err)
+	}
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, err
+	}
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		enc.Close()
+		return nil, err
+	}
+	a := &segmentArchive{dir: dir, maxEntries: maxEntries, enc: enc, dec: dec, logs: make(map[string]*segmentLog)}
+	dirs, err := os.ReadDir(filepath.Join(dir, "logs"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open entry archive %s: %w", dir, err)
+	}
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		l, err := a.loadLog(filepath.Join(dir, "logs", d.Name()))
+		if err != nil {
+			a.Close()
+			return nil, fmt.Errorf("failed to open entry archive %s: %w", dir, err)
+		}
+		if l != nil {
+			a.logs[l.key] = l
+		}
+	}
+	if err := a.writeManifest(); err != nil {
+		a.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *segmentArchive) Name() string { return "segments:" + a.dir }
+
+// Directorio de un log: su ruta con lo que no sea letra, dígito, punto o
+// guion cambiado por _
+func archiveLogDir(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+// Log del disco: sus segmentos cerrados y el abierto, que se recupera hasta
+// el último registro completo. nil si el directorio no tiene log.json.
+func (a *segmentArchive) loadLog(dir string) (*segmentLog, error) {
+	data, err := os.ReadFile(filepath.Join(dir, archiveLogFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var meta segmentLogMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Join(dir, archiveLogFile), err)
+	}
+	l := &segmentLog{key: meta.Log, url: meta.URL, dir: dir, sth: meta.STH}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var open []string
+	for _, f := range files {
+		path := filepath.Join(dir, f.Name())
+		switch filepath.Ext(f.Name()) {
+		case ".zst":
+			seg, err := readArchiveSegment(path)
+			if err != nil {
+				return nil, err
+			}
+			l.sealed = append(l.sealed, seg)
+			l.end = max(l.end, seg.last+1)
+		case ".open":
+			open = append(open, path)
+		case ".tmp":
+			os.Remove(path)
+		}
+	}
+	sort.Slice(l.sealed, func(i, j int) bool { return l.sealed[i].first < l.sealed[j].first })
+	for _, path := range open {
+		// Cerrado justo antes de parar: el .zst está completo
+		if _, err := os.Stat(strings.TrimSuffix(path, ".open") + ".zst"); err == nil {
+			os.Remove(path)
+			continue
+		}
+		if l.open != nil {
+			return nil, fmt.Errorf("%s: more than one open segment", dir)
+		}
+		if l.open, err = recoverOpenSegment(path); err != nil {
+			return nil, err
+		}
+		n := len(l.open.index)
+		if n == 0 {
+			l.open.f.Close()
+			os.Remove(path)
+			l.open = nil
+			continue
+		}
+		l.end = max(l.end, l.open.index[n-1]+1)
+	}
+	return l, nil
+}
+
+// Log por su URL, creándolo la primera vez
+func (a *segmentArchive) log(logURL string) (*segmentLog, error) {
+	key := archiveLogKey(logURL)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if l, ok := a.logs[key]; ok {
+		return l, nil
+	}
+	l := &segmentLog{key: key, url: logURL, dir: filepath.Join(a.dir, "logs", archiveLogDir(key))}
+	if err := os.MkdirAll(l.dir, 0o700); err != nil {
+		return nil, err
+	}
+	if data, err := os.ReadFile(filepath.Join(l.dir, archiveLogFile)); err == nil {
+		var meta segmentLogMeta
+		json.Unmarshal(data, &meta)
+		return nil, fmt.Errorf("archive directory %s already used by %s", l.dir, meta.Log)
+	}
+	if err := l.writeMeta(); err != nil {
+		return nil, err
+	}
+	a.logs[key] = l
+	return l, nil
+}
+
+func (l *segmentLog) writeMeta() error {
+	data, err := json.Marshal(segmentLogMeta{Log: l.key, URL: l.url, STH: l.sth})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(l.dir, archiveLogFile), data)
+}
+
+func (a *segmentArchive) Append(logURL string, start uint64, entries []CertTransp.LeafEntry, sth *CertTransp.SignedTreeHead) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	l, err := a.log(logURL)
+	if err == nil {
+		var changed bool
+		if changed, err = a.appendLog(l, start, entries, sth); err == nil && changed {
+			err = a.writeManifest()
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to archive entries of %s: %w", logURL, err)
+	}
+	return nil
+}
+
+// Añade las entradas al segmento abierto, cerrándolo al completar su rango.
+// Las que ya están archivadas (releídas tras un checkpoint anterior) se
+// saltan: los segmentos solo crecen. changed si se ha cerrado o borrado
+// algún segmento.
+func (a *segmentArchive) appendLog(l *segmentLog, start uint64, entries []CertTransp.LeafEntry, sth *CertTransp.SignedTreeHead) (changed bool, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, e := range entries {
+		idx := start + uint64(i)
+		if idx < l.end {
+			continue
+		}
+		base := idx - idx%archiveSegmentEntries
+		if l.open != nil && l.open.base != base {
+			if err := a.seal(l); err != nil {
+				return changed, err
+			}
+			changed = true
+		}
+		if l.open == nil {
+			if l.open, err = createOpenSegment(filepath.Join(l.dir, fmt.Sprintf("%020d.open", base)), base); err != nil {
+				return changed, err
+			}
+		}
+		l.open.add(idx, encodeArchivedEntry(e))
+		l.end = idx + 1
+		if idx == base+archiveSegmentEntries-1 {
+			if err := a.seal(l); err != nil {
+				return changed, err
+			}
+			changed = true
+		}
+	}
+	if l.open != nil {
+		if err := l.open.flush(); err != nil {
+			return changed, err
+		}
+	}
+	if sth != nil && start+uint64(len(entries)) == sth.TreeSize {
+		data, err := marshalArchivedSTH(sth)
+		if err != nil {
+			return changed, err
+		}
+		l.sth = data
+		if err := l.writeMeta(); err != nil {
+			return changed, err
+		}
+	}
+	// Retención: los segmentos cerrados que quedan enteros fuera de las
+	// últimas maxEntries
+	for a.maxEntries > 0 && l.end > a.maxEntries && len(l.sealed) > 0 && l.sealed[0].last < l.end-a.maxEntries {
+		if err := os.Remove(l.sealed[0].path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return changed, err
+		}
+		l.sealed, changed = l.sealed[1:], true
+	}
+	return changed, nil
+}
+
+func createOpenSegment(path string, base uint64) (*openSegment, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &openSegment{base: base, path: path, f: f}, nil
+}
+
+// Abre un segmento abierto tras un reinicio, truncando el último registro
+// si se quedó a medias
+func recoverOpenSegment(path string) (*openSegment, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	base, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(path), ".open"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid open segment name %s", path)
+	}
+	o, err := createOpenSegment(path, base)
+	if err != nil {
+		return nil, err
+	}
+	for o.size < int64(len(data)) {
+		idx, _, n, ok := parseOpenRecord(data[o.size:])
+		if !ok {
+			break
+		}
+		o.index, o.offsets = append(o.index, idx), append(o.offsets, o.size)
+		o.size += int64(n)
+	}
+	if o.size < int64(len(data)) {
+		if err := o.f.Truncate(o.size); err != nil {
+			o.f.Close()
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+func (o *openSegment) add(idx uint64, entry []byte) {
+	o.index = append(o.index, idx)
+	o.offsets = append(o.offsets, o.size+int64(len(o.pending)))
+	o.pending = binary.BigEndian.AppendUint64(o.pending, idx)
+	o.pending = binary.AppendUvarint(o.pending, uint64(len(entry)))
+	o.pending = append(o.pending, entry...)
+}
+
+func (o *openSegment) flush() error {
+	if len(o.pending) == 0 {
+		return nil
+	}
+	if _, err := o.f.Write(o.pending); err != nil {
+		return err
+	}
+	o.size += int64(len(o.pending))
+	o.pending = o.pending[:0]
+	return nil
+}
+
+// Índice, entrada y tamaño del registro al principio de b
+func parseOpenRecord(b []byte) (idx uint64, entry []byte, size int, ok bool) {
+	if len(b) < 8 {
+		return 0, nil, 0, false
+	}
+	n, s := binary.Uvarint(b[8:])
+	if s <= 0 || uint64(len(b)-8-s) < n {
+		return 0, nil, 0, false
+	}
+	return binary.BigEndian.Uint64(b), b[8+s : 8+s+int(n)], 8 + s + int(n), true
+}
+
+// Entradas consecutivas desde next hasta end como mucho
+func (o *openSegment) read(next, end uint64) ([]CertTransp.LeafEntry, error) {
+	i, found := slices.BinarySearch(o.index, next)
+	if !found {
+		return nil, nil
+	}
+	j := i
+	for j < len(o.index) && o.index[j] == next+uint64(j-i) && o.index[j] <= end {
+		j++
+	}
+	stop := o.size
+	if j < len(o.offsets) {
+		stop = o.offsets[j]
+	}
+	buf := make([]byte, stop-o.offsets[i])
+	if _, err := o.f.ReadAt(buf, o.offsets[i]); err != nil {
+		return nil, err
+	}
+	entries := make([]CertTransp.LeafEntry, 0, j-i)
+	for len(buf) > 0 {
+		_, v, n, ok := parseOpenRecord(buf)
+		if !ok {
+			return entries, errors.New("corrupt open archive segment")
+		}
+		e, err := decodeArchivedEntry(v)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, e)
+		buf = buf[n:]
+	}
+	return entries, nil
+}
+
+// Comprime el segmento abierto en tramas de entradas consecutivas y lo
+// sustituye por el .zst
+func (a *segmentArchive) seal(l *segmentLog) error {
+	o := l.open
+	if err := o.flush(); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(o.path)
+	if err != nil {
+		return err
+	}
+	seg := &archiveSegment{path: strings.TrimSuffix(o.path, ".open") + ".zst", first: o.index[0], last: o.index[len(o.index)-1], entries: uint64(len(o.index))}
+	var out, raw []byte
+	var frame segmentFrame
+	emit := func() {
+		if frame.count == 0 {
+			return
+		}
+		frame.offset = uint64(len(out))
+		out = a.enc.EncodeAll(raw, out)
+		frame.size = uint32(uint64(len(out)) - frame.offset)
+		seg.frames = append(seg.frames, frame)
+		raw, frame = raw[:0], segmentFrame{}
+	}
+	for pos := 0; pos < len(data); {
+		idx, entry, n, ok := parseOpenRecord(data[pos:])
+		if !ok {
+			return fmt.Errorf("corrupt open archive segment %s", o.path)
+		}
+		pos += n
+		if frame.count == archiveFrameEntries || (frame.count > 0 && idx != frame.first+uint64(frame.count)) {
+			emit()
+		}
+		if frame.count == 0 {
+			frame.first = idx
+		}
+		raw = binary.AppendUvarint(raw, uint64(len(entry)))
+		raw = append(raw, entry...)
+		frame.count++
+	}
+	emit()
+	for _, f := range seg.frames {
+		out = binary.BigEndian.AppendUint64(out, f.first)
+		out = binary.BigEndian.AppendUint32(out, f.count)
+		out = binary.BigEndian.AppendUint64(out, f.offset)
+		out = binary.BigEndian.AppendUint32(out, f.size)
+	}
+	out = binary.BigEndian.AppendUint32(out, uint32(len(seg.frames)))
+	out = append(out, archiveSegmentMagic...)
+	if err := writeFileAtomic(seg.path, out); err != nil {
+		return err
+	}
+	seg.bytes = int64(len(out))
+	o.f.Close()
+	// Si no se puede borrar, se borra al abrir: el .zst manda
+	l.sealed, l.open = append(l.sealed, seg), nil
+	return os.Remove(o.path)
+}
+
+// Índice de un segmento cerrado, del final del fichero
+func readArchiveSegment(path string) (*archiveSegment, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	corrupt := fmt.Errorf("corrupt archive segment %s", path)
+	trailer := make([]byte, 4+len(archiveSegmentMagic))
+	if st.Size() < int64(len(trailer)) {
+		return nil, corrupt
+	}
+	if _, err := f.ReadAt(trailer, st.Size()-int64(len(trailer))); err != nil {
+		return nil, err
+	}
+	n := int64(binary.BigEndian.Uint32(trailer))
+	if string(trailer[4:]) != archiveSegmentMagic || n == 0 || st.Size() < int64(len(trailer))+n*archiveFrameSize {
+		return nil, corrupt
+	}
+	index := make([]byte, n*archiveFrameSize)
+	if _, err := f.ReadAt(index, st.Size()-int64(len(trailer))-int64(len(index))); err != nil {
+		return nil, err
+	}
+	seg := &archiveSegment{path: path, bytes: st.Size(), frames: make([]segmentFrame, n)}
+	for i := range seg.frames {
+		b := index[i*archiveFrameSize:]
+		seg.frames[i] = segmentFrame{
+			first: binary.BigEndian.Uint64(b), count: binary.BigEndian.Uint32(b[8:]),
+			offset: binary.BigEndian.Uint64(b[12:]), size: binary.BigEndian.Uint32(b[20:]),
+		}
+		seg.entries += uint64(seg.frames[i].count)
+	}
+	seg.first = seg.frames[0].first
+	last := seg.frames[n-1]
+	seg.last = last.first + uint64(last.count) - 1
+	return seg, nil
+}
+
+// Entradas de la trama i
+func (s *archiveSegment) frame(f *os.File, dec *zstd.Decoder, i int) ([]CertTransp.LeafEntry, error) {
+	fr := s.frames[i]
+	comp := make([]byte, fr.size)
+	if _, err := f.ReadAt(comp, int64(fr.offset)); err != nil {
+		return nil, err
+	}
+	raw, err := dec.DecodeAll(comp, nil)
+	if err != nil {
+		return nil, fmt.Errorf("corrupt archive segment %s: %w", s.path, err)
+	}
+	entries := make([]CertTransp.LeafEntry, 0, fr.count)
+	for len(raw) > 0 {
+		n, size := binary.Uvarint(raw)
+		if size <= 0 || uint64(len(raw)-size) < n {
+			return nil, fmt.Errorf("corrupt archive segment %s", s.path)
+		}
+		e, err := decodeArchivedEntry(raw[size : size+int(n)])
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+		raw = raw[size+int(n):]
+	}
+	if len(entries) != int(fr.count) {
+		return nil, fmt.Errorf("corrupt archive segment %s", s.path)
+	}
+	return entries, nil
+}
+
+// Entradas consecutivas desde next hasta end como mucho, descomprimiendo
+// solo las tramas que las contienen
+func (s *archiveSegment) read(dec *zstd.Decoder, next, end uint64) ([]CertTransp.LeafEntry, error) {
+	i := sort.Search(len(s.frames), func(i int) bool { return s.frames[i].first+uint64(s.frames[i].count) > next })
+	if i == len(s.frames) || s.frames[i].first > next {
+		return nil, nil
+	}
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []CertTransp.LeafEntry
+	for ; i < len(s.frames) && next <= end; i++ {
+		fr := s.frames[i]
+		if fr.first > next {
+			break // hueco
+		}
+		es, err := s.frame(f, dec, i)
+		if err != nil {
+			return entries, err
+		}
+		to := min(uint64(len(es)), end-fr.first+1)
+		entries = append(entries, es[next-fr.first:to]...)
+		next = fr.first + to
+	}
+	return entries, nil
+}
+
+// Registros completos de un segmento abierto, sin tocarlo: lo puede estar
+// escribiendo una instancia en marcha
+func readOpenSegmentFile(path string) ([]uint64, []CertTransp.LeafEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var index []uint64
+	var entries []CertTransp.LeafEntry
+	for len(data) > 0 {
+		idx, v, n, ok := parseOpenRecord(data)
+		if !ok {
+			break
+		}
+		e, err := decodeArchivedEntry(v)
+		if err != nil {
+			return nil, nil, err
+		}
+		index, entries = append(index, idx), append(entries, e)
+		data = data[n:]
+	}
+	return index, entries, nil
+}
+
+func (a *segmentArchive) get(key string) *segmentLog {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.logs[key]
+}
+
+func (a *segmentArchive) STH(key string) ([]byte, error) {
+	l := a.get(key)
+	if l == nil {
+		return nil, nil
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.sth, nil
+}
+
+func (a *segmentArchive) Entries(key string, start, end uint64) ([]CertTransp.LeafEntry, error) {
+	l := a.get(key)
+	if l == nil {
+		return nil, nil
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	var entries []CertTransp.LeafEntry
+	next := start
+	for next <= end {
+		var got []CertTransp.LeafEntry
+		var err error
+		i := sort.Search(len(l.sealed), func(i int) bool { return l.sealed[i].last >= next })
+		switch {
+		case i < len(l.sealed) && l.sealed[i].first <= next:
+			got, err = l.sealed[i].read(a.dec, next, end)
+		case l.open != nil:
+			got, err = l.open.read(next, end)
+		}
+		entries = append(entries, got...)
+		if err != nil {
+			return entries, err
+		}
+		if len(got) == 0 {
+			break
+		}
+		next += uint64(len(got))
+	}
+	return entries, nil
+}
+
+// Estado del log para el índice y el manifiesto
+func (l *segmentLog) manifest(root string) (ArchiveManifestLog, ArchivedLog) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	rel := func(path string) string {
+		r, _ := filepath.Rel(root, path)
+		return filepath.ToSlash(r)
+	}
+	m := ArchiveManifestLog{Log: l.key, URL: l.url, Dir: rel(l.dir), Segments: []ArchiveManifestSegment{}}
+	for _, s := range l.sealed {
+		m.Segments = append(m.Segments, ArchiveManifestSegment{File: rel(s.path), First: s.first, Last: s.last, Entries: s.entries, Bytes: s.bytes})
+	}
+	if o := l.open; o != nil && len(o.index) > 0 {
+		m.Segments = append(m.Segments, ArchiveManifestSegment{
+			File: rel(o.path), First: o.index[0], Last: o.index[len(o.index)-1], Entries: uint64(len(o.index)), Bytes: o.size, Open: true,
+		})
+	}
+	var sth CertTransp.GetSTHResponse
+	if json.Unmarshal(l.sth, &sth) == nil {
+		m.TreeSize = sth.TreeSize
+	}
+	al := ArchivedLog{Log: l.key, URL: l.url, TreeSize: m.TreeSize, Segments: len(m.Segments)}
+	if n := len(m.Segments); n > 0 {
+		al.First, al.Last = m.Segments[0].First, m.Segments[n-1].Last
+	}
+	for _, s := range m.Segments {
+		al.Bytes += s.Bytes
+	}
+	return m, al
+}
+
+func (a *segmentArchive) snapshot() ([]ArchiveManifestLog, []ArchivedLog) {
+	keys := make([]string, 0, len(a.logs))
+	for k := range a.logs {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	var ms []ArchiveManifestLog
+	var ls []ArchivedLog
+	for _, k := range keys {
+		m, l := a.logs[k].manifest(a.dir)
+		ms, ls = append(ms, m), append(ls, l)
+	}
+	return ms, ls
+}
+
+func (a *segmentArchive) Logs() ([]ArchivedLog, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, logs := a.snapshot()
+	return logs, nil
+}
+
+func (a *segmentArchive) writeManifest() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	logs, _ := a.snapshot()
+	m := ArchiveManifest{
+		Version: 1, SegmentEntries: archiveSegmentEntries, FrameEntries: archiveFrameEntries,
+		UpdatedAt: time.Now().UTC(), Logs: logs,
+	}
+	if m.Logs == nil {
+		m.Logs = []ArchiveManifestLog{}
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(a.dir, archiveManifestFile), append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write archive manifest: %w", err)
+	}
+	return nil
+}
+
+// Deja los segmentos abiertos en disco, para seguir con ellos al arrancar
+func (a *segmentArchive) Close() error {
+	var errs []error
+	a.mu.Lock()
+	for _, l := range a.logs {
+		l.mu.Lock()
+		if l.open != nil {
+			errs = append(errs, l.open.flush(), l.open.f.Close())
+		}
+		l.mu.Unlock()
+	}
+	a.mu.Unlock()
+	errs = append(errs, a.writeManifest())
+	a.enc.Close()
+	a.dec.Close()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	CertTransp "github.com/google/certificate-transparency-go"
+)
+
+const testArchiveLog = "https://ct.example.net/2026/"
+
+func testArchiveEntry(i uint64) CertTransp.LeafEntry {
+	return CertTransp.LeafEntry{LeafInput: fmt.Appendf(nil, "leaf-%d", i), ExtraData: fmt.Appendf(nil, "extra-%d", i)}
+}
+
+// Añade [from, to) en lotes como los de get-entries
+func appendTestEntries(t *testing.T, a EntryArchive, from, to uint64) {
+	t.Helper()
+	for start := from; start < to; start += archiveMaxGetEntries {
+		end := min(start+archiveMaxGetEntries, to)
+		batch := make([]CertTransp.LeafEntry, 0, end-start)
+		for i := start; i < end; i++ {
+			batch = append(batch, testArchiveEntry(i))
+		}
+		if err := a.Append(testArchiveLog, start, batch, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Comprueba que Entries(start, end) devuelve exactamente [start, start+want)
+func checkArchiveRange(t *testing.T, a EntryArchive, start, end uint64, want int) {
+	t.Helper()
+	got, err := a.Entries(archiveLogKey(testArchiveLog), start, end)
+	if err != nil {
+		t.Fatalf("Entries(%d, %d): %v", start, end, err)
+	}
+	if len(got) != want {
+		t.Fatalf("Entries(%d, %d) returned %d entries; want %d", start, end, len(got), want)
+	}
+	for i, e := range got {
+		w := testArchiveEntry(start + uint64(i))
+		if !bytes.Equal(e.LeafInput, w.LeafInput) || !bytes.Equal(e.ExtraData, w.ExtraData) {
+			t.Fatalf("Entries(%d, %d)[%d] = %q; want %q", start, end, i, e.LeafInput, w.LeafInput)
+		}
+	}
+}
+
+func openTestSegmentArchive(t *testing.T, dir string) *segmentArchive {
+	t.Helper()
+	a, err := openSegmentArchive(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestSegmentArchiveRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	a := openTestSegmentArchive(t, dir)
+	// Dos segmentos completos y parte del tercero, con un hueco en el segundo
+	const gapStart, gapEnd, total = 120_000, 120_500, 2*archiveSegmentEntries + 2_500
+	appendTestEntries(t, a, 0, gapStart)
+	appendTestEntries(t, a, gapEnd, total)
+	// Lo ya archivado se salta
+	appendTestEntries(t, a, 1_000, 3_000)
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reabierto: índices de los .zst y registros del .open desde disco
+	a = openTestSegmentArchive(t, dir)
+	defer a.Close()
+	logs, err := a.Logs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 1 || logs[0].Segments != 3 || logs[0].First != 0 || logs[0].Last != total-1 {
+		t.Fatalf("Logs() = %+v; want one log with 3 segments [0, %d]", logs, total-1)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, archiveManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m ArchiveManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	var segs []ArchiveManifestSegment
+	if len(m.Logs) == 1 {
+		segs = m.Logs[0].Segments
+	}
+	want := []ArchiveManifestSegment{
+		{First: 0, Last: archiveSegmentEntries - 1, Entries: archiveSegmentEntries},
+		{First: archiveSegmentEntries, Last: 2*archiveSegmentEntries - 1, Entries: archiveSegmentEntries - (gapEnd - gapStart)},
+		{First: 2 * archiveSegmentEntries, Last: total - 1, Entries: 2_500, Open: true},
+	}
+	if len(segs) != len(want) {
+		t.Fatalf("manifest has %d segments; want %d", len(segs), len(want))
+	}
+	for i, s := range segs {
+		if s.First != want[i].First || s.Last != want[i].Last || s.Entries != want[i].Entries || s.Open != want[i].Open {
+			t.Errorf("manifest segment %d = %+v; want %+v", i, s, want[i])
+		}
+	}
+
+	tests := []struct {
+		name       string
+		start, end uint64
+		want       int
+	}{
+		{"first entry", 0, 0, 1},
+		{"mid frame", 54_321, 54_330, 10},
+		{"across frames", 12_990, 13_009, 20},
+		{"one get-entries", 123_456, 124_455, 1000},
+		{"across sealed segments", 99_500, 100_499, 1000},
+		{"sealed into open", 199_900, 200_099, 200},
+		{"open only", 201_000, 201_099, 100},
+		{"up to the gap", 119_990, 120_100, 10},
+		{"after the gap", gapEnd, gapEnd + 9, 10},
+		{"in the gap", 120_100, 120_200, 0},
+		{"past the end", total - 5, total + 100, 5},
+		{"not archived", total, total + 10, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkArchiveRange(t, a, tt.start, tt.end, tt.want)
+		})
+	}
+}
+
+func TestSegmentArchiveRecovery(t *testing.T) {
+	dir := t.TempDir()
+	a := openTestSegmentArchive(t, dir)
+	const total = archiveSegmentEntries + 2_500
+	appendTestEntries(t, a, 0, total)
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	logDir := filepath.Join(dir, "logs", archiveLogDir(archiveLogKey(testArchiveLog)))
+	sealed := filepath.Join(logDir, fmt.Sprintf("%020d.zst", 0))
+	open := filepath.Join(logDir, fmt.Sprintf("%020d.open", archiveSegmentEntries))
+
+	// Último registro del segmento abierto a medias: se recupera hasta el
+	// anterior y se sigue escribiendo desde ahí
+	st, err := os.Stat(open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(open, st.Size()-3); err != nil {
+		t.Fatal(err)
+	}
+	a = openTestSegmentArchive(t, dir)
+	checkArchiveRange(t, a, total-10, total+10, 9)
+	appendTestEntries(t, a, total-1, total+10)
+	checkArchiveRange(t, a, total-10, total+10, 20)
+
+	// Última trama de un segmento cerrado dañada con el índice intacto: las
+	// anteriores se leen y esa da error
+	seg, err := readArchiveSegment(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := seg.frames[len(seg.frames)-1]
+	data, err := os.ReadFile(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := last.offset + uint64(last.size)/2; i < last.offset+uint64(last.size); i++ {
+		data[i] ^= 0xff
+	}
+	if err := os.WriteFile(sealed, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	checkArchiveRange(t, a, 0, 999, 1000)
+	if _, err := a.Entries(archiveLogKey(testArchiveLog), last.first, last.first+10); err == nil {
+		t.Error("damaged last frame read without error")
+	}
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Segmento cerrado truncado (sin índice): no se abre el archivo
+	if err := os.Truncate(sealed, int64(last.offset)+int64(last.size)/2); err != nil {
+		t.Fatal(err)
+	}
+	if a, err := openSegmentArchive(dir, 0); err == nil {
+		a.Close()
+		t.Error("archive with a truncated sealed segment opened")
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+/* Qué hacer con las entradas que no caben en OutputChan */
+
+const (
+	BackpressureDrop  = "drop"  // se descartan (hueco de cobertura)
+	BackpressureBlock = "block" // la lectura espera a que haya hueco
+	BackpressureSpill = "spill" // van a la cola en disco (-spill-queue)
+)
+
+var metricBackpressureBlocked = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gctwatch_backpressure_blocked_seconds_total",
+	Help: "Tiempo que la lectura de cada log ha esperado con OutputChan lleno (política block).",
+}, []string{"log"})
+
+func checkBackpressure(policy string) error {
+	switch policy {
+	case BackpressureDrop, BackpressureBlock, BackpressureSpill:
+		return nil
+	}
+	return fmt.Errorf("unknown backpressure policy %q (drop, block, spill)", policy)
+}
+
+// Encola las entradas de un lote según la política. Devuelve cuántas se han
+// descartado. Con block, si se para a mitad, las que faltan siguen pendientes
+// para el checkpoint y se vuelven a leer en el siguiente arranque.
+func (mngr *CTLogsManager) enqueue(source *CTLogSource, batch *entryBatch, entries []SourcedEntry) int {
+	var overflow []SourcedEntry
+	for i, se := range entries {
+		select {
+		case mngr.OutputChan <- se:
+			continue
+		default:
+		}
+		if mngr.Backpressure != BackpressureBlock {
+			overflow = append(overflow, se)
+			continue
+		}
+		t0 := time.Now()
+		select {
+		case mngr.OutputChan <- se:
+			metricBackpressureBlocked.WithLabelValues(source.Source).Add(time.Since(t0).Seconds())
+		case <-mngr.context.Done():
+			log.Printf("log %s: stopped with %d entries of the batch not queued", source.Source, len(entries)-i)
+			return 0
+		}
+	}
+	if len(overflow) > 0 && mngr.Backpressure == BackpressureSpill && mngr.Spill != nil {
+		n, err := mngr.Spill.Push(overflow)
+		if err != nil {
+			log.Printf("WARNING: %v", err)
+		}
+		overflow = overflow[n:]
+	}
+	for range overflow {
+		batch.Done()
+	}
+	if n := len(overflow); n > 0 {
+		metricEntriesDropped.WithLabelValues(source.Source).Add(float64(n))
+		source.Stats.Dropped.Add(int64(n))
+		log.Printf("WARNING: log %s: %d entries dropped, processing queue full", source.Source, n)
+	}
+	return len(overflow)
+}
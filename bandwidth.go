@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* Contabilidad y límites de ancho de banda */
+
+// Bytes descargados por log y día (UTC). Con DailyCap > 0, al superarlo se
+// pausa el tráfico de baja prioridad: logs marcados como tales y fuentes que
+// van recuperando atraso (más de una ventana por detrás del STH).
+type Bandwidth struct {
+	DailyCap    int64
+	LowPriority []string // subcadenas de URL de logs de baja prioridad
+
+	mu       sync.Mutex
+	day      string
+	total    int64
+	perLog   map[string]int64
+	exceeded bool
+}
+
+func NewBandwidth(dailyCap int64, lowPriority []string) *Bandwidth {
+	return &Bandwidth{DailyCap: dailyCap, LowPriority: lowPriority, perLog: make(map[string]int64)}
+}
+
+// Cambio de día: se reinician los contadores diarios
+func (b *Bandwidth) rollover(now time.Time) {
+	if day := now.UTC().Format(time.DateOnly); day != b.day {
+		if b.exceeded {
+			log.Printf("bandwidth cap reset for %s, resuming low-priority traffic", day)
+		}
+		b.day, b.total, b.perLog, b.exceeded = day, 0, make(map[string]int64), false
+	}
+}
+
+func (b *Bandwidth) Add(logURL string, n int64) {
+	metricLogBytes.WithLabelValues(logURL).Add(float64(n))
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rollover(time.Now())
+	b.total += n
+	b.perLog[logURL] += n
+	metricBandwidthToday.Set(float64(b.total))
+	if b.DailyCap > 0 && b.total >= b.DailyCap && !b.exceeded {
+		b.exceeded = true
+		log.Printf("WARNING: daily bandwidth cap of %d bytes reached, pausing low-priority traffic until %s 00:00 UTC",
+			b.DailyCap, time.Now().UTC().AddDate(0, 0, 1).Format(time.DateOnly))
+	}
+}
+
+func (b *Bandwidth) Exceeded() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rollover(time.Now())
+	return b.exceeded
+}
+
+// Bytes de hoy: total y por log
+func (b *Bandwidth) Today() (int64, map[string]int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rollover(time.Now())
+	perLog := make(map[string]int64, len(b.perLog))
+	for k, v := range b.perLog {
+		perLog[k] = v
+	}
+	return b.total, perLog
+}
+
+func (b *Bandwidth) lowPriority(logURL string) bool {
+	for _, s := range b.LowPriority {
+		if s = strings.TrimSpace(s); s != "" && strings.Contains(logURL, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Indica si la siguiente petición de la fuente debe esperar por el límite diario
+func (b *Bandwidth) Paused(source *CTLogSource, treeSize uint64) bool {
+	if b == nil || b.DailyCap <= 0 || !b.Exceeded() {
+		return false
+	}
+	return b.lowPriority(source.Source) || treeSize-source.LastSize > source.WindowSize
+}
+
+// Cliente que anota los bytes recibidos a nombre del log
+func (b *Bandwidth) Client(c *http.Client, logURL string) *http.Client {
+	cc := *c
+	base := c.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	cc.Transport = &countingTransport{base: base, bw: b, log: logURL}
+	return &cc
+}
+
+type countingTransport struct {
+	base http.RoundTripper
+	bw   *Bandwidth
+	log  string
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &countingBody{rc: resp.Body, t: t}
+	return resp, nil
+}
+
+type countingBody struct {
+	rc io.ReadCloser
+	t  *countingTransport
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.rc.Read(p)
+	if n > 0 {
+		b.t.bw.Add(b.t.log, int64(n))
+	}
+	return n, err
+}
+
+func (b *countingBody) Close() error { return b.rc.Close() }
+
+// Parsea tamaños como "500MB", "50GiB" o "1048576"
+func parseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(strings.ToUpper(s))
+	if s == "" || s == "0" {
+		return 0, nil
+	}
+	units := []struct {
+		suffix string
+		mult   int64
+	}{
+		{"TIB", 1 << 40}, {"GIB", 1 << 30}, {"MIB", 1 << 20}, {"KIB", 1 << 10},
+		{"TB", 1e12}, {"GB", 1e9}, {"MB", 1e6}, {"KB", 1e3}, {"B", 1},
+	}
+	mult := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s, mult = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(mult)), nil
+}
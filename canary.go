@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+/* Dominios canario: nunca deberían tener certificados */
+
+// Clases de regla
+const (
+	RuleClassNormal = ""
+	RuleClassCanary = "canary" // cualquier coincidencia es un incidente
+)
+
+var metricCanaryHits = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gctwatch_canary_hits_total",
+	Help: "Certificados emitidos para dominios canario, por tag.",
+}, []string{"tag"})
+
+// Una coincidencia canario se trata aparte: no se muestrea, no se deduplica
+// ni se suprime en mantenimiento, va a todos los sinks sin mirar -routes y
+// queda en el registro de auditoría antes de enriquecerla.
+func (mngr *CTLogsManager) tripCanary(ev MatchEvent, cert *x509.Certificate, entry SourcedEntry) {
+	ev.Canary = true
+	metricCanaryHits.WithLabelValues(ev.Tag).Inc()
+	log.Printf("CRITICAL: canary %s: certificate for %s in %s #%d (%s)", ev.Tag, ev.MatchedName, ev.Log.URL, ev.Index, ev.Certificate.FingerprintSHA256)
+	if mngr.CanaryAudit != nil {
+		err := mngr.CanaryAudit.Append(ev)
+		if mngr.Health.Set("canary_audit", false, err) && err != nil {
+			log.Printf("WARNING: canary audit %s: %v", mngr.CanaryAudit.path, err)
+		}
+	}
+	mngr.Events.Publish("canary_hit", ev.Log.URL, "canary %s: certificate for %s, %s #%d", ev.Tag, ev.MatchedName, ev.Log.URL, ev.Index)
+	mngr.enrich(&ev, cert, entry)
+	for _, d := range mngr.dispatchers {
+		if mngr.Redactor.Applies(d.sink) {
+			d.Submit(mngr.Redactor.Apply(ev))
+		} else {
+			d.Submit(ev)
+		}
+	}
+}
+
+// Registro de un disparo del canario. Cada registro incluye el hash del
+// anterior, así que borrar o modificar uno rompe la cadena.
+type canaryAuditRecord struct {
+	Seq   uint64          `json:"seq"`
+	Time  time.Time       `json:"time"`
+	Tag   string          `json:"tag"`
+	Event json.RawMessage `json:"event"`
+	Prev  string          `json:"prev"` // hash del registro anterior; vacío en el primero
+	Hash  string          `json:"hash"`
+}
+
+func (r *canaryAuditRecord) digest() string {
+	h := cryptoProvider.NewHash()
+	fmt.Fprintf(h, "%s\n%d\n%s\n%s\n", r.Prev, r.Seq, r.Time.Format(time.RFC3339Nano), r.Tag)
+	h.Write(r.Event)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Fichero JSON Lines solo de añadir, con fsync en cada registro. Al abrirlo se
+// verifica la cadena completa. Para que ni el propio proceso pueda reescribirlo
+// conviene marcarlo con chattr +a.
+type CanaryAudit struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+	seq  uint64
+	last string
+}
+
+func OpenCanaryAudit(path string) (*CanaryAudit, error) {
+	a := &CanaryAudit{path: path}
+	if err := a.verify(); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open canary audit: %w", err)
+	}
+	a.f = f
+	return a, nil
+}
+
+// Recorre la cadena y deja preparado el siguiente registro
+func (a *CanaryAudit) verify() error {
+	f, err := os.Open(a.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read canary audit: %w", err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for line := 1; sc.Scan(); line++ {
+		var r canaryAuditRecord
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			return fmt.Errorf("canary audit %s line %d: %w", a.path, line, err)
+		}
+		if r.Seq != a.seq+1 || r.Prev != a.last || r.Hash != r.digest() {
+			return fmt.Errorf("canary audit %s: chain broken at line %d", a.path, line)
+		}
+		a.seq, a.last = r.Seq, r.Hash
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("canary audit %s: %w", a.path, err)
+	}
+	return nil
+}
+
+func (a *CanaryAudit) Append(ev MatchEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	r := canaryAuditRecord{Seq: a.seq + 1, Time: time.Now().UTC(), Tag: ev.Tag, Event: data, Prev: a.last}
+	r.Hash = r.digest()
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err := a.f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := a.f.Sync(); err != nil {
+		return err
+	}
+	a.seq, a.last = r.Seq, r.Hash
+	return nil
+}
+
+func (a *CanaryAudit) Name() string { return a.path }
+
+func (a *CanaryAudit) Close() error {
+	return a.f.Close()
+}
+
+// Tags de las reglas canario, para el preflight
+func (rules RegexRules) canaryTags() []string {
+	var tags []string
+	for tag, r := range rules {
+		if r.Class == RuleClassCanary {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func checkRuleClass(c string) error {
+	switch c {
+	case RuleClassNormal, RuleClassCanary:
+		return nil
+	}
+	return fmt.Errorf("invalid rule class %q (canary)", c)
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/* Checkpoints: posición de cada log */
+
+var ErrLeaseLost = errors.New("checkpoint lease held by another instance")
+
+// Última posición procesada de cada log, por URL
+type CheckpointStore interface {
+	Name() string
+	Load(ctx context.Context, logURL string) (uint64, bool, error)
+	Save(ctx context.Context, logURL string, pos uint64) error
+	Close() error
+}
+
+// Almacenes compartidos: cada log lo lee una sola instancia a la vez, la que
+// tiene su concesión. Si la instancia cae, la concesión caduca y otra retoma
+// el log desde el último checkpoint.
+type CheckpointLeaser interface {
+	Acquire(ctx context.Context, logURL string, ttl time.Duration) (bool, error) // obtiene o renueva
+	Release(ctx context.Context, logURL string) error
+}
+
+const DefaultLeaseTTL = 30 * time.Second
+
+// Identificador de esta instancia para las concesiones
+func defaultInstanceID() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// Abre el almacén a partir de su especificación: "json:/ruta/checkpoints.json",
+// "bolt:/ruta/checkpoints.db" (volcados en lotes según flush) o "redis://host:6379/0"
+func OpenCheckpointStore(spec, instance string, flush CheckpointFlush, network *Network) (CheckpointStore, error) {
+	switch {
+	case strings.HasPrefix(spec, "json:"):
+		path := strings.TrimPrefix(spec, "json:")
+		if err := checkWritableDir(path); err != nil {
+			return nil, fmt.Errorf("checkpoints directory not writable: %w", err)
+		}
+		return openDiskCheckpoints(spec, jsonCheckpointFile{path: path, fsync: flush.Fsync}, flush)
+	case strings.HasPrefix(spec, "bolt:"):
+		backend, err := openBoltCheckpointFile(strings.TrimPrefix(spec, "bolt:"), flush.Fsync)
+		if err != nil {
+			return nil, err
+		}
+		return openDiskCheckpoints(spec, backend, flush)
+	case strings.HasPrefix(spec, "redis://"), strings.HasPrefix(spec, "rediss://"):
+		return OpenRedisCheckpoints(spec, instance, network)
+	}
+	return nil, fmt.Errorf("unknown checkpoint store %q (json:<path>, bolt:<path>, redis://...)", spec)
+}
+
+// Comprueba (o consigue) la concesión de la fuente antes de leerla. Al
+// conseguirla (o al arrancar, sin concesiones) se retoma desde el checkpoint.
+func (mngr *CTLogsManager) claim(source *CTLogSource) bool {
+	if mngr.Checkpoints == nil {
+		return true
+	}
+	held := true
+	leaser, leased := mngr.Checkpoints.(CheckpointLeaser)
+	if leased {
+		var err error
+		held, err = leaser.Acquire(mngr.context, source.Source, mngr.LeaseTTL)
+		if err != nil {
+			if mngr.Health.Set("checkpoints", false, err) {
+				log.Printf("WARNING: checkpoint store %s: %v", mngr.Checkpoints.Name(), err)
+				mngr.Events.Publish("checkpoint_failing", mngr.Checkpoints.Name(), "%v", err)
+			}
+			return false
+		}
+	}
+	switch {
+	case held && !source.owned:
+		pos, found, err := mngr.Checkpoints.Load(mngr.context, source.Source)
+		if err != nil {
+			log.Printf("WARNING: failed to load checkpoint for %s: %v", source.Source, err)
+			if leased {
+				leaser.Release(mngr.context, source.Source)
+			}
+			return false
+		}
+		if found {
+			source.LastSize, source.saved = pos, pos
+			source.Stats.checkpoint.Store(pos)
+		}
+		source.acked.Reset()
+		source.owned = true
+		log.Printf("log %s: resuming at %d", source.Source, source.LastSize)
+	case !held && source.owned:
+		source.owned = false
+		log.Printf("WARNING: log %s: lease lost to another instance", source.Source)
+		mngr.Events.Publish("lease_lost", source.Source, "lease for %s lost to another instance", source.Source)
+	}
+	source.Stats.standby.Store(!held)
+	return held
+}
+
+// Posición inicial desde el checkpoint, sin esperar al STH. Con concesiones la
+// posición se vuelve a leer al obtenerla, por si otra instancia ha avanzado.
+func (mngr *CTLogsManager) resumeFromCheckpoint(ctx context.Context, source *CTLogSource) (bool, error) {
+	if mngr.Checkpoints == nil {
+		return false, nil
+	}
+	pos, found, err := mngr.Checkpoints.Load(ctx, source.Source)
+	if err != nil {
+		return false, fmt.Errorf("failed to load checkpoint for %s: %w", source.Source, err)
+	}
+	if !found {
+		return false, nil
+	}
+	_, leased := mngr.Checkpoints.(CheckpointLeaser)
+	source.LastSize, source.saved, source.owned = pos, pos, !leased
+	source.Stats.checkpoint.Store(pos)
+	return true, nil
+}
+
+// Guarda la posición confirmada: hasta la primera entrada que sigue en la
+// cola o en un worker, nunca por delante. Tras una caída se vuelven a leer
+// las entradas sin procesar en lugar de perderlas.
+func (mngr *CTLogsManager) saveCheckpoint(ctx context.Context, source *CTLogSource) {
+	pos := source.acked.Committed(source.LastSize)
+	if pos == source.saved {
+		return
+	}
+	err := mngr.Checkpoints.Save(ctx, source.Source, pos)
+	if errors.Is(err, ErrLeaseLost) {
+		source.owned = false
+		source.Stats.standby.Store(true)
+		log.Printf("WARNING: log %s: lease lost, checkpoint not saved", source.Source)
+		mngr.Events.Publish("lease_lost", source.Source, "lease for %s lost, checkpoint at %d not saved", source.Source, pos)
+		return
+	}
+	if err == nil {
+		source.saved = pos
+		source.Stats.checkpoint.Store(pos)
+	}
+	if mngr.Health.Set("checkpoints", false, err) && err != nil {
+		log.Printf("WARNING: checkpoint store %s: %v", mngr.Checkpoints.Name(), err)
+		mngr.Events.Publish("checkpoint_failing", mngr.Checkpoints.Name(), "%v", err)
+	}
+}
+
+// Libera las concesiones para que otra instancia retome los logs sin esperar a que caduquen
+func (mngr *CTLogsManager) releaseCheckpoints() {
+	leaser, ok := mngr.Checkpoints.(CheckpointLeaser)
+	for i := range mngr.sources {
+		// Lo procesado desde el último sondeo
+		if mngr.sources[i].owned || !ok {
+			mngr.saveCheckpoint(context.Background(), &mngr.sources[i])
+		}
+		if ok && mngr.sources[i].owned {
+			leaser.Release(context.Background(), mngr.sources[i].Source)
+		}
+	}
+	if err := mngr.Checkpoints.Close(); err != nil {
+		log.Printf("WARNING: closing checkpoint store: %v", err)
+	}
+}
+
+// Lote de entradas de una fuente en la cola de proceso
+type entryBatch struct {
+	start   uint64
+	pending atomic.Int64
+}
+
+func (b *entryBatch) Done() {
+	if b != nil {
+		b.pending.Add(-1)
+	}
+}
+
+// Lotes pendientes de una fuente, en orden. Solo lo usa la gorutina de
+// lectura de la fuente; los workers solo descuentan entradas de cada lote.
+type checkpointTracker struct {
+	batches []*entryBatch
+}
+
+func (t *checkpointTracker) Add(start uint64, n int) *entryBatch {
+	b := &entryBatch{start: start}
+	b.pending.Store(int64(n))
+	t.batches = append(t.batches, b)
+	return b
+}
+
+// Inicio del lote pendiente más antiguo o, si está todo procesado, current
+func (t *checkpointTracker) Committed(current uint64) uint64 {
+	for len(t.batches) > 0 && t.batches[0].pending.Load() <= 0 {
+		t.batches = t.batches[1:]
+	}
+	if len(t.batches) == 0 {
+		return current
+	}
+	return t.batches[0].start
+}
+
+// Descarta los lotes al retomar la fuente desde el almacén
+func (t *checkpointTracker) Reset() {
+	t.batches = nil
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+/* Checkpoints en disco (JSON o bbolt) para una sola instancia */
+
+const DefaultCheckpointFlush = 10 * time.Second
+
+// Agrupación de las escrituras a disco: a ritmo de firehose no se escribe en
+// cada sondeo, sino cada Interval o al avanzar Entries entre todos los logs.
+// Tras una caída se releen como mucho esas entradas.
+type CheckpointFlush struct {
+	Interval time.Duration
+	Entries  uint64 // 0 = solo por tiempo
+	Fsync    bool   // sin fsync el volcado sobrevive a la caída del proceso, no a la del sistema
+}
+
+var boltCheckpointBucket = []byte("checkpoints")
+
+// Formato del fichero de posiciones
+type checkpointBackend interface {
+	load() (map[string]uint64, error)
+	store(positions map[string]uint64) error
+	close() error
+}
+
+// Las posiciones se actualizan en memoria y se vuelcan a disco cada
+// intervalo, al acumular el avance configurado y al cerrar. Tras una caída se
+// releen como mucho las entradas de un lote (la deduplicación descarta las
+// repetidas).
+type diskCheckpoints struct {
+	name    string
+	backend checkpointBackend
+	entries uint64
+
+	mu        sync.Mutex
+	positions map[string]uint64
+	dirty     bool
+	advanced  uint64 // entradas avanzadas desde el último volcado
+
+	kick chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+func openDiskCheckpoints(name string, backend checkpointBackend, flush CheckpointFlush) (*diskCheckpoints, error) {
+	positions, err := backend.load()
+	if err != nil {
+		backend.close()
+		return nil, err
+	}
+	c := &diskCheckpoints{name: name, backend: backend, entries: flush.Entries, positions: positions,
+		kick: make(chan struct{}, 1), stop: make(chan struct{}), done: make(chan struct{})}
+	if flush.Interval <= 0 {
+		flush.Interval = DefaultCheckpointFlush
+	}
+	go c.flushLoop(flush.Interval)
+	return c, nil
+}
+
+func (c *diskCheckpoints) Name() string { return c.name }
+
+func (c *diskCheckpoints) Load(ctx context.Context, logURL string) (uint64, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pos, ok := c.positions[logURL]
+	return pos, ok, nil
+}
+
+func (c *diskCheckpoints) Save(ctx context.Context, logURL string, pos uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	prev := c.positions[logURL]
+	if prev == pos {
+		return nil
+	}
+	c.positions[logURL] = pos
+	c.dirty = true
+	if pos > prev {
+		c.advanced += pos - prev
+	}
+	if c.entries > 0 && c.advanced >= c.entries {
+		// Volcado anticipado; si ya hay uno pendiente, basta con ese
+		select {
+		case c.kick <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (c *diskCheckpoints) flush() error {
+	c.mu.Lock()
+	if !c.dirty {
+		c.mu.Unlock()
+		return nil
+	}
+	snapshot := maps.Clone(c.positions)
+	advanced := c.advanced
+	c.dirty, c.advanced = false, 0
+	c.mu.Unlock()
+	if err := c.backend.store(snapshot); err != nil {
+		c.mu.Lock()
+		c.dirty = true
+		c.advanced += advanced
+		c.mu.Unlock()
+		return fmt.Errorf("failed to write checkpoints: %w", err)
+	}
+	return nil
+}
+
+func (c *diskCheckpoints) flushLoop(interval time.Duration) {
+	defer close(c.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		case <-c.kick:
+		}
+		if err := c.flush(); err != nil {
+			log.Printf("WARNING: checkpoint store %s: %v", c.name, err)
+		}
+	}
+}
+
+func (c *diskCheckpoints) Close() error {
+	close(c.stop)
+	<-c.done
+	return errors.Join(c.flush(), c.backend.close())
+}
+
+// Fichero JSON {url: posición}, reescrito de forma atómica. Con fsync se
+// sincronizan el temporal y el directorio tras el rename, de modo que tras un
+// corte de luz queda el fichero anterior o el nuevo, nunca uno a medias.
+type jsonCheckpointFile struct {
+	path  string
+	fsync bool
+}
+
+func (f jsonCheckpointFile) load() (map[string]uint64, error) {
+	positions := make(map[string]uint64)
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return positions, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoints %s: %w", f.path, err)
+	}
+	if err := json.Unmarshal(data, &positions); err != nil {
+		return nil, fmt.Errorf("invalid checkpoints file %s: %w", f.path, err)
+	}
+	return positions, nil
+}
+
+func (f jsonCheckpointFile) store(positions map[string]uint64) error {
+	data, err := json.MarshalIndent(positions, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if f.fsync {
+		if err := tmp.Sync(); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil || !f.fsync {
+		return err
+	}
+	dir, err := os.Open(filepath.Dir(f.path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+func (f jsonCheckpointFile) close() error { return nil }
+
+// Bucket "checkpoints" de bbolt, posición en big endian
+type boltCheckpointFile struct{ db *bolt.DB }
+
+// Sin fsync, bbolt no sincroniza al confirmar (NoSync)
+func openBoltCheckpointFile(path string, fsync bool) (boltCheckpointFile, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second, NoSync: !fsync})
+	if err != nil {
+		return boltCheckpointFile{}, fmt.Errorf("failed to open checkpoints %s: %w", path, err)
+	}
+	return boltCheckpointFile{db: db}, nil
+}
+
+func (f boltCheckpointFile) load() (map[string]uint64, error) {
+	positions := make(map[string]uint64)
+	err := f.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(boltCheckpointBucket)
+		if err != nil {
+			return err
+		}
+		return b.ForEach(func(k, v []byte) error {
+			if len(v) == 8 {
+				positions[string(k)] = binary.BigEndian.Uint64(v)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoints: %w", err)
+	}
+	return positions, nil
+}
+
+func (f boltCheckpointFile) store(positions map[string]uint64) error {
+	return f.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltCheckpointBucket)
+		for url, pos := range positions {
+			if err := b.Put([]byte(url), binary.BigEndian.AppendUint64(nil, pos)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (f boltCheckpointFile) close() error { return f.db.Close() }
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+/* Checkpoints en Redis, con concesiones por log */
+
+const redisCheckpointsKey = redisKeyPrefix + "checkpoints" // hash url -> posición
+
+func redisLeaseKey(logURL string) string { return redisKeyPrefix + "lease:" + logURL }
+
+var (
+	// Obtiene la concesión libre o renueva la propia
+	redisAcquire = redis.NewScript(`
+local cur = redis.call('GET', KEYS[1])
+if cur == false then
+  redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+  return 1
+end
+if cur == ARGV[1] then
+  redis.call('PEXPIRE', KEYS[1], ARGV[2])
+  return 1
+end
+return 0`)
+	redisRelease = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('DEL', KEYS[1])
+end
+return 0`)
+	// Solo guarda quien tiene la concesión, y nunca hacia atrás
+	redisSave = redis.NewScript(`
+if redis.call('GET', KEYS[2]) ~= ARGV[1] then
+  return 0
+end
+local cur = tonumber(redis.call('HGET', KEYS[1], ARGV[2]) or '-1')
+if tonumber(ARGV[3]) > cur then
+  redis.call('HSET', KEYS[1], ARGV[2], ARGV[3])
+end
+return 1`)
+)
+
+type redisCheckpoints struct {
+	client   *redis.Client
+	instance string
+}
+
+func OpenRedisCheckpoints(url, instance string, network *Network) (*redisCheckpoints, error) {
+	client, err := newRedisClient(url, network)
+	if err != nil {
+		return nil, err
+	}
+	return &redisCheckpoints{client: client, instance: instance}, nil
+}
+
+func (s *redisCheckpoints) Name() string { return "redis:" + s.client.Options().Addr }
+func (s *redisCheckpoints) Close() error { return s.client.Close() }
+
+func (s *redisCheckpoints) Check() error {
+	return s.client.Ping(context.Background()).Err()
+}
+
+func (s *redisCheckpoints) Load(ctx context.Context, logURL string) (uint64, bool, error) {
+	v, err := s.client.HGet(ctx, redisCheckpointsKey, logURL).Result()
+	if errors.Is(err, redis.Nil) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	pos, err := strconv.ParseUint(v, 10, 64)
+	return pos, err == nil, err
+}
+
+func (s *redisCheckpoints) Save(ctx context.Context, logURL string, pos uint64) error {
+	ok, err := redisSave.Run(ctx, s.client, []string{redisCheckpointsKey, redisLeaseKey(logURL)},
+		s.instance, logURL, pos).Int()
+	if err != nil {
+		return err
+	}
+	if ok == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (s *redisCheckpoints) Acquire(ctx context.Context, logURL string, ttl time.Duration) (bool, error) {
+	ok, err := redisAcquire.Run(ctx, s.client, []string{redisLeaseKey(logURL)}, s.instance, ttl.Milliseconds()).Int()
+	return ok == 1, err
+}
+
+func (s *redisCheckpoints) Release(ctx context.Context, logURL string) error {
+	return redisRelease.Run(ctx, s.client, []string{redisLeaseKey(logURL)}, s.instance).Err()
+}
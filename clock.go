@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+/* Desfase de reloj */
+
+const DefaultClockSkewTolerance = 5 * time.Minute
+
+// Compara los timestamps de STHs y entradas con la hora local. Un STH no puede
+// ser posterior a la hora real y ningún log debería tener un STH más antiguo
+// que su MMD: si la mayoría de logs discrepa en el mismo sentido, el que está
+// mal es el reloj local.
+type ClockCheck struct {
+	Tolerance time.Duration
+	Health    *Health
+
+	mu     sync.Mutex
+	skews  map[string]time.Duration // por log: hora local - timestamp del STH, menos su MMD si va atrasado
+	future map[string]bool          // logs con el último STH del futuro
+	warned time.Time
+}
+
+func NewClockCheck(tolerance time.Duration, health *Health) *ClockCheck {
+	return &ClockCheck{Tolerance: tolerance, Health: health, skews: make(map[string]time.Duration), future: make(map[string]bool)}
+}
+
+// Timestamp del STH (ms). Devuelve error si viene del futuro más allá de la tolerancia.
+func (c *ClockCheck) ObserveSTH(logURL string, timestampMs uint64, mmd time.Duration) error {
+	age := time.Since(time.UnixMilli(int64(timestampMs)))
+	var skew time.Duration
+	switch {
+	case age < 0:
+		skew = age
+	case age > mmd:
+		skew = age - mmd
+	}
+	c.mu.Lock()
+	c.skews[logURL] = skew
+	c.mu.Unlock()
+	c.evaluate()
+	if -age > c.Tolerance {
+		return fmt.Errorf("STH timestamp %s is %s in the future (local clock behind?)",
+			time.UnixMilli(int64(timestampMs)).UTC().Format(time.RFC3339), (-age).Round(time.Second))
+	}
+	return nil
+}
+
+// Comprueba el STH de una fuente; se registra solo al cambiar
+func (mngr *CTLogsManager) checkClock(source *CTLogSource, timestampMs uint64) {
+	c := mngr.Clock
+	err := c.ObserveSTH(source.Source, timestampMs, source.MMD)
+	c.mu.Lock()
+	changed := c.future[source.Source] != (err != nil)
+	c.future[source.Source] = err != nil
+	c.mu.Unlock()
+	if changed && err != nil {
+		log.Printf("WARNING: log %s: %v", source.Source, err)
+		mngr.Events.Publish("sth_inconsistency", source.Source, "%v", err)
+	}
+}
+
+// Timestamp de una entrada (ms); una entrada del futuro recibe el mismo trato que un STH
+func (c *ClockCheck) ObserveEntry(logURL string, timestampMs uint64) error {
+	if ahead := time.Until(time.UnixMilli(int64(timestampMs))); ahead > c.Tolerance {
+		return fmt.Errorf("entry timestamp is %s in the future (local clock behind?)", ahead.Round(time.Second))
+	}
+	return nil
+}
+
+var metricEntryAge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "gctwatch_log_entry_age_seconds",
+	Help: "Antigüedad de la última entrada leída de cada log al leerla.",
+}, []string{"log"})
+
+// Antigüedad de la entrada más reciente de un lote respecto a la hora local.
+// Al día con el STH es el retraso real de integración del log, que no debería
+// pasar de su MMD; si aún vamos por detrás es nuestro retraso (checkpoint
+// antiguo, cola que no da abasto). Se avisa solo al cambiar de estado.
+func (mngr *CTLogsManager) checkEntryAge(source *CTLogSource, timestampMs uint64, atTip bool) {
+	age := time.Since(time.UnixMilli(int64(timestampMs)))
+	metricEntryAge.WithLabelValues(source.Source).Set(age.Seconds())
+	state := ""
+	if age > source.MMD+mngr.Clock.Tolerance {
+		state = "reader_behind"
+		if atTip {
+			state = "mmd_exceeded"
+		}
+	}
+	if state == source.ageState {
+		return
+	}
+	source.ageState = state
+	var err error
+	switch state {
+	case "mmd_exceeded":
+		err = fmt.Errorf("newest entry is %s old at the tree head, over the log's MMD of %s", age.Round(time.Second), source.MMD)
+	case "reader_behind":
+		err = fmt.Errorf("reading entries %s old, over the log's MMD of %s (stale checkpoint or processing backlog)", age.Round(time.Second), source.MMD)
+	}
+	mngr.Health.Set("entries:"+source.Source, false, err)
+	if err == nil {
+		log.Printf("log %s: entry age back within MMD", source.Source)
+		mngr.Events.Publish("entry_age_ok", source.Source, "log %s: entry age back within MMD", source.Source)
+		return
+	}
+	log.Printf("WARNING: log %s: %v", source.Source, err)
+	mngr.Events.Publish(state, source.Source, "log %s: %v", source.Source, err)
+}
+
+// Desfase estimado del reloj local: mediana de los logs observados.
+// Negativo = reloj local atrasado; positivo = adelantado.
+func (c *ClockCheck) Skew() (time.Duration, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.skews) == 0 {
+		return 0, 0
+	}
+	s := make([]time.Duration, 0, len(c.skews))
+	for _, d := range c.skews {
+		s = append(s, d)
+	}
+	sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+	return s[len(s)/2], len(s)
+}
+
+// Se necesitan al menos 3 logs para culpar al reloj local y no a un log concreto
+func (c *ClockCheck) evaluate() {
+	skew, n := c.Skew()
+	if n < 3 {
+		return
+	}
+	var err error
+	if skew > c.Tolerance || -skew > c.Tolerance {
+		err = fmt.Errorf("local clock appears to be off by %s (median of %d logs)", skew.Round(time.Second), n)
+	}
+	c.mu.Lock()
+	loud := err != nil && time.Since(c.warned) > time.Hour
+	if loud {
+		c.warned = time.Now()
+	}
+	c.mu.Unlock()
+	if loud {
+		log.Printf("WARNING: ********** %v; log usability checks and timestamps are unreliable, check NTP **********", err)
+	}
+	c.Health.Set("clock", false, err)
+}
+
+// Fecha de fin de un log relativa a la hora local, con la tolerancia de desfase:
+// solo se descarta si ha pasado con holgura, y se avisa si está en la zona dudosa.
+func (c *ClockCheck) Expired(desc string, endExclusive time.Time) bool {
+	if endExclusive.IsZero() {
+		return false
+	}
+	now := time.Now()
+	if now.After(endExclusive.Add(c.Tolerance)) {
+		return true
+	}
+	if now.After(endExclusive.Add(-c.Tolerance)) {
+		log.Printf("WARNING: log %s ends at %s, within the clock skew tolerance of now; keeping it",
+			desc, endExclusive.UTC().Format(time.RFC3339))
+	}
+	return false
+}
+
+// Consulta SNTP (RFC 4330): devuelve el desfase del reloj local respecto al servidor
+func (n *Network) ClockOffset(ctx context.Context, server string) (time.Duration, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+	host, _, _ := net.SplitHostPort(server)
+	if err := n.Policy.Check(host); err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	conn, err := n.Dialer.DialContext(ctx, "udp", server)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if dl, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(dl)
+	}
+	req := make([]byte, 48)
+	req[0] = 0x23 // LI=0, VN=4, modo cliente
+	t0 := time.Now()
+	if _, err := conn.Write(req); err != nil {
+		return 0, fmt.Errorf("failed to query NTP server %s: %w", server, err)
+	}
+	resp := make([]byte, 48)
+	if _, err := conn.Read(resp); err != nil {
+		return 0, fmt.Errorf("failed to read NTP response from %s: %w", server, err)
+	}
+	t3 := time.Now()
+	if resp[0]&0x07 != 4 || resp[1] == 0 {
+		return 0, fmt.Errorf("invalid NTP response from %s", server)
+	}
+	t1, t2 := ntpTime(resp[32:40]), ntpTime(resp[40:48])
+	return -(t1.Sub(t0) + t2.Sub(t3)) / 2, nil
+}
+
+// Segundos desde 1900 en 32.32 bits
+func ntpTime(b []byte) time.Time {
+	const ntpEpochOffset = 2208988800
+	sec := binary.BigEndian.Uint32(b[:4])
+	frac := binary.BigEndian.Uint32(b[4:])
+	nsec := (int64(frac) * 1e9) >> 32
+	return time.Unix(int64(sec)-ntpEpochOffset, nsec)
+}
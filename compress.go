@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+/* Compresión de salidas */
+
+const (
+	CompressNone = "none"
+	CompressGzip = "gzip"
+	CompressZstd = "zstd"
+)
+
+func checkCompression(kind string) error {
+	switch kind {
+	case "", CompressNone, CompressGzip, CompressZstd:
+		return nil
+	}
+	return fmt.Errorf("unknown compression %q (none, gzip, zstd)", kind)
+}
+
+// Writer comprimido; Flush vuelca lo pendiente sin cerrar el flujo
+type flushWriter interface {
+	io.WriteCloser
+	Flush() error
+}
+
+type nopFlushWriter struct{ io.Writer }
+
+func (nopFlushWriter) Close() error { return nil }
+func (nopFlushWriter) Flush() error { return nil }
+
+func newCompressWriter(kind string, w io.Writer) (flushWriter, error) {
+	switch kind {
+	case "", CompressNone:
+		return nopFlushWriter{w}, nil
+	case CompressGzip:
+		return gzip.NewWriter(w), nil
+	case CompressZstd:
+		return zstd.NewWriter(w)
+	}
+	return nil, checkCompression(kind)
+}
+
+// Comprime un cuerpo completo (webhooks, peticiones bulk). Devuelve también
+// el valor de Content-Encoding ("" si no se comprime).
+func compressBody(kind string, data []byte) ([]byte, string, error) {
+	if kind == "" || kind == CompressNone {
+		return data, "", nil
+	}
+	var buf bytes.Buffer
+	w, err := newCompressWriter(kind, &buf)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, "", err
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), kind, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+/* Fichero de configuración (-config) */
+
+// Cada clave es el nombre de un flag, con "-" o "_" indistintamente. Las
+// secciones anidadas se unen con "-" ({"window": {"size": 500}} = -window-size),
+// las listas se unen con comas y los objetos bajo un flag de pares clave=valor
+// ({"sink-concurrency": {"file": 4}}) se convierten a "file=4". Los flags de la
+// línea de comandos tienen prioridad; lo que no aparece conserva su valor por defecto.
+//
+// El fichero puede cambiar reglas, reglas remotas y enrutado, así que con
+// -rules-pubkey en la línea de comandos tiene que estar firmado con esa clave
+// como ellos. La clave no puede venir del propio fichero: quien lo modificara
+// podría quitarla.
+func applyConfigFile(path string, fs *flag.FlagSet) error {
+	var verifier *SignatureVerifier
+	if f := explicitFlag(fs, "rules-pubkey"); f != nil && f.Value.String() != "" {
+		v, err := LoadSignatureVerifier(f.Value.String())
+		if err != nil {
+			return fmt.Errorf("failed to load rules signing key: %w", err)
+		}
+		verifier = v
+	}
+	data, err := readVerified(path, verifier)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	var raw map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	default:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		err = dec.Decode(&raw)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	settings := make(map[string]string)
+	if err := flattenConfig("", raw, fs, settings); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if _, ok := settings["rules-pubkey"]; ok {
+		return fmt.Errorf("invalid config file %s: rules-pubkey must be given on the command line", path)
+	}
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	keys := make([]string, 0, len(settings))
+	for k := range settings {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, name := range keys {
+		if explicit[name] || name == "config" {
+			continue
+		}
+		if err := fs.Set(name, settings[name]); err != nil {
+			return fmt.Errorf("invalid config file %s: %s: %w", path, name, err)
+		}
+	}
+	return nil
+}
+
+// El flag si se ha dado en la línea de comandos
+func explicitFlag(fs *flag.FlagSet, name string) *flag.Flag {
+	var found *flag.Flag
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			found = f
+		}
+	})
+	return found
+}
+
+func flattenConfig(prefix string, v map[string]any, fs *flag.FlagSet, out map[string]string) error {
+	for k, val := range v {
+		name := strings.ReplaceAll(strings.ToLower(k), "_", "-")
+		if prefix != "" {
+			name = prefix + "-" + name
+		}
+		if m, ok := val.(map[string]any); ok && fs.Lookup(name) == nil {
+			if err := flattenConfig(name, m, fs, out); err != nil {
+				return err
+			}
+			continue
+		}
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("unknown setting %q", name)
+		}
+		s, err := configValue(val)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		out[name] = s
+	}
+	return nil
+}
+
+// Valor en el formato que espera el flag
+func configValue(v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []any:
+		parts := make([]string, 0, len(v))
+		for _, e := range v {
+			s, err := configValue(e)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, s)
+		}
+		return strings.Join(parts, ","), nil
+	case map[string]any:
+		parts := make([]string, 0, len(v))
+		for k, e := range v {
+			s, err := configValue(e)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, k+"="+s)
+		}
+		slices.Sort(parts)
+		return strings.Join(parts, ","), nil
+	case bool, int, int64, uint64, float64, json.Number:
+		return fmt.Sprint(v), nil
+	}
+	return "", fmt.Errorf("unsupported value %v", v)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// FlagSet con los flags que toca el fichero de prueba
+func newTestConfigFlags() (*flag.FlagSet, *string, *string) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("config", "", "")
+	pubkey := fs.String("rules-pubkey", "", "")
+	rulesURL := fs.String("rules-url", "", "")
+	return fs, pubkey, rulesURL
+}
+
+func writeTestFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApplyConfigFileSigned(t *testing.T) {
+	dir := t.TempDir()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(dir, "rules.pub")
+	writeTestFile(t, keyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	config := []byte("rules-url: https://rules.example.net/rules.json\n")
+	configPath := filepath.Join(dir, "config.yaml")
+	writeTestFile(t, configPath, config)
+	sign := func(data []byte) {
+		writeTestFile(t, configPath+".sig", []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(priv, data))))
+	}
+
+	// Sin clave no se pide firma
+	fs, _, rulesURL := newTestConfigFlags()
+	if err := applyConfigFile(configPath, fs); err != nil || *rulesURL == "" {
+		t.Fatalf("unsigned config without -rules-pubkey: %v, rules-url %q", err, *rulesURL)
+	}
+
+	// Con clave: sin firma, firmado y modificado después de firmar
+	tests := []struct {
+		name   string
+		sign   []byte // nil = sin firma
+		wantOK bool
+	}{
+		{"unsigned", nil, false},
+		{"signed", config, true},
+		{"tampered", []byte("rules-url: https://other.example.net/\n"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(configPath + ".sig")
+			if tt.sign != nil {
+				sign(tt.sign)
+			}
+			fs, _, rulesURL := newTestConfigFlags()
+			if err := fs.Parse([]string{"-rules-pubkey", keyPath}); err != nil {
+				t.Fatal(err)
+			}
+			err := applyConfigFile(configPath, fs)
+			if (err == nil) != tt.wantOK {
+				t.Fatalf("applyConfigFile = %v; want ok %v", err, tt.wantOK)
+			}
+			if !tt.wantOK && *rulesURL != "" {
+				t.Errorf("rules-url set to %q from a rejected config", *rulesURL)
+			}
+		})
+	}
+
+	// La clave no puede venir del propio fichero
+	writeTestFile(t, configPath, []byte("rules-pubkey: "+keyPath+"\n"))
+	fs, pubkey, _ := newTestConfigFlags()
+	if err := applyConfigFile(configPath, fs); err == nil || *pubkey != "" {
+		t.Errorf("rules-pubkey from the config file accepted: %v, %q", err, *pubkey)
+	}
+}
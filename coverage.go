@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+/* Cobertura: logs utilizables de la lista que no se monitorizan */
+
+var metricCoverageGaps = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "gctwatch_coverage_unmonitored_logs",
+	Help: "Logs utilizables de la lista que no se monitorizan, por motivo (filtered, init_failed, not_selected, new_log).",
+}, []string{"reason"})
+
+// Por qué un log utilizable no se monitoriza
+const (
+	CoverageFiltered    = "filtered"     // fuera de -only-logs o en -exclude-logs
+	CoverageInitFailed  = "init_failed"  // falló al arrancar (STH, réplicas, política de salida...)
+	CoverageNotSelected = "not_selected" // descartado en -select
+	CoverageNewLog      = "new_log"      // ha aparecido en la lista después de arrancar
+)
+
+var coverageReasons = []string{CoverageFiltered, CoverageInitFailed, CoverageNotSelected, CoverageNewLog}
+
+// Comparación de los logs monitorizados con todos los utilizables de la
+// última lista: "vigilamos todo CT" comprobado en lugar de supuesto. Un log
+// monitorizado cuenta aunque esté fallando; eso lo dicen /inventory y
+// /healthz.
+type CoverageReport struct {
+	CheckedAt   time.Time          `json:"checked_at"`
+	LogLists    []InventoryLogList `json:"log_lists"`
+	Usable      int                `json:"usable"`
+	Monitored   int                `json:"monitored"` // de los utilizables
+	Covered     bool               `json:"covered"`
+	Unmonitored []CoverageGap      `json:"unmonitored"`
+}
+
+type CoverageGap struct {
+	URL         string `json:"url"`
+	LogID       string `json:"log_id"`
+	Description string `json:"description,omitempty"`
+	Operator    string `json:"operator,omitempty"`
+	ListState   string `json:"list_state,omitempty"`
+	Reason      string `json:"reason"`
+	Error       string `json:"error,omitempty"` // con init_failed
+}
+
+type coverageState struct {
+	mu        sync.Mutex
+	attempted map[string]string // URL de los logs inicializados al arrancar -> error ("" si arrancó)
+	listed    []*logCandidate   // candidatos de la lista de arranque, sin filtrar
+	report    *CoverageReport
+}
+
+// Resultado de la inicialización de un log
+func (c *coverageState) initResult(url string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.attempted == nil {
+		c.attempted = make(map[string]string)
+	}
+	c.attempted[normalizeLogURL(url)] = ""
+	if err != nil {
+		c.attempted[normalizeLogURL(url)] = err.Error()
+	}
+}
+
+func (mngr *CTLogsManager) CoverageReport() *CoverageReport {
+	mngr.coverage.mu.Lock()
+	defer mngr.coverage.mu.Unlock()
+	return mngr.coverage.report
+}
+
+// Mismo criterio que initLogSource
+func (mngr *CTLogsManager) candidateUsable(c *logCandidate) bool {
+	if mngr.MergePolicy == MergeStrictest && len(c.rejectedBy) > 0 {
+		return false
+	}
+	return mngr.isUsableLog(c.desc, c.state, c.endExclusive, c.mmd)
+}
+
+// Compara los candidatos con las fuentes y avisa de los logs que han dejado
+// de estar cubiertos desde la comprobación anterior
+func (mngr *CTLogsManager) checkCoverage(candidates []*logCandidate, lists []InventoryLogList) {
+	monitored := make(map[string]bool, len(mngr.sources))
+	for i := range mngr.sources {
+		monitored[normalizeLogURL(mngr.sources[i].Source)] = true
+	}
+	r := &CoverageReport{CheckedAt: time.Now().UTC(), LogLists: lists, Unmonitored: []CoverageGap{}}
+	mngr.coverage.mu.Lock()
+	defer mngr.coverage.mu.Unlock()
+	seen := make(map[string]bool)
+	for _, c := range candidates {
+		url := normalizeLogURL(c.url)
+		if seen[url] || !mngr.candidateUsable(c) {
+			continue
+		}
+		seen[url] = true
+		r.Usable++
+		if monitored[url] {
+			r.Monitored++
+			continue
+		}
+		gap := CoverageGap{URL: c.url, LogID: c.id, Description: c.desc, Operator: c.operator, ListState: logStatusName(c.state)}
+		initErr, attempted := mngr.coverage.attempted[url]
+		switch {
+		case !mngr.logSelected(c.url):
+			gap.Reason = CoverageFiltered
+		case attempted && initErr != "":
+			gap.Reason, gap.Error = CoverageInitFailed, initErr
+		case attempted:
+			gap.Reason = CoverageNotSelected
+		default:
+			gap.Reason = CoverageNewLog
+		}
+		r.Unmonitored = append(r.Unmonitored, gap)
+	}
+	r.Covered = len(r.Unmonitored) == 0
+
+	previous := make(map[string]bool)
+	if mngr.coverage.report != nil {
+		for _, g := range mngr.coverage.report.Unmonitored {
+			previous[g.URL] = true
+		}
+	}
+	byReason := make(map[string]int)
+	for _, g := range r.Unmonitored {
+		byReason[g.Reason]++
+		if previous[g.URL] {
+			continue
+		}
+		detail := g.Reason
+		if g.Error != "" {
+			detail += ": " + g.Error
+		}
+		log.Printf("WARNING: usable log %s not monitored (%s)", g.URL, detail)
+		mngr.Events.Publish("log_unmonitored", g.URL, "usable log %s (%s) not monitored: %s", g.URL, g.Description, detail)
+	}
+	for _, reason := range coverageReasons {
+		metricCoverageGaps.WithLabelValues(reason).Set(float64(byReason[reason]))
+	}
+	// Sin recuento: Health solo guarda el error al cambiar de estado
+	var err error
+	if !r.Covered {
+		err = errors.New("usable logs not monitored (see /coverage)")
+	}
+	if mngr.Health.Set("coverage", false, err) && err == nil && mngr.coverage.report != nil {
+		log.Printf("coverage: all %d usable logs monitored", r.Usable)
+	}
+	mngr.coverage.report = r
+}
+
+// Vuelve a descargar las listas cada intervalo y comprueba la cobertura con
+// ellas. Un fallo de descarga deja el informe anterior.
+func (mngr *CTLogsManager) runCoverage(interval time.Duration) {
+	defer mngr.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-mngr.context.Done():
+			return
+		case <-ticker.C:
+			names, lists, loaded, err := mngr.loadLogLists()
+			if err != nil {
+				if !errors.Is(err, context.Canceled) {
+					log.Printf("WARNING: coverage: failed to refresh log lists: %v", err)
+				}
+				continue
+			}
+			candidates := mergeLogLists(names, lists, mngr.MergePolicy)
+			mngr.checkCoverage(append(candidates, extraLogCandidates(mngr.ExtraLogs)...), loaded)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/time/rate"
+)
+
+/* Referencia cruzada con crt.sh */
+
+const crtshBaseURL = "https://crt.sh/"
+
+// Enlace a crt.sh por huella SHA-256 y, opcionalmente, su ID
+type CrtSh struct {
+	URL string `json:"url"`
+	ID  int64  `json:"id,omitempty"` // 0 si no se ha resuelto (crt.sh tarda en indexar)
+}
+
+// Añade el enlace a todas las coincidencias; el ID solo se pide para los tags
+// de resolveTags y dentro del límite de peticiones (si se supera, se omite en
+// lugar de frenar el pipeline).
+type crtshEnricher struct {
+	client      *http.Client
+	limiter     *rate.Limiter
+	resolveTags []string
+}
+
+func NewCrtShEnricher(client *http.Client, rps float64, resolveTags []string) *crtshEnricher {
+	return &crtshEnricher{client: client, limiter: rate.NewLimiter(rate.Limit(rps), 1), resolveTags: resolveTags}
+}
+
+func (c *crtshEnricher) Name() string { return "crtsh" }
+
+func (c *crtshEnricher) Enrich(ctx context.Context, ev *MatchEvent, in EnrichInput) error {
+	fp := ev.Certificate.FingerprintSHA256
+	if fp == "" {
+		return nil
+	}
+	ref := &CrtSh{URL: crtshBaseURL + "?q=" + fp}
+	ev.Enrichment.CrtSh = ref
+	if len(c.resolveTags) == 0 || !routeHasAnyTag(Route{Tags: c.resolveTags}, ev.AllTags()) || !c.limiter.Allow() {
+		return nil
+	}
+	id, err := c.resolve(ctx, fp)
+	if err != nil {
+		return err
+	}
+	if id != 0 {
+		ref.ID = id
+		ref.URL = fmt.Sprintf("%s?id=%d", crtshBaseURL, id)
+	}
+	return nil
+}
+
+func (c *crtshEnricher) resolve(ctx context.Context, fingerprint string) (int64, error) {
+	u := crtshBaseURL + "?" + url.Values{"q": {fingerprint}, "output": {"json"}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query crt.sh: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("failed to query crt.sh: %s", resp.Status)
+	}
+	data, err := readLimited(resp.Body, 1<<20)
+	if err != nil {
+		return 0, err
+	}
+	var found []struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.Unmarshal(data, &found); err != nil {
+		return 0, fmt.Errorf("invalid crt.sh response: %w", err)
+	}
+	if len(found) == 0 {
+		return 0, nil
+	}
+	return found[0].ID, nil
+}
@@ -0,0 +1,28 @@
+//go:build boringcrypto
+
+package main
+
+import (
+	"crypto"
+	"crypto/boring"
+	_ "crypto/tls/fipsonly" // TLS restringido a parámetros aprobados
+)
+
+// Compilado con GOEXPERIMENT=boringcrypto
+func init() {
+	if boring.Enabled() {
+		cryptoProvider = boringCrypto{}
+	}
+}
+
+type boringCrypto struct{ stdCrypto }
+
+func (boringCrypto) Name() string { return "boringcrypto" }
+func (boringCrypto) FIPS() bool   { return true }
+
+func (c boringCrypto) Verify(pub crypto.PublicKey, data, sig []byte) error {
+	if err := checkFIPSKey(pub); err != nil {
+		return err
+	}
+	return c.stdCrypto.Verify(pub, data, sig)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* Directorio de datos de la instancia */
+
+// Ficheros dentro del directorio de datos. Los almacenes se colocan aquí con
+// la forma corta del flag (-state-store bolt, -checkpoint-store json|bolt,
+// -match-store sqlite, -spill-queue bolt, -archive bolt|segments); con
+// una ruta explícita siguen donde se indique.
+const (
+	dataDirLock        = "gctwatch.lock"
+	dataStateFile      = "state.db"
+	dataCheckpointJSON = "checkpoints.json"
+	dataCheckpointBolt = "checkpoints.db"
+	dataMatchesFile    = "matches.db"
+	dataSpillFile      = "spill.db"
+	dataArchiveFile    = "archive.db"
+	dataArchiveDir     = "archive"           // -archive segments
+	dataRulesCache     = "rules/remote.json" // última respuesta válida de -rules-url
+)
+
+// $XDG_STATE_HOME/gCTWatch, o ~/.local/state/gCTWatch; fuera de unix, junto
+// a la caché del usuario
+func defaultDataDir() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "gCTWatch")
+	}
+	if runtime.GOOS != "windows" && runtime.GOOS != "darwin" {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, ".local", "state", "gCTWatch")
+		}
+	}
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "gCTWatch", "data")
+	}
+	return "gctwatch-data"
+}
+
+// Formas cortas de cada almacén: tipo → fichero
+var (
+	stateStoreFiles      = map[string]string{"bolt": dataStateFile}
+	checkpointStoreFiles = map[string]string{"json": dataCheckpointJSON, "bolt": dataCheckpointBolt}
+	matchStoreFiles      = map[string]string{"sqlite": dataMatchesFile}
+	spillQueueFiles      = map[string]string{"bolt": dataSpillFile}
+	archiveFiles         = map[string]string{"bolt": dataArchiveFile, "segments": dataArchiveDir}
+)
+
+// Expande la forma corta de un almacén a su fichero del directorio de datos
+func dataDirSpec(spec, dir string, shorthands map[string]string) (string, bool) {
+	file, ok := shorthands[spec]
+	if !ok || dir == "" {
+		return spec, false
+	}
+	return spec + ":" + filepath.Join(dir, file), true
+}
+
+// Directorio de datos en uso, bloqueado para esta instancia
+type DataDir struct {
+	Path string
+	lock *os.File
+}
+
+// Crea el directorio y toma el lock. Si otra instancia lo tiene, falla en
+// lugar de esperar: dos procesos escribiendo el mismo estado lo corrompen.
+func OpenDataDir(path string) (*DataDir, error) {
+	if err := os.MkdirAll(path, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+	name := filepath.Join(path, dataDirLock)
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open data directory lock: %w", err)
+	}
+	if err := lockFile(f); err != nil {
+		owner, _ := os.ReadFile(name)
+		f.Close()
+		if errors.Is(err, errLocked) {
+			return nil, fmt.Errorf("data directory %s is in use by another instance (%s)", path, strings.TrimSpace(string(owner)))
+		}
+		return nil, fmt.Errorf("failed to lock data directory: %w", err)
+	}
+	// Quién lo tiene, para el mensaje de la otra instancia
+	host, _ := os.Hostname()
+	f.Truncate(0)
+	f.WriteAt([]byte("pid "+strconv.Itoa(os.Getpid())+" on "+host+" since "+time.Now().Format(time.RFC3339)+"\n"), 0)
+	return &DataDir{Path: path, lock: f}, nil
+}
+
+func (d *DataDir) File(name string) string { return filepath.Join(d.Path, name) }
+
+// Suelta el lock (también se suelta si el proceso muere)
+func (d *DataDir) Close() error {
+	return d.lock.Close()
+}
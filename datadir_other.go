@@ -0,0 +1,13 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+var errLocked = errors.New("locked")
+
+// Sin flock: el fichero solo indica quién usa el directorio
+func lockFile(f *os.File) error { return nil }
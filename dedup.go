@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+/* Deduplicación y supresión de coincidencias */
+
+// Antes de enrutar un evento se descartan:
+//   - duplicados: el mismo certificado (huella) con el mismo tag, que suele
+//     aparecer en varios logs, dentro de Window;
+//   - repeticiones: el mismo tag y dominio registrado dentro de SuppressWindow.
+//
+// Con el almacén compartido (Redis) la supresión es común a todas las instancias.
+type Dedup struct {
+	Store          StateStore
+	Window         time.Duration // 0 desactiva
+	SuppressWindow time.Duration // 0 desactiva
+	Health         *Health
+}
+
+// Indica si el evento debe entregarse. Ante errores del almacén se entrega
+// (mejor un duplicado que perder una alerta).
+func (d *Dedup) Allow(ctx context.Context, ev MatchEvent) bool {
+	if d == nil || d.Store == nil {
+		return true
+	}
+	now := []byte(time.Now().UTC().Format(time.RFC3339))
+	check := func(reason, key string, ttl time.Duration) bool {
+		if ttl <= 0 {
+			return true
+		}
+		created, err := d.Store.SetNX(ctx, key, now, ttl)
+		if d.Health.Set("state-store", false, err) && err != nil {
+			log.Printf("WARNING: state store %s: %v", d.Store.Name(), err)
+		}
+		if err != nil || created {
+			return true
+		}
+		metricEventsSuppressed.WithLabelValues(reason).Inc()
+		return false
+	}
+	if fp := ev.Certificate.FingerprintSHA256; fp != "" && !check("duplicate", "dedup:"+ev.Tag+":"+fp, d.Window) {
+		return false
+	}
+	return check("suppressed", "suppress:"+ev.Tag+":"+eventDomain(ev), d.SuppressWindow)
+}
+
+// Como Allow, pero sin registrar el evento: devuelve el motivo por el que se
+// descartaría (duplicate o suppressed) y la clave, o "" si se entregaría
+func (d *Dedup) Check(ctx context.Context, ev MatchEvent) (reason, key string, err error) {
+	if d == nil || d.Store == nil {
+		return "", "", nil
+	}
+	keys := []struct {
+		reason, key string
+		ttl         time.Duration
+	}{
+		{"duplicate", "dedup:" + ev.Tag + ":" + ev.Certificate.FingerprintSHA256, d.Window},
+		{"suppressed", "suppress:" + ev.Tag + ":" + eventDomain(ev), d.SuppressWindow},
+	}
+	for _, k := range keys {
+		if k.ttl <= 0 {
+			continue
+		}
+		_, found, err := d.Store.Get(ctx, k.key)
+		if err != nil || found {
+			return k.reason, k.key, err
+		}
+	}
+	return "", "", nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* Conexiones salientes */
+
+// Preferencia de familia de direcciones
+const (
+	FamilyAuto = "auto"
+	FamilyIPv4 = "ipv4"
+	FamilyIPv6 = "ipv6"
+)
+
+// Configuración de marcado: familia global, por host y Happy Eyeballs (RFC 8305)
+type NetDialer struct {
+	Family        string
+	PerHost       map[string]string // host -> familia
+	FallbackDelay time.Duration     // espera antes de probar la otra familia; <0 desactiva
+	Timeout       time.Duration
+	Resolver      *net.Resolver // nil = resolver del sistema
+}
+
+func NewNetDialer(family string, perHost string, fallback time.Duration) (*NetDialer, error) {
+	d := &NetDialer{Family: FamilyAuto, PerHost: make(map[string]string), FallbackDelay: fallback, Timeout: 30 * time.Second}
+	if family != "" {
+		if err := checkFamily(family); err != nil {
+			return nil, err
+		}
+		d.Family = family
+	}
+	for _, kv := range strings.Split(perHost, ",") {
+		if strings.TrimSpace(kv) == "" {
+			continue
+		}
+		host, fam, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid per-host family %q, expected host=family", kv)
+		}
+		if err := checkFamily(fam); err != nil {
+			return nil, err
+		}
+		d.PerHost[strings.ToLower(strings.TrimSpace(host))] = fam
+	}
+	return d, nil
+}
+
+func checkFamily(f string) error {
+	switch f {
+	case FamilyAuto, FamilyIPv4, FamilyIPv6:
+		return nil
+	}
+	return fmt.Errorf("unknown address family %q (auto, ipv4, ipv6)", f)
+}
+
+// Familia aplicable a un host
+func (d *NetDialer) familyFor(host string) string {
+	if f, ok := d.PerHost[strings.ToLower(host)]; ok {
+		return f
+	}
+	return d.Family
+}
+
+func (d *NetDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	family := d.familyFor(host)
+	if strings.HasPrefix(network, "tcp") || strings.HasPrefix(network, "udp") {
+		base := network[:3]
+		switch family {
+		case FamilyIPv4:
+			network = base + "4"
+		case FamilyIPv6:
+			network = base + "6"
+		}
+	}
+	nd := net.Dialer{Timeout: d.Timeout, FallbackDelay: d.FallbackDelay, KeepAlive: 30 * time.Second, Resolver: d.Resolver}
+	conn, err := nd.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, classifyDialError(host, family, err)
+	}
+	return conn, nil
+}
+
+// Distingue fallos de DNS de fallos de conectividad
+func classifyDialError(host, family string, err error) error {
+	var dnsErr *net.DNSError
+	var addrErr *net.AddrError
+	switch {
+	case errors.As(err, &dnsErr):
+		return fmt.Errorf("DNS resolution failed for %s: %w", host, err)
+	case errors.As(err, &addrErr):
+		return fmt.Errorf("no %s address for %s: %w", family, host, err)
+	}
+	return fmt.Errorf("connection to %s (%s) failed: %w", host, family, err)
+}
+
+// Red saliente: política de egress sobre el dialer configurado
+type Network struct {
+	Policy *EgressPolicy
+	Dialer *NetDialer
+	Retry  RetryPolicy
+	Events *EventBus // circuit_open / circuit_closed
+
+	sharedOnce sync.Once
+	shared     *http.Client
+}
+
+// Dial para conexiones que no son HTTP (sinks TCP/UDP, etc.)
+func (n *Network) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if err := n.Policy.Check(host); err != nil {
+		return nil, err
+	}
+	return n.Dialer.DialContext(ctx, network, addr)
+}
+
+// Resolución de nombres (logs y enriquecimiento) con el resolver configurado
+func (n *Network) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r := n.Dialer.Resolver
+	if r == nil {
+		r = net.DefaultResolver
+	}
+	return r.LookupHost(ctx, host)
+}
+
+// Activa DNS sobre HTTPS. El servidor DoH se contacta con la política de egress
+// pero resolviendo su nombre con el resolver del sistema.
+func (n *Network) UseDoH(endpoint string) error {
+	if err := n.Policy.CheckURL(endpoint); err != nil {
+		return err
+	}
+	bootstrap := &Network{Policy: n.Policy, Dialer: &NetDialer{Family: n.Dialer.Family, PerHost: n.Dialer.PerHost, FallbackDelay: n.Dialer.FallbackDelay, Timeout: n.Dialer.Timeout}}
+	client := bootstrap.HTTPClient()
+	client.Timeout = 10 * time.Second
+	n.Dialer.Resolver = NewDoHResolver(endpoint, client)
+	return nil
+}
+
+// Cliente compartido por todas las integraciones salientes (lista de logs,
+// sinks HTTP, enriquecimiento): reintentos, backoff y circuit breaker por host
+func (n *Network) Client() *http.Client {
+	n.sharedOnce.Do(func() {
+		base := n.HTTPClient()
+		policy := n.Retry
+		if policy.BaseDelay == 0 {
+			policy = DefaultRetryPolicy
+		}
+		n.shared = &http.Client{Transport: newRetryTransport(base.Transport, policy, n.Events), Timeout: 2 * time.Minute}
+	})
+	return n.shared
+}
+
+// Cliente HTTP sujeto a la política, sin reintentos (los clientes de logs
+// ya hacen su propio backoff)
+func (n *Network) HTTPClient() *http.Client {
+	return n.TLSClient(nil)
+}
+
+// Como HTTPClient, con otra configuración TLS (CA o certificado de cliente
+// propios); nil = la por defecto
+func (n *Network) TLSClient(cfg *tls.Config) *http.Client {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.DialContext = n.DialContext
+	if cfg != nil {
+		base.TLSClientConfig = cfg
+	}
+	return &http.Client{Transport: &policyTransport{base: base, policy: n.Policy}}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+/* Entrega a sinks: concurrencia y orden por sink */
+
+// Opciones de entrega de un sink
+type SinkOptions struct {
+	Concurrency int  // workers de entrega
+	Ordered     bool // conserva el orden por dominio registrado (particionado por hash)
+	QueueSize   int  // eventos en cola por worker antes de descartar
+}
+
+var defaultSinkOptions = SinkOptions{Concurrency: 1, QueueSize: 1000}
+
+// Tipo de sink a partir de su nombre ("file:/tmp/x" -> "file")
+func sinkKind(name string) string {
+	kind, _, _ := strings.Cut(name, ":")
+	return kind
+}
+
+// Opciones por tipo de sink a partir de los flags
+func parseSinkOptions(concurrency, ordered string) (map[string]SinkOptions, error) {
+	out := make(map[string]SinkOptions)
+	get := func(kind string) SinkOptions {
+		if o, ok := out[kind]; ok {
+			return o
+		}
+		return defaultSinkOptions
+	}
+	for kind, v := range parseKeyValues(concurrency) {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid concurrency %q for sink %s", v, kind)
+		}
+		o := get(kind)
+		o.Concurrency = n
+		out[kind] = o
+	}
+	for _, kind := range strings.Split(ordered, ",") {
+		if kind = strings.TrimSpace(kind); kind != "" {
+			o := get(kind)
+			o.Ordered = true
+			out[kind] = o
+		}
+	}
+	return out, nil
+}
+
+// Dominio registrado del evento (clave de ordenación)
+func eventDomain(ev MatchEvent) string {
+	name := ev.Certificate.Subject
+	if len(ev.Certificate.DNSNames) > 0 {
+		name = ev.Certificate.DNSNames[0]
+	}
+	name = strings.TrimPrefix(strings.ToLower(name), "*.")
+	if d, err := publicsuffix.EffectiveTLDPlusOne(name); err == nil {
+		return d
+	}
+	return name
+}
+
+// Cola y workers de un sink. Sin orden, todos los workers comparten cola;
+// con orden, cada dominio va siempre a la misma cola.
+type sinkDispatcher struct {
+	sink   Sink
+	opts   SinkOptions
+	queues []chan MatchEvent
+	wg     sync.WaitGroup
+
+	health   *Health
+	critical bool
+
+	delivered, failed, dropped atomic.Int64
+}
+
+// Entregas de un sink desde el arranque
+type SinkStatsReport struct {
+	Name      string `json:"name"`
+	Delivered int64  `json:"delivered"`
+	Failed    int64  `json:"failed"`
+	Dropped   int64  `json:"dropped"` // cola llena
+}
+
+func (d *sinkDispatcher) Stats() SinkStatsReport {
+	return SinkStatsReport{Name: d.sink.Name(), Delivered: d.delivered.Load(), Failed: d.failed.Load(), Dropped: d.dropped.Load()}
+}
+
+func newSinkDispatcher(ctx context.Context, sink Sink, opts SinkOptions) *sinkDispatcher {
+	if opts.Concurrency < 1 {
+		opts.Concurrency = 1
+	}
+	if opts.QueueSize < 1 {
+		opts.QueueSize = defaultSinkOptions.QueueSize
+	}
+	d := &sinkDispatcher{sink: sink, opts: opts}
+	nq := 1
+	if opts.Ordered {
+		nq = opts.Concurrency
+	}
+	for i := 0; i < nq; i++ {
+		d.queues = append(d.queues, make(chan MatchEvent, opts.QueueSize))
+	}
+	for i := 0; i < opts.Concurrency; i++ {
+		q := d.queues[i%nq]
+		d.wg.Add(1)
+		go d.deliver(ctx, q)
+	}
+	return d
+}
+
+func (d *sinkDispatcher) deliver(ctx context.Context, q chan MatchEvent) {
+	defer d.wg.Done()
+	for ev := range q {
+		err := d.sink.Write(ctx, ev)
+		if err != nil {
+			d.failed.Add(1)
+			log.Printf("WARNING: sink %s: %v", d.sink.Name(), err)
+		} else {
+			d.delivered.Add(1)
+		}
+		if d.health != nil {
+			d.health.Set("sink:"+d.sink.Name(), d.critical, err)
+		}
+	}
+}
+
+// Encola sin bloquear: un sink lento no frena el resto del pipeline
+func (d *sinkDispatcher) Submit(ev MatchEvent) {
+	q := d.queues[0]
+	if len(d.queues) > 1 {
+		h := fnv.New32a()
+		h.Write([]byte(eventDomain(ev)))
+		q = d.queues[h.Sum32()%uint32(len(d.queues))]
+	}
+	select {
+	case q <- ev:
+	default:
+		d.dropped.Add(1)
+		log.Printf("WARNING: sink %s queue full, dropping event", d.sink.Name())
+	}
+}
+
+// Vacía las colas y cierra el sink
+func (d *sinkDispatcher) Close() error {
+	for _, q := range d.queues {
+		close(q)
+	}
+	d.wg.Wait()
+	return d.sink.Close()
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+/* DNS sobre HTTPS (RFC 8484) */
+
+// Resolver que envía las consultas a un servidor DoH en lugar del resolver local.
+// El host del propio servidor DoH se resuelve con el resolver del sistema (o usar una IP en la URL).
+func NewDoHResolver(endpoint string, client *http.Client) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return &dohConn{ctx: ctx, endpoint: endpoint, client: client}, nil
+		},
+	}
+}
+
+// Conexión "stream" ficticia: el resolver de Go escribe la consulta con prefijo de
+// longitud de 2 bytes (framing TCP) y lee la respuesta con el mismo formato.
+type dohConn struct {
+	ctx      context.Context
+	endpoint string
+	client   *http.Client
+	mu       sync.Mutex
+	query    bytes.Buffer
+	reply    bytes.Buffer
+	deadline time.Time
+}
+
+func (c *dohConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.query.Write(b)
+	q := c.query.Bytes()
+	if len(q) < 2 {
+		return len(b), nil
+	}
+	n := int(binary.BigEndian.Uint16(q))
+	if len(q) < 2+n {
+		return len(b), nil
+	}
+	msg := q[2 : 2+n]
+	resp, err := c.exchange(msg)
+	if err != nil {
+		return 0, err
+	}
+	c.query.Reset()
+	c.reply.Write([]byte{byte(len(resp) >> 8), byte(len(resp))})
+	c.reply.Write(resp)
+	return len(b), nil
+}
+
+func (c *dohConn) exchange(msg []byte) ([]byte, error) {
+	ctx := c.ctx
+	if !c.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, c.deadline)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(msg))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("DoH query to %s failed: %w", c.endpoint, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH query to %s failed: HTTP %d", c.endpoint, resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 65535))
+	if err != nil {
+		return nil, fmt.Errorf("DoH query to %s failed: %w", c.endpoint, err)
+	}
+	return body, nil
+}
+
+func (c *dohConn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.reply.Len() == 0 {
+		return 0, errors.New("DoH: no pending reply")
+	}
+	return c.reply.Read(b)
+}
+
+func (c *dohConn) Close() error                       { return nil }
+func (c *dohConn) LocalAddr() net.Addr                { return dohAddr{} }
+func (c *dohConn) RemoteAddr() net.Addr               { return dohAddr{} }
+func (c *dohConn) SetDeadline(t time.Time) error      { c.deadline = t; return nil }
+func (c *dohConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *dohConn) SetWriteDeadline(t time.Time) error { c.deadline = t; return nil }
+
+type dohAddr struct{}
+
+func (dohAddr) Network() string { return "doh" }
+func (dohAddr) String() string  { return "doh" }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Prefijo de longitud de 2 bytes como el del framing TCP
+func dohFrame(msg []byte) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(len(msg))), msg...)
+}
+
+func TestDoHConnFraming(t *testing.T) {
+	var got [][]byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/dns-message" {
+			t.Errorf("Content-Type = %q", r.Header.Get("Content-Type"))
+		}
+		msg, _ := io.ReadAll(r.Body)
+		got = append(got, msg)
+		w.Write(append([]byte("reply:"), msg...))
+	}))
+	defer srv.Close()
+
+	// Longitudes con los bits bajos de cada byte puestos y por encima de 255
+	for _, n := range []int{1, 2, 3, 12, 35, 37, 255, 256, 257, 259, 515, 1023} {
+		msg := bytes.Repeat([]byte{byte(n)}, n)
+		for _, split := range []int{1, 2, 3, n + 1} { // escrituras parciales
+			got = nil
+			c := &dohConn{ctx: context.Background(), endpoint: srv.URL, client: srv.Client()}
+			frame := dohFrame(msg)
+			split = min(split, len(frame))
+			for _, part := range [][]byte{frame[:split], frame[split:]} {
+				if len(part) == 0 {
+					continue
+				}
+				if w, err := c.Write(part); err != nil || w != len(part) {
+					t.Fatalf("length %d, split %d: Write = %d, %v", n, split, w, err)
+				}
+			}
+			if len(got) != 1 || !bytes.Equal(got[0], msg) {
+				t.Fatalf("length %d, split %d: server got %q; want one query of %d bytes", n, split, got, n)
+			}
+			// Read falla al vaciarse la respuesta, así que ReadAll devuelve error
+			reply, _ := io.ReadAll(c)
+			if want := dohFrame(append([]byte("reply:"), msg...)); !bytes.Equal(reply, want) {
+				t.Fatalf("length %d, split %d: reply %d bytes; want %d", n, split, len(reply), len(want))
+			}
+		}
+	}
+}
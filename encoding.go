@@ -0,0 +1,464 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+/* Codificación de eventos para sinks de colas */
+
+// Codifica un MatchEvent en el formato de un sink
+type Encoder interface {
+	Name() string
+	ContentType() string
+	Schema() (schemaType string, schema string) // para el registro de esquemas
+	Encode(ev MatchEvent) ([]byte, error)
+}
+
+func NewEncoder(format string) (Encoder, error) {
+	switch format {
+	case "", "json":
+		return jsonEncoder{}, nil
+	case "protobuf":
+		return protoEncoder{}, nil
+	case "avro":
+		return newAvroEncoder(), nil
+	}
+	return nil, fmt.Errorf("unknown encoding %q (json, protobuf, avro)", format)
+}
+
+// JSON
+type jsonEncoder struct{}
+
+func (jsonEncoder) Name() string        { return "json" }
+func (jsonEncoder) ContentType() string { return "application/json" }
+func (jsonEncoder) Schema() (string, string) {
+	s, _ := MatchEventSchema()
+	return "JSON", string(s)
+}
+func (jsonEncoder) Encode(ev MatchEvent) ([]byte, error) { return json.Marshal(ev) }
+
+// Protobuf, según schema/match_event.proto
+type protoEncoder struct{}
+
+//go:embed schema/match_event.proto
+var matchEventProto string
+
+func (protoEncoder) Name() string             { return "protobuf" }
+func (protoEncoder) ContentType() string      { return "application/x-protobuf" }
+func (protoEncoder) Schema() (string, string) { return "PROTOBUF", matchEventProto }
+
+func (protoEncoder) Encode(ev MatchEvent) ([]byte, error) {
+	var b []byte
+	b = pbInt(b, 1, int64(ev.SchemaVersion))
+	b = pbTime(b, 2, ev.Timestamp)
+	b = pbString(b, 3, ev.Tag)
+	var lr []byte
+	lr = pbString(lr, 1, ev.Log.URL)
+	lr = pbStrings(lr, 2, ev.Log.Lists)
+	if ev.Log.URL != "" || len(ev.Log.Lists) > 0 {
+		b = pbMessage(b, 4, lr)
+	}
+	b = pbInt(b, 5, ev.Index)
+	c := ev.Certificate
+	var cb []byte
+	cb = pbString(cb, 1, c.FingerprintSHA256)
+	cb = pbString(cb, 2, c.Signature)
+	cb = pbString(cb, 3, c.SignatureAlgorithm)
+	cb = pbString(cb, 4, c.PublicKeyAlgorithm)
+	cb = pbString(cb, 5, c.PublicKey)
+	cb = pbInt(cb, 6, int64(c.Version))
+	cb = pbString(cb, 7, c.SerialNumber)
+	cb = pbString(cb, 8, c.Issuer)
+	cb = pbString(cb, 9, c.Subject)
+	cb = pbTime(cb, 10, c.NotBefore)
+	cb = pbTime(cb, 11, c.NotAfter)
+	cb = pbStrings(cb, 12, c.KeyUsage)
+	cb = pbStrings(cb, 13, c.ExtKeyUsage)
+	cb = pbBool(cb, 14, c.IsCA)
+	cb = pbInt(cb, 15, int64(c.MaxPathLen))
+	cb = pbBool(cb, 16, c.MaxPathLenZero)
+	cb = pbBool(cb, 17, c.BasicConstraintsValid)
+	cb = pbString(cb, 18, c.SubjectKeyId)
+	cb = pbString(cb, 19, c.AuthorityKeyId)
+	cb = pbStrings(cb, 20, c.DNSNames)
+	cb = pbStrings(cb, 21, c.EmailAddresses)
+	cb = pbStrings(cb, 22, c.IPAddresses)
+	cb = pbStrings(cb, 23, c.URIs)
+	cb = pbStrings(cb, 24, c.OCSPServer)
+	cb = pbStrings(cb, 25, c.IssuingCertificateURL)
+	cb = pbStrings(cb, 26, c.UnhandledCriticalExtensions)
+	cb = pbStrings(cb, 27, c.PolicyIdentifiers)
+	if len(cb) > 0 {
+		b = pbMessage(b, 6, cb)
+	}
+	b = pbString(b, 7, ev.Kind)
+	if hb := ev.Heartbeat; hb != nil {
+		var hbb []byte
+		hbb = pbString(hbb, 1, hb.Instance)
+		hbb = pbTime(hbb, 2, hb.StartedAt)
+		hbb = pbInt(hbb, 3, hb.UptimeSeconds)
+		hbb = pbString(hbb, 4, hb.Status)
+		hbb = pbInt(hbb, 5, int64(hb.Sources))
+		hbb = pbInt(hbb, 6, hb.EntriesProcessed)
+		hbb = pbInt(hbb, 7, hb.Matches)
+		hbb = pbTime(hbb, 8, hb.LastEntryAt)
+		b = pbMessage(b, 8, hbb)
+	}
+	if en := ev.Enrichment; en != nil {
+		var enb []byte
+		if r := en.Revocation; r != nil {
+			var rb []byte
+			rb = pbString(rb, 1, r.Status)
+			rb = pbString(rb, 2, r.Method)
+			rb = pbTime(rb, 3, r.RevokedAt)
+			rb = pbString(rb, 4, r.Reason)
+			rb = pbTime(rb, 5, r.CheckedAt)
+			rb = pbString(rb, 6, r.Error)
+			enb = pbMessage(enb, 1, rb)
+		}
+		if c := en.CrtSh; c != nil {
+			var cb []byte
+			cb = pbString(cb, 1, c.URL)
+			cb = pbInt(cb, 2, c.ID)
+			enb = pbMessage(enb, 2, cb)
+		}
+		if z := en.Zone; z != nil {
+			var zb []byte
+			zb = pbString(zb, 1, z.Status)
+			zb = pbString(zb, 2, z.Zone)
+			zb = pbInt(zb, 3, int64(z.Serial))
+			enb = pbMessage(enb, 3, zb)
+		}
+		if sb := en.SafeBrowsing; sb != nil {
+			var sbb []byte
+			sbb = pbString(sbb, 1, sb.Status)
+			for _, t := range sb.Threats {
+				sbb = pbString(sbb, 2, t)
+			}
+			sbb = pbString(sbb, 3, sb.Service)
+			sbb = pbTime(sbb, 4, sb.CheckedAt)
+			enb = pbMessage(enb, 4, sbb)
+		}
+		if vt := en.VirusTotal; vt != nil {
+			var vb []byte
+			vb = pbString(vb, 1, vt.Status)
+			vb = pbInt(vb, 2, int64(vt.Malicious))
+			vb = pbInt(vb, 3, int64(vt.Suspicious))
+			vb = pbInt(vb, 4, int64(vt.Harmless))
+			vb = pbInt(vb, 5, int64(vt.Undetected))
+			vb = pbInt(vb, 6, int64(vt.Reputation))
+			vb = pbStrings(vb, 7, vt.Categories)
+			vb = pbTime(vb, 8, vt.LastAnalysis)
+			vb = pbTime(vb, 9, vt.CheckedAt)
+			enb = pbMessage(enb, 5, vb)
+		}
+		if is := en.Issuance; is != nil {
+			var ib []byte
+			ib = pbString(ib, 1, is.Status)
+			ib = pbStrings(ib, 2, is.Expected)
+			ib = pbString(ib, 3, is.Account)
+			enb = pbMessage(enb, 6, ib)
+		}
+		if sc := en.Score; sc != nil {
+			var sb []byte
+			sb = pbDouble(sb, 1, sc.Value)
+			sb = pbString(sb, 2, sc.Label)
+			sb = pbString(sb, 3, sc.Backend)
+			sb = pbString(sb, 4, sc.Model)
+			enb = pbMessage(enb, 7, sb)
+		}
+		for _, k := range slices.Sorted(maps.Keys(en.Script)) {
+			var kb []byte
+			kb = pbString(kb, 1, k)
+			kb = pbString(kb, 2, en.Script[k])
+			enb = pbMessage(enb, 8, kb)
+		}
+		b = pbMessage(b, 9, enb)
+	}
+	b = pbDouble(b, 10, ev.SampleRate)
+	if op := ev.Ops; op != nil {
+		var ob []byte
+		ob = pbString(ob, 1, op.Type)
+		ob = pbString(ob, 2, op.Severity)
+		ob = pbString(ob, 3, op.Source)
+		ob = pbString(ob, 4, op.Message)
+		b = pbMessage(b, 11, ob)
+	}
+	b = pbString(b, 12, ev.MatchedName)
+	b = pbBool(b, 13, ev.Canary)
+	if ri := ev.Rule; ri != nil {
+		var rb []byte
+		rb = pbString(rb, 1, ri.Severity)
+		rb = pbString(rb, 2, ri.Description)
+		rb = pbStrings(rb, 3, ri.References)
+		b = pbMessage(b, 14, rb)
+	}
+	b = pbStrings(b, 15, ev.Tags)
+	if ts := ev.Typosquat; ts != nil {
+		var tb []byte
+		tb = pbString(tb, 1, ts.Target)
+		tb = pbInt(tb, 2, int64(ts.Distance))
+		tb = pbString(tb, 3, ts.Technique)
+		b = pbMessage(b, 16, tb)
+	}
+	return b, nil
+}
+
+// proto3: los valores por defecto no se emiten
+func pbString(b []byte, n protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, n, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func pbStrings(b []byte, n protowire.Number, vs []string) []byte {
+	for _, v := range vs {
+		b = protowire.AppendTag(b, n, protowire.BytesType)
+		b = protowire.AppendString(b, v)
+	}
+	return b
+}
+
+func pbInt(b []byte, n protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, n, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+func pbBool(b []byte, n protowire.Number, v bool) []byte {
+	if !v {
+		return b
+	}
+	b = protowire.AppendTag(b, n, protowire.VarintType)
+	return protowire.AppendVarint(b, 1)
+}
+
+func pbDouble(b []byte, n protowire.Number, v float64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, n, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, math.Float64bits(v))
+}
+
+func pbMessage(b []byte, n protowire.Number, m []byte) []byte {
+	b = protowire.AppendTag(b, n, protowire.BytesType)
+	return protowire.AppendBytes(b, m)
+}
+
+// google.protobuf.Timestamp
+func pbTime(b []byte, n protowire.Number, t time.Time) []byte {
+	if t.IsZero() {
+		return b
+	}
+	var m []byte
+	m = pbInt(m, 1, t.Unix())
+	m = pbInt(m, 2, int64(t.Nanosecond()))
+	return pbMessage(b, n, m)
+}
+
+// Avro binario; el esquema se genera de los tipos igual que el JSON Schema
+type avroEncoder struct{ schema string }
+
+func newAvroEncoder() avroEncoder {
+	s, _ := json.Marshal(avroSchemaFor(reflect.TypeOf(MatchEvent{}), map[string]bool{}))
+	return avroEncoder{schema: string(s)}
+}
+
+func (avroEncoder) Name() string               { return "avro" }
+func (avroEncoder) ContentType() string        { return "avro/binary" }
+func (e avroEncoder) Schema() (string, string) { return "AVRO", e.schema }
+
+func (avroEncoder) Encode(ev MatchEvent) ([]byte, error) {
+	var buf bytes.Buffer
+	avroWrite(&buf, reflect.ValueOf(ev))
+	return buf.Bytes(), nil
+}
+
+func avroSchemaFor(t reflect.Type, named map[string]bool) any {
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "long", "logicalType": "timestamp-micros"}
+	case t.Kind() == reflect.Pointer:
+		return []any{"null", avroSchemaFor(t.Elem(), named)}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return "long"
+	case reflect.Float32, reflect.Float64:
+		return "double"
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": avroSchemaFor(t.Elem(), named)}
+	case reflect.Map:
+		return map[string]any{"type": "map", "values": avroSchemaFor(t.Elem(), named)}
+	case reflect.Struct:
+		if named[t.Name()] {
+			return t.Name()
+		}
+		named[t.Name()] = true
+		var fields []any
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if !f.IsExported() || name == "-" {
+				continue
+			}
+			fields = append(fields, map[string]any{"name": name, "type": avroSchemaFor(f.Type, named)})
+		}
+		return map[string]any{"type": "record", "name": t.Name(), "namespace": "gctwatch.v1", "fields": fields}
+	}
+	panic(fmt.Sprintf("avroSchemaFor: unsupported type %s", t))
+}
+
+func avroLong(w *bytes.Buffer, v int64) {
+	w.Write(binary.AppendUvarint(nil, uint64((v<<1)^(v>>63))))
+}
+
+func avroWrite(w *bytes.Buffer, v reflect.Value) {
+	if v.Type() == timeType {
+		avroLong(w, v.Interface().(time.Time).UnixMicro())
+		return
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			avroLong(w, 0)
+			return
+		}
+		avroLong(w, 1)
+		avroWrite(w, v.Elem())
+	case reflect.String:
+		avroLong(w, int64(v.Len()))
+		w.WriteString(v.String())
+	case reflect.Bool:
+		if v.Bool() {
+			w.WriteByte(1)
+		} else {
+			w.WriteByte(0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		avroLong(w, v.Int())
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		avroLong(w, int64(v.Uint()))
+	case reflect.Float32, reflect.Float64:
+		w.Write(binary.LittleEndian.AppendUint64(nil, math.Float64bits(v.Float())))
+	case reflect.Slice, reflect.Array:
+		if v.Len() > 0 {
+			avroLong(w, int64(v.Len()))
+			for i := 0; i < v.Len(); i++ {
+				avroWrite(w, v.Index(i))
+			}
+		}
+		avroLong(w, 0)
+	case reflect.Map:
+		if v.Len() > 0 {
+			avroLong(w, int64(v.Len()))
+			iter := v.MapRange()
+			for iter.Next() {
+				avroWrite(w, iter.Key())
+				avroWrite(w, iter.Value())
+			}
+		}
+		avroLong(w, 0)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if !f.IsExported() || name == "-" {
+				continue
+			}
+			avroWrite(w, v.Field(i))
+		}
+	}
+}
+
+// Registro de esquemas (API de Confluent Schema Registry)
+type SchemaRegistry struct {
+	URL     string
+	Subject string
+	Client  *http.Client
+}
+
+// Registra el esquema del encoder y devuelve uno que antepone el
+// framing de Confluent (byte mágico + id de esquema) a cada mensaje.
+func (r *SchemaRegistry) Wrap(ctx context.Context, enc Encoder) (Encoder, error) {
+	schemaType, schema := enc.Schema()
+	body, _ := json.Marshal(map[string]string{"schema": schema, "schemaType": schemaType})
+	u := strings.TrimSuffix(r.URL, "/") + "/subjects/" + url.PathEscape(r.Subject) + "/versions"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register schema for %s: %w", r.Subject, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to register schema for %s: HTTP %d: %s", r.Subject, resp.StatusCode, data)
+	}
+	var out struct {
+		ID uint32 `json:"id"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("failed to register schema for %s: %w", r.Subject, err)
+	}
+	return &registryEncoder{Encoder: enc, id: out.ID}, nil
+}
+
+// Encoder de un sink de colas: el formato de -queue-encoding y, con
+// -schema-registry-url, el esquema registrado bajo subject
+func NewQueueEncoder(ctx context.Context, format, registryURL, subject string, client *http.Client) (Encoder, error) {
+	enc, err := NewEncoder(format)
+	if err != nil || registryURL == "" {
+		return enc, err
+	}
+	r := &SchemaRegistry{URL: registryURL, Subject: subject, Client: client}
+	return r.Wrap(ctx, enc)
+}
+
+type registryEncoder struct {
+	Encoder
+	id uint32
+}
+
+func (e *registryEncoder) Encode(ev MatchEvent) ([]byte, error) {
+	payload, err := e.Encoder.Encode(ev)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, 5, 6+len(payload))
+	binary.BigEndian.PutUint32(b[1:], e.id)
+	if e.Encoder.Name() == "protobuf" {
+		b = append(b, 0) // índice de mensaje: el primero del fichero (MatchEvent)
+	}
+	return append(b, payload...), nil
+}
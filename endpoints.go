@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	CertTransp "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/client"
+	"github.com/google/certificate-transparency-go/jsonclient"
+)
+
+/* Endpoints alternativos por log (CDN, réplicas regionales) */
+
+const (
+	endpointReprobeEvery = 20               // sondeos entre re-mediciones de otros endpoints
+	endpointMinBackoff   = 30 * time.Second // primer bloqueo tras un fallo
+	endpointMaxBackoff   = 10 * time.Minute
+	endpointEWMAWeight   = 0.3
+)
+
+// URL base de un log con su latencia media y estado
+type LogEndpoint struct {
+	URL         string
+	Client      *client.LogClient
+	latency     time.Duration // media móvil exponencial
+	samples     int
+	failures    int
+	failedUntil time.Time
+	lastUsed    time.Time
+}
+
+// Anota el resultado de una petición
+func (ep *LogEndpoint) observe(source string, d time.Duration, err error) {
+	if err != nil {
+		ep.failures++
+		backoff := min(endpointMinBackoff<<min(ep.failures-1, 10), endpointMaxBackoff)
+		// Un error permanente no se va a arreglar en segundos: mejor otra réplica
+		var fe *FetchError
+		if errors.As(err, &fe) && !fe.Policy().Transient {
+			backoff = endpointMaxBackoff
+		}
+		ep.failedUntil = time.Now().Add(backoff)
+		return
+	}
+	ep.failures = 0
+	if ep.samples == 0 {
+		ep.latency = d
+	} else {
+		ep.latency = time.Duration(endpointEWMAWeight*float64(d) + (1-endpointEWMAWeight)*float64(ep.latency))
+	}
+	ep.samples++
+	metricEndpointLatency.WithLabelValues(source, ep.URL).Set(ep.latency.Seconds())
+}
+
+// Elige el endpoint sano de menor latencia. Los que no se han medido se prueban
+// primero y, cada endpointReprobeEvery sondeos, se vuelve a medir el menos usado
+// para detectar cambios de ruta.
+func (s *CTLogSource) pickEndpoint() *LogEndpoint {
+	now := time.Now()
+	s.polls++
+	var best, stalest, recovering *LogEndpoint
+	for _, ep := range s.Endpoints {
+		if now.Before(ep.failedUntil) {
+			if recovering == nil || ep.failedUntil.Before(recovering.failedUntil) {
+				recovering = ep
+			}
+			continue
+		}
+		if ep.samples == 0 {
+			best = ep
+			break
+		}
+		if best == nil || ep.latency < best.latency {
+			best = ep
+		}
+		if stalest == nil || ep.lastUsed.Before(stalest.lastUsed) {
+			stalest = ep
+		}
+	}
+	switch {
+	case best == nil:
+		// Todos fallando: el que antes salga del bloqueo
+		best = recovering
+	case best.samples > 0 && s.polls%endpointReprobeEvery == 0:
+		best = stalest
+	}
+	best.lastUsed = now
+	return best
+}
+
+// Parsea "url=alt1|alt2,url2=alt3"
+func parseLogMirrors(s string) map[string][]string {
+	out := make(map[string][]string)
+	for base, alts := range parseKeyValues(s) {
+		for _, alt := range strings.Split(alts, "|") {
+			if alt = strings.TrimSpace(alt); alt != "" {
+				out[normalizeLogURL(base)] = append(out[normalizeLogURL(base)], alt)
+			}
+		}
+	}
+	return out
+}
+
+func normalizeLogURL(u string) string {
+	return strings.TrimSuffix(strings.TrimSpace(u), "/")
+}
+
+// Crea los clientes del log (URL oficial más réplicas)
+func (mngr *CTLogsManager) newLogEndpoints(source, desc string) ([]*LogEndpoint, error) {
+	var endpoints []*LogEndpoint
+	for _, u := range append([]string{source}, mngr.LogMirrors[normalizeLogURL(source)]...) {
+		if err := mngr.network.Policy.CheckURL(u); err != nil {
+			return nil, fmt.Errorf("source %s not allowed: %w", desc, err)
+		}
+		httpClient := mngr.logHTTPClient
+		if creds := mngr.LogCredentials[normalizeLogURL(u)]; creds != nil {
+			httpClient = creds.httpClient(mngr.network, mngr.MaxResponseBytes)
+		}
+		c, err := client.New(u, mngr.Bandwidth.Client(httpClient, source), jsonclient.Options{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create client for %s: %w", desc, err)
+		}
+		endpoints = append(endpoints, &LogEndpoint{URL: u, Client: c})
+	}
+	return endpoints, nil
+}
+
+// STH inicial del primer endpoint que responda
+func initialSTH(ctx context.Context, endpoints []*LogEndpoint, source, desc string) (*CertTransp.SignedTreeHead, error) {
+	var lastErr error
+	for _, ep := range endpoints {
+		start := time.Now()
+		sth, err := ep.Client.GetSTH(ctx)
+		ep.observe(source, time.Since(start), err)
+		if err == nil {
+			return sth, nil
+		}
+		lastErr = err
+	}
+	return nil, fmt.Errorf("failed to get STH for %s: %w", desc, lastErr)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"log"
+	"time"
+)
+
+/* Enriquecimiento de coincidencias */
+
+const enrichTimeout = 10 * time.Second
+
+// Añade datos a un evento antes de enrutarlo. Solo se aplica a los tags
+// configurados, porque suele implicar peticiones externas.
+type Enricher interface {
+	Name() string
+	Enrich(ctx context.Context, ev *MatchEvent, in EnrichInput) error
+}
+
+// Certificado parseado y entrada de origen
+type EnrichInput struct {
+	Cert   *x509.Certificate
+	Issuer *x509.Certificate // nil si la cadena del log no lo trae
+	Entry  SourcedEntry
+}
+
+type enricherConfig struct {
+	Enricher
+	Tags []string // vacío o "*" = todos
+}
+
+func (e enricherConfig) appliesTo(tags []string) bool {
+	return len(e.Tags) == 0 || routeHasAnyTag(Route{Tags: e.Tags}, tags)
+}
+
+// Emisor: primer certificado de la cadena que acompaña a la entrada
+func entryIssuer(e SourcedEntry) *x509.Certificate {
+	if len(e.Entry.Chain) == 0 {
+		return nil
+	}
+	issuer, err := x509.ParseCertificate(e.Entry.Chain[0].Data)
+	if err != nil {
+		return nil
+	}
+	return issuer
+}
+
+// Aplica los enriquecedores; un fallo no impide entregar el evento
+func (mngr *CTLogsManager) enrich(ev *MatchEvent, cert *x509.Certificate, entry SourcedEntry) {
+	var in *EnrichInput
+	for _, e := range mngr.Enrichers {
+		if !e.appliesTo(ev.AllTags()) {
+			continue
+		}
+		if in == nil {
+			in = &EnrichInput{Cert: cert, Issuer: entryIssuer(entry), Entry: entry}
+		}
+		if ev.Enrichment == nil {
+			ev.Enrichment = &Enrichment{}
+		}
+		ctx, cancel := context.WithTimeout(mngr.outCtx, enrichTimeout)
+		err := e.Enrich(ctx, ev, *in)
+		cancel()
+		if mngr.Health.Set("enricher:"+e.Name(), false, err) && err != nil {
+			log.Printf("WARNING: enricher %s: %v", e.Name(), err)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"time"
+
+	CertTransp "github.com/google/certificate-transparency-go"
+)
+
+/* Eventos de salida */
+
+// Versión del esquema de MatchEvent. Subir en cambios incompatibles
+// (campos eliminados, con otro tipo o que dejan de ser obligatorios);
+// añadir campos no la cambia.
+//
+// 2: campo kind; log y certificate solo están en eventos "match".
+const MatchEventSchemaVersion = 2
+
+// Tipos de evento
+const (
+	EventKindMatch     = "match"
+	EventKindHeartbeat = "heartbeat"
+	EventKindShadow    = "shadow" // regla en evaluación; solo llega al histórico (-match-store)
+	EventKindOps       = "ops"    // evento operacional (ver ops.go)
+)
+
+// Entrada de log junto a su origen
+type SourcedEntry struct {
+	Source *CTLogSource
+	Entry  CertTransp.LogEntry
+	batch  *entryBatch // se confirma al terminar de procesarla
+}
+
+// Log de origen de una coincidencia
+type LogRef struct {
+	URL   string   `json:"url"`
+	Lists []string `json:"lists"`
+}
+
+// Certificado que coincide con alguna regla (o evento propio del watcher)
+type MatchEvent struct {
+	SchemaVersion int             `json:"schema_version"`
+	Kind          string          `json:"kind"`
+	Timestamp     time.Time       `json:"timestamp"` // momento de la detección
+	Tag           string          `json:"tag"`
+	Tags          []string        `json:"tags,omitempty"`         // todas las reglas que coincidieron, la principal (tag) primero
+	MatchedName   string          `json:"matched_name,omitempty"` // valor del certificado que coincidió con la regla (nombre, DN u organización)
+	Log           LogRef          `json:"log,omitzero"`
+	Index         int64           `json:"index"`
+	Certificate   CertificateJSON `json:"certificate,omitzero"`
+	Heartbeat     *Heartbeat      `json:"heartbeat,omitempty"`
+	Ops           *OpsEvent       `json:"ops,omitempty"`
+	Enrichment    *Enrichment     `json:"enrichment,omitempty"`
+	Rule          *RuleInfo       `json:"rule,omitempty"`        // metadatos de la regla que coincidió
+	Canary        bool            `json:"canary,omitempty"`      // regla canario: el dominio nunca debería tener certificados
+	Typosquat     *Typosquat      `json:"typosquat,omitempty"`   // regla typosquat: dominio protegido al que imita y distancia
+	SampleRate    float64         `json:"sample_rate,omitempty"` // fracción entregada si el tag se muestrea (peso = 1/sample_rate)
+}
+
+// Metadatos de una regla
+type RuleInfo struct {
+	Severity    string   `json:"severity"` // low, medium, high o critical
+	Description string   `json:"description,omitempty"`
+	References  []string `json:"references,omitempty"`
+}
+
+// Datos añadidos por los enriquecedores (ver enrich.go)
+type Enrichment struct {
+	Revocation   *Revocation       `json:"revocation,omitempty"`
+	CrtSh        *CrtSh            `json:"crtsh,omitempty"`
+	Zone         *ZoneStatus       `json:"zone,omitempty"`
+	SafeBrowsing *SafeBrowsing     `json:"safebrowsing,omitempty"`
+	VirusTotal   *VirusTotal       `json:"virustotal,omitempty"`
+	Issuance     *Issuance         `json:"issuance,omitempty"`
+	Score        *Score            `json:"score,omitempty"`
+	Script       map[string]string `json:"script,omitempty"` // campos de la función enrich de -lua-script
+}
+
+// Estado de revocación del certificado en el momento de la detección
+type Revocation struct {
+	Status    string    `json:"status"`           // good, revoked, unknown o error
+	Method    string    `json:"method,omitempty"` // ocsp o crl
+	RevokedAt time.Time `json:"revoked_at,omitzero"`
+	Reason    string    `json:"reason,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Latido periódico: permite distinguir "sin coincidencias" de "watcher parado"
+type Heartbeat struct {
+	Instance         string    `json:"instance"` // -instance-id
+	StartedAt        time.Time `json:"started_at"`
+	UptimeSeconds    int64     `json:"uptime_seconds"`
+	Status           string    `json:"status"` // estado de salud global
+	Sources          int       `json:"sources"`
+	EntriesProcessed int64     `json:"entries_processed"`
+	Matches          int64     `json:"matches"`
+	LastEntryAt      time.Time `json:"last_entry_at,omitzero"`
+}
+
+func NewMatchEvent(tag string, e SourcedEntry, cert CertificateJSON) MatchEvent {
+	return MatchEvent{
+		SchemaVersion: MatchEventSchemaVersion,
+		Kind:          EventKindMatch,
+		Timestamp:     time.Now().UTC(),
+		Tag:           tag,
+		Log:           LogRef{URL: e.Source.Source, Lists: e.Source.Lists},
+		Index:         e.Entry.Index,
+		Certificate:   cert,
+	}
+}
+
+// Tags del evento; los que no vienen de una coincidencia solo tienen Tag
+func (ev MatchEvent) AllTags() []string {
+	if len(ev.Tags) > 0 {
+		return ev.Tags
+	}
+	return []string{ev.Tag}
+}
+
+func NewHeartbeatEvent(hb Heartbeat) MatchEvent {
+	return MatchEvent{
+		SchemaVersion: MatchEventSchemaVersion,
+		Kind:          EventKindHeartbeat,
+		Timestamp:     time.Now().UTC(),
+		Tag:           EventKindHeartbeat,
+		Heartbeat:     &hb,
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	CertTransp "github.com/google/certificate-transparency-go"
+)
+
+/* gctwatch explain: traza de las decisiones para un certificado */
+
+// gctwatch [flags] explain <cert.pem|cert.der> [log]. Monta la instancia con
+// los mismos flags, pero sin los almacenes que solo sirven para leer logs
+// (checkpoints, spill, archivo e histórico), que además
+// bloquearían el directorio de datos de una instancia en marcha.
+func runExplain(f setupFlags, args []string, maintenance bool, out io.Writer) error {
+	if len(args) == 0 || len(args) > 2 {
+		return fmt.Errorf("usage: gctwatch [flags] explain <cert.pem|cert.der> [log-url]")
+	}
+	cert, err := readCertificateFile(args[0])
+	if err != nil {
+		return err
+	}
+	logURL := ""
+	if len(args) == 2 {
+		logURL = args[1]
+	}
+	f.checkpointStore, f.spillQueue, f.archive, f.matchStore = "", "", "", ""
+	f.backpressure = BackpressureDrop
+	f.offline, f.noLogLists, f.ntpServer = true, true, "" // sin lista de logs ni comprobación del reloj
+	mngr, p := setup(f)
+	if mngr == nil || p.CriticalFailed() {
+		p.Report(os.Stderr)
+		return fmt.Errorf("cannot explain with critical setup failures")
+	}
+	if p.Failed() {
+		p.Report(os.Stderr)
+	}
+	defer mngr.closeExplain()
+	if maintenance {
+		mngr.Maintenance.Set(true, "-maintenance flag")
+	}
+	mngr.Explain(cert, logURL, out)
+	return nil
+}
+
+// Certificado en PEM (el primer bloque CERTIFICATE) o DER
+func readCertificateFile(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for rest := data; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			data = block.Bytes
+			break
+		}
+	}
+	cert, err := x509.ParseCertificate(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate %s: %w", path, err)
+	}
+	return cert, nil
+}
+
+func (mngr *CTLogsManager) closeExplain() {
+	for _, s := range mngr.Sinks {
+		s.Close()
+	}
+	for _, pl := range mngr.Plugins {
+		pl.Close()
+	}
+	if mngr.CanaryAudit != nil {
+		mngr.CanaryAudit.Close()
+	}
+	if mngr.Scorer != nil {
+		mngr.Scorer.Close()
+	}
+	if mngr.Dedup != nil {
+		mngr.Dedup.Store.Close()
+	}
+	if mngr.DataDir != nil {
+		mngr.DataDir.Close()
+	}
+}
+
+// Pasa el certificado por el mismo camino que una entrada de log (reglas,
+// plugins y script, muestreo, deduplicación, enriquecimiento y enrutado)
+// sin entregarlo, y escribe lo que se decide en cada paso. Lo que descarta
+// el evento se indica, pero se sigue para ver qué pasaría si no.
+func (mngr *CTLogsManager) Explain(cert *x509.Certificate, logURL string, w io.Writer) {
+	entry := SourcedEntry{Source: &CTLogSource{Source: logURL}, Entry: CertTransp.LogEntry{Index: -1}}
+	now := time.Now()
+	names := cert.DNSNames
+	if len(names) > 5 {
+		names = append(names[:5:5], fmt.Sprintf("... (%d more)", len(cert.DNSNames)-5))
+	}
+	fmt.Fprintf(w, "Certificate: %s\n", cert.Subject)
+	fmt.Fprintf(w, "  names:   %s\n", strings.Join(names, ", "))
+	fmt.Fprintf(w, "  issuer:  %s\n", cert.Issuer)
+	fmt.Fprintf(w, "  valid:   %s to %s\n", cert.NotBefore.Format(time.DateOnly), cert.NotAfter.Format(time.DateOnly))
+	if logURL != "" {
+		fmt.Fprintf(w, "  log:     %s\n", logURL)
+	}
+
+	// Reglas
+	values := mngr.newCertValues(cert, entry.Source)
+	ruleMatches := mngr.checkCertMatch(values)
+	mngr.rulesMu.RLock()
+	active, shadowing := len(mngr.filtering), mngr.shadowing
+	inactive := 0
+	for _, r := range mngr.rules {
+		if r.State(now) != RuleActive && r.State(now) != RuleDraft {
+			inactive++
+		}
+	}
+	mngr.rulesMu.RUnlock()
+	fmt.Fprintf(w, "\nRules: %d active, %d shadow, %d disabled or expired (not evaluated)\n", active, len(shadowing), inactive)
+	for _, m := range ruleMatches {
+		explainMatch(w, "match", m)
+	}
+	for _, tag := range slices.Sorted(maps.Keys(shadowing)) {
+		if v, ok := shadowing[tag].Match(values); ok {
+			explainMatch(w, "shadow", ruleMatch{Tag: tag, Rule: shadowing[tag], Value: v})
+		}
+	}
+	if n := active - len(ruleMatches); n > 0 {
+		fmt.Fprintf(w, "  %d active rules do not match\n", n)
+	}
+
+	// Plugins y script
+	matches := ruleMatches
+	if len(mngr.Plugins) > 0 || mngr.Script != nil {
+		matches = mngr.extraMatches(values, ruleMatches)
+		fmt.Fprintln(w, "\nPlugins and script:")
+		added := 0
+		for _, m := range matches {
+			if m.From != "" {
+				explainMatch(w, "match", m)
+				added++
+			}
+		}
+		switch {
+		case len(matches) == 0 && len(ruleMatches) > 0:
+			fmt.Fprintln(w, "  -lua-script discarded the certificate")
+		case added == 0:
+			fmt.Fprintln(w, "  no matches added")
+		}
+	}
+	if len(matches) == 0 {
+		fmt.Fprintln(w, "\nResult: no match, nothing is delivered")
+		return
+	}
+
+	// Evento
+	ev := newRuleMatchEvent(matches, entry, cert)
+	fmt.Fprintf(w, "\nEvent: tag %s (%s), tags %s, matched_name %s\n", ev.Tag, ev.Rule.Severity, strings.Join(ev.Tags, ", "), ev.MatchedName)
+	if matches[0].Rule.Class == RuleClassCanary {
+		ev.Canary = true
+		fmt.Fprintln(w, "  canary: not sampled, deduplicated, suppressed in maintenance or routed; goes to every sink")
+	}
+	dropped := ""
+	if !ev.Canary {
+		switch kept := mngr.Sampling.Sample(&ev); {
+		case !kept:
+			fmt.Fprintf(w, "  sampling: dropped (tag %s sampled at %g)\n", ev.Tag, ev.SampleRate)
+			dropped = "sampling"
+		case ev.SampleRate > 0:
+			fmt.Fprintf(w, "  sampling: kept (tag %s sampled at %g)\n", ev.Tag, ev.SampleRate)
+		}
+		switch reason, key, err := mngr.Dedup.Check(context.Background(), ev); {
+		case mngr.Dedup == nil:
+			fmt.Fprintln(w, "  dedup: disabled")
+		case err != nil:
+			fmt.Fprintf(w, "  dedup: state store %s: %v\n", mngr.Dedup.Store.Name(), err)
+		case reason != "":
+			fmt.Fprintf(w, "  dedup: %s (%s in %s)\n", reason, key, mngr.Dedup.Store.Name())
+			if dropped == "" {
+				dropped = reason
+			}
+		default:
+			fmt.Fprintf(w, "  dedup: not seen in %s", mngr.Dedup.Store.Name())
+			if mngr.Dedup.Store.Name() == "memory" {
+				fmt.Fprint(w, " (memory: a running instance's state is not visible)")
+			}
+			fmt.Fprintln(w)
+		}
+	}
+
+	// Enriquecimiento
+	if len(mngr.Enrichers) > 0 {
+		fmt.Fprintln(w, "\nEnrichment:")
+		in := EnrichInput{Cert: cert, Issuer: entryIssuer(entry), Entry: entry}
+		ev.Enrichment = &Enrichment{}
+		for _, e := range mngr.Enrichers {
+			if !e.appliesTo(ev.AllTags()) {
+				fmt.Fprintf(w, "  %-20s not for these tags\n", e.Name())
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), enrichTimeout)
+			err := e.Enrich(ctx, &ev, in)
+			cancel()
+			if err != nil {
+				fmt.Fprintf(w, "  %-20s error: %v\n", e.Name(), err)
+			} else {
+				fmt.Fprintf(w, "  %-20s ok\n", e.Name())
+			}
+		}
+		if s := ev.Enrichment.Score; s != nil {
+			fmt.Fprintf(w, "  score: %s (%s %s)\n", scoreSummary(s), s.Backend, s.Model)
+		}
+		if data, err := json.Marshal(ev.Enrichment); err == nil {
+			fmt.Fprintf(w, "  %s\n", data)
+		}
+	}
+
+	// Enrutado
+	targets, routed := mngr.Router.Targets(ev.AllTags(), now)
+	switch {
+	case ev.Canary:
+		fmt.Fprintln(w, "\nSinks (canary, without routes):")
+	case routed:
+		fmt.Fprintf(w, "\nSinks (routes for these tags: %s):\n", strings.Join(targets, ", "))
+	default:
+		fmt.Fprintln(w, "\nSinks (no route for these tags: all sinks):")
+	}
+	delivered := 0
+	for _, s := range mngr.Sinks {
+		name := s.Name()
+		decision := "delivered"
+		switch {
+		case !ev.Canary && routed && !routedTo(name, targets):
+			decision = "not routed"
+		case !ev.Canary && mngr.Maintenance.Enabled() && !isLocalSink(s):
+			decision = "suppressed (maintenance)"
+		default:
+			delivered++
+			if mngr.Redactor.Applies(s) {
+				decision += " (redacted)"
+			}
+		}
+		fmt.Fprintf(w, "  %-30s %s\n", name, decision)
+	}
+	if mngr.Throttle != nil && !ev.Canary {
+		fmt.Fprintln(w, "  (paced by -emit-rate)")
+	}
+
+	if dropped != "" {
+		fmt.Fprintf(w, "\nResult: dropped by %s; otherwise delivered to %d of %d sinks\n", dropped, delivered, len(mngr.Sinks))
+		return
+	}
+	fmt.Fprintf(w, "\nResult: delivered to %d of %d sinks\n", delivered, len(mngr.Sinks))
+}
+
+func explainMatch(w io.Writer, kind string, m ruleMatch) {
+	from := m.From
+	if from == "" {
+		regex, expr := m.Rule.Source()
+		switch {
+		case expr != "":
+			from = "expr " + expr
+		case m.Rule.Keywords != nil:
+			term, _ := m.Rule.Keywords.Find(m.Value)
+			from = fmt.Sprintf("keyword %q (of %d)", term, m.Rule.Keywords.Len())
+		case m.Rule.Typosquat != nil:
+			if t, ok := m.Rule.Typosquat.Find(m.Value); ok {
+				from = fmt.Sprintf("typosquat of %s (%s, distance %d)", t.Target, t.Technique, t.Distance)
+			}
+		default:
+			from = "regex " + regex
+		}
+	}
+	fmt.Fprintf(w, "  %-6s %-20s %-8s %-30q %s\n", kind, m.Tag, m.Rule.Info.Severity, m.Value, from)
+}
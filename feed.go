@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* Feeds RSS/Atom de coincidencias por tag */
+
+// Guarda las últimas coincidencias de cada tag para servirlas como feed
+// desde el servidor de administración (GET /feed/{tag}, "*" = todos)
+type feedSink struct {
+	size   int
+	locale Locale
+
+	mu    sync.Mutex
+	byTag map[string][]MatchEvent // más antiguas primero
+	all   []MatchEvent
+}
+
+func NewFeedSink(size int) *feedSink {
+	return &feedSink{size: max(size, 1), locale: defaultLocale, byTag: make(map[string][]MatchEvent)}
+}
+
+func (f *feedSink) Name() string { return "feed" }
+
+func (f *feedSink) SetLocale(l Locale) { f.locale = l }
+func (f *feedSink) Close() error       { return nil }
+
+func (f *feedSink) Write(ctx context.Context, ev MatchEvent) error {
+	if ev.Kind != EventKindMatch {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	push := func(list []MatchEvent) []MatchEvent {
+		if len(list) == f.size {
+			list = slices.Delete(list, 0, 1)
+		}
+		return append(list, ev)
+	}
+	for _, tag := range ev.AllTags() {
+		f.byTag[tag] = push(f.byTag[tag])
+	}
+	f.all = push(f.all)
+	return nil
+}
+
+// Coincidencias del tag, la más reciente primero
+func (f *feedSink) Recent(tag string) []MatchEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	list := f.byTag[tag]
+	if tag == "*" {
+		list = f.all
+	}
+	out := slices.Clone(list)
+	slices.Reverse(out)
+	return out
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	Title   string    `xml:"title"`
+	ID      string    `xml:"id"`
+	Updated string    `xml:"updated"`
+	Link    *atomLink `xml:"link,omitempty"`
+	Content atomText  `xml:"content"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Author  string      `xml:"author>name"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type rssGUID struct {
+	PermaLink bool   `xml:"isPermaLink,attr"`
+	ID        string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link,omitempty"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Description string  `xml:"description"`
+}
+
+type rssFeed struct {
+	XMLName     xml.Name  `xml:"rss"`
+	Version     string    `xml:"version,attr"`
+	Title       string    `xml:"channel>title"`
+	Link        string    `xml:"channel>link"`
+	Description string    `xml:"channel>description"`
+	Items       []rssItem `xml:"channel>item"`
+}
+
+// Identificador estable de la coincidencia en los lectores de feeds
+func feedEntryID(ev MatchEvent) string {
+	return "urn:gctwatch:" + url.PathEscape(ev.Tag) + ":" + ev.Certificate.FingerprintSHA256
+}
+
+func feedEntryText(ev MatchEvent, l Locale) (string, string) {
+	title, facts := notifyContent(ev, l)
+	var body strings.Builder
+	for _, f := range facts {
+		body.WriteString(f.Name + ": " + f.Value + "\n")
+	}
+	return title, body.String()
+}
+
+// Sirve el feed del tag; ?format=rss para RSS 2.0, Atom por defecto
+func (f *feedSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tag := r.PathValue("tag")
+	events := f.Recent(tag)
+	title := "gCTWatch: " + tag
+	if tag == "*" {
+		title = "gCTWatch: " + f.locale.T("all matches")
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	self := (&url.URL{Scheme: scheme, Host: r.Host, Path: r.URL.Path, RawQuery: r.URL.RawQuery}).String()
+	var doc any
+	contentType := "application/atom+xml; charset=utf-8"
+	if r.URL.Query().Get("format") == "rss" {
+		feed := rssFeed{Version: "2.0", Title: title, Link: self, Description: "Certificates matching " + tag}
+		for _, ev := range events {
+			t, body := feedEntryText(ev, f.locale)
+			feed.Items = append(feed.Items, rssItem{
+				Title: t, Link: notifyLink(ev), GUID: rssGUID{ID: feedEntryID(ev)},
+				PubDate: ev.Timestamp.Format(time.RFC1123Z), Description: body,
+			})
+		}
+		doc, contentType = feed, "application/rss+xml; charset=utf-8"
+	} else {
+		updated := time.Now().UTC()
+		if len(events) > 0 {
+			updated = events[0].Timestamp
+		}
+		feed := atomFeed{
+			Title: title, ID: "urn:gctwatch:feed:" + url.PathEscape(tag), Updated: updated.Format(time.RFC3339),
+			Link: atomLink{Href: self, Rel: "self"}, Author: "gCTWatch",
+		}
+		for _, ev := range events {
+			t, body := feedEntryText(ev, f.locale)
+			entry := atomEntry{Title: t, ID: feedEntryID(ev), Updated: ev.Timestamp.Format(time.RFC3339), Content: atomText{Type: "text", Body: body}}
+			if link := notifyLink(ev); link != "" {
+				entry.Link = &atomLink{Href: link}
+			}
+			feed.Entries = append(feed.Entries, entry)
+		}
+		doc = feed
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	enc.Encode(doc)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+/* Etiquetado de coincidencias (verdaderos y falsos positivos) */
+
+const (
+	LabelTruePositive  = "tp"
+	LabelFalsePositive = "fp"
+)
+
+// Umbral por defecto de falsos positivos de un dominio para sugerir suprimirlo
+const defaultFPSuggestThreshold = 3
+
+var errMatchNotFound = errors.New("match not found")
+
+func checkLabel(label string) error {
+	switch label {
+	case LabelTruePositive, LabelFalsePositive, "":
+		return nil
+	}
+	return fmt.Errorf("invalid label %q (tp, fp, or empty to clear)", label)
+}
+
+// Precisión de una regla según las coincidencias etiquetadas
+type RulePrecision struct {
+	Kind           string   `json:"kind"`
+	Tag            string   `json:"tag"`
+	Matches        int64    `json:"matches"`
+	Labeled        int64    `json:"labeled"`
+	TruePositives  int64    `json:"true_positives"`
+	FalsePositives int64    `json:"false_positives"`
+	Precision      *float64 `json:"precision,omitempty"` // TP / (TP + FP); sin etiquetas no hay
+}
+
+// Dominio marcado repetidamente como falso positivo de una regla, y nunca
+// como verdadero: candidato a excluirse de la regla o a suprimirse
+type SuppressionSuggestion struct {
+	Tag            string `json:"tag"`
+	Domain         string `json:"domain"`
+	FalsePositives int64  `json:"false_positives"`
+}
+
+type PrecisionReport struct {
+	Rules       []RulePrecision         `json:"rules"`
+	Suggestions []SuppressionSuggestion `json:"suggested_suppressions"`
+}
+
+// Consultas comunes a los almacenes SQL (con marcadores ?)
+const (
+	rulePrecisionQuery = `SELECT kind, tag, count(*),
+		sum(CASE WHEN label = 'tp' THEN 1 ELSE 0 END), sum(CASE WHEN label = 'fp' THEN 1 ELSE 0 END)
+		FROM matches GROUP BY kind, tag ORDER BY kind, tag`
+	suppressionSuggestionQuery = `SELECT tag, domain, sum(CASE WHEN label = 'fp' THEN 1 ELSE 0 END) AS fp
+		FROM matches GROUP BY tag, domain
+		HAVING sum(CASE WHEN label = 'fp' THEN 1 ELSE 0 END) >= ? AND sum(CASE WHEN label = 'tp' THEN 1 ELSE 0 END) = 0
+		ORDER BY fp DESC, tag, domain`
+)
+
+func (p *RulePrecision) compute() {
+	p.Labeled = p.TruePositives + p.FalsePositives
+	if p.Labeled > 0 {
+		v := float64(p.TruePositives) / float64(p.Labeled)
+		p.Precision = &v
+	}
+}
+
+// Listas vacías en vez de null en el JSON
+func newPrecisionReport() PrecisionReport {
+	return PrecisionReport{Rules: []RulePrecision{}, Suggestions: []SuppressionSuggestion{}}
+}
+
+// Avisa cuando el dominio de una coincidencia recién marcada como falso
+// positivo alcanza el umbral
+func logSuppressionSuggestion(ctx context.Context, store MatchStore, m StoredMatch, threshold int) {
+	if m.Label != LabelFalsePositive || threshold <= 0 {
+		return
+	}
+	report, err := store.Precision(ctx, threshold)
+	if err != nil {
+		log.Printf("WARNING: failed to compute suppression suggestions: %v", err)
+		return
+	}
+	for _, s := range report.Suggestions {
+		if s.Tag == m.Tag && s.Domain == m.Domain {
+			log.Printf("rule %s: %s labeled false positive %d times, consider excluding it", s.Tag, s.Domain, s.FalsePositives)
+		}
+	}
+}
+
+// -label: etiqueta coincidencias por ID (42=fp,43=tp,44=) e imprime cada una
+func labelMatches(store MatchStore, labels string, threshold int, out io.Writer) error {
+	ctx := context.Background()
+	enc := json.NewEncoder(out)
+	for _, kv := range strings.Split(labels, ",") {
+		k, label, ok := strings.Cut(strings.TrimSpace(kv), "=")
+		id, err := strconv.ParseInt(k, 10, 64)
+		if !ok || err != nil {
+			return fmt.Errorf("invalid label %q (ID=tp, ID=fp or ID= to clear)", kv)
+		}
+		if err := checkLabel(label); err != nil {
+			return err
+		}
+		m, err := store.Label(ctx, id, label, "")
+		if err != nil {
+			return fmt.Errorf("match %d: %w", id, err)
+		}
+		enc.Encode(m)
+		logSuppressionSuggestion(ctx, store, m, threshold)
+	}
+	return nil
+}
+
+// -precision: imprime la precisión por regla y las supresiones sugeridas
+func printPrecision(store MatchStore, threshold int, out io.Writer) error {
+	report, err := store.Precision(context.Background(), threshold)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// POST /matches/{id}/label con {"label": "fp", "note": "..."}
+func (mngr *CTLogsManager) serveLabel(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid match id", http.StatusBadRequest)
+		return
+	}
+	var req struct {
+		Label string `json:"label"`
+		Note  string `json:"note"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := checkLabel(req.Label); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	m, err := mngr.Matches.Label(r.Context(), id, req.Label, req.Note)
+	if errors.Is(err, errMatchNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logSuppressionSuggestion(r.Context(), mngr.Matches, m, mngr.FPSuggestThreshold)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m)
+}
+
+// GET /precision
+func (mngr *CTLogsManager) servePrecision(w http.ResponseWriter, r *http.Request) {
+	report, err := mngr.Matches.Precision(r.Context(), mngr.FPSuggestThreshold)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/google/certificate-transparency-go/jsonclient"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+/* Clasificación de los errores de lectura de los logs */
+
+// Categoría de un error de get-sth o get-entries
+type FetchErrorKind string
+
+const (
+	FetchErrDNS          FetchErrorKind = "dns"
+	FetchErrTimeout      FetchErrorKind = "timeout"
+	FetchErrNetwork      FetchErrorKind = "network"      // conexión rechazada, cortada...
+	FetchErrCircuitOpen  FetchErrorKind = "circuit_open" // circuit breaker del host
+	FetchErrRateLimited  FetchErrorKind = "rate_limited" // 429
+	FetchErrServer       FetchErrorKind = "server"       // 5xx
+	FetchErrClient       FetchErrorKind = "client"       // otros 4xx (404 de un log retirado...)
+	FetchErrTLS          FetchErrorKind = "tls"          // certificado o handshake
+	FetchErrDenied       FetchErrorKind = "denied"       // política de red
+	FetchErrMalformed    FetchErrorKind = "malformed"    // respuesta que no se puede interpretar
+	FetchErrInconsistent FetchErrorKind = "inconsistent" // STH que encoge, más entradas de las pedidas
+	FetchErrOther        FetchErrorKind = "other"
+)
+
+const fetchRetryMaxDelay = 10 * time.Minute
+
+// Lecturas seguidas en las que una entrada no se puede interpretar antes de
+// saltarla (cada vez puede servirla otra réplica)
+const malformedEntryAttempts = 3
+
+// Cómo se reintenta tras un error de cada categoría. Delay es la espera antes
+// del siguiente sondeo (0 = en el siguiente intervalo), que se dobla con cada
+// fallo seguido de la misma categoría hasta fetchRetryMaxDelay. Weight es lo
+// que cuenta para suspender el log (-log-breaker-failures): un 429 no indica
+// que el log esté caído y un error permanente no va a arreglarse solo.
+type fetchRetryPolicy struct {
+	Transient bool
+	Delay     time.Duration
+	Weight    int
+}
+
+var fetchRetryPolicies = map[FetchErrorKind]fetchRetryPolicy{
+	FetchErrDNS:          {Transient: true, Weight: 1},
+	FetchErrTimeout:      {Transient: true, Weight: 1},
+	FetchErrNetwork:      {Transient: true, Weight: 1},
+	FetchErrCircuitOpen:  {Transient: true, Weight: 1},
+	FetchErrServer:       {Transient: true, Weight: 1},
+	FetchErrInconsistent: {Transient: true, Weight: 1},
+	FetchErrOther:        {Transient: true, Weight: 1},
+	FetchErrRateLimited:  {Transient: true, Delay: 30 * time.Second, Weight: 0},
+	FetchErrClient:       {Delay: time.Minute, Weight: 20},
+	FetchErrTLS:          {Delay: time.Minute, Weight: 20},
+	FetchErrDenied:       {Delay: time.Minute, Weight: 20},
+	FetchErrMalformed:    {Delay: time.Minute, Weight: 20},
+}
+
+var metricFetchErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gctwatch_log_fetch_errors_total",
+	Help: "Errores de lectura de cada log por operación (get-sth, get-entries) y categoría.",
+}, []string{"log", "op", "kind"})
+
+// Error de lectura de un endpoint de log con su categoría
+type FetchError struct {
+	Kind     FetchErrorKind
+	Op       string // get-sth, get-entries
+	Endpoint string
+	Err      error
+}
+
+func (e *FetchError) Error() string {
+	return fmt.Sprintf("%s from %s (%s): %v", e.Op, e.Endpoint, e.Kind, e.Err)
+}
+
+func (e *FetchError) Unwrap() error { return e.Err }
+
+func (e *FetchError) Policy() fetchRetryPolicy { return fetchRetryPolicies[e.Kind] }
+
+// Envuelve err con su categoría y lo cuenta en las métricas
+func newFetchError(source, op, endpoint string, err error) *FetchError {
+	fe := &FetchError{Kind: classifyFetchError(err), Op: op, Endpoint: endpoint, Err: err}
+	metricFetchErrors.WithLabelValues(source, op, string(fe.Kind)).Inc()
+	return fe
+}
+
+func classifyFetchError(err error) FetchErrorKind {
+	var (
+		rsp       jsonclient.RspError
+		dnsErr    *net.DNSError
+		netErr    net.Error
+		syntax    *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+		verifyErr *tls.CertificateVerificationError
+		alert     tls.AlertError
+		header    tls.RecordHeaderError
+		unknownCA x509.UnknownAuthorityError
+		invalid   x509.CertificateInvalidError
+		hostname  x509.HostnameError
+	)
+	switch {
+	case errors.Is(err, ErrCircuitOpen):
+		return FetchErrCircuitOpen
+	case errors.Is(err, ErrEgressDenied):
+		return FetchErrDenied
+	case errors.As(err, &rsp):
+		switch {
+		case rsp.StatusCode == http.StatusTooManyRequests:
+			return FetchErrRateLimited
+		case rsp.StatusCode >= 500:
+			return FetchErrServer
+		case rsp.StatusCode >= 400:
+			return FetchErrClient
+		}
+		// 200 con un cuerpo que no se puede decodificar
+		return FetchErrMalformed
+	case errors.As(err, &verifyErr), errors.As(err, &alert), errors.As(err, &header),
+		errors.As(err, &unknownCA), errors.As(err, &invalid), errors.As(err, &hostname):
+		return FetchErrTLS
+	case errors.As(err, &dnsErr):
+		if dnsErr.IsTimeout {
+			return FetchErrTimeout
+		}
+		return FetchErrDNS
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return FetchErrTimeout
+	case errors.As(err, &syntax), errors.As(err, &typeErr):
+		return FetchErrMalformed
+	case errors.As(err, &netErr), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		return FetchErrNetwork
+	}
+	return FetchErrOther
+}
+
+// Aplica la política de reintento del error a la fuente: cuándo se vuelve a
+// sondear. Devuelve lo que cuenta para suspender el log.
+func (source *CTLogSource) scheduleRetry(err error, interval time.Duration) int {
+	var fe *FetchError
+	if !errors.As(err, &fe) {
+		source.retryAt, source.retryKind, source.retries = time.Time{}, "", 0
+		if err != nil {
+			return 1
+		}
+		return 0
+	}
+	if fe.Kind != source.retryKind {
+		source.retryKind, source.retries = fe.Kind, 0
+	}
+	source.retries++
+	p := fe.Policy()
+	source.retryAt = time.Time{}
+	if p.Delay > 0 {
+		delay := min(p.Delay<<min(source.retries-1, 10), fetchRetryMaxDelay)
+		// El ticker ya espera un intervalo
+		source.retryAt = time.Now().Add(delay - interval)
+	}
+	return p.Weight
+}
+
+// Cuenta un fallo al interpretar la entrada index. Devuelve si ya se ha
+// intentado malformedEntryAttempts veces y hay que saltarla.
+func (source *CTLogSource) malformedEntry(index uint64) bool {
+	if source.malformedAt != index {
+		source.malformedAt, source.malformedTries = index, 0
+	}
+	source.malformedTries++
+	return source.malformedTries >= malformedEntryAttempts
+}
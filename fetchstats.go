@@ -0,0 +1,145 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+/* Instrumentación de lectura por log */
+
+var (
+	metricGetEntriesDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gctwatch_get_entries_duration_seconds",
+		Help:    "Latencia de get-entries por log.",
+		Buckets: prometheus.ExponentialBuckets(0.05, 2, 10), // 50ms .. ~25s
+	}, []string{"log"})
+	metricGetEntriesBatch = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gctwatch_get_entries_batch_size",
+		Help:    "Entradas devueltas por get-entries por log.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12), // 1 .. 2048
+	}, []string{"log"})
+	metricParseDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gctwatch_entry_parse_duration_seconds",
+		Help:    "Tiempo de parseo X.509 de una entrada por log.",
+		Buckets: prometheus.ExponentialBuckets(10e-6, 2, 12), // 10µs .. ~20ms
+	}, []string{"log"})
+)
+
+// Contadores acumulados de una fuente (para la API de estadísticas)
+type FetchStats struct {
+	Requests       atomic.Int64
+	Errors         atomic.Int64
+	Entries        atomic.Int64
+	Dropped        atomic.Int64 // OutputChan lleno
+	fetchNanos     atomic.Int64
+	Parsed         atomic.Int64
+	parseNanos     atomic.Int64
+	lastBatch      atomic.Int64
+	lastFetchAt    atomic.Int64 // unix nanos
+	position       atomic.Uint64
+	window         atomic.Uint64
+	suspendedUntil atomic.Int64  // unix nanos; 0 = no suspendida
+	treeSize       atomic.Uint64 // del último STH
+	checkpoint     atomic.Uint64 // última posición guardada en el almacén
+	standby        atomic.Bool   // concesión en manos de otra instancia
+}
+
+// Resultado de una ronda de get-entries de la fuente
+func (s *FetchStats) ObserveFetch(source *CTLogSource, d time.Duration, batch int, err error) {
+	logURL := source.Source
+	s.Requests.Add(1)
+	s.lastFetchAt.Store(time.Now().UnixNano())
+	s.position.Store(source.LastSize)
+	s.window.Store(source.WindowSize)
+	if err != nil {
+		s.Errors.Add(1)
+		return
+	}
+	s.Entries.Add(int64(batch))
+	s.fetchNanos.Add(int64(d))
+	s.lastBatch.Store(int64(batch))
+	metricGetEntriesDuration.WithLabelValues(logURL).Observe(d.Seconds())
+	metricGetEntriesBatch.WithLabelValues(logURL).Observe(float64(batch))
+}
+
+func (s *FetchStats) ObserveParse(logURL string, d time.Duration) {
+	s.Parsed.Add(1)
+	s.parseNanos.Add(int64(d))
+	metricParseDuration.WithLabelValues(logURL).Observe(d.Seconds())
+}
+
+type SourceStatsReport struct {
+	URL            string    `json:"url"`
+	WindowSize     uint64    `json:"window_size"`
+	Position       uint64    `json:"position"`
+	Requests       int64     `json:"requests"`
+	Errors         int64     `json:"errors"`
+	Entries        int64     `json:"entries"`
+	Parsed         int64     `json:"parsed"`
+	Dropped        int64     `json:"dropped"`
+	AvgLatencyMs   float64   `json:"avg_latency_ms"`
+	AvgBatchSize   float64   `json:"avg_batch_size"`
+	LastBatchSize  int64     `json:"last_batch_size"`
+	AvgParseUs     float64   `json:"avg_parse_us"`
+	LastFetchAt    time.Time `json:"last_fetch_at,omitzero"`
+	SuspendedUntil time.Time `json:"suspended_until,omitzero"` // circuit breaker del log abierto
+}
+
+type StatsReport struct {
+	StartedAt        time.Time           `json:"started_at"`
+	EntriesProcessed int64               `json:"entries_processed"`
+	Matches          int64               `json:"matches"`
+	MatchesByTag     map[string]int64    `json:"matches_by_tag"`
+	ShadowByTag      map[string]int64    `json:"shadow_matches_by_tag,omitempty"` // reglas en evaluación (-shadow-rules)
+	Sources          []SourceStatsReport `json:"sources"`
+	Sinks            []SinkStatsReport   `json:"sinks"`
+	Resources        ResourceReport      `json:"resources"`
+}
+
+func (mngr *CTLogsManager) StatsReport() StatsReport {
+	r := StatsReport{
+		StartedAt:        mngr.stats.StartedAt,
+		EntriesProcessed: mngr.stats.EntriesProcessed.Load(),
+		Matches:          mngr.stats.Matches.Load(),
+		MatchesByTag:     mngr.stats.TagMatches(),
+		ShadowByTag:      mngr.stats.ShadowTagMatches(),
+		Resources:        resourceReport(),
+	}
+	for _, d := range mngr.dispatchers {
+		r.Sinks = append(r.Sinks, d.Stats())
+	}
+	for i := range mngr.sources {
+		src := &mngr.sources[i]
+		s := src.Stats
+		ok := s.Requests.Load() - s.Errors.Load()
+		sr := SourceStatsReport{
+			URL:           src.Source,
+			WindowSize:    s.window.Load(),
+			Position:      s.position.Load(),
+			Requests:      s.Requests.Load(),
+			Errors:        s.Errors.Load(),
+			Entries:       s.Entries.Load(),
+			Parsed:        s.Parsed.Load(),
+			Dropped:       s.Dropped.Load(),
+			LastBatchSize: s.lastBatch.Load(),
+		}
+		if ok > 0 {
+			sr.AvgLatencyMs = float64(s.fetchNanos.Load()) / float64(ok) / 1e6
+			sr.AvgBatchSize = float64(sr.Entries) / float64(ok)
+		}
+		if n := s.Parsed.Load(); n > 0 {
+			sr.AvgParseUs = float64(s.parseNanos.Load()) / float64(n) / 1e3
+		}
+		if t := s.lastFetchAt.Load(); t > 0 {
+			sr.LastFetchAt = time.Unix(0, t).UTC()
+		}
+		if t := s.suspendedUntil.Load(); t > 0 {
+			sr.SuspendedUntil = time.Unix(0, t).UTC()
+		}
+		r.Sources = append(r.Sources, sr)
+	}
+	return r
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+/* Estado de salud por subsistema */
+
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded"
+	HealthDown     = "down"
+)
+
+type ComponentHealth struct {
+	Status   string    `json:"status"`
+	Error    string    `json:"error,omitempty"`
+	Since    time.Time `json:"since"`
+	Critical bool      `json:"critical"` // si falla, el servicio está caído (no degradado)
+}
+
+type HealthReport struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentHealth `json:"components"`
+}
+
+type Health struct {
+	mu         sync.RWMutex
+	components map[string]ComponentHealth
+}
+
+func NewHealth() *Health {
+	return &Health{components: make(map[string]ComponentHealth)}
+}
+
+// Registra el estado de un componente. Devuelve true si ha cambiado,
+// para registrar solo las transiciones.
+func (h *Health) Set(name string, critical bool, err error) bool {
+	c := ComponentHealth{Status: HealthOK, Critical: critical}
+	if err != nil {
+		c.Status, c.Error = HealthDown, err.Error()
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	prev, ok := h.components[name]
+	if ok && prev.Status == c.Status {
+		return false
+	}
+	c.Since = time.Now().UTC()
+	h.components[name] = c
+	return true
+}
+
+// Estado global: caído si falla un componente crítico, degradado si falla otro
+func (h *Health) Report() HealthReport {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	r := HealthReport{Status: HealthOK, Components: make(map[string]ComponentHealth, len(h.components))}
+	for name, c := range h.components {
+		r.Components[name] = c
+		if c.Status == HealthOK {
+			continue
+		}
+		if c.Critical {
+			r.Status = HealthDown
+		} else if r.Status == HealthOK {
+			r.Status = HealthDegraded
+		}
+	}
+	return r
+}
+
+// Componentes que están fallando, ordenados
+func (r HealthReport) Failing() []string {
+	var out []string
+	for name, c := range r.Components {
+		if c.Status != HealthOK {
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
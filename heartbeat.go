@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+/* Latidos periódicos */
+
+// Emite un heartbeat cada intervalo a los sinks indicados (por tipo; vacío = todos)
+func (mngr *CTLogsManager) runHeartbeat(interval time.Duration, route []string) {
+	defer mngr.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-mngr.context.Done():
+			return
+		case <-ticker.C:
+			ev := NewHeartbeatEvent(Heartbeat{
+				Instance:         mngr.InstanceID,
+				StartedAt:        mngr.stats.StartedAt,
+				UptimeSeconds:    int64(time.Since(mngr.stats.StartedAt).Seconds()),
+				Status:           mngr.Health.Report().Status,
+				Sources:          len(mngr.sources),
+				EntriesProcessed: mngr.stats.EntriesProcessed.Load(),
+				Matches:          mngr.stats.Matches.Load(),
+				LastEntryAt:      mngr.stats.LastEntryAt(),
+			})
+			for _, d := range mngr.dispatchers {
+				if routedTo(d.sink.Name(), route) {
+					mngr.deliver(d, ev)
+				}
+			}
+		}
+	}
+}
+
+func routedTo(sinkName string, route []string) bool {
+	if len(route) == 0 {
+		return true
+	}
+	for _, r := range route {
+		r = strings.TrimSpace(r)
+		if r == sinkKind(sinkName) || r == sinkName {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/text/unicode/norm"
+)
+
+/* Homógrafos IDN: nombres Unicode que se leen como otro en ASCII */
+
+// Caracteres que se confunden con una letra ASCII y que NFKD no
+// descompone: cirílico, griego, armenio y variantes latinas. Es la parte de
+// confusables.txt (Unicode TR39) que se ve en dominios de phishing, no la
+// tabla entera.
+var confusables = map[rune]string{
+	// Cirílico
+	'а': "a", 'в': "b", 'ь': "b", 'с': "c", 'ԁ': "d", 'е': "e", 'ё': "e", 'һ': "h", 'н': "h",
+	'і': "i", 'ї': "i", 'ј': "j", 'к': "k", 'ӏ': "l", 'м': "m", 'п': "n", 'о': "o", 'р': "p",
+	'ԛ': "q", 'г': "r", 'ѕ': "s", 'т': "t", 'џ': "u", 'ѵ': "v", 'ԝ': "w", 'х': "x", 'у': "y",
+	'ў': "y", 'ҫ': "c", 'ӕ': "ae", 'ԃ': "d", 'ԍ': "g",
+	// Griego
+	'α': "a", 'β': "b", 'ϲ': "c", 'δ': "d", 'ε': "e", 'η': "n", 'ι': "i", 'κ': "k", 'ν': "v",
+	'ο': "o", 'ρ': "p", 'τ': "t", 'υ': "u", 'χ': "x", 'γ': "y", 'ϳ': "j", 'ω': "w", 'ϱ': "p",
+	// Armenio
+	'ա': "w", 'գ': "q", 'զ': "q", 'հ': "h", 'ո': "n", 'ռ': "n", 'ս': "u", 'ց': "g", 'օ': "o",
+	'ք': "p",
+	// Latín sin descomposición
+	'ı': "i", 'ɩ': "i", 'ȷ': "j", 'ł': "l", 'ƚ': "l", 'ɫ': "l", 'ø': "o", 'ɵ': "o", 'đ': "d", 'ɗ': "d",
+	'ħ': "h", 'ɦ': "h", 'ƀ': "b", 'ɓ': "b", 'ƈ': "c", 'ɡ': "g", 'ɠ': "g", 'ɑ': "a", 'ɐ': "a",
+	'ʏ': "y", 'ƴ': "y", 'ʋ': "u", 'ꞓ': "e", 'ɛ': "e", 'ʀ': "r", 'ɾ': "r", 'ʂ': "s", 'ȿ': "s",
+	'ᴀ': "a", 'ʙ': "b", 'ᴄ': "c", 'ᴅ': "d", 'ᴇ': "e", 'ɢ': "g", 'ʜ': "h", 'ɪ': "i", 'ᴊ': "j",
+	'ᴋ': "k", 'ʟ': "l", 'ᴍ': "m", 'ɴ': "n", 'ᴏ': "o", 'ᴘ': "p", 'ᴛ': "t", 'ᴜ': "u", 'ᴠ': "v",
+	'ᴡ': "w", 'ᴢ': "z",
+}
+
+// Esqueleto ASCII de un nombre IDN: las etiquetas xn-- se decodifican y
+// cada carácter se pasa a la letra ASCII con la que se confunde (NFKD y sin
+// diacríticos, más la tabla de confusables). pаypal.com (con "а" cirílica,
+// xn--pypal-4ve.com) da paypal.com. "" si el nombre no tiene caracteres
+// fuera de ASCII tras decodificarlo, porque entonces no es un homógrafo;
+// los caracteres sin equivalencia se quedan como están.
+func homographSkeleton(name string) string {
+	name = strings.TrimSuffix(strings.TrimPrefix(strings.ToLower(name), "*."), ".")
+	if strings.Contains(name, "xn--") {
+		u, err := idna.Punycode.ToUnicode(name)
+		if err != nil {
+			return ""
+		}
+		name = u
+	}
+	if isASCII(name) {
+		return ""
+	}
+	var b strings.Builder
+	for _, r := range norm.NFKD.String(name) {
+		r = unicode.ToLower(r)
+		switch s, ok := confusables[r]; {
+		case ok:
+			b.WriteString(s)
+		case unicode.Is(unicode.Mn, r):
+			// Diacrítico separado por NFKD (á -> a + ´)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	CertTransp "github.com/google/certificate-transparency-go"
+	ctx509 "github.com/google/certificate-transparency-go/x509"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+/* Receptor de certificados enviados por otros sistemas */
+
+const (
+	ingestMaxBody         = 1 << 20
+	ingestMaxCertificates = 100 // por petición
+	defaultIngestSource   = "push"
+)
+
+var metricIngested = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gctwatch_ingested_certificates_total",
+	Help: "Certificados recibidos en POST /ingest por origen.",
+}, []string{"source"})
+
+var ingestSourceName = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Certificado enviado en JSON
+type pushedCertificate struct {
+	Source      string   `json:"source,omitempty"`
+	Certificate string   `json:"certificate"`     // PEM o DER en base64
+	Chain       []string `json:"chain,omitempty"` // intermedios, igual
+}
+
+// Acepta certificados emitidos fuera de CT (CA internas, hooks de ACME) y los
+// pasa por OutputChan como una entrada más, así que se aplican las mismas
+// reglas, enriquecedores y sinks. Cada origen es una fuente "push:<nombre>"
+// con su propia numeración de entradas. Los certificados enviados no tienen
+// checkpoint: si se para el watcher con la petición en curso se responde 503.
+type Receiver struct {
+	token string
+	ch    chan SourcedEntry
+
+	mu      sync.Mutex
+	sources map[string]*ingestSource
+}
+
+type ingestSource struct {
+	source CTLogSource
+	seq    int64
+}
+
+func NewReceiver(tokenFile string) (*Receiver, error) {
+	token, err := readBearerToken(tokenFile, "ingest")
+	if err != nil {
+		return nil, err
+	}
+	return &Receiver{token: token, ch: make(chan SourcedEntry), sources: make(map[string]*ingestSource)}, nil
+}
+
+// Token bearer de un fichero (-ingest-token-file, -admin-token-file)
+func readBearerToken(path, what string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s token: %w", what, err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("empty %s token in %s", what, path)
+	}
+	return token, nil
+}
+
+// Comprueba Authorization: Bearer; si no coincide responde 401
+func checkBearer(w http.ResponseWriter, r *http.Request, token string) bool {
+	auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(auth), []byte(token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// Pasa a out lo recibido hasta que se cancela ctx
+func (r *Receiver) forward(ctx context.Context, out chan<- SourcedEntry) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-r.ch:
+			select {
+			case out <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// Entrada de un certificado recibido, numerada dentro de su origen
+func (r *Receiver) entry(name string, cert []byte, chain [][]byte) SourcedEntry {
+	r.mu.Lock()
+	src, ok := r.sources[name]
+	if !ok {
+		src = &ingestSource{source: CTLogSource{Source: "push:" + name, Lists: []string{"push"}, Stats: &FetchStats{}}}
+		r.sources[name] = src
+	}
+	index := src.seq
+	src.seq++
+	r.mu.Unlock()
+	e := SourcedEntry{Source: &src.source, Entry: CertTransp.LogEntry{Index: index, X509Cert: &ctx509.Certificate{Raw: cert}}}
+	for _, c := range chain {
+		e.Entry.Chain = append(e.Entry.Chain, CertTransp.ASN1Cert{Data: c})
+	}
+	return e
+}
+
+// Un certificado en PEM o en DER codificado en base64
+func decodePushedCert(s string) ([]byte, error) {
+	var der []byte
+	if strings.TrimSpace(s) == "" {
+		return nil, errors.New("missing certificate")
+	}
+	if strings.Contains(s, "-----BEGIN") {
+		block, _ := pem.Decode([]byte(s))
+		if block == nil || block.Type != "CERTIFICATE" {
+			return nil, errors.New("no CERTIFICATE PEM block")
+		}
+		der = block.Bytes
+	} else {
+		var err error
+		if der, err = base64.StdEncoding.DecodeString(strings.TrimSpace(s)); err != nil {
+			return nil, fmt.Errorf("invalid base64: %w", err)
+		}
+	}
+	if _, err := x509.ParseCertificate(der); err != nil {
+		return nil, err
+	}
+	return der, nil
+}
+
+// JSON: un objeto o una lista de objetos. PEM: una cadena, con el
+// certificado primero (como fullchain.pem de ACME) y el origen en ?source=.
+func parsePushedCertificates(r *http.Request, body []byte) ([]pushedCertificate, error) {
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if ct != "application/json" {
+		var chain []string
+		for rest := body; ; {
+			var block *pem.Block
+			if block, rest = pem.Decode(rest); block == nil {
+				break
+			}
+			if block.Type == "CERTIFICATE" {
+				chain = append(chain, string(pem.EncodeToMemory(block)))
+			}
+		}
+		if len(chain) == 0 {
+			return nil, errors.New("no CERTIFICATE PEM blocks (send PEM or application/json)")
+		}
+		return []pushedCertificate{{Source: r.URL.Query().Get("source"), Certificate: chain[0], Chain: chain[1:]}}, nil
+	}
+	var certs []pushedCertificate
+	if body = bytes.TrimSpace(body); len(body) > 0 && body[0] == '[' {
+		if err := json.Unmarshal(body, &certs); err != nil {
+			return nil, err
+		}
+	} else {
+		var c pushedCertificate
+		if err := json.Unmarshal(body, &c); err != nil {
+			return nil, err
+		}
+		certs = append(certs, c)
+	}
+	return certs, nil
+}
+
+// POST /ingest
+func (mngr *CTLogsManager) serveIngest(w http.ResponseWriter, r *http.Request) {
+	rcv := mngr.Receiver
+	if !checkBearer(w, r, rcv.token) {
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, ingestMaxBody))
+	if err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	pushed, err := parsePushedCertificates(r, body)
+	if err == nil && len(pushed) > ingestMaxCertificates {
+		err = fmt.Errorf("too many certificates (max %d per request)", ingestMaxCertificates)
+	}
+	if err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Se valida todo antes de encolar nada
+	entries := make([]SourcedEntry, 0, len(pushed))
+	for i, p := range pushed {
+		name := p.Source
+		if name == "" {
+			name = defaultIngestSource
+		}
+		if !ingestSourceName.MatchString(name) {
+			http.Error(w, fmt.Sprintf("certificate %d: invalid source %q", i, name), http.StatusBadRequest)
+			return
+		}
+		cert, err := decodePushedCert(p.Certificate)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("certificate %d: %v", i, err), http.StatusBadRequest)
+			return
+		}
+		var chain [][]byte
+		for j, c := range p.Chain {
+			der, err := decodePushedCert(c)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("certificate %d: chain %d: %v", i, j, err), http.StatusBadRequest)
+				return
+			}
+			chain = append(chain, der)
+		}
+		entries = append(entries, rcv.entry(name, cert, chain))
+	}
+	accepted := 0
+	for _, e := range entries {
+		select {
+		case rcv.ch <- e:
+			accepted++
+			if mngr.Issuance != nil {
+				account := strings.TrimPrefix(e.Source.Source, "push:")
+				if err := mngr.Issuance.Record(r.Context(), account, e.Entry.X509Cert.Raw); err != nil {
+					log.Printf("WARNING: recording issuance by %s: %v", account, err)
+				}
+			}
+			metricIngested.WithLabelValues(strings.TrimPrefix(e.Source.Source, "push:")).Inc()
+			continue
+		case <-mngr.context.Done():
+			http.Error(w, fmt.Sprintf("shutting down, %d of %d certificates accepted", accepted, len(entries)), http.StatusServiceUnavailable)
+		case <-r.Context().Done():
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]int{"accepted": accepted})
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testIngestToken = "s3cret"
+
+func newTestReceiverManager(t *testing.T) *CTLogsManager {
+	t.Helper()
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte(testIngestToken+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	rcv, err := NewReceiver(tokenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mngr, err := NewLogManager("", RegexRules{}, &Network{Policy: NewEgressPolicy(false, nil), Dialer: &NetDialer{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mngr.Receiver = rcv
+	t.Cleanup(func() {
+		mngr.cancel()
+		mngr.outCancel()
+	})
+	return mngr
+}
+
+func postIngest(mngr *CTLogsManager, token, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/ingest?source=acme", strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	mngr.serveIngest(w, req)
+	return w
+}
+
+// Un PEM aceptado llega a un worker y se procesa como una entrada de log
+func TestServeIngest(t *testing.T) {
+	mngr := newTestReceiverManager(t)
+	go mngr.Receiver.forward(mngr.context, mngr.OutputChan)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		mngr.consumeLogOutputs(1)
+	}()
+
+	der := testReplayCert(t)
+	body := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	if w := postIngest(mngr, testIngestToken, "application/x-pem-file", body); w.Code != http.StatusAccepted {
+		t.Fatalf("POST /ingest = %d %s; want 202", w.Code, w.Body)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for mngr.stats.EntriesProcessed.Load() < 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("pushed certificate not processed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	src := mngr.Receiver.sources["acme"]
+	if src == nil || src.source.Source != "push:acme" || src.source.Stats.Parsed.Load() != 1 {
+		t.Errorf("push source after one certificate = %+v", src)
+	}
+	mngr.outCancel()
+	<-done
+}
+
+func TestServeIngestRejects(t *testing.T) {
+	mngr := newTestReceiverManager(t)
+	der := testReplayCert(t)
+	certPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	tests := []struct {
+		name        string
+		token       string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"no token", "", "application/x-pem-file", certPEM, http.StatusUnauthorized},
+		{"wrong token", "other", "application/x-pem-file", certPEM, http.StatusUnauthorized},
+		{"no PEM", testIngestToken, "application/x-pem-file", "hello", http.StatusBadRequest},
+		{"bad JSON", testIngestToken, "application/json", "{", http.StatusBadRequest},
+		{"bad base64", testIngestToken, "application/json", `{"certificate":"%%%"}`, http.StatusBadRequest},
+		{"bad source", testIngestToken, "application/json", `{"source":"a b","certificate":"` + strings.ReplaceAll(certPEM, "\n", `\n`) + `"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := postIngest(mngr, tt.token, tt.contentType, tt.body); w.Code != tt.want {
+				t.Errorf("POST /ingest = %d %s; want %d", w.Code, w.Body, tt.want)
+			}
+		})
+	}
+	select {
+	case e := <-mngr.Receiver.ch:
+		t.Errorf("rejected request queued %s #%d", e.Source.Source, e.Entry.Index)
+	default:
+	}
+}
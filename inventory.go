@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/certificate-transparency-go/loglist3"
+)
+
+/* Inventario de los logs monitorizados */
+
+// Qué logs (y shards) se están leyendo exactamente, con su estado en la
+// lista, su posición y su salud: la evidencia de cobertura que piden las
+// auditorías. Se sirve en /inventory y, con -inventory-file, se vuelca
+// periódicamente a un fichero.
+type InventoryReport struct {
+	GeneratedAt     time.Time          `json:"generated_at"`
+	Instance        string             `json:"instance"`
+	StartedAt       time.Time          `json:"started_at"`
+	LogLists        []InventoryLogList `json:"log_lists"`
+	MergePolicy     string             `json:"merge_policy,omitempty"`
+	OnlyLogs        []string           `json:"only_logs,omitempty"`
+	ExcludeLogs     []string           `json:"exclude_logs,omitempty"`
+	CheckpointStore string             `json:"checkpoint_store,omitempty"`
+	Logs            []InventoryLog     `json:"logs"`
+}
+
+// Lista de logs con la que se eligieron los monitorizados
+type InventoryLogList struct {
+	Name      string    `json:"name"`
+	URL       string    `json:"url,omitempty"` // vacía en la empaquetada (-offline)
+	Version   string    `json:"version,omitempty"`
+	Timestamp time.Time `json:"timestamp,omitzero"`
+}
+
+// Estados de un log en el inventario
+const (
+	InventoryStarting  = "starting"  // sin sondeos todavía
+	InventoryOK        = "ok"        // leyéndose
+	InventoryFailing   = "failing"   // falló el último sondeo
+	InventorySuspended = "suspended" // circuit breaker abierto
+	InventoryStandby   = "standby"   // lo lee otra instancia (concesión)
+)
+
+type InventoryLog struct {
+	URL            string    `json:"url"`
+	LogID          string    `json:"log_id"`
+	Description    string    `json:"description,omitempty"`
+	Operator       string    `json:"operator,omitempty"`
+	Lists          []string  `json:"lists"`
+	ListState      string    `json:"list_state,omitempty"`
+	ShardStart     time.Time `json:"shard_start,omitzero"`
+	ShardEnd       time.Time `json:"shard_end,omitzero"`
+	MMDSeconds     int64     `json:"mmd_seconds"`
+	Endpoints      []string  `json:"endpoints"`
+	Status         string    `json:"status"`
+	Error          string    `json:"error,omitempty"`
+	StatusSince    time.Time `json:"status_since,omitzero"`
+	TreeSize       uint64    `json:"tree_size"`
+	Position       uint64    `json:"position"`
+	Checkpoint     uint64    `json:"checkpoint,omitempty"` // con -checkpoint-store
+	Backlog        uint64    `json:"backlog"`              // entradas por leer hasta el último STH
+	LastFetchAt    time.Time `json:"last_fetch_at,omitzero"`
+	SuspendedUntil time.Time `json:"suspended_until,omitzero"`
+}
+
+func newInventoryLogList(name, url string, ll *loglist3.LogList) InventoryLogList {
+	return InventoryLogList{Name: name, URL: url, Version: ll.Version, Timestamp: ll.LogListTimestamp}
+}
+
+// "usable", "readonly"...; "" si la lista no da estado
+func logStatusName(state *loglist3.LogStates) string {
+	if s := state.LogStatus(); s != loglist3.UndefinedLogStatus {
+		return strings.ToLower(strings.TrimSuffix(s.String(), "LogStatus"))
+	}
+	return ""
+}
+
+func (mngr *CTLogsManager) InventoryReport() InventoryReport {
+	now := time.Now().UTC()
+	health := mngr.Health.Report()
+	r := InventoryReport{
+		GeneratedAt: now,
+		Instance:    mngr.InstanceID,
+		StartedAt:   mngr.stats.StartedAt,
+		LogLists:    mngr.loadedLists,
+		MergePolicy: mngr.MergePolicy,
+		OnlyLogs:    mngr.OnlyLogs,
+		ExcludeLogs: mngr.ExcludeLogs,
+		Logs:        make([]InventoryLog, 0, len(mngr.sources)),
+	}
+	if mngr.Checkpoints != nil {
+		r.CheckpointStore = mngr.Checkpoints.Name()
+	}
+	for i := range mngr.sources {
+		src := &mngr.sources[i]
+		s := src.Stats
+		l := InventoryLog{
+			URL:         src.Source,
+			LogID:       src.LogID,
+			Description: src.Description,
+			Operator:    src.Operator,
+			Lists:       src.Lists,
+			ListState:   src.ListState,
+			ShardStart:  src.ShardStart,
+			ShardEnd:    src.ShardEnd,
+			MMDSeconds:  int64(src.MMD.Seconds()),
+			Status:      InventoryOK,
+			TreeSize:    s.treeSize.Load(),
+			Position:    s.position.Load(),
+			Checkpoint:  s.checkpoint.Load(),
+		}
+		for _, ep := range src.Endpoints {
+			l.Endpoints = append(l.Endpoints, ep.URL)
+		}
+		if l.TreeSize > l.Position {
+			l.Backlog = l.TreeSize - l.Position
+		}
+		if t := s.lastFetchAt.Load(); t > 0 {
+			l.LastFetchAt = time.Unix(0, t).UTC()
+		}
+		if t := s.suspendedUntil.Load(); t > 0 {
+			l.SuspendedUntil = time.Unix(0, t).UTC()
+		}
+		c, polled := health.Components["log:"+src.Source]
+		if polled {
+			l.StatusSince = c.Since
+		}
+		switch {
+		case l.SuspendedUntil.After(now):
+			l.Status, l.Error = InventorySuspended, c.Error
+		case s.standby.Load():
+			l.Status = InventoryStandby
+		case !polled:
+			l.Status = InventoryStarting
+		case c.Status != HealthOK:
+			l.Status, l.Error = InventoryFailing, c.Error
+		}
+		r.Logs = append(r.Logs, l)
+	}
+	return r
+}
+
+// Escribe el inventario de forma atómica, para que quien lo recoja nunca
+// lea uno a medias
+func (r InventoryReport) WriteFile(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write inventory: %w", err)
+	}
+	return nil
+}
+
+// Vuelca el inventario al arrancar, cada intervalo y al parar
+func (mngr *CTLogsManager) runInventory(path string, interval time.Duration) {
+	defer mngr.wg.Done()
+	write := func() {
+		err := mngr.InventoryReport().WriteFile(path)
+		if mngr.Health.Set("inventory", false, err) && err != nil {
+			log.Printf("WARNING: %v", err)
+		}
+	}
+	write()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-mngr.context.Done():
+			write()
+			return
+		case <-ticker.C:
+			write()
+		}
+	}
+}
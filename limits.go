@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+/* Límites de tamaño de respuesta */
+
+const (
+	DefaultMaxResponseBytes = 64 << 20 // get-entries / get-sth
+	DefaultMaxLogListBytes  = 16 << 20 // log_list.json
+)
+
+// Limita el cuerpo de todas las respuestas de un cliente HTTP
+func withResponseLimit(c *http.Client, max int64) *http.Client {
+	lc := *c
+	base := c.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	lc.Transport = &limitTransport{base: base, max: max}
+	return &lc
+}
+
+type limitTransport struct {
+	base http.RoundTripper
+	max  int64
+}
+
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.ContentLength > t.max {
+		resp.Body.Close()
+		return nil, fmt.Errorf("response from %s too large: %d bytes (max %d)", req.URL.Host, resp.ContentLength, t.max)
+	}
+	resp.Body = &limitedBody{rc: resp.Body, remaining: t.max, max: t.max, host: req.URL.Host}
+	return resp, nil
+}
+
+// Devuelve error (en lugar de truncar en silencio) si se supera el límite
+type limitedBody struct {
+	rc        io.ReadCloser
+	remaining int64
+	max       int64
+	host      string
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		// Comprobar si queda algo más allá del límite
+		var one [1]byte
+		if n, _ := b.rc.Read(one[:]); n > 0 {
+			return 0, fmt.Errorf("response from %s exceeds %d bytes", b.host, b.max)
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.rc.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+func (b *limitedBody) Close() error { return b.rc.Close() }
+
+// Lectura acotada para cuerpos leídos directamente
+func readLimited(r io.Reader, max int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > max {
+		return nil, fmt.Errorf("body exceeds %d bytes", max)
+	}
+	return data, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+/* Idioma de las notificaciones */
+
+const defaultLocale Locale = "en"
+
+// Idioma de un sink. Los textos fijos del código están en inglés y son la
+// clave del catálogo; lo que no está traducido (o no cambia, como Tag o Log)
+// sale tal cual.
+type Locale string
+
+var notifyCatalog = map[Locale]map[string]string{
+	"es": {
+		// Títulos
+		"[%s] certificate for %s": "[%s] certificado para %s",
+		"Certificate for %s":      "Certificado para %s",
+		"gCTWatch heartbeat: %s":  "Latido de gCTWatch: %s",
+		"all matches":             "todas las coincidencias",
+		// Campos
+		"Names":       "Nombres",
+		"Issuer":      "Emisor",
+		"Valid":       "Validez",
+		"Fingerprint": "Huella",
+		"Severity":    "Severidad",
+		"Rule":        "Regla",
+		"Revocation":  "Revocación",
+		"Zone":        "Zona",
+		"Issuance":    "Emisión",
+		"Score":       "Puntuación",
+		"Instance":    "Instancia",
+		"Uptime":      "Tiempo activo",
+		"Sources":     "Fuentes",
+		"Matches":     "Coincidencias",
+		"Event":       "Evento",
+		"Source":      "Origen",
+		"Details":     "Detalles",
+		"Suppressed":  "Suprimidas",
+		// Frases
+		"%d alerts over the rate limit since the last message": "%d alertas por encima del límite desde el último mensaje",
+		"%s in .%s":                 "%s en .%s",
+		"matches":                   "coincidencias",
+		"%d matches from %s to %s.": "%d coincidencias del %s al %s.",
+	},
+}
+
+var notifyLocales = []Locale{"en", "es"}
+
+func (l Locale) T(s string) string {
+	if t, ok := notifyCatalog[l][s]; ok {
+		return t
+	}
+	return s
+}
+
+func (l Locale) Sprintf(format string, args ...any) string {
+	return fmt.Sprintf(l.T(format), args...)
+}
+
+// Funciones de las plantillas de correo: t traduce, label da el nombre de un
+// campo con los dos puntos y alineado, y locale devuelve el idioma del sink
+func (l Locale) templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"t":      l.T,
+		"label":  func(s string) string { return fmt.Sprintf("%-13s", l.T(s)+":") },
+		"locale": func() string { return string(l) },
+	}
+}
+
+// Sinks cuyos mensajes dependen del idioma
+type LocalizedSink interface {
+	SetLocale(l Locale)
+}
+
+// -notify-locale: un idioma por defecto y, por sink, sink=idioma. El sink se
+// indica por nombre (slack:soc, email:smtp.example:587) o por tipo (slack).
+type NotifyLocales struct {
+	Default Locale
+	BySink  map[string]Locale
+}
+
+func ParseNotifyLocales(spec string) (NotifyLocales, error) {
+	nl := NotifyLocales{Default: defaultLocale, BySink: make(map[string]Locale)}
+	for _, item := range splitList(spec) {
+		sink, l, ok := strings.Cut(item, "=")
+		if !ok {
+			sink, l = "", item
+		}
+		if !slices.Contains(notifyLocales, Locale(l)) {
+			return nl, fmt.Errorf("unknown notification locale %q (en, es)", l)
+		}
+		if sink == "" {
+			nl.Default = Locale(l)
+		} else {
+			nl.BySink[sink] = Locale(l)
+		}
+	}
+	return nl, nil
+}
+
+// Idioma de un sink: por nombre, luego por tipo y si no el de por defecto
+func (nl NotifyLocales) For(name string) Locale {
+	if l, ok := nl.BySink[name]; ok {
+		return l
+	}
+	kind, _, _ := strings.Cut(name, ":")
+	if l, ok := nl.BySink[kind]; ok {
+		return l
+	}
+	return nl.Default
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+/* Credenciales HTTP de logs privados (-log-credentials) */
+
+// Credenciales de un log, por URL (la de -extra-logs o la de una réplica de
+// -log-mirrors: cada réplica lleva las suyas, no hereda las del log). Los secretos se leen de ficheros, como los demás tokens
+// (secretos de Kubernetes o Docker, /run/secrets...), al arrancar.
+type LogCredentialConfig struct {
+	User         string `json:"user,omitempty"` // autenticación básica, con password_file
+	PasswordFile string `json:"password_file,omitempty"`
+	TokenFile    string `json:"token_file,omitempty"`  // Authorization: Bearer
+	ClientCert   string `json:"client_cert,omitempty"` // mTLS: certificado y clave en PEM
+	ClientKey    string `json:"client_key,omitempty"`
+	CAFile       string `json:"ca_file,omitempty"` // CA del log si no es pública
+}
+
+type logCredentials struct {
+	host          string
+	authorization string      // "" = sin cabecera
+	tls           *tls.Config // nil = la por defecto
+
+	once   sync.Once
+	client *http.Client
+}
+
+// Fichero JSON {"https://ct.example/log/": {...}, ...}
+func LoadLogCredentials(path string) (map[string]*logCredentials, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]LogCredentialConfig
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse log credentials %s: %w", path, err)
+	}
+	out := make(map[string]*logCredentials, len(raw))
+	for logURL, c := range raw {
+		creds, err := c.load(logURL)
+		if err != nil {
+			return nil, fmt.Errorf("log credentials for %s: %w", logURL, err)
+		}
+		out[normalizeLogURL(logURL)] = creds
+	}
+	return out, nil
+}
+
+func (c LogCredentialConfig) load(logURL string) (*logCredentials, error) {
+	u, err := url.Parse(logURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid log URL")
+	}
+	creds := &logCredentials{host: u.Host}
+	switch {
+	case c.TokenFile != "" && (c.User != "" || c.PasswordFile != ""):
+		return nil, fmt.Errorf("token_file cannot be combined with user and password_file")
+	case c.TokenFile != "":
+		token, err := readSecretFile(c.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		creds.authorization = "Bearer " + token
+	case c.User != "" || c.PasswordFile != "":
+		if c.User == "" || c.PasswordFile == "" {
+			return nil, fmt.Errorf("basic authentication needs user and password_file")
+		}
+		password, err := readSecretFile(c.PasswordFile)
+		if err != nil {
+			return nil, err
+		}
+		creds.authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(c.User+":"+password))
+	}
+	if creds.authorization != "" && u.Scheme != "https" {
+		return nil, fmt.Errorf("credentials require an https URL")
+	}
+	if c.ClientCert != "" || c.ClientKey != "" || c.CAFile != "" {
+		creds.tls = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if c.ClientCert != "" || c.ClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(c.ClientCert, c.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		creds.tls.Certificates = []tls.Certificate{cert}
+	}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA: %w", err)
+		}
+		creds.tls.RootCAs = x509.NewCertPool()
+		if !creds.tls.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in CA %s", c.CAFile)
+		}
+	}
+	if creds.authorization == "" && creds.tls == nil {
+		return nil, fmt.Errorf("no credentials (token_file, user and password_file, or client_cert and client_key)")
+	}
+	return creds, nil
+}
+
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret: %w", err)
+	}
+	secret := strings.TrimSpace(string(data))
+	if secret == "" {
+		return "", fmt.Errorf("empty secret in %s", path)
+	}
+	return secret, nil
+}
+
+// Cliente de logs con las credenciales; se crea una vez por log
+func (c *logCredentials) httpClient(network *Network, maxResponse int64) *http.Client {
+	c.once.Do(func() {
+		client := network.TLSClient(c.tls)
+		if c.authorization != "" {
+			client.Transport = &authTransport{base: client.Transport, host: c.host, authorization: c.authorization}
+		}
+		c.client = withResponseLimit(client, maxResponse)
+	})
+	return c.client
+}
+
+// Añade Authorization solo a las peticiones al host del log: una
+// redirección a otro host no se lleva las credenciales
+type authTransport struct {
+	base          http.RoundTripper
+	host          string
+	authorization string
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != t.host || req.URL.Scheme != "https" {
+		return t.base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", t.authorization)
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+/* Circuit breaker por log */
+
+var metricLogSuspended = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "gctwatch_log_suspended",
+	Help: "1 si el log está suspendido por fallos seguidos.",
+}, []string{"log"})
+
+// Un log que falla Threshold sondeos seguidos deja de sondearse durante
+// Cooldown. Pasado ese tiempo se prueba un sondeo: si vuelve a fallar se
+// suspende otra vez y, si no, se reanuda con normalidad. Así un log caído o
+// retirado no gasta una petición en cada intervalo de sondeo.
+type SourceBreaker struct {
+	Threshold int           // sondeos fallidos seguidos; 0 desactiva
+	Cooldown  time.Duration // tiempo suspendido antes de probar de nuevo
+}
+
+var DefaultSourceBreaker = SourceBreaker{Threshold: 60, Cooldown: 30 * time.Minute}
+
+// Indica si toca sondear la fuente
+func (b *SourceBreaker) Allow(source *CTLogSource) bool {
+	return b == nil || !time.Now().Before(source.suspendedUntil)
+}
+
+// Resultado de un sondeo; suspende o reanuda la fuente al cruzar el umbral.
+// weight es lo que cuenta el error según su categoría (0 = no cuenta).
+func (mngr *CTLogsManager) recordSourceResult(source *CTLogSource, err error, weight int) {
+	b := mngr.Breaker
+	if b == nil || b.Threshold <= 0 || (err != nil && weight == 0) {
+		return
+	}
+	suspended := !source.suspendedUntil.IsZero()
+	if err == nil {
+		source.failures = 0
+		if suspended {
+			source.suspendedUntil = time.Time{}
+			source.Stats.suspendedUntil.Store(0)
+			metricLogSuspended.WithLabelValues(source.Source).Set(0)
+			log.Printf("log %s: resumed after suspension", source.Source)
+			mngr.Events.Publish("log_resumed", source.Source, "log %s polled again after suspension", source.Source)
+		}
+		return
+	}
+	source.failures += weight
+	if source.failures < b.Threshold && !suspended {
+		return
+	}
+	// Al llegar al umbral o si falla la prueba tras la suspensión
+	source.suspendedUntil = time.Now().Add(b.Cooldown)
+	source.Stats.suspendedUntil.Store(source.suspendedUntil.UnixNano())
+	metricLogSuspended.WithLabelValues(source.Source).Set(1)
+	if !suspended {
+		log.Printf("WARNING: log %s suspended for %s after %d consecutive failures: %v", source.Source, b.Cooldown, source.failures, err)
+		mngr.Events.Publish("log_suspended", source.Source, "log %s suspended for %s after %d consecutive failures: %v", source.Source, b.Cooldown, source.failures, err)
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	_ "embed"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/certificate-transparency-go/loglist3"
+)
+
+/* Lista de logs: descarga, firma y caché */
+
+// Clave con la que Google firma la lista v3
+const LogListPubKeyURL = "https://www.gstatic.com/ct/log_list/v3/log_list_pubkey.pem"
+
+// La misma clave, empaquetada en el binario. Se actualiza con "make
+// loglist-key", que solo la instala si coincide con la huella fijada en
+// LOGLIST_KEY_SHA256; la compilación nunca la descarga.
+//
+//go:embed snapshot/log_list_pubkey.pem
+var bundledLogListKey []byte
+
+// URL de la firma asociada a una lista (log_list.json -> log_list.sig)
+func logListSigURL(listURL string) string {
+	return strings.TrimSuffix(listURL, ".json") + ".sig"
+}
+
+// Lista de logs configurada
+type LogListSource struct {
+	Name  string
+	URL   string
+	Key   crypto.PublicKey // nil = sin verificación de firma
+	Cache string           // "" desactiva la caché
+}
+
+// Políticas de combinación de varias listas
+const (
+	MergeUnion        = "union"        // cualquier log de cualquier lista; estado de la primera que lo contiene
+	MergeIntersection = "intersection" // solo logs presentes en todas las listas
+	MergeStrictest    = "strictest"    // unión, pero inusable si alguna lista lo marca retirado/rechazado
+)
+
+// Log candidato tras combinar las listas
+type logCandidate struct {
+	id             string
+	url            string
+	desc           string
+	operator       string
+	state          *loglist3.LogStates
+	startInclusive time.Time // intervalo de los logs por shards
+	endExclusive   time.Time
+	mmd            int32
+	lists          []string // listas en las que aparece
+	rejectedBy     []string // listas que lo marcan retirado/rechazado
+}
+
+func checkMergePolicy(p string) error {
+	switch p {
+	case MergeUnion, MergeIntersection, MergeStrictest:
+		return nil
+	}
+	return fmt.Errorf("unknown log list merge policy %q (union, intersection, strictest)", p)
+}
+
+// Combina las listas según la política
+func mergeLogLists(names []string, lists []*loglist3.LogList, policy string) []*logCandidate {
+	var order []*logCandidate
+	byID := make(map[string]*logCandidate)
+	add := func(list, operator string, id []byte, url, desc string, state *loglist3.LogStates, ti *loglist3.TemporalInterval, mmd int32) {
+		key := base64.StdEncoding.EncodeToString(id)
+		if len(id) == 0 {
+			key = strings.TrimSuffix(url, "/")
+		}
+		c, ok := byID[key]
+		if !ok {
+			c = &logCandidate{id: key, url: url, desc: desc, operator: operator, state: state, mmd: mmd}
+			if ti != nil {
+				c.startInclusive, c.endExclusive = ti.StartInclusive, ti.EndExclusive
+			}
+			byID[key] = c
+			order = append(order, c)
+		}
+		c.lists = append(c.lists, list)
+		if state != nil && (state.LogStatus() == loglist3.RetiredLogStatus || state.LogStatus() == loglist3.RejectedLogStatus) {
+			c.rejectedBy = append(c.rejectedBy, list)
+		}
+	}
+	for i, ll := range lists {
+		for _, operator := range ll.Operators {
+			for _, log := range operator.Logs {
+				add(names[i], operator.Name, log.LogID, log.URL, log.Description, log.State, log.TemporalInterval, log.MMD)
+			}
+			for _, log := range operator.TiledLogs {
+				add(names[i], operator.Name, log.LogID, log.MonitoringURL, log.Description, log.State, log.TemporalInterval, log.MMD)
+			}
+		}
+	}
+	var out []*logCandidate
+	for _, c := range order {
+		if policy == MergeIntersection && len(c.lists) != len(lists) {
+			continue
+		}
+		if len(c.lists) > 1 && len(c.rejectedBy) > 0 && len(c.rejectedBy) < len(c.lists) {
+			log.Printf("WARNING: log lists disagree on state of %s (rejected/retired in %v)", c.desc, c.rejectedBy)
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// Ruta por defecto de la caché de la lista
+func defaultLogListCache() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "gCTWatch", "log_list.json")
+}
+
+// Carga una clave pública PEM (PKIX)
+func loadPublicKey(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parsePublicKeyPEM(data)
+}
+
+// Clave de la lista principal: la de -loglist-pubkey o, sin él, la empaquetada
+func loadLogListKey(path string) (crypto.PublicKey, error) {
+	if path != "" {
+		return loadPublicKey(path)
+	}
+	if len(bytes.TrimSpace(bundledLogListKey)) == 0 {
+		return nil, fmt.Errorf("no log list key bundled in this build")
+	}
+	return parsePublicKeyPEM(bundledLogListKey)
+}
+
+func parsePublicKeyPEM(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// GET acotado en tiempo y tamaño
+func (mngr *CTLogsManager) download(url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(mngr.context, mngr.LogListTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := mngr.network.Client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: HTTP %d", url, resp.StatusCode)
+	}
+	return readLimited(resp.Body, mngr.MaxLogListBytes)
+}
+
+// Descarga lista y, si hay clave configurada, su firma
+func (mngr *CTLogsManager) downloadLogList(src *LogListSource) (list, sig []byte, err error) {
+	list, err = mngr.download(src.URL)
+	if err != nil {
+		return nil, nil, err
+	}
+	if src.Key != nil {
+		sig, err = mngr.download(logListSigURL(src.URL))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to fetch log list signature: %w", err)
+		}
+	}
+	return list, sig, nil
+}
+
+// Verifica la firma de la lista con el proveedor criptográfico
+func (mngr *CTLogsManager) verifyLogList(src *LogListSource, list, sig []byte) error {
+	if src.Key == nil {
+		return nil
+	}
+	if len(sig) == 0 {
+		return fmt.Errorf("log list signature missing")
+	}
+	if err := cryptoProvider.Verify(src.Key, list, sig); err != nil {
+		return fmt.Errorf("log list signature invalid: %w", err)
+	}
+	return nil
+}
+
+// Guarda la última lista válida (y su firma) en disco
+func saveLogListCache(src *LogListSource, list, sig []byte) error {
+	if src.Cache == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(src.Cache), 0o755); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(src.Cache, list); err != nil {
+		return err
+	}
+	if len(sig) > 0 {
+		return writeFileAtomic(src.Cache+".sig", sig)
+	}
+	return nil
+}
+
+func loadLogListCache(src *LogListSource) (list, sig []byte, err error) {
+	if src.Cache == "" {
+		return nil, nil, fmt.Errorf("no log list cache configured")
+	}
+	list, err = os.ReadFile(src.Cache)
+	if err != nil {
+		return nil, nil, err
+	}
+	sig, _ = os.ReadFile(src.Cache + ".sig")
+	return list, sig, nil
+}
+
+// Escritura con rename para no dejar ficheros a medias
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Aplica -only-logs y -exclude-logs a los candidatos
+func (mngr *CTLogsManager) filterLogs(candidates []*logCandidate) []*logCandidate {
+	if len(mngr.OnlyLogs) == 0 && len(mngr.ExcludeLogs) == 0 {
+		return candidates
+	}
+	var out []*logCandidate
+	for _, c := range candidates {
+		if mngr.logSelected(c.url) {
+			out = append(out, c)
+		}
+	}
+	log.Printf("log filters: %d of %d logs selected", len(out), len(candidates))
+	return out
+}
+
+func (mngr *CTLogsManager) logSelected(url string) bool {
+	contains := func(subs []string) bool {
+		for _, s := range subs {
+			if strings.Contains(url, s) {
+				return true
+			}
+		}
+		return false
+	}
+	return (len(mngr.OnlyLogs) == 0 || contains(mngr.OnlyLogs)) && !contains(mngr.ExcludeLogs)
+}
@@ -1,164 +1,1633 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"crypto/x509"
-	"encoding/json"
 	"flag"
+	"log"
+	"math"
 	"os"
-	"regexp"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
 
 	"fmt"
-	"io"
 	"net/http"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	CertTransp "github.com/google/certificate-transparency-go"
-	"github.com/google/certificate-transparency-go/client"
-	"github.com/google/certificate-transparency-go/jsonclient"
 	"github.com/google/certificate-transparency-go/loglist3"
 )
 
 // Gestion de fuentes y logs
 type CTLogSource struct {
-	Source     string
-	Client     *client.LogClient
-	LastSize   uint64
-	WindowSize uint64
+	Source         string
+	Lists          []string // listas de logs en las que aparece
+	LogID          string   // base64; la URL en los de -extra-logs
+	Description    string
+	Operator       string
+	ListState      string    // estado en la lista: usable, qualified, readonly... ("" fuera de lista)
+	ShardStart     time.Time // intervalo temporal de los logs por shards; cero sin él
+	ShardEnd       time.Time
+	Endpoints      []*LogEndpoint // URL oficial y réplicas; se usa la más rápida sana
+	LastSize       uint64
+	WindowSize     uint64
+	MMD            time.Duration // retraso máximo de integración declarado
+	polls          int
+	Stats          *FetchStats
+	owned          bool // checkpoint cargado (y concesión obtenida si el almacén es compartido)
+	acked          checkpointTracker
+	saved          uint64    // última posición guardada en el almacén
+	failures       int       // sondeos fallidos seguidos
+	suspendedUntil time.Time // circuit breaker abierto hasta entonces
+	retryAt        time.Time // no se sondea antes (política del último error)
+	ageState       string    // "", mmd_exceeded o reader_behind (checkEntryAge)
+	retryKind      FetchErrorKind
+	retries        int    // fallos seguidos de retryKind
+	malformedAt    uint64 // entrada que el log sirve mal
+	malformedTries int    // lecturas seguidas en las que ha fallado
 }
 
 type CTLogsManager struct {
-	logListURL   string
-	sources      []CTLogSource
-	filtering    map[string]*regexp.Regexp
-	context      context.Context
-	cancel       context.CancelFunc
-	PollInterval time.Duration
-	OutputChan   chan CertTransp.LogEntry
-	wg           sync.WaitGroup
+	LogLists           []*LogListSource // la primera es la principal
+	MergePolicy        string
+	Offline            bool                       // usar la lista empaquetada, sin descargas
+	ExtraLogs          []string                   // URLs de logs añadidos a mano
+	OnlyLogs           []string                   // subcadenas de URL; vacío = todos
+	ExcludeLogs        []string                   // subcadenas de URL a omitir
+	LogMirrors         map[string][]string        // URL de log -> URLs alternativas
+	LogCredentials     map[string]*logCredentials // URL de log o réplica -> credenciales HTTP
+	sources            []CTLogSource
+	loadedLists        []InventoryLogList // listas con las que se eligieron los logs
+	rules              RegexRules         // todas las reglas, con su estado
+	filtering          map[string]*Rule   // activas
+	shadowing          map[string]*Rule   // draft y las de -shadow-rules
+	ruleStates         map[string]string  // último estado registrado por tag
+	MatchSubjectDN     bool               // reglas name: probar también el DN completo del sujeto
+	shadowRules        RegexRules
+	RuleEngine         string      // -match-engine; "" = solo regexp
+	ruleFilter         *ruleFilter // nil = se prueban todas las regexp
+	rulesMu            sync.RWMutex
+	RemoteRules        *RemoteRules    // nil = solo reglas locales
+	context            context.Context // captura: se cancela al parar
+	cancel             context.CancelFunc
+	outCtx             context.Context // tratamiento: sigue hasta vaciar OutputChan
+	outCancel          context.CancelFunc
+	ShutdownTimeout    time.Duration // plazo para vaciar la cola al parar
+	httpClient         *http.Client
+	logHTTPClient      *http.Client // con límite de tamaño de respuesta
+	network            *Network
+	PollInterval       time.Duration
+	Workers            int // consumidores de OutputChan
+	MaxResponseBytes   int64
+	MaxLogListBytes    int64
+	LogListTimeout     time.Duration
+	OutputChan         chan SourcedEntry
+	Sinks              []Sink
+	SinkOptions        map[string]SinkOptions // por tipo de sink
+	dispatchers        []*sinkDispatcher
+	Health             *Health
+	Router             *Router    // nil = todos los eventos a todos los sinks
+	Feed               *feedSink  // feeds RSS/Atom del servidor de administración
+	Matches            MatchStore // histórico consultable en /matches; nil = sin histórico
+	FPSuggestThreshold int        // falsos positivos de un dominio para sugerir suprimirlo (0 = nunca)
+	matchesDispatcher  *sinkDispatcher
+	Maintenance        *Maintenance
+	Bandwidth          *Bandwidth
+	Clock              *ClockCheck
+	Enrichers          []enricherConfig
+	Dedup              *Dedup            // nil = sin deduplicación
+	Sampling           Sampler           // fracción entregada por tag
+	Redactor           *Redactor         // nil = sin redacción
+	Checkpoints        CheckpointStore   // nil = posiciones solo en memoria
+	Backpressure       string            // con OutputChan lleno: drop, block o spill
+	Spill              *SpillQueue       // cola en disco de la política spill
+	Throttle           *EmitThrottle     // nil = sin límite de entrega
+	Archive            EntryArchive      // nil = no se guardan las entradas leídas
+	Receiver           *Receiver         // nil = sin POST /ingest
+	AdminToken         string            // bearer de las rutas que modifican estado; "" = rechazadas
+	Issuance           *issuanceEnricher // registra las emisiones recibidas en /ingest
+	CanaryAudit        *CanaryAudit      // nil = sin registro de los disparos canario
+	Scorer             Scorer            // nil = sin puntuación
+	Script             *LuaScript        // nil = sin -lua-script
+	Plugins            []*Plugin         // sus sinks están en Sinks
+	DataDir            *DataDir          // nil = no se usa; mantiene el lock
+	InstanceID         string            // -instance-id: concesiones e inventario
+	LeaseTTL           time.Duration
+	InitConcurrency    int               // logs inicializados a la vez
+	InitTimeout        time.Duration     // plazo global de inicialización
+	WindowSize         uint64            // ventana inicial de get-entries
+	Window             *WindowController // nil = ventana fija
+	Breaker            *SourceBreaker    // nil = se sondean siempre
+	HeartbeatEvery     time.Duration     // 0 desactiva
+	HeartbeatRoute     []string          // tipos o nombres de sink; vacío = todos
+	InventoryFile      string            // "" = inventario solo en /inventory
+	InventoryEvery     time.Duration
+	CoverageEvery      time.Duration // 0 = solo se comprueba al arrancar
+	coverage           coverageState
+	Events             *EventBus // eventos operacionales; nil = desactivados
+	eventsWG           sync.WaitGroup
+	stats              Stats
+	wg                 sync.WaitGroup
+	outWG              sync.WaitGroup // consumidores de OutputChan
 }
 
-type RegexConfig map[string]string        // categoría -> expresión regular
-type RegexRules map[string]*regexp.Regexp // compiladas
+type RegexConfig map[string]RuleConfig // categoría -> expresión regular (y estado)
+type RegexRules map[string]*Rule       // compiladas
 
 // Punto de entrada
 func main() {
 
+	var configFile = flag.String("config", "", "Fichero de configuración YAML o JSON con los valores de los flags; los de la línea de comandos tienen prioridad")
 	var rulesFile = flag.String("rules", "rules.json", "Ruta al fichero JSON con las reglas de regex")
-	rules, err := LoadRules(*rulesFile)
+	var shadowRules = flag.String("shadow-rules", "", "Fichero JSON con reglas en evaluación: sus coincidencias solo se cuentan y se guardan en el histórico, nunca se notifican")
+	var matchSubjectDN = flag.Bool("match-subject-dn", false, "Aplica las reglas de tipo name también al DN completo del sujeto (p.ej. CN=...,O=...), además del CN y los SAN DNS")
+	var matchEngine = flag.String("match-engine", "", "Motor que preselecciona las reglas de regex recorriendo cada nombre una vez: hyperscan (compilado con -tags hyperscan); vacío = se prueba cada regexp")
+	var rulesURL = flag.String("rules-url", "", "Servicio remoto de reglas (REST con long polling); el fichero de -rules queda como respaldo")
+	var rulesTokenFile = flag.String("rules-token-file", "", "Fichero con el token bearer del servicio de reglas")
+	var rulesPubKey = flag.String("rules-pubkey", "", "Clave pública (minisign o PEM) con la que deben estar firmadas las reglas y el enrutado")
+	var strictEgress = flag.Bool("strict-egress", false, "Solo permite conexiones a los hosts de -allow-hosts")
+	var allowHosts = flag.String("allow-hosts", "", "Hosts permitidos en modo estricto, separados por comas (admite *.dominio)")
+	var ipFamily = flag.String("ip-family", FamilyAuto, "Familia de direcciones para los logs: auto, ipv4 o ipv6")
+	var hostFamily = flag.String("host-ip-family", "", "Familia por host, p.ej. ct.googleapis.com=ipv6,oak.ct.letsencrypt.org=ipv4")
+	var eyeballsDelay = flag.Duration("happy-eyeballs-delay", 300*time.Millisecond, "Espera antes de probar la otra familia (negativo desactiva)")
+	var dohURL = flag.String("doh", "", "URL de un resolver DNS sobre HTTPS, p.ej. https://1.1.1.1/dns-query")
+	var maxResponse = flag.Int64("max-response-bytes", DefaultMaxResponseBytes, "Tamaño máximo de una respuesta get-entries/get-sth")
+	var logListURL = flag.String("loglist-url", loglist3.LogListURL, "URL de la lista de logs principal")
+	var pollInterval = flag.Duration("poll-interval", 5*time.Second, "Intervalo de sondeo de los logs al día")
+	var logBreakerFailures = flag.Int("log-breaker-failures", DefaultSourceBreaker.Threshold, "Sondeos fallidos seguidos tras los que un log deja de sondearse (0 desactiva)")
+	var logBreakerCooldown = flag.Duration("log-breaker-cooldown", DefaultSourceBreaker.Cooldown, "Tiempo que un log suspendido pasa sin sondearse antes de probarlo de nuevo")
+	var bufferSize = flag.Int("buffer-size", 1000, "Entradas en cola entre la lectura de los logs y el filtrado")
+	var workers = flag.Int("workers", 5, "Workers que parsean y filtran las entradas")
+	var logListTimeout = flag.Duration("loglist-timeout", 30*time.Second, "Timeout de descarga de la lista de logs")
+	var logListCache = flag.String("loglist-cache", defaultLogListCache(), "Caché en disco de la última lista de logs válida (vacío desactiva)")
+	var logListKey = flag.String("loglist-pubkey", "", "Clave pública PEM para verificar log_list.sig en lugar de la empaquetada")
+	var extraLogLists = flag.String("extra-loglists", "", "Listas de logs adicionales, nombre=url separadas por comas (p.ej. apple=https://valid.apple.com/ct/log_list/current_log_list.json)")
+	var extraLogListKeys = flag.String("extra-loglist-keys", "", "Claves PEM de las listas adicionales, nombre=fichero separadas por comas")
+	var mergePolicy = flag.String("loglist-merge", MergeUnion, "Combinación de listas: union, intersection o strictest")
+	var offline = flag.Bool("offline", false, "No descarga la lista de logs, usa la copia empaquetada en el binario")
+	var selectLogs = flag.Bool("select", false, "Muestra los logs utilizables con su tamaño y pregunta cuáles monitorizar en esta ejecución")
+	var onlyLogs = flag.String("only-logs", "", "Solo monitoriza los logs cuya URL contiene alguna de estas subcadenas, separadas por comas")
+	var excludeLogs = flag.String("exclude-logs", "", "Omite los logs cuya URL contiene alguna de estas subcadenas, separadas por comas")
+	var extraLogs = flag.String("extra-logs", "", "URLs de logs adicionales a monitorizar, separadas por comas")
+	var logCredentials = flag.String("log-credentials", "", "Fichero JSON con credenciales HTTP (bearer, básica o certificado de cliente) por URL de log o réplica, para logs privados")
+	var logMirrors = flag.String("log-mirrors", "", "URLs alternativas por log, url=alt1|alt2 separadas por comas; se usa la más rápida que responda")
+	var bandwidthCap = flag.String("bandwidth-daily-cap", "", "Límite diario de descarga de los logs (p.ej. 50GB); al superarlo se pausa el tráfico de baja prioridad")
+	var lowPriorityLogs = flag.String("low-priority-logs", "", "Subcadenas de URL de logs de baja prioridad, separadas por comas")
+	var skewTolerance = flag.Duration("clock-skew-tolerance", DefaultClockSkewTolerance, "Desfase de reloj tolerado frente a los timestamps de los logs")
+	var ntpServer = flag.String("ntp-server", "", "Servidor NTP con el que comprobar el reloj local al arrancar, p.ej. pool.ntp.org")
+	var insecureLogList = flag.Bool("insecure-loglist", false, "Acepta la lista de logs sin verificar su firma")
+	var printSchema = flag.Bool("print-schema", false, "Imprime el JSON Schema de los eventos y sale")
+	var verifyLogList = flag.String("verify-log-list", "", "Comprueba la firma (<fichero>.sig) de un fichero de lista de logs con la clave de la lista principal y sale")
+	var toStdout = flag.Bool("stdout", true, "Escribe los eventos en la salida estándar")
+	var outputFile = flag.String("output-file", "", "Fichero JSON lines al que añadir los eventos")
+	var outputCompress = flag.String("output-file-compress", CompressNone, "Compresión del fichero de salida: none, gzip o zstd")
+	var webhookURL = flag.String("webhook-url", "", "URLs a las que enviar por POST cada evento en JSON, separadas por comas")
+	var webhookTmpl = flag.String("webhook-template", "", "Plantilla del payload de cada webhook (flat, zapier, ifttt o fichero text/template), separadas por comas en el orden de -webhook-url; una sola se aplica a todos")
+	var webhookSecret = flag.String("webhook-secret-file", "", "Fichero con el secreto compartido con el que se firman (HMAC-SHA256) los webhooks")
+	var webhookCompress = flag.String("webhook-compress", CompressNone, "Compresión del cuerpo de los webhooks: none, gzip o zstd")
+	var matrixHomeserver = flag.String("matrix-homeserver", "", "URL del homeserver de Matrix, p.ej. https://matrix.org")
+	var matrixRoom = flag.String("matrix-room", "", "ID de la sala de Matrix a la que notificar (!sala:servidor)")
+	var matrixToken = flag.String("matrix-token-file", "", "Fichero con el token de acceso del usuario de Matrix")
+	var teamsURL = flag.String("teams-webhook-url", "", "URL del incoming webhook de Microsoft Teams")
+	var slackWebhooks = flag.String("slack-webhooks", "", "Canales de Slack, canal=URL del incoming webhook separados por comas")
+	var discordWebhooks = flag.String("discord-webhooks", "", "Canales de Discord, canal=URL del webhook separados por comas")
+	var telegramToken = flag.String("telegram-token-file", "", "Fichero con el token del bot de Telegram")
+	var telegramChats = flag.String("telegram-chats", "", "Chats de Telegram, canal=ID del chat (o @canal) separados por comas")
+	var chatTags = flag.String("chat-tags", "", "Tags por canal de chat, slack:canal=tag1|tag2 separados por comas; los canales sin entrada reciben todos")
+	var queueEncoding = flag.String("queue-encoding", "json", "Codificación de los mensajes en los sinks de colas: json, protobuf o avro")
+	var schemaRegistry = flag.String("schema-registry-url", "", "URL de un Schema Registry compatible con Confluent en el que registrar el esquema de los sinks de colas")
+	var natsURL = flag.String("nats-url", "", "Servidores NATS (nats://host:4222, tls://...), separados por comas; publica los eventos en JetStream")
+	var natsSubject = flag.String("nats-subject", defaultNATSSubject, "Subject de cada evento; {kind} y {tag} se sustituyen")
+	var natsStream = flag.String("nats-stream", defaultNATSStream, "Stream de JetStream que recibe los eventos (se crea si no existe)")
+	var natsCreds = flag.String("nats-creds-file", "", "Fichero de credenciales NATS (JWT + NKey)")
+	var natsCA = flag.String("nats-ca-file", "", "CA (PEM) con la que verificar los servidores NATS")
+	var redisSinkURL = flag.String("redis-sink-url", "", "Redis (redis://, rediss://) al que enviar los eventos con -redis-channel y/o -redis-stream")
+	var redisChannel = flag.String("redis-channel", "", "Canal pub/sub en el que publicar cada evento; {kind} y {tag} se sustituyen")
+	var redisStream = flag.String("redis-stream", "", "Stream de Redis al que añadir cada evento (XADD)")
+	var redisStreamMaxLen = flag.Int64("redis-stream-maxlen", defaultRedisStreamMaxLen, "Eventos que conserva el stream de Redis, aproximado (0 = sin recorte)")
+	var mqttURL = flag.String("mqtt-url", "", "Broker MQTT (mqtt://host:1883, mqtts://host:8883) en el que publicar los eventos")
+	var mqttTopic = flag.String("mqtt-topic", defaultMQTTTopic, "Topic de cada evento; {kind} y {tag} se sustituyen")
+	var mqttQoS = flag.Int("mqtt-qos", 1, "QoS de las publicaciones MQTT: 0, 1 o 2")
+	var mqttUser = flag.String("mqtt-user", "", "Usuario del broker MQTT")
+	var mqttPassword = flag.String("mqtt-password-file", "", "Fichero con la contraseña del broker MQTT")
+	var mqttCA = flag.String("mqtt-ca-file", "", "CA (PEM) con la que verificar el broker MQTT en mqtts://")
+	var sqsQueueURL = flag.String("sqs-queue-url", "", "URL de la cola SQS a la que enviar los eventos (https://sqs.<región>.amazonaws.com/<cuenta>/<cola>)")
+	var snsTopicARN = flag.String("sns-topic-arn", "", "ARN del topic SNS en el que publicar los eventos")
+	var awsRegion = flag.String("aws-region", "", "Región de AWS de la cola SQS si no se deduce de su URL (endpoints de VPC)")
+	var smtpAddr = flag.String("smtp-addr", "", "Servidor SMTP (host[:puerto]) al que enviar las coincidencias por correo")
+	var smtpTLS = flag.String("smtp-tls", "starttls", "TLS con el servidor SMTP: starttls (puerto 587), tls (implícito, 465) o none (relay local, 25)")
+	var smtpCA = flag.String("smtp-ca-file", "", "CA (PEM) con la que verificar el servidor SMTP en lugar de las del sistema")
+	var smtpUser = flag.String("smtp-user", "", "Usuario SMTP (AUTH PLAIN); vacío = sin autenticación")
+	var smtpPassword = flag.String("smtp-password-file", "", "Fichero con la contraseña SMTP")
+	var smtpFrom = flag.String("smtp-from", "", "Remitente de los correos")
+	var smtpTo = flag.String("smtp-to", "", "Destinatarios de los correos, separados por comas")
+	var smtpSubject = flag.String("smtp-subject", "", "Plantilla text/template del asunto (vacío = por defecto)")
+	var smtpBody = flag.String("smtp-body-template", "", "Fichero text/template con el cuerpo del correo (vacío = por defecto)")
+	var smtpDigest = flag.Duration("smtp-digest", 0, "Envía un resumen agrupado por tag cada este intervalo, p.ej. 1h (0 = un correo por coincidencia)")
+	var notifyLocale = flag.String("notify-locale", "", "Idioma de las notificaciones (en, es); por sink con sink=idioma separados por comas, p.ej. es,teams=en,slack:latam=es (vacío = en)")
+	var chatRate = flag.Float64("chat-rate", defaultChatRate, "Mensajes por minuto como máximo en cada canal de Slack, Discord o Telegram (0 = sin límite)")
+	var matchStore = flag.String("match-store", "", "Histórico consultable de coincidencias: sqlite:<fichero> o postgres://usuario@host/base compartido entre instancias")
+	var label = flag.String("label", "", "Etiqueta coincidencias de -match-store como verdadero o falso positivo y sale, p.ej. 42=fp,43=tp (44= quita la etiqueta)")
+	var precision = flag.Bool("precision", false, "Imprime la precisión por regla de -match-store según las etiquetas y sale")
+	var fpSuggest = flag.Int("fp-suggest-threshold", defaultFPSuggestThreshold, "Falsos positivos de un dominio, sin ningún verdadero, para sugerir suprimirlo (0 desactiva)")
+	var query = flag.String("query", "", "Consulta el histórico de -match-store y sale, p.ej. tag=phishing,domain=example.com,since=24h")
+	var feedSize = flag.Int("feed-size", 0, "Coincidencias por tag que se sirven como feed RSS/Atom en /feed/{tag} del servidor de administración (0 desactiva)")
+	var sheetID = flag.String("sheet-id", "", "ID de la hoja de Google Sheets a la que añadir las coincidencias")
+	var sheetRange = flag.String("sheet-range", "Sheet1!A1", "Rango de la hoja donde se añaden las filas")
+	var sheetCreds = flag.String("sheet-credentials", "", "Fichero JSON de la cuenta de servicio con acceso a la hoja")
+	var csvPushURL = flag.String("csv-push-url", "", "URL a la que enviar por POST bloques CSV de coincidencias")
+	var rowsBatch = flag.Int("rows-batch-size", 50, "Filas por envío a Google Sheets / CSV")
+	var rowsInterval = flag.Duration("rows-flush-interval", time.Minute, "Envía las filas pendientes a Google Sheets / CSV cada este intervalo")
+	var esURL = flag.String("es-url", "", "URL de Elasticsearch/OpenSearch en la que indexar las coincidencias (admite usuario:contraseña@)")
+	var esIndex = flag.String("es-index", "gctwatch-{date}", "Índice de Elasticsearch; {date} se sustituye por el día UTC de la detección")
+	var esAPIKey = flag.String("es-api-key-file", "", "Fichero con la API key de Elasticsearch (en lugar de usuario y contraseña)")
+	var esCompress = flag.String("es-compress", CompressNone, "Compresión de las peticiones a Elasticsearch: none o gzip")
+	var esTemplate = flag.Bool("es-template", true, "Instala la plantilla de índice de Elasticsearch al arrancar")
+	var esBatch = flag.Int("es-batch-size", 500, "Documentos por petición _bulk a Elasticsearch")
+	var esInterval = flag.Duration("es-flush-interval", 5*time.Second, "Envía los documentos pendientes a Elasticsearch cada este intervalo")
+	var execCommand = flag.String("exec", "", "Comando que se ejecuta (con sh -c) por cada coincidencia, con el evento en JSON por la entrada estándar")
+	var execTimeout = flag.Duration("exec-timeout", defaultExecTimeout, "Tiempo máximo de cada ejecución de -exec; si se supera se mata el comando")
+	var syslogAddr = flag.String("syslog-addr", "", "Servidor syslog al que enviar las coincidencias: udp://host:514, tcp://host:514 o tls://host:6514")
+	var syslogFormat = flag.String("syslog-format", "cef", "Formato de los mensajes syslog: cef o rfc5424 (evento JSON)")
+	var syslogFacility = flag.String("syslog-facility", "local0", "Facility syslog (user, daemon, auth, authpriv, local0-local7...)")
+	var syslogFraming = flag.String("syslog-framing", "octet", "Delimitación en TCP/TLS: octet (RFC 6587, longitud delante) o lf (un mensaje por línea)")
+	var syslogCA = flag.String("syslog-ca-file", "", "CA en PEM con la que verificar el servidor syslog TLS (por defecto las del sistema)")
+	var sinkConcurrency = flag.String("sink-concurrency", "", "Workers de entrega por tipo de sink, p.ej. file=4,webhook=8")
+	var sinkOrdered = flag.String("sink-ordered", "", "Tipos de sink que conservan el orden por dominio registrado, separados por comas")
+	var httpRetries = flag.Int("http-retries", DefaultRetryPolicy.MaxRetries, "Reintentos de las peticiones HTTP de integraciones (429/5xx/errores de red)")
+	var breakerCooldown = flag.Duration("http-breaker-cooldown", DefaultRetryPolicy.BreakerCooldown, "Tiempo que un host queda bloqueado tras fallos seguidos")
+	var httpAddr = flag.String("http-addr", "", "Dirección del servidor de administración (/healthz, /metrics, /stats, /inventory, /coverage, /schema, /rules, /maintenance, /feed, /matches, /precision, /ct, /ingest), p.ej. :8080")
+	var acmeAccounts = flag.String("acme-accounts", "", "Fichero JSON con las cuentas ACME propias y sus dominios: marca las emisiones que no registró la cuenta esperada en /ingest")
+	var acmeTags = flag.String("acme-tags", "", "Tags (o *) de dominios propios a los que se aplica -acme-accounts")
+	var canaryAudit = flag.String("canary-audit-file", "", "Registro de auditoría (JSON Lines encadenado por hashes, solo de añadir) de las coincidencias de reglas canario")
+	var adminToken = flag.String("admin-token-file", "", "Fichero con el token bearer que piden las rutas de administración que modifican estado (POST /maintenance, POST /matches/{id}/label); sin él se rechazan")
+	var ingestToken = flag.String("ingest-token-file", "", "Fichero con el token bearer de POST /ingest; activa el receptor de certificados enviados por otros sistemas (requiere -http-addr)")
+	var requireFIPS = flag.Bool("require-fips", false, "Aborta si el proveedor criptográfico no es FIPS (BoringCrypto o GOFIPS140)")
+	var heartbeatEvery = flag.Duration("heartbeat-interval", 0, "Intervalo de los eventos heartbeat (0 desactiva)")
+	var opsEvents = flag.String("ops-events", "", "Eventos operacionales que se envían a los sinks (log_failing, sth_inconsistency, circuit_open, coverage_gap... o *), separados por comas")
+	var inventoryFile = flag.String("inventory-file", "", "Fichero JSON en el que volcar periódicamente el inventario de logs monitorizados (estado, checkpoint y salud de cada uno), también en /inventory")
+	var inventoryEvery = flag.Duration("inventory-interval", 5*time.Minute, "Intervalo de volcado de -inventory-file")
+	var coverageEvery = flag.Duration("coverage-interval", time.Hour, "Intervalo con el que se vuelve a descargar la lista de logs para comprobar que se monitorizan todos los utilizables (0 = solo al arrancar)")
+	var heartbeatRoute = flag.String("heartbeat-sinks", "", "Sinks que reciben los heartbeats, por tipo o nombre separados por comas (vacío = todos)")
+	var routesFile = flag.String("routes", "", "Fichero JSON con el enrutado de eventos por tag y horario")
+	var maintenance = flag.Bool("maintenance", false, "Arranca en modo mantenimiento: no notifica a sinks externos (ver /maintenance)")
+	var stateStore = flag.String("state-store", "memory", "Almacén de deduplicación/supresión: memory, bolt:<fichero> o redis://host:6379/0")
+	var sampleRates = flag.String("sample-rates", "", "Fracción de coincidencias entregada a los sinks por tag, p.ej. wildcards=0.01 (el resto solo cuenta en métricas)")
+	var redact = flag.String("redact", "", "Campos a redactar en sinks menos fiables, campo=hash|truncate:N|drop separados por comas (p.ej. certificate.dns_names=hash)")
+	var redactSinks = flag.String("redact-sinks", "", "Sinks a los que se aplica -redact, por tipo o nombre separados por comas (vacío = todos salvo stdout, file y feed)")
+	var redactKey = flag.String("redact-key-file", "", "Fichero con la clave HMAC de la redacción hash (sin clave, SHA-256)")
+	var dedupWindow = flag.Duration("dedup-window", 24*time.Hour, "Descarta el mismo certificado con el mismo tag visto de nuevo en este plazo (0 desactiva)")
+	var suppressWindow = flag.Duration("suppress-window", 0, "Descarta coincidencias del mismo tag y dominio registrado en este plazo (0 desactiva)")
+	var dataDir = flag.String("data-dir", defaultDataDir(), "Directorio de datos de la instancia (almacenes con forma corta, caché de reglas remotas); se bloquea para que no lo use otra instancia")
+	var checkpointStore = flag.String("checkpoint-store", "", "Almacén de posiciones por log: json:<fichero>, bolt:<fichero> o redis://host:6379/0 compartido entre instancias (vacío = solo en memoria)")
+	var checkpointFlush = flag.Duration("checkpoint-flush-interval", DefaultCheckpointFlush, "Intervalo de volcado a disco de los checkpoints json: y bolt:")
+	var checkpointEntries = flag.Uint64("checkpoint-flush-entries", 0, "Vuelca los checkpoints json: y bolt: antes del intervalo al avanzar tantas entradas entre todos los logs (0 = solo por tiempo)")
+	var backpressure = flag.String("backpressure", "", "Con la cola de proceso llena: drop (descarta), block (la lectura espera) o spill (a -spill-queue); vacío = spill con -spill-queue, si no drop")
+	var emitRate = flag.Float64("emit-rate", 0, "Coincidencias por segundo como máximo entregadas a los sinks, para repartir las ráfagas (0 = sin límite)")
+	var emitBurst = flag.Int("emit-burst", 0, "Ráfaga de -emit-rate (0 = un segundo de -emit-rate)")
+	var spillQueue = flag.String("spill-queue", "", "Cola en disco de -backpressure spill: bolt:<fichero> o bolt (en -data-dir)")
+	var archive = flag.String("archive", "", "Guarda las entradas leídas (bolt:<fichero>, segments:<directorio> o bolt|segments, en -data-dir) y las sirve como un log RFC 6962 en /ct/ del servidor de administración")
+	var archiveMax = flag.Uint64("archive-max-entries", DefaultArchiveMaxEntries, "Entradas que se conservan por log en -archive, las más recientes (0 = todas; con segments, en segmentos enteros)")
+	var spillMax = flag.Int("spill-max-entries", DefaultSpillMax, "Entradas que admite la cola en disco; por encima se descartan")
+	var checkpointFsync = flag.Bool("checkpoint-fsync", true, "Sincroniza a disco (fsync) cada volcado de los checkpoints json: y bolt:")
+	var instanceID = flag.String("instance-id", defaultInstanceID(), "Identificador de la instancia para las concesiones de logs")
+	var leaseTTL = flag.Duration("lease-ttl", DefaultLeaseTTL, "Validez de la concesión de un log; si la instancia cae, otra lo retoma pasado este tiempo")
+	var windowSize = flag.Uint64("window-size", DefaultWindowSize, "Entradas pedidas por get-entries al empezar")
+	var windowFixed = flag.Bool("window-fixed", false, "No ajusta la ventana de get-entries según latencia, errores y tope de cada log")
+	var windowMax = flag.Uint64("window-max", DefaultWindowController.Max, "Ventana máxima de get-entries en modo adaptativo")
+	var windowLatency = flag.Duration("window-target-latency", DefaultWindowController.TargetLatency, "Latencia de get-entries por encima de la cual se reduce la ventana")
+	var initConcurrency = flag.Int("init-concurrency", 16, "Logs que se inicializan (GetSTH) a la vez al arrancar")
+	var initTimeout = flag.Duration("init-timeout", time.Minute, "Plazo global para inicializar los logs; los que no respondan se omiten")
+	var revocationTags = flag.String("revocation-tags", "", "Tags cuyas coincidencias se comprueban por OCSP/CRL, separados por comas (\"*\" = todos)")
+	var crtshLinks = flag.Bool("crtsh-links", true, "Añade a cada coincidencia el enlace a crt.sh por huella")
+	var crtshResolve = flag.String("crtsh-resolve-tags", "", "Tags para los que se resuelve el ID de crt.sh por su API, separados por comas (\"*\" = todos)")
+	var crtshRate = flag.Float64("crtsh-rate", 1, "Consultas por segundo a la API de crt.sh")
+	var zoneFiles = flag.String("zone-files", "", "Ficheros de zona (CZDS, RFC 1035, opcionalmente .gz) o patrones glob, separados por comas, para marcar si el dominio está delegado")
+	var sbKey = flag.String("safebrowsing-key-file", "", "Fichero con la clave de API de Google Safe Browsing o Web Risk; activa la consulta de reputación del dominio")
+	var sbService = flag.String("safebrowsing-service", "safebrowsing", "API de reputación: safebrowsing (Lookup API v4) o webrisk (uso comercial)")
+	var sbTags = flag.String("safebrowsing-tags", "", "Tags cuyas coincidencias se consultan en Safe Browsing/Web Risk, separados por comas (vacío = todos)")
+	var vtKey = flag.String("virustotal-key-file", "", "Fichero con la clave de API de VirusTotal; activa la consulta del informe del dominio")
+	var vtTags = flag.String("virustotal-tags", "", "Tags cuyas coincidencias se consultan en VirusTotal, separados por comas (vacío = todos)")
+	var vtRate = flag.Float64("virustotal-rate", defaultVTRate, "Consultas por minuto a VirusTotal (0 = sin límite); por encima se omite la consulta")
+	var vtTTL = flag.Duration("virustotal-cache-ttl", 24*time.Hour, "Tiempo que se guarda en caché el informe de VirusTotal de cada dominio")
+	var scorer = flag.String("scorer", "", "Backend de puntuación de las coincidencias: URL de un servicio HTTP (POST) u onnx:/ruta/modelo.onnx (compilado con -tags onnx)")
+	var luaScript = flag.String("lua-script", "", "Script Lua con funciones match(cert, log, tags) y/o enrich(event) para añadir o descartar coincidencias y añadir campos")
+	var plugins = flag.String("plugins", "", "Plugins de Go (.so) con matchers y/o sinks propios, separados por comas")
+	var pluginConfig = flag.String("plugin-config", "", "Configuración de cada plugin: plugin=config separados por comas (plugin es el nombre del fichero sin .so)")
+	var scoreTags = flag.String("score-tags", "", "Tags cuyas coincidencias se puntúan con -scorer, separados por comas (vacío = todos)")
+	var scoreTimeout = flag.Duration("score-timeout", defaultScoreTimeout, "Tiempo máximo de cada puntuación; si se supera la coincidencia sigue sin puntuación")
+	var sbTTL = flag.Duration("safebrowsing-cache-ttl", time.Hour, "Tiempo que se guarda en caché el veredicto de cada dominio")
+	var zoneTags = flag.String("zone-tags", "", "Tags cuyas coincidencias se cruzan con -zone-files, separados por comas (vacío = todos)")
+	var duration = flag.Duration("duration", 0, "Tiempo de ejecución; al cumplirse se para de forma ordenada (0 = hasta SIGINT/SIGTERM)")
+	var shutdownTimeout = flag.Duration("shutdown-timeout", 30*time.Second, "Plazo para tratar las entradas en cola al parar")
+	var reportFile = flag.String("report-file", "", "Fichero JSON en el que guardar el informe de la ejecución al parar")
+	var replayParallel = flag.Int("replay-parallel", runtime.GOMAXPROCS(0), "Segmentos del archivo que lee a la vez gctwatch replay")
+	var replayChronological = flag.Bool("replay-chronological", false, "gctwatch replay entrega las entradas de todos los logs mezcladas por la marca de tiempo de la hoja")
+	var replayState = flag.String("replay-state", "", "Fichero con la posición de gctwatch replay en cada segmento (por defecto replay-state.json en el archivo)")
+	var allowDegraded = flag.Bool("allow-degraded", false, "Arranca aunque fallen comprobaciones no críticas (sinks secundarios, estado)")
 	flag.Parse()
+	if *configFile != "" {
+		if err := applyConfigFile(*configFile, flag.CommandLine); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
 
-	manager, err := NewLogManager(loglist3.LogListURL, rules)
-	if err != nil {
-		panic(err)
+	if *printSchema {
+		schema, err := MatchEventSchema()
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println(string(schema))
+		return
+	}
+	if *verifyLogList != "" {
+		n, err := verifyLogListFile(*verifyLogList, *logListKey)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", *verifyLogList, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s: signature valid, %d logs\n", *verifyLogList, n)
+		return
+	}
+	if *query != "" || *label != "" || *precision {
+		dialer, err := NewNetDialer(*ipFamily, "", 0)
+		if err == nil {
+			network := &Network{Policy: NewEgressPolicy(false, nil), Dialer: dialer, Retry: DefaultRetryPolicy}
+			spec, _ := dataDirSpec(*matchStore, *dataDir, matchStoreFiles)
+			err = withMatchStore(spec, network, func(store MatchStore) error {
+				switch {
+				case *label != "":
+					return labelMatches(store, *label, *fpSuggest, os.Stdout)
+				case *precision:
+					return printPrecision(store, *fpSuggest, os.Stdout)
+				}
+				return queryMatches(store, *query, os.Stdout)
+			})
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	flags := setupFlags{
+		rulesFile:         *rulesFile,
+		shadowRules:       *shadowRules,
+		matchSubjectDN:    *matchSubjectDN,
+		matchEngine:       *matchEngine,
+		rulesURL:          *rulesURL,
+		rulesTokenFile:    *rulesTokenFile,
+		rulesPubKey:       *rulesPubKey,
+		strictEgress:      *strictEgress,
+		allowHosts:        *allowHosts,
+		ipFamily:          *ipFamily,
+		hostFamily:        *hostFamily,
+		eyeballsDelay:     *eyeballsDelay,
+		dohURL:            *dohURL,
+		logListURL:        *logListURL,
+		maxResponse:       *maxResponse,
+		logListTimeout:    *logListTimeout,
+		logListCache:      *logListCache,
+		logListKey:        *logListKey,
+		extraLogLists:     *extraLogLists,
+		extraLogListKeys:  *extraLogListKeys,
+		mergePolicy:       *mergePolicy,
+		offline:           *offline,
+		extraLogs:         *extraLogs,
+		logMirrors:        *logMirrors,
+		logCredentials:    *logCredentials,
+		bandwidthCap:      *bandwidthCap,
+		lowPriorityLogs:   *lowPriorityLogs,
+		skewTolerance:     *skewTolerance,
+		ntpServer:         *ntpServer,
+		redact:            *redact,
+		redactSinks:       *redactSinks,
+		redactKey:         *redactKey,
+		sampleRates:       *sampleRates,
+		stateStore:        *stateStore,
+		dedupWindow:       *dedupWindow,
+		suppressWindow:    *suppressWindow,
+		revocationTags:    *revocationTags,
+		crtshLinks:        *crtshLinks,
+		crtshResolve:      *crtshResolve,
+		crtshRate:         *crtshRate,
+		zoneFiles:         *zoneFiles,
+		zoneTags:          *zoneTags,
+		sbKey:             *sbKey,
+		sbService:         *sbService,
+		sbTags:            *sbTags,
+		sbTTL:             *sbTTL,
+		vtKey:             *vtKey,
+		vtTags:            *vtTags,
+		vtRate:            *vtRate,
+		vtTTL:             *vtTTL,
+		scorer:            *scorer,
+		scoreTags:         *scoreTags,
+		scoreTimeout:      *scoreTimeout,
+		luaScript:         *luaScript,
+		execCommand:       *execCommand,
+		execTimeout:       *execTimeout,
+		plugins:           *plugins,
+		pluginConfig:      *pluginConfig,
+		checkpointStore:   *checkpointStore,
+		dataDir:           *dataDir,
+		checkpointFlush:   *checkpointFlush,
+		checkpointEntries: *checkpointEntries,
+		checkpointFsync:   *checkpointFsync,
+		backpressure:      *backpressure,
+		emitRate:          *emitRate,
+		emitBurst:         *emitBurst,
+		spillQueue:        *spillQueue,
+		spillMax:          *spillMax,
+		archive:           *archive,
+		archiveMax:        *archiveMax,
+		ingestToken:       *ingestToken,
+		adminToken:        *adminToken,
+		canaryAudit:       *canaryAudit,
+		acmeAccounts:      *acmeAccounts,
+		acmeTags:          *acmeTags,
+		instanceID:        *instanceID,
+		leaseTTL:          *leaseTTL,
+		insecureLogList:   *insecureLogList,
+		toStdout:          *toStdout,
+		outputFile:        *outputFile,
+		outputCompress:    *outputCompress,
+		webhookURL:        *webhookURL,
+		webhookTmpl:       *webhookTmpl,
+		webhookCompress:   *webhookCompress,
+		webhookSecret:     *webhookSecret,
+		matrixHomeserver:  *matrixHomeserver,
+		matrixRoom:        *matrixRoom,
+		matrixToken:       *matrixToken,
+		teamsURL:          *teamsURL,
+		slackWebhooks:     *slackWebhooks,
+		discordWebhooks:   *discordWebhooks,
+		telegramToken:     *telegramToken,
+		telegramChats:     *telegramChats,
+		chatTags:          *chatTags,
+		chatRate:          *chatRate,
+		notifyLocale:      *notifyLocale,
+		queueEncoding:     *queueEncoding,
+		schemaRegistry:    *schemaRegistry,
+		natsURL:           *natsURL,
+		natsSubject:       *natsSubject,
+		natsStream:        *natsStream,
+		natsCreds:         *natsCreds,
+		natsCA:            *natsCA,
+		redisSinkURL:      *redisSinkURL,
+		redisChannel:      *redisChannel,
+		redisStream:       *redisStream,
+		redisStreamMaxLen: *redisStreamMaxLen,
+		mqttURL:           *mqttURL,
+		mqttTopic:         *mqttTopic,
+		mqttQoS:           *mqttQoS,
+		mqttUser:          *mqttUser,
+		mqttPassword:      *mqttPassword,
+		mqttCA:            *mqttCA,
+		sqsQueueURL:       *sqsQueueURL,
+		snsTopicARN:       *snsTopicARN,
+		awsRegion:         *awsRegion,
+		smtpAddr:          *smtpAddr,
+		smtpTLS:           *smtpTLS,
+		smtpCA:            *smtpCA,
+		smtpUser:          *smtpUser,
+		smtpPassword:      *smtpPassword,
+		smtpFrom:          *smtpFrom,
+		smtpTo:            *smtpTo,
+		smtpSubject:       *smtpSubject,
+		smtpBody:          *smtpBody,
+		smtpDigest:        *smtpDigest,
+		matchStore:        *matchStore,
+		feedSize:          *feedSize,
+		sheetID:           *sheetID,
+		sheetRange:        *sheetRange,
+		sheetCreds:        *sheetCreds,
+		csvPushURL:        *csvPushURL,
+		rowsBatch:         *rowsBatch,
+		rowsInterval:      *rowsInterval,
+		esURL:             *esURL,
+		esIndex:           *esIndex,
+		esAPIKey:          *esAPIKey,
+		esCompress:        *esCompress,
+		esTemplate:        *esTemplate,
+		esBatch:           *esBatch,
+		esInterval:        *esInterval,
+		opsEvents:         *opsEvents,
+		syslogAddr:        *syslogAddr,
+		syslogFormat:      *syslogFormat,
+		syslogFacility:    *syslogFacility,
+		syslogFraming:     *syslogFraming,
+		syslogCA:          *syslogCA,
+		sinkConcurrency:   *sinkConcurrency,
+		sinkOrdered:       *sinkOrdered,
+		routesFile:        *routesFile,
+		httpRetries:       *httpRetries,
+		breakerCooldown:   *breakerCooldown,
+		requireFIPS:       *requireFIPS,
+	}
+	if flag.Arg(0) == "explain" {
+		if err := runExplain(flags, flag.Args()[1:], *maintenance, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "replay" {
+		opts := replayOptions{
+			Parallel:        *replayParallel,
+			Chronological:   *replayChronological,
+			State:           *replayState,
+			Workers:         *workers,
+			BufferSize:      *bufferSize,
+			ShutdownTimeout: *shutdownTimeout,
+			OnlyLogs:        splitList(*onlyLogs),
+			ExcludeLogs:     splitList(*excludeLogs),
+			HTTPAddr:        *httpAddr,
+			ReportFile:      *reportFile,
+			Maintenance:     *maintenance,
+		}
+		if err := runReplay(flags, opts, flag.Args()[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
 	}
+
+	manager, preflight := setup(flags)
+	preflight.Report(os.Stderr)
+	if preflight.CriticalFailed() || (preflight.Failed() && !*allowDegraded) {
+		fmt.Fprintln(os.Stderr, "Refusing to start (use -allow-degraded to start with non-critical failures)")
+		os.Exit(1)
+	}
+
+	if *httpAddr != "" {
+		stop := manager.StartAdminServer(*httpAddr)
+		defer stop()
+	}
+	if *maintenance {
+		manager.Maintenance.Set(true, "-maintenance flag")
+	}
+	manager.WindowSize = *windowSize
+	manager.OnlyLogs, manager.ExcludeLogs = splitList(*onlyLogs), splitList(*excludeLogs)
+	manager.FPSuggestThreshold = *fpSuggest
+	manager.PollInterval, manager.Workers = *pollInterval, *workers
+	manager.ShutdownTimeout = *shutdownTimeout
+	manager.OutputChan = make(chan SourcedEntry, *bufferSize)
+	manager.InitConcurrency, manager.InitTimeout = *initConcurrency, *initTimeout
+	if *logBreakerFailures > 0 {
+		manager.Breaker = &SourceBreaker{Threshold: *logBreakerFailures, Cooldown: *logBreakerCooldown}
+	}
+	if !*windowFixed {
+		wc := DefaultWindowController
+		wc.Max, wc.TargetLatency = *windowMax, *windowLatency
+		manager.Window = &wc
+	}
+	manager.HeartbeatEvery = *heartbeatEvery
+	if *heartbeatRoute != "" {
+		manager.HeartbeatRoute = strings.Split(*heartbeatRoute, ",")
+	}
+	if *inventoryFile != "" && *inventoryEvery <= 0 {
+		fmt.Fprintln(os.Stderr, "-inventory-interval must be positive")
+		os.Exit(2)
+	}
+	manager.InventoryFile, manager.InventoryEvery = *inventoryFile, *inventoryEvery
+	manager.CoverageEvery = *coverageEvery
 	if err := manager.NormalizeLogs(); err != nil {
-		panic(err)
+		fmt.Fprintf(os.Stderr, "Failed to load CT logs: %v\n", err)
+		os.Exit(1)
+	}
+	if *selectLogs {
+		if err := manager.SelectLogs(os.Stdin, os.Stderr); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
 	}
 	manager.StartStreaming()
 
-	time.Sleep(10 * time.Minute)
-
+	// Hasta SIGINT/SIGTERM o -duration; una segunda señal aborta sin esperar
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+	<-ctx.Done()
+	stop()
+	log.Printf("shutting down")
 	manager.StopStreaming()
+	report := manager.ShutdownReport()
+	report.Log()
+	if *reportFile != "" {
+		if err := report.WriteFile(*reportFile); err != nil {
+			log.Printf("WARNING: %v", err)
+		}
+	}
 }
 
-// Carga reglas de filtrado
-func LoadRules(path string) (RegexRules, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
+type setupFlags struct {
+	rulesFile, allowHosts, ipFamily, hostFamily, dohURL           string
+	logListCache, logListKey, extraLogLists, extraLogListKeys     string
+	mergePolicy, extraLogs, outputFile, outputCompress            string
+	sinkConcurrency, sinkOrdered, routesFile, logMirrors          string
+	logCredentials, adminToken                                    string
+	bandwidthCap, lowPriorityLogs, ntpServer, stateStore          string
+	checkpointStore, instanceID, rulesURL, rulesTokenFile         string
+	dataDir, spillQueue, archive, backpressure, ingestToken       string
+	rulesPubKey, revocationTags, crtshResolve                     string
+	sheetID, sheetRange, sheetCreds, csvPushURL                   string
+	webhookURL, webhookTmpl, webhookCompress, webhookSecret       string
+	matrixHomeserver, matrixRoom, matrixToken, teamsURL           string
+	sampleRates, logListURL, redact, redactSinks, redactKey       string
+	esURL, esIndex, esAPIKey, esCompress, matchStore              string
+	shadowRules, syslogAddr, syslogFormat, syslogFacility         string
+	syslogFraming, syslogCA, opsEvents, zoneFiles, zoneTags       string
+	slackWebhooks, discordWebhooks, telegramToken, telegramChats  string
+	chatTags, smtpAddr, smtpTLS, smtpCA, smtpUser, smtpPassword   string
+	notifyLocale, scorer, scoreTags, luaScript                    string
+	plugins, pluginConfig, execCommand, matchEngine               string
+	smtpFrom, smtpTo, smtpSubject, smtpBody                       string
+	sbKey, sbService, sbTags, queueEncoding, schemaRegistry       string
+	vtKey, vtTags, acmeAccounts, acmeTags, canaryAudit            string
+	natsURL, natsSubject, natsStream, natsCreds, natsCA           string
+	redisSinkURL, redisChannel, redisStream                       string
+	sqsQueueURL, snsTopicARN, awsRegion                           string
+	mqttURL, mqttTopic, mqttUser, mqttPassword, mqttCA            string
+	strictEgress, offline, insecureLogList, toStdout, requireFIPS bool
+	noLogLists                                                    bool // explain y replay: no se cargan listas
+	crtshLinks, esTemplate, checkpointFsync, matchSubjectDN       bool
+	crtshRate, chatRate, vtRate, emitRate                         float64
+	eyeballsDelay, logListTimeout, breakerCooldown, skewTolerance time.Duration
+	dedupWindow, suppressWindow, leaseTTL, rowsInterval           time.Duration
+	checkpointFlush, esInterval, smtpDigest, sbTTL, vtTTL         time.Duration
+	scoreTimeout, execTimeout                                     time.Duration
+	maxResponse, redisStreamMaxLen                                int64
+	checkpointEntries, archiveMax                                 uint64
+	httpRetries, rowsBatch, feedSize, esBatch, mqttQoS, spillMax  int
+	emitBurst                                                     int
+}
+
+// Construye el manager registrando cada paso en el preflight en lugar de abortar
+// en el primer error. Si falla algo crítico del que dependen los pasos siguientes
+// se devuelve en ese punto.
+func setup(f setupFlags) (*CTLogsManager, *Preflight) {
+	p := &Preflight{}
+
+	p.Check("crypto provider "+cryptoProvider.Name(), f.requireFIPS, func() error {
+		if f.requireFIPS && !cryptoProvider.FIPS() {
+			return fmt.Errorf("FIPS crypto required but provider is %s", cryptoProvider.Name())
+		}
+		return nil
+	}())
+	dataDir, ok := setupDataDir(&f, p)
+	if !ok {
+		return nil, p
 	}
 
-	var raw RegexConfig
-	if err := json.Unmarshal(data, &raw); err != nil {
-		return nil, err
+	var verifier *SignatureVerifier
+	if f.rulesPubKey != "" {
+		var err error
+		verifier, err = LoadSignatureVerifier(f.rulesPubKey)
+		p.Check("rules signing key "+f.rulesPubKey, true, err)
+	}
+	// Con reglas remotas el fichero local es solo el respaldo
+	rules, err := LoadRules(f.rulesFile, verifier)
+	if p.Check(fmt.Sprintf("rules %s (%d)", f.rulesFile, len(rules)), f.rulesURL == "", err) && len(rules) == 0 && f.rulesURL == "" {
+		p.Check("rules not empty", true, fmt.Errorf("no rules in %s", f.rulesFile))
+	}
+	if canaries := rules.canaryTags(); len(canaries) > 0 && f.canaryAudit == "" {
+		p.Check("canary audit", false, fmt.Errorf("canary rules %s without -canary-audit-file", strings.Join(canaries, ", ")))
 	}
+	p.Check("log list merge policy", true, checkMergePolicy(f.mergePolicy))
+	p.Check("output file compression", true, checkCompression(f.outputCompress))
+	sinkOpts, err := parseSinkOptions(f.sinkConcurrency, f.sinkOrdered)
+	p.Check("sink options", true, err)
 
-	compiled := make(RegexRules)
-	for tag, expr := range raw {
-		re, err := regexp.Compile(expr)
-		if err != nil {
-			return nil, fmt.Errorf("error compilando regex para %s: %w", tag, err)
+	network, ok := setupNetwork(&f, p)
+	if !ok {
+		return nil, p
+	}
+	remote, rules := setupRemoteRules(&f, rules, verifier, network, p)
+	manager, err := NewLogManager(f.logListURL, rules, network)
+	if !p.Check("log manager", true, err) {
+		return nil, p
+	}
+	manager.RemoteRules = remote
+	manager.DataDir = dataDir
+	manager.Events = network.Events
+	if f.shadowRules != "" {
+		shadow, err := LoadRules(f.shadowRules, verifier)
+		if err == nil {
+			err = checkShadowRules(shadow, rules)
+		}
+		if p.Check(fmt.Sprintf("shadow rules %s (%d)", f.shadowRules, len(shadow)), false, err) {
+			manager.SetShadowRules(shadow)
+		}
+	}
+	if f.matchEngine != "" {
+		p.Check("match engine "+f.matchEngine, true, manager.SetRuleEngine(f.matchEngine))
+	}
+	manager.SinkOptions = sinkOpts
+	manager.MatchSubjectDN = f.matchSubjectDN
+	manager.InstanceID = f.instanceID
+
+	setupLogSources(&f, manager, network, p)
+	setupLogLists(&f, manager, p)
+	setupSinks(&f, manager, network, p)
+	setupDelivery(&f, manager, network, p)
+	setupPipeline(&f, manager, network, p)
+	setupEnrichers(&f, manager, network, p)
+	if f.routesFile != "" {
+		manager.Router, err = LoadRoutes(f.routesFile, verifier)
+		p.Check("routes "+f.routesFile, true, err)
+	}
+	return manager, p
+}
+
+// Almacenes con forma corta: van al directorio de datos, que se bloquea.
+// Reescribe en f las rutas de esos almacenes.
+func setupDataDir(f *setupFlags, p *Preflight) (*DataDir, bool) {
+	var stateIn, checkpointsIn, matchesIn, spillIn, archiveIn bool
+	f.stateStore, stateIn = dataDirSpec(f.stateStore, f.dataDir, stateStoreFiles)
+	f.checkpointStore, checkpointsIn = dataDirSpec(f.checkpointStore, f.dataDir, checkpointStoreFiles)
+	f.matchStore, matchesIn = dataDirSpec(f.matchStore, f.dataDir, matchStoreFiles)
+	switch {
+	case f.backpressure == "" && f.spillQueue != "":
+		f.backpressure = BackpressureSpill
+	case f.backpressure == "":
+		f.backpressure = BackpressureDrop
+	case f.backpressure == BackpressureSpill && f.spillQueue == "":
+		f.spillQueue = "bolt"
+	}
+	f.spillQueue, spillIn = dataDirSpec(f.spillQueue, f.dataDir, spillQueueFiles)
+	f.archive, archiveIn = dataDirSpec(f.archive, f.dataDir, archiveFiles)
+	if !stateIn && !checkpointsIn && !matchesIn && !spillIn && !archiveIn {
+		return nil, true
+	}
+	dataDir, err := OpenDataDir(f.dataDir)
+	return dataDir, p.Check("data directory "+f.dataDir, true, err)
+}
+
+// Conexiones salientes: familia de direcciones, egress, reintentos, DoH y
+// bus de eventos operativos
+func setupNetwork(f *setupFlags, p *Preflight) (*Network, bool) {
+	dialer, err := NewNetDialer(f.ipFamily, f.hostFamily, f.eyeballsDelay)
+	if !p.Check("network dialer", true, err) {
+		return nil, false
+	}
+	network := &Network{Policy: NewEgressPolicy(f.strictEgress, strings.Split(f.allowHosts, ",")), Dialer: dialer, Retry: DefaultRetryPolicy}
+	network.Retry.MaxRetries = f.httpRetries
+	network.Retry.BreakerCooldown = f.breakerCooldown
+	network.Events, err = NewEventBus(splitList(f.opsEvents))
+	p.Check("ops events", true, err)
+	if f.dohURL != "" {
+		p.Check("DoH resolver "+f.dohURL, true, network.UseDoH(f.dohURL))
+	}
+	return network, true
+}
+
+// Reglas remotas: sustituyen a las del fichero si se pueden descargar (o hay
+// copia en caché)
+func setupRemoteRules(f *setupFlags, rules RegexRules, verifier *SignatureVerifier, network *Network, p *Preflight) (*RemoteRules, RegexRules) {
+	if f.rulesURL == "" {
+		return nil, rules
+	}
+	remote, err := NewRemoteRules(f.rulesURL, f.rulesTokenFile, network.Client())
+	if err == nil {
+		remote.Verifier = verifier
+		if f.dataDir != "" {
+			remote.Cache = filepath.Join(f.dataDir, dataRulesCache)
+		}
+	}
+	var remoteRules RegexRules
+	if err == nil {
+		remoteRules, err = remote.Fetch(context.Background(), 0)
+	}
+	// Servicio caído al arrancar: la última respuesta válida
+	if err != nil && remote != nil && remote.Cache != "" {
+		if cached, cerr := LoadRules(remote.Cache, verifier); cerr == nil && len(cached) > 0 {
+			log.Printf("WARNING: remote rules %s: %v (using cached copy %s)", f.rulesURL, err, remote.Cache)
+			remoteRules, err = cached, nil
 		}
-		compiled[tag] = re
 	}
-	return compiled, nil
+	if p.Check(fmt.Sprintf("remote rules %s (%d)", f.rulesURL, len(remoteRules)), len(rules) == 0, err) {
+		rules = remoteRules
+	}
+	return remote, rules
+}
+
+// Acceso a los logs: límites, logs extra, réplicas, credenciales, reloj y
+// ancho de banda
+func setupLogSources(f *setupFlags, manager *CTLogsManager, network *Network, p *Preflight) {
+	manager.MaxResponseBytes = f.maxResponse
+	manager.LogListTimeout = f.logListTimeout
+	manager.LogLists[0].Cache = f.logListCache
+	manager.MergePolicy = f.mergePolicy
+	manager.Offline = f.offline
+	if f.extraLogs != "" {
+		manager.ExtraLogs = strings.Split(f.extraLogs, ",")
+	}
+	manager.LogMirrors = parseLogMirrors(f.logMirrors)
+	if f.logCredentials != "" {
+		creds, err := LoadLogCredentials(f.logCredentials)
+		if p.Check(fmt.Sprintf("log credentials %s (%d)", f.logCredentials, len(creds)), true, err) {
+			manager.LogCredentials = creds
+		}
+	}
+	manager.Clock.Tolerance = f.skewTolerance
+	if f.ntpServer != "" {
+		offset, err := network.ClockOffset(context.Background(), f.ntpServer)
+		if err == nil && (offset > f.skewTolerance || -offset > f.skewTolerance) {
+			err = fmt.Errorf("local clock off by %s (tolerance %s)", offset.Round(time.Millisecond), f.skewTolerance)
+		}
+		p.Check(fmt.Sprintf("clock vs NTP %s (%s)", f.ntpServer, offset.Round(time.Millisecond)), false, err)
+		manager.Health.Set("clock", false, err)
+	}
+	bwCap, err := parseByteSize(f.bandwidthCap)
+	p.Check("bandwidth cap", true, err)
+	manager.Bandwidth = NewBandwidth(bwCap, strings.Split(f.lowPriorityLogs, ","))
+}
+
+// Listas de logs y sus claves
+func setupLogLists(f *setupFlags, manager *CTLogsManager, p *Preflight) {
+	var err error
+	if f.offline {
+		// La lista empaquetada forma parte del binario; no se descargan listas
+		if !f.noLogLists {
+			n, err := manager.checkBundledLogList()
+			p.Check(fmt.Sprintf("bundled log list (%d usable logs)", n), len(manager.ExtraLogs) == 0, err)
+		}
+	} else if f.insecureLogList {
+		log.Printf("WARNING: log list signature verification disabled")
+	} else {
+		manager.LogLists[0].Key, err = loadLogListKey(f.logListKey)
+		name := f.logListKey
+		if name == "" {
+			name = "(bundled)"
+			if err != nil {
+				err = fmt.Errorf("%w (rebuild after make loglist-key, or pass -loglist-pubkey with the key from %s verified out of band)", err, LogListPubKeyURL)
+			}
+		} else if err != nil {
+			err = fmt.Errorf("%w (get it from %s and verify it out of band, or use -insecure-loglist)", err, LogListPubKeyURL)
+		}
+		p.Check("log list key "+name, true, err)
+	}
+	// En el orden de -extra-loglists, que es el de precedencia al mezclar
+	extraKeys := parseKeyValues(f.extraLogListKeys)
+	for _, extra := range parseKeyValueList(f.extraLogLists) {
+		if f.offline {
+			break
+		}
+		name, url := extra.Key, extra.Value
+		src := &LogListSource{Name: name, URL: url}
+		if f.logListCache != "" {
+			src.Cache = filepath.Join(filepath.Dir(f.logListCache), name+".json")
+		}
+		err = nil
+		if path, ok := extraKeys[name]; ok {
+			src.Key, err = loadPublicKey(path)
+		} else if !f.insecureLogList {
+			err = fmt.Errorf("no signing key (use -extra-loglist-keys or -insecure-loglist)")
+		}
+		if p.Check("log list "+name, false, err) {
+			manager.LogLists = append(manager.LogLists, src)
+		}
+	}
+
+	// Estado en disco
+	if f.logListCache != "" && !f.offline {
+		p.Check("log list cache writable", false, checkWritableDir(f.logListCache))
+	}
+}
+
+// Registra un sink en el preflight y, si está bien, en el manager
+type sinkAdder func(name string, s Sink, err error)
+
+// Sinks: el primero es el principal, así que el orden importa
+func setupSinks(f *setupFlags, manager *CTLogsManager, network *Network, p *Preflight) {
+	locales, err := ParseNotifyLocales(f.notifyLocale)
+	p.Check("notify locale", true, err)
+	addSink := func(name string, s Sink, err error) {
+		if err == nil {
+			if l, ok := s.(LocalizedSink); ok {
+				l.SetLocale(locales.For(s.Name()))
+			}
+			if c, ok := s.(SinkChecker); ok {
+				err = c.Check()
+			}
+		}
+		critical := len(manager.Sinks) == 0
+		name = "sink:" + name
+		if p.Check(name, critical, err) {
+			manager.Sinks = append(manager.Sinks, s)
+		} else {
+			manager.Health.Set(name, false, err)
+		}
+	}
+	if f.toStdout {
+		addSink("stdout", &stdoutSink{}, nil)
+	}
+	if f.outputFile != "" {
+		fs, err := NewFileSink(f.outputFile, f.outputCompress)
+		addSink("file:"+f.outputFile, fs, err)
+	}
+	setupWebhookSinks(f, network, p, addSink)
+	setupChatSinks(f, network, p, addSink)
+	setupQueueSinks(f, network, addSink)
+	if f.smtpAddr != "" {
+		es, err := NewEmailSink(EmailConfig{
+			Addr: f.smtpAddr, TLS: f.smtpTLS, CAFile: f.smtpCA, User: f.smtpUser, PasswordFile: f.smtpPassword,
+			From: f.smtpFrom, To: splitList(f.smtpTo), Subject: f.smtpSubject, BodyFile: f.smtpBody, Digest: f.smtpDigest,
+		}, network)
+		name := "email"
+		if err == nil {
+			name, err = es.Name(), network.Policy.Check(es.host)
+		}
+		addSink(name, es, err)
+	}
+	if f.matchStore != "" {
+		ms, err := OpenMatchStore(f.matchStore, network)
+		name := f.matchStore
+		if err == nil {
+			name, manager.Matches = ms.Name(), ms
+		}
+		addSink(name, ms, err)
+	}
+	if f.feedSize > 0 {
+		manager.Feed = NewFeedSink(f.feedSize)
+		addSink("feed", manager.Feed, nil)
+	}
+	if f.sheetID != "" {
+		ss, err := NewSheetSink(f.sheetID, f.sheetRange, f.sheetCreds, network.Client(), f.rowsBatch, f.rowsInterval)
+		addSink("sheets:"+f.sheetID, ss, err)
+	}
+	if f.csvPushURL != "" {
+		err := network.Policy.CheckURL(f.csvPushURL)
+		addSink("csv:"+f.csvPushURL, NewCSVPushSink(f.csvPushURL, network.Client(), f.rowsBatch, f.rowsInterval), err)
+	}
+	if f.esURL != "" {
+		es, err := NewElasticSink(f.esURL, f.esIndex, f.esAPIKey, f.esCompress, network.Client(), f.esBatch, f.esInterval)
+		name := "elasticsearch"
+		if err == nil {
+			es.Template = f.esTemplate
+			name, err = es.Name(), network.Policy.CheckURL(f.esURL)
+		}
+		addSink(name, es, err)
+	}
+	if f.syslogAddr != "" {
+		ss, err := NewSyslogSink(f.syslogAddr, f.syslogFormat, f.syslogFacility, f.syslogFraming, f.syslogCA, network)
+		name := "syslog"
+		if err == nil {
+			name = ss.Name()
+		}
+		addSink(name, ss, err)
+	}
+	if f.execCommand != "" {
+		es, err := NewExecSink(f.execCommand, f.execTimeout)
+		name := "exec"
+		if err == nil {
+			name = es.Name()
+		}
+		addSink(name, es, err)
+	}
+	if f.plugins != "" {
+		plugins, err := LoadPlugins(splitList(f.plugins), parseKeyValues(f.pluginConfig))
+		if p.Check("plugins", true, err) {
+			manager.Plugins = plugins
+			for _, pl := range plugins {
+				if pl.Sink != nil {
+					addSink("plugin:"+pl.Name, &pluginSink{name: pl.Name, sink: pl.Sink}, nil)
+				}
+			}
+		}
+	}
+	if len(manager.Sinks) == 0 {
+		p.Check("at least one sink", true, fmt.Errorf("no sink configured"))
+	}
+}
+
+// Webhooks genéricos, Matrix y Teams
+func setupWebhookSinks(f *setupFlags, network *Network, p *Preflight, addSink sinkAdder) {
+	if f.webhookURL != "" {
+		var secret []byte
+		if f.webhookSecret != "" {
+			data, err := os.ReadFile(f.webhookSecret)
+			if p.Check("webhook secret", true, err) {
+				secret = []byte(strings.TrimSpace(string(data)))
+			}
+		}
+		urls, tmpls := splitList(f.webhookURL), splitList(f.webhookTmpl)
+		for i, u := range urls {
+			tmpl := ""
+			if len(tmpls) == 1 {
+				tmpl = tmpls[0]
+			} else if i < len(tmpls) {
+				tmpl = tmpls[i]
+			}
+			ws, err := NewWebhookSink(u, tmpl, f.webhookCompress, network.Client())
+			if err == nil {
+				ws.Secret = secret
+				err = network.Policy.CheckURL(u)
+			}
+			name := "webhook"
+			if ws != nil {
+				name = ws.Name()
+			}
+			addSink(name, ws, err)
+		}
+	}
+	if f.matrixRoom != "" {
+		ms, err := NewMatrixSink(f.matrixHomeserver, f.matrixRoom, f.matrixToken, network.Client())
+		if err == nil {
+			err = network.Policy.CheckURL(f.matrixHomeserver)
+		}
+		addSink("matrix:"+f.matrixRoom, ms, err)
+	}
+	if f.teamsURL != "" {
+		ts, err := NewTeamsSink(f.teamsURL, network.Client())
+		name := "teams"
+		if err == nil {
+			name, err = ts.Name(), network.Policy.CheckURL(f.teamsURL)
+		}
+		addSink(name, ts, err)
+	}
+}
+
+// Slack, Discord y Telegram, con tags y límite de envío por canal
+func setupChatSinks(f *setupFlags, network *Network, p *Preflight, addSink sinkAdder) {
+	chatTags := parseChatTags(f.chatTags)
+	addChat := func(name string, cs *chatSink, err error) {
+		if cs != nil {
+			cs.tags = chatTags[cs.Name()]
+			cs.SetRate(f.chatRate)
+		}
+		addSink(name, cs, err)
+	}
+	slack, err := parseChatChannels(f.slackWebhooks)
+	p.Check("slack channels", true, err)
+	for _, c := range slack {
+		cs, err := NewSlackSink(c[0], c[1], network.Client())
+		if err == nil {
+			err = network.Policy.CheckURL(c[1])
+		}
+		addChat("slack:"+c[0], cs, err)
+	}
+	discord, err := parseChatChannels(f.discordWebhooks)
+	p.Check("discord channels", true, err)
+	for _, c := range discord {
+		cs, err := NewDiscordSink(c[0], c[1], network.Client())
+		if err == nil {
+			err = network.Policy.CheckURL(c[1])
+		}
+		addChat("discord:"+c[0], cs, err)
+	}
+	telegram, err := parseChatChannels(f.telegramChats)
+	p.Check("telegram chats", true, err)
+	for _, c := range telegram {
+		cs, err := NewTelegramSink(c[0], c[1], f.telegramToken, network.Client())
+		if err == nil {
+			err = network.Policy.CheckURL(telegramAPI)
+		}
+		addChat("telegram:"+c[0], cs, err)
+	}
+}
+
+// Sinks de colas: codificación común y esquema registrado por destino
+func setupQueueSinks(f *setupFlags, network *Network, addSink sinkAdder) {
+	queueEncoder := func(subject string) (Encoder, error) {
+		if f.schemaRegistry != "" {
+			if err := network.Policy.CheckURL(f.schemaRegistry); err != nil {
+				return nil, err
+			}
+		}
+		return NewQueueEncoder(context.Background(), f.queueEncoding, f.schemaRegistry, subject, network.Client())
+	}
+	if f.natsURL != "" {
+		var ns *natsSink
+		enc, err := queueEncoder(f.natsStream + "-value")
+		if err == nil {
+			ns, err = NewNATSSink(f.natsURL, f.natsSubject, f.natsStream, f.natsCreds, f.natsCA, enc, network)
+		}
+		addSink("nats:"+f.natsStream, ns, err)
+	}
+	if f.redisSinkURL != "" {
+		var rs *redisSink
+		enc, err := queueEncoder(cmp.Or(f.redisStream, f.redisChannel) + "-value")
+		if err == nil {
+			rs, err = NewRedisSink(f.redisSinkURL, f.redisChannel, f.redisStream, f.redisStreamMaxLen, enc, network)
+		}
+		name := "redis"
+		if rs != nil {
+			name = rs.Name()
+		}
+		addSink(name, rs, err)
+	}
+	if f.mqttURL != "" {
+		var ms *mqttSink
+		enc, err := queueEncoder(f.mqttTopic + "-value")
+		if err == nil {
+			ms, err = NewMQTTSink(f.mqttURL, f.mqttTopic, f.mqttQoS, f.mqttUser, f.mqttPassword, f.mqttCA, "gctwatch-"+f.instanceID, enc, network)
+		}
+		name := "mqtt"
+		if ms != nil {
+			name = ms.Name()
+		}
+		addSink(name, ms, err)
+	}
+	if f.sqsQueueURL != "" {
+		var qs *awsSink
+		enc, err := queueEncoder(path.Base(f.sqsQueueURL) + "-value")
+		if err == nil {
+			qs, err = NewSQSSink(f.sqsQueueURL, f.awsRegion, enc, network)
+		}
+		addSink("sqs:"+path.Base(f.sqsQueueURL), qs, err)
+	}
+	if f.snsTopicARN != "" {
+		var ts *awsSink
+		topic := f.snsTopicARN[strings.LastIndex(f.snsTopicARN, ":")+1:]
+		enc, err := queueEncoder(topic + "-value")
+		if err == nil {
+			ts, err = NewSNSSink(f.snsTopicARN, enc, network)
+		}
+		addSink("sns:"+topic, ts, err)
+	}
+}
+
+// Qué se entrega: muestreo, redacción, deduplicación y supresión
+func setupDelivery(f *setupFlags, manager *CTLogsManager, network *Network, p *Preflight) {
+	if f.sampleRates != "" {
+		var err error
+		manager.Sampling, err = ParseSampleRates(f.sampleRates)
+		p.Check("sample rates", true, err)
+	}
+	if f.redact != "" {
+		var key []byte
+		var err error
+		if f.redactKey != "" {
+			key, err = os.ReadFile(f.redactKey)
+		}
+		if err == nil {
+			key = []byte(strings.TrimSpace(string(key)))
+			manager.Redactor, err = ParseRedaction(f.redact, splitList(f.redactSinks), key)
+		}
+		p.Check("redaction", true, err)
+	}
+	if f.dedupWindow > 0 || f.suppressWindow > 0 {
+		store, err := OpenStateStore(f.stateStore, network)
+		if err == nil {
+			if c, ok := store.(SinkChecker); ok {
+				err = c.Check()
+			}
+		}
+		if p.Check("state store "+f.stateStore, true, err) {
+			manager.Dedup = &Dedup{Store: store, Window: f.dedupWindow, SuppressWindow: f.suppressWindow, Health: manager.Health}
+		}
+	}
+}
+
+// Cola de proceso y lo que la rodea: checkpoints, contrapresión, archivo de
+// entradas, auditoría de canarios y recepción por /ingest
+func setupPipeline(f *setupFlags, manager *CTLogsManager, network *Network, p *Preflight) {
+	if f.checkpointStore != "" {
+		store, err := OpenCheckpointStore(f.checkpointStore, f.instanceID,
+			CheckpointFlush{Interval: f.checkpointFlush, Entries: f.checkpointEntries, Fsync: f.checkpointFsync}, network)
+		if err == nil {
+			if c, ok := store.(SinkChecker); ok {
+				err = c.Check()
+			}
+		}
+		if p.Check("checkpoint store "+f.checkpointStore, true, err) {
+			manager.Checkpoints, manager.LeaseTTL = store, f.leaseTTL
+		}
+	}
+	if p.Check("backpressure policy "+f.backpressure, true, checkBackpressure(f.backpressure)) {
+		manager.Backpressure = f.backpressure
+	}
+	if f.emitRate > 0 {
+		burst := f.emitBurst
+		if burst <= 0 {
+			burst = int(math.Ceil(f.emitRate))
+		}
+		manager.Throttle = NewEmitThrottle(f.emitRate, burst)
+		if f.backpressure == BackpressureDrop {
+			p.Check("emit throttle", false, fmt.Errorf("bursts over -emit-rate will fill the processing queue and drop entries (use -backpressure block or spill)"))
+		}
+	}
+	if f.backpressure == BackpressureSpill {
+		spill, err := OpenSpillQueue(f.spillQueue, f.spillMax)
+		if p.Check("spill queue "+f.spillQueue, true, err) {
+			manager.Spill = spill
+		}
+	}
+	if f.archive != "" {
+		archive, err := OpenEntryArchive(f.archive, f.archiveMax)
+		if p.Check("entry archive "+f.archive, true, err) {
+			manager.Archive = archive
+		}
+	}
+	if f.canaryAudit != "" {
+		audit, err := OpenCanaryAudit(f.canaryAudit)
+		if p.Check("canary audit "+f.canaryAudit, true, err) {
+			manager.CanaryAudit = audit
+		}
+	}
+	if f.ingestToken != "" {
+		receiver, err := NewReceiver(f.ingestToken)
+		if p.Check("ingest receiver", true, err) {
+			manager.Receiver = receiver
+		}
+	}
+	if f.adminToken != "" {
+		token, err := readBearerToken(f.adminToken, "admin")
+		if p.Check("admin token", true, err) {
+			manager.AdminToken = token
+		}
+	}
+}
+
+// Enriquecedores, en el orden en que se ejecutan. Va después de setupPipeline:
+// el de ACME usa el almacén de estado y el receptor de /ingest.
+func setupEnrichers(f *setupFlags, manager *CTLogsManager, network *Network, p *Preflight) {
+	if f.revocationTags != "" {
+		manager.Enrichers = append(manager.Enrichers, enricherConfig{
+			Enricher: NewRevocationEnricher(network.Client()), Tags: splitList(f.revocationTags),
+		})
+	}
+	if f.crtshLinks {
+		manager.Enrichers = append(manager.Enrichers, enricherConfig{
+			Enricher: NewCrtShEnricher(network.Client(), f.crtshRate, splitList(f.crtshResolve)),
+		})
+	}
+	if f.acmeAccounts != "" {
+		var store StateStore
+		if manager.Dedup != nil {
+			store = manager.Dedup.Store
+		}
+		issuance, err := NewIssuanceEnricher(f.acmeAccounts, store)
+		if p.Check("ACME accounts "+f.acmeAccounts, false, err) {
+			manager.Issuance = issuance
+			manager.Enrichers = append(manager.Enrichers, enricherConfig{Enricher: issuance, Tags: splitList(f.acmeTags)})
+			if manager.Receiver == nil {
+				p.Check("ACME issuance records", false, fmt.Errorf("no records without -ingest-token-file, every issuance will be flagged"))
+			}
+		}
+	}
+	if f.zoneFiles != "" {
+		zones, err := NewZoneEnricher(splitList(f.zoneFiles))
+		if p.Check("zone files "+f.zoneFiles, false, err) {
+			manager.Enrichers = append(manager.Enrichers, enricherConfig{Enricher: zones, Tags: splitList(f.zoneTags)})
+		}
+	}
+	if f.sbKey != "" {
+		sb, err := NewSafeBrowsingEnricher(f.sbService, f.sbKey, f.sbTTL, network.Client())
+		if err == nil {
+			err = network.Policy.CheckURL(sb.Endpoint())
+		}
+		if p.Check("reputation "+f.sbService, false, err) {
+			manager.Enrichers = append(manager.Enrichers, enricherConfig{Enricher: sb, Tags: splitList(f.sbTags)})
+		}
+	}
+	if f.vtKey != "" {
+		vt, err := NewVirusTotalEnricher(f.vtKey, f.vtRate, f.vtTTL, network.Client())
+		if err == nil {
+			err = network.Policy.CheckURL(vt.Endpoint())
+		}
+		if p.Check("reputation virustotal", false, err) {
+			manager.Enrichers = append(manager.Enrichers, enricherConfig{Enricher: vt, Tags: splitList(f.vtTags)})
+		}
+	}
+	if f.scorer != "" {
+		scorer, err := OpenScorer(f.scorer, network)
+		if p.Check("scorer", false, err) {
+			manager.Scorer = scorer
+			manager.Enrichers = append(manager.Enrichers, enricherConfig{Enricher: NewScoreEnricher(scorer, f.scoreTimeout), Tags: splitList(f.scoreTags)})
+		}
+	}
+	if f.luaScript != "" {
+		// Después de los demás enriquecedores, para que enrich vea sus datos
+		script, err := LoadLuaScript(f.luaScript)
+		if p.Check("script "+f.luaScript, true, err) {
+			manager.Script = script
+			if script.Enriches() {
+				manager.Enrichers = append(manager.Enrichers, enricherConfig{Enricher: NewScriptEnricher(script)})
+			}
+		}
+	}
+}
+
+// Parsea listas "a,b,c" ignorando espacios y elementos vacíos
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// Parsea listas "clave=valor,clave=valor"
+func parseKeyValues(s string) map[string]string {
+	out := make(map[string]string)
+	for _, kv := range parseKeyValueList(s) {
+		out[kv.Key] = kv.Value
+	}
+	return out
+}
+
+type keyValue struct{ Key, Value string }
+
+// Como parseKeyValues, en el orden en que aparecen (una clave repetida se
+// queda en su primera posición con el último valor)
+func parseKeyValueList(s string) []keyValue {
+	var out []keyValue
+	for _, kv := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(kv), "=")
+		if !ok || k == "" {
+			continue
+		}
+		if i := slices.IndexFunc(out, func(e keyValue) bool { return e.Key == k }); i >= 0 {
+			out[i].Value = v
+			continue
+		}
+		out = append(out, keyValue{k, v})
+	}
+	return out
+}
+
+// Carga reglas de filtrado
+func LoadRules(path string, verifier *SignatureVerifier) (RegexRules, error) {
+	data, err := readVerified(path, verifier)
+	if err != nil {
+		return nil, err
+	}
+	return parseRules(data)
 }
 
 // "Constructor"
-func NewLogManager(url string, rules RegexRules) (*CTLogsManager, error) {
+func NewLogManager(url string, rules RegexRules, network *Network) (*CTLogsManager, error) {
 	ctx, cancel := context.WithCancel(context.Background())
+	outCtx, outCancel := context.WithCancel(context.Background())
 	mng := &CTLogsManager{
-		logListURL:   url,
-		filtering:    rules,
-		context:      ctx,
-		cancel:       cancel,
-		PollInterval: 5 * time.Second,
-		OutputChan:   make(chan CertTransp.LogEntry, 1000),
+		LogLists:         []*LogListSource{{Name: "google", URL: url, Cache: defaultLogListCache()}},
+		MergePolicy:      MergeUnion,
+		context:          ctx,
+		cancel:           cancel,
+		outCtx:           outCtx,
+		outCancel:        outCancel,
+		ShutdownTimeout:  30 * time.Second,
+		httpClient:       network.HTTPClient(),
+		network:          network,
+		PollInterval:     5 * time.Second,
+		Workers:          5,
+		MaxResponseBytes: DefaultMaxResponseBytes,
+		MaxLogListBytes:  DefaultMaxLogListBytes,
+		LogListTimeout:   30 * time.Second,
+		OutputChan:       make(chan SourcedEntry, 1000),
+		Health:           NewHealth(),
+		Maintenance:      &Maintenance{},
+		Bandwidth:        NewBandwidth(0, nil),
+		InstanceID:       defaultInstanceID(),
+		LeaseTTL:         DefaultLeaseTTL,
+		WindowSize:       DefaultWindowSize,
+		InitConcurrency:  16,
+		InitTimeout:      time.Minute,
 	}
+	mng.Clock = NewClockCheck(DefaultClockSkewTolerance, mng.Health)
+	mng.SetRules(rules)
 	return mng, nil
 }
 
 // Ciclo de vida
 func (mngr *CTLogsManager) NormalizeLogs() error {
-	ll, err := mngr.fetchLogList()
+	names, lists, loaded, err := mngr.loadLogLists()
 	if err != nil {
 		return err
 	}
-	for _, operator := range ll.Operators {
-		for _, log := range operator.Logs {
-			mngr.initLogSource(log.URL, log.Description, log.State, log.TemporalInterval.EndExclusive, log.MMD)
+	mngr.loadedLists = loaded
+	mngr.logHTTPClient = withResponseLimit(mngr.httpClient, mngr.MaxResponseBytes)
+	candidates := append(mergeLogLists(names, lists, mngr.MergePolicy), extraLogCandidates(mngr.ExtraLogs)...)
+	mngr.coverage.listed = candidates
+	mngr.initLogSources(mngr.filterLogs(candidates))
+	return nil
+}
+
+// Descarga (o toma la empaquetada con -offline) las listas de logs. Solo la
+// principal es imprescindible.
+func (mngr *CTLogsManager) loadLogLists() ([]string, []*loglist3.LogList, []InventoryLogList, error) {
+	if mngr.Offline {
+		ll, err := loadBundledLogList()
+		if err != nil {
+			return nil, nil, nil, err
 		}
-		for _, log := range operator.TiledLogs {
-			mngr.initLogSource(log.MonitoringURL, log.Description, log.State, log.TemporalInterval.EndExclusive, log.MMD)
+		return []string{"bundled"}, []*loglist3.LogList{ll}, []InventoryLogList{newInventoryLogList("bundled", "", ll)}, nil
+	}
+	var names []string
+	var lists []*loglist3.LogList
+	var loaded []InventoryLogList
+	for i, src := range mngr.LogLists {
+		ll, err := mngr.fetchLogList(src)
+		if err != nil {
+			if i == 0 {
+				return nil, nil, nil, err
+			}
+			log.Printf("WARNING: skipping log list %s: %v", src.Name, err)
+			mngr.Health.Set("loglist:"+src.Name, false, err)
+			continue
 		}
+		mngr.Health.Set("loglist:"+src.Name, i == 0, nil)
+		names = append(names, src.Name)
+		lists = append(lists, ll)
+		loaded = append(loaded, newInventoryLogList(src.Name, src.URL, ll))
 	}
-	return nil
+	return names, lists, loaded, nil
 }
 
 // stream
 func (mngr *CTLogsManager) StartStreaming() {
-	go mngr.consumeLogOutputs(5)
+	for i, sink := range mngr.Sinks {
+		opts, ok := mngr.SinkOptions[sinkKind(sink.Name())]
+		if !ok {
+			opts = defaultSinkOptions
+		}
+		// Contexto propio: las colas se vacían al parar aunque se cancele el de captura
+		d := newSinkDispatcher(context.Background(), sink, opts)
+		// El primer sink es el principal: si falla, el servicio está caído
+		d.health, d.critical = mngr.Health, i == 0
+		mngr.dispatchers = append(mngr.dispatchers, d)
+		if mngr.Matches != nil && sink == Sink(mngr.Matches) {
+			mngr.matchesDispatcher = d
+		}
+	}
+	mngr.outWG.Add(1)
+	go func() {
+		defer mngr.outWG.Done()
+		mngr.consumeLogOutputs(mngr.Workers)
+	}()
+	if mngr.Spill != nil {
+		sources := make(map[string]*CTLogSource, len(mngr.sources))
+		for i := range mngr.sources {
+			sources[mngr.sources[i].Source] = &mngr.sources[i]
+		}
+		// En wg: tiene que dejar de escribir en OutputChan antes de que se cierre
+		mngr.wg.Add(1)
+		go func() {
+			defer mngr.wg.Done()
+			mngr.Spill.Replay(mngr.context, mngr.OutputChan, sources)
+		}()
+	}
+	if mngr.Receiver != nil {
+		mngr.wg.Add(1)
+		go func() {
+			defer mngr.wg.Done()
+			mngr.Receiver.forward(mngr.context, mngr.OutputChan)
+		}()
+	}
+	mngr.stats.StartedAt = time.Now().UTC()
+	if mngr.RemoteRules != nil {
+		mngr.wg.Add(1)
+		go mngr.watchRemoteRules(mngr.RemoteRules)
+	}
+	mngr.wg.Add(1)
+	go mngr.watchRuleExpiry()
+	if mngr.HeartbeatEvery > 0 {
+		mngr.wg.Add(1)
+		go mngr.runHeartbeat(mngr.HeartbeatEvery, mngr.HeartbeatRoute)
+	}
+	if mngr.InventoryFile != "" {
+		mngr.wg.Add(1)
+		go mngr.runInventory(mngr.InventoryFile, mngr.InventoryEvery)
+	}
+	mngr.checkCoverage(mngr.coverage.listed, mngr.loadedLists)
+	if mngr.CoverageEvery > 0 {
+		mngr.wg.Add(1)
+		go mngr.runCoverage(mngr.CoverageEvery)
+	}
+	if mngr.Events != nil {
+		mngr.eventsWG.Add(1)
+		go mngr.runEvents()
+	}
 	for i := range mngr.sources {
 		mngr.wg.Add(1)
 		go mngr.consumeLogInputs(&mngr.sources[i])
 	}
 }
 
+// Parada ordenada: deja de leer los logs, trata lo que queda en OutputChan
+// (hasta ShutdownTimeout), vacía las colas de los sinks y guarda los checkpoints
 func (mngr *CTLogsManager) StopStreaming() {
 	mngr.cancel()
 	mngr.wg.Wait()
+	pending := len(mngr.OutputChan)
 	close(mngr.OutputChan)
+	drained := make(chan struct{})
+	go func() {
+		mngr.outWG.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(mngr.ShutdownTimeout):
+		log.Printf("WARNING: shutdown timeout, discarding %d queued entries", len(mngr.OutputChan))
+		mngr.outCancel()
+		<-drained
+	}
+	mngr.outCancel()
+	mngr.eventsWG.Wait()
+	log.Printf("stopped reading logs, %d queued entries processed", pending-len(mngr.OutputChan))
+	for _, d := range mngr.dispatchers {
+		if err := d.Close(); err != nil {
+			log.Printf("WARNING: closing sink %s: %v", d.sink.Name(), err)
+		}
+	}
+	if mngr.Checkpoints != nil {
+		mngr.releaseCheckpoints()
+	}
+	if mngr.Spill != nil {
+		if n := mngr.Spill.Len(); n > 0 {
+			log.Printf("spill queue %s: %d entries left for the next run", mngr.Spill.Name(), n)
+		}
+		if err := mngr.Spill.Close(); err != nil {
+			log.Printf("WARNING: closing spill queue: %v", err)
+		}
+	}
+	if mngr.Archive != nil {
+		if err := mngr.Archive.Close(); err != nil {
+			log.Printf("WARNING: closing entry archive: %v", err)
+		}
+	}
+	if mngr.CanaryAudit != nil {
+		if err := mngr.CanaryAudit.Close(); err != nil {
+			log.Printf("WARNING: closing canary audit: %v", err)
+		}
+	}
+	for _, pl := range mngr.Plugins {
+		if err := pl.Close(); err != nil {
+			log.Printf("WARNING: closing plugin %s: %v", pl.Name, err)
+		}
+	}
+	if mngr.Scorer != nil {
+		if err := mngr.Scorer.Close(); err != nil {
+			log.Printf("WARNING: closing scorer: %v", err)
+		}
+	}
+	if mngr.Dedup != nil {
+		if err := mngr.Dedup.Store.Close(); err != nil {
+			log.Printf("WARNING: closing state store: %v", err)
+		}
+	}
+	if mngr.DataDir != nil {
+		mngr.DataDir.Close()
+	}
 }
 
 // Tratamiento
 
-// Obtener JSON original y convertirlo en LogList3
-func (mngr *CTLogsManager) fetchLogList() (*loglist3.LogList, error) {
-	formattedMsg := "failed to fetch CT log list: %w"
-	resp, err := http.Get(mngr.logListURL)
-	if err != nil {
-		return nil, fmt.Errorf(formattedMsg, err)
+// Obtener JSON original y convertirlo en LogList3 (con la caché como respaldo)
+func (mngr *CTLogsManager) fetchLogList(src *LogListSource) (*loglist3.LogList, error) {
+	formattedMsg := "failed to fetch CT log list " + src.Name + ": %w"
+	list, sig, err := mngr.downloadLogList(src)
+	if err == nil {
+		err = mngr.verifyLogList(src, list, sig)
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf(formattedMsg, err)
+	var ll *loglist3.LogList
+	if err == nil {
+		ll, err = loglist3.NewFromJSON(list)
+	}
+	if err == nil {
+		if cerr := saveLogListCache(src, list, sig); cerr != nil {
+			log.Printf("WARNING: failed to cache log list: %v", cerr)
+		}
+		return ll, nil
 	}
 
-	ll, err := loglist3.NewFromJSON(body)
-	if err != nil {
+	// Respaldo: última lista válida
+	list, sig, cerr := loadLogListCache(src)
+	if cerr != nil {
 		return nil, fmt.Errorf(formattedMsg, err)
 	}
+	if verr := mngr.verifyLogList(src, list, sig); verr != nil {
+		return nil, fmt.Errorf(formattedMsg+" (cached copy: %v)", err, verr)
+	}
+	ll, perr := loglist3.NewFromJSON(list)
+	if perr != nil {
+		return nil, fmt.Errorf(formattedMsg+" (cached copy: %v)", err, perr)
+	}
+	log.Printf("WARNING: using cached log list %s: %v", src.Cache, err)
 	return ll, nil
 }
 
 // Descarta no usables
 func (mngr *CTLogsManager) isUsableLog(desc string, state *loglist3.LogStates, endExclusive time.Time, mmd int32) bool {
-	now := time.Now()
 	// Fake log
 	if strings.Contains(desc, "bogus") || strings.Contains(desc, "placeholder") {
 		return false
@@ -167,8 +1636,8 @@ func (mngr *CTLogsManager) isUsableLog(desc string, state *loglist3.LogStates, e
 	if state.LogStatus() == loglist3.RetiredLogStatus || state.LogStatus() == loglist3.RejectedLogStatus {
 		return false
 	}
-	// No actual
-	if now.After(endExclusive) {
+	// No actual (sin intervalo temporal = sin fecha de fin)
+	if mngr.Clock.Expired(desc, endExclusive) {
 		return false
 	}
 	// Latencia > 24h
@@ -179,31 +1648,72 @@ func (mngr *CTLogsManager) isUsableLog(desc string, state *loglist3.LogStates, e
 }
 
 // Conversión a CTLogSource
-func (mngr *CTLogsManager) initLogSource(source string, desc string, state *loglist3.LogStates, endExclusive time.Time, mmd int32) error {
-	if mngr.isUsableLog(desc, state, endExclusive, mmd) {
-		client, err := client.New(source, &http.Client{}, jsonclient.Options{})
+func (mngr *CTLogsManager) initLogSource(ctx context.Context, c *logCandidate) (*CTLogSource, error) {
+	source, desc := c.url, c.desc
+	if mngr.MergePolicy == MergeStrictest && len(c.rejectedBy) > 0 {
+		return nil, fmt.Errorf("source log %s rejected/retired in %v: %w", desc, c.rejectedBy, errUnusableLog)
+	}
+	if mngr.isUsableLog(desc, c.state, c.endExclusive, c.mmd) {
+		endpoints, err := mngr.newLogEndpoints(source, desc)
 		if err != nil {
-			return fmt.Errorf("failed to create client for %s: %w", desc, err)
+			return nil, err
+		}
+		lsrc := CTLogSource{WindowSize: mngr.WindowSize, Source: source, Lists: c.lists, Endpoints: endpoints, Stats: &FetchStats{},
+			MMD: time.Duration(c.mmd) * time.Second, LogID: c.id, Description: desc, Operator: c.operator,
+			ListState: logStatusName(c.state), ShardStart: c.startInclusive, ShardEnd: c.endExclusive}
+		if lsrc.MMD == 0 {
+			lsrc.MMD = 24 * time.Hour
 		}
-		sth, err := client.GetSTH(mngr.context)
+		// Con checkpoint se empieza ya desde él; el STH llega en el primer sondeo
+		resumed, err := mngr.resumeFromCheckpoint(ctx, &lsrc)
 		if err != nil {
-			return fmt.Errorf("failed to get STH for %s: %w", desc, err)
+			log.Printf("WARNING: %v", err)
 		}
-		lsrc := CTLogSource{WindowSize: 1000, LastSize: sth.TreeSize, Source: source, Client: client}
-		mngr.sources = append(mngr.sources, lsrc)
-		return nil
+		if resumed {
+			lsrc.Stats.position.Store(lsrc.LastSize)
+			return &lsrc, nil
+		}
+		sth, err := initialSTH(ctx, endpoints, source, desc)
+		if err != nil {
+			return nil, err
+		}
+		lsrc.LastSize = sth.TreeSize
+		lsrc.Stats.treeSize.Store(sth.TreeSize)
+		lsrc.Stats.position.Store(sth.TreeSize)
+		mngr.checkClock(&lsrc, sth.Timestamp)
+		return &lsrc, nil
 	}
-	return fmt.Errorf("Inusable source log %s", desc)
+	return nil, fmt.Errorf("Inusable source log %s: %w", desc, errUnusableLog)
 }
 
 // Obtener entradas de log en base a "paginacion"
 func (mngr *CTLogsManager) fetchEntries(source *CTLogSource) error {
-
-	sth, err := source.Client.GetSTH(mngr.context)
+	ep := source.pickEndpoint()
+	t0 := time.Now()
+	sth, err := ep.Client.GetSTH(mngr.context)
 	if err != nil {
-		return fmt.Errorf("failed to get STH: %w", err)
+		fe := newFetchError(source.Source, "get-sth", ep.URL, err)
+		ep.observe(source.Source, 0, fe)
+		metricSTHErrors.WithLabelValues(source.Source).Inc()
+		return fe
+	}
+	ep.observe(source.Source, time.Since(t0), nil)
+	mngr.checkClock(source, sth.Timestamp)
+	source.Stats.treeSize.Store(max(sth.TreeSize, source.Stats.treeSize.Load()))
+	if sth.TreeSize < source.LastSize {
+		// Una réplica atrasada no debe volver a usarse hasta que se ponga al día
+		err := fmt.Errorf("STH tree size %d from %s smaller than last seen %d", sth.TreeSize, ep.URL, source.LastSize)
+		fe := &FetchError{Kind: FetchErrInconsistent, Op: "get-sth", Endpoint: ep.URL, Err: err}
+		metricFetchErrors.WithLabelValues(source.Source, fe.Op, string(fe.Kind)).Inc()
+		ep.observe(source.Source, 0, fe)
+		metricSTHErrors.WithLabelValues(source.Source).Inc()
+		mngr.Events.Publish("sth_inconsistency", source.Source, "%v", err)
+		return fe
 	}
-	if sth.TreeSize == source.LastSize {
+	defer func() {
+		metricLogLag.WithLabelValues(source.Source).Set(float64(sth.TreeSize - source.LastSize))
+	}()
+	if sth.TreeSize == source.LastSize || mngr.Bandwidth.Paused(source, sth.TreeSize) {
 		return nil
 	}
 	start := source.LastSize
@@ -211,16 +1721,71 @@ func (mngr *CTLogsManager) fetchEntries(source *CTLogSource) error {
 	if end > sth.TreeSize {
 		end = sth.TreeSize
 	}
-	entries, err := source.Client.GetEntries(mngr.context, int64(start), int64(end))
+	// get-entries usa rango inclusivo
+	t0 = time.Now()
+	raw, err := ep.Client.GetRawEntries(mngr.context, int64(start), int64(end-1))
+	var entries []CertTransp.LogEntry
+	partial := false // lote cortado en una entrada mal formada
 	if err != nil {
-		return fmt.Errorf("failed to get entries: %w", err)
-	}
-	for _, entry := range entries {
-		select {
-		case mngr.OutputChan <- entry:
+		err = newFetchError(source.Source, "get-entries", ep.URL, err)
+	} else if entries, err = parseLeafEntries(start, raw.Entries); err != nil {
+		metricFetchErrors.WithLabelValues(source.Source, "get-entries", string(FetchErrMalformed)).Inc()
+		bad := start + uint64(len(entries))
+		skip := source.malformedEntry(bad)
+		switch {
+		case len(entries) > 0:
+			// Se tratan las anteriores; desde la que falla se vuelve a pedir
+			// en el siguiente sondeo
+			log.Printf("WARNING: log %s: %v; re-requesting from entry %d", source.Source, err, bad)
+			raw.Entries, err, partial = raw.Entries[:len(entries)], nil, true
+		case skip:
+			// Siempre falla: se salta, pero no en silencio
+			log.Printf("WARNING: log %s: skipping entry %d after %d attempts: %v", source.Source, bad, malformedEntryAttempts, err)
+			mngr.Events.Publish("coverage_gap", source.Source, "entry %d skipped, unparseable after %d attempts: %v", bad, malformedEntryAttempts, err)
+			metricEntriesSkipped.WithLabelValues(source.Source).Inc()
+			source.LastSize, err = bad+1, nil
+			return nil
 		default:
-			fmt.Println("WARNING: Dropping log entry, channel full")
+			err = &FetchError{Kind: FetchErrMalformed, Op: "get-entries", Endpoint: ep.URL, Err: err}
+		}
+	}
+	ep.observe(source.Source, time.Since(t0), err)
+	source.Stats.ObserveFetch(source, time.Since(t0), len(entries), err)
+	// Un lote cortado no dice nada del tope del log: no se toma como tal
+	if !partial {
+		mngr.Window.Adjust(source, end-start, len(entries), time.Since(t0), err)
+	}
+	if err != nil {
+		return err
+	}
+	if uint64(len(entries)) > end-start {
+		err := fmt.Errorf("log returned %d entries, requested %d", len(entries), end-start)
+		mngr.Events.Publish("sth_inconsistency", source.Source, "%s: %v", ep.URL, err)
+		metricFetchErrors.WithLabelValues(source.Source, "get-entries", string(FetchErrInconsistent)).Inc()
+		return &FetchError{Kind: FetchErrInconsistent, Op: "get-entries", Endpoint: ep.URL, Err: err}
+	}
+	if mngr.Archive != nil {
+		err := mngr.Archive.Append(source.Source, start, raw.Entries, sth)
+		if mngr.Health.Set("archive", false, err) && err != nil {
+			log.Printf("WARNING: %v", err)
+		}
+	}
+	source.LastSize = start + uint64(len(entries))
+	metricEntriesFetched.WithLabelValues(source.Source).Add(float64(len(entries)))
+	if n := len(entries); n > 0 {
+		if err := mngr.Clock.ObserveEntry(source.Source, entries[n-1].Leaf.TimestampedEntry.Timestamp); err != nil {
+			log.Printf("WARNING: log %s: %v", source.Source, err)
 		}
+		mngr.checkEntryAge(source, entries[n-1].Leaf.TimestampedEntry.Timestamp, source.LastSize == sth.TreeSize)
+	}
+	batch := source.acked.Add(start, len(entries))
+	queued := make([]SourcedEntry, len(entries))
+	for i, entry := range entries {
+		queued[i] = SourcedEntry{Source: source, Entry: entry, batch: batch}
+	}
+	dropped := mngr.enqueue(source, batch, queued)
+	if dropped > 0 {
+		mngr.Events.Publish("coverage_gap", source.Source, "%d of %d entries in [%d, %d) dropped with the processing queue full", dropped, len(entries), start, source.LastSize)
 	}
 	return nil
 
@@ -232,31 +1797,163 @@ func (mngr *CTLogsManager) consumeLogInputs(source *CTLogSource) {
 	pollInterval := mngr.PollInterval
 	ticker := time.NewTicker(pollInterval)
 	defer ticker.Stop()
-	if err := mngr.fetchEntries(source); err != nil {
-	}
+	mngr.poll(source)
 	for {
 		select {
 		case <-mngr.context.Done():
 			return
 		case <-ticker.C:
-			if err := mngr.fetchEntries(source); err != nil {
-			}
+			mngr.poll(source)
 		}
 	}
 }
 
-// Aplica filtros
-func (mngr *CTLogsManager) checkCertMatch(cert *x509.Certificate) (bool, string) {
-	found := false
-	var tag string
-	var re *regexp.Regexp
-	for tag, re = range mngr.filtering {
-		if re.MatchString(cert.Subject.CommonName) {
-			found = true
-			break
+// Una ronda de lectura, si la fuente nos corresponde
+func (mngr *CTLogsManager) poll(source *CTLogSource) {
+	// Suspendida: sin renovar la concesión, por si otra instancia llega al log
+	if !mngr.Breaker.Allow(source) || time.Now().Before(source.retryAt) || !mngr.claim(source) {
+		return
+	}
+	err := mngr.fetchEntries(source)
+	mngr.reportFetch(source, err)
+	if err != nil && mngr.context.Err() != nil {
+		return
+	}
+	mngr.recordSourceResult(source, err, source.scheduleRetry(err, mngr.PollInterval))
+	if mngr.Checkpoints != nil {
+		mngr.saveCheckpoint(mngr.context, source)
+	}
+}
+
+// Estado de la fuente; se registra solo al cambiar
+func (mngr *CTLogsManager) reportFetch(source *CTLogSource, err error) {
+	if err != nil && mngr.context.Err() != nil {
+		return
+	}
+	if mngr.Health.Set("log:"+source.Source, false, err) {
+		if err != nil {
+			log.Printf("WARNING: log %s failing: %v", source.Source, err)
+			mngr.Events.Publish("log_failing", source.Source, "%v", err)
+		} else {
+			log.Printf("log %s ok", source.Source)
+			mngr.Events.Publish("log_recovered", source.Source, "log %s ok", source.Source)
+		}
+	}
+}
+
+// Coincidencia de una regla con un certificado
+type ruleMatch struct {
+	Tag   string
+	Rule  *Rule
+	Value string // valor del certificado que coincidió
+	From  string // "" si es de una regla; plugin:<nombre> o script
+}
+
+// Aplica filtros. Devuelve todas las reglas que coinciden, la principal
+// primero: las canario, después de más a menos severidad y por tag, para que
+// el orden no dependa del recorrido del mapa.
+func (mngr *CTLogsManager) checkCertMatch(values *certValues) []ruleMatch {
+	mngr.rulesMu.RLock()
+	defer mngr.rulesMu.RUnlock()
+	var matches []ruleMatch
+	candidates := values.Candidates(mngr.ruleFilter)
+	for tag, rule := range mngr.filtering {
+		if candidates.Skip(rule) {
+			continue
+		}
+		if v, ok := rule.Match(values); ok {
+			matches = append(matches, ruleMatch{Tag: tag, Rule: rule, Value: v})
+		}
+	}
+	sortMatches(matches)
+	return matches
+}
+
+func sortMatches(matches []ruleMatch) {
+	rank := func(m ruleMatch) int {
+		if m.Rule.Class == RuleClassCanary {
+			return len(ruleSeverities)
+		}
+		return slices.Index(ruleSeverities, m.Rule.Info.Severity)
+	}
+	slices.SortFunc(matches, func(a, b ruleMatch) int {
+		return cmp.Or(cmp.Compare(rank(b), rank(a)), cmp.Compare(a.Tag, b.Tag))
+	})
+}
+
+// Coincidencia que no viene de una regla (script o plugin). name es el
+// valor que coincidió; por defecto el primer nombre del certificado.
+func newExtraMatch(tag, severity, description, name string, v *certValues) (ruleMatch, error) {
+	if tag == "" {
+		return ruleMatch{}, fmt.Errorf("match without tag")
+	}
+	if severity == "" {
+		severity = defaultRuleSeverity
+	}
+	if !slices.Contains(ruleSeverities, severity) {
+		return ruleMatch{}, fmt.Errorf("tag %s: invalid severity %q (low, medium, high, critical)", tag, severity)
+	}
+	if name == "" {
+		name = v.firstName()
+	}
+	info := RuleInfo{Severity: severity, Description: description}
+	return ruleMatch{Tag: tag, Rule: &Rule{Status: RuleActive, Info: info, tag: tag}, Value: name}, nil
+}
+
+// Añade coincidencias a las de las reglas; si el tag ya está se queda la
+// que había
+func mergeMatches(matches, added []ruleMatch) []ruleMatch {
+	if len(added) == 0 {
+		return matches
+	}
+	out := slices.Clone(matches)
+	for _, m := range added {
+		if !slices.ContainsFunc(out, func(o ruleMatch) bool { return o.Tag == m.Tag }) {
+			out = append(out, m)
+		}
+	}
+	sortMatches(out)
+	return out
+}
+
+// Coincidencias de los plugins y de -lua-script, que van después de las
+// reglas: el script ve los tags de todos y puede descartar el certificado
+func (mngr *CTLogsManager) extraMatches(values *certValues, matches []ruleMatch) []ruleMatch {
+	for _, pl := range mngr.Plugins {
+		if pl.Matcher == nil {
+			continue
+		}
+		added, err := pl.Match(values)
+		if mngr.Health.Set("plugin:"+pl.Name, false, err) && err != nil {
+			log.Printf("WARNING: plugin %s: %v", pl.Name, err)
+		}
+		matches = mergeMatches(matches, added)
+	}
+	if mngr.Script != nil {
+		var err error
+		matches, err = mngr.Script.Match(values, matches)
+		if mngr.Health.Set("script:match", false, err) && err != nil {
+			log.Printf("WARNING: script %v", err)
 		}
 	}
-	return found, tag
+	return matches
+}
+
+// Un solo evento por certificado: Tag es la coincidencia principal y Tags
+// todas
+func newRuleMatchEvent(matches []ruleMatch, entry SourcedEntry, cert *x509.Certificate) MatchEvent {
+	primary := matches[0]
+	ev := NewMatchEvent(primary.Tag, entry, ConvertCertificate(cert))
+	for _, m := range matches {
+		ev.Tags = append(ev.Tags, m.Tag)
+	}
+	ev.MatchedName = primary.Value
+	info := primary.Rule.Info
+	ev.Rule = &info
+	if t := primary.Rule.Typosquat; t != nil {
+		ev.Typosquat, _ = t.Find(primary.Value)
+	}
+	return ev
 }
 
 // Acciones a realizar con certificados obtenidos
@@ -268,32 +1965,57 @@ func (mngr *CTLogsManager) consumeLogOutputs(workers int) {
 			defer wg.Done()
 			for {
 				select {
-				case <-mngr.context.Done():
+				case <-mngr.outCtx.Done():
 					return
-				case entry := <-mngr.OutputChan:
-
-					if entry.X509Cert == nil {
-						continue
+				case entry, ok := <-mngr.OutputChan:
+					if !ok {
+						return
 					}
-					cert, err := x509.ParseCertificate(entry.X509Cert.Raw)
-					if err != nil {
-						continue
-					}
-
-					found, tag := mngr.checkCertMatch(cert)
-					if !found {
-						continue
-					}
-
-					c := ConvertCertificate(cert)
-					d, err := json.Marshal(c)
-					if err != nil {
-						continue
-					}
-					fmt.Printf("%sn", tag, string(d))
+					mngr.processEntry(entry)
+					entry.batch.Done()
 				}
 			}
 		}()
 	}
 	wg.Wait()
 }
+
+// Una entrada de la cola: filtros, muestreo, deduplicación, enriquecimiento y
+// enrutado. Al volver, la entrada cuenta como procesada para el checkpoint.
+func (mngr *CTLogsManager) processEntry(entry SourcedEntry) {
+	mngr.stats.EntrySeen()
+
+	if entry.Entry.X509Cert == nil {
+		return
+	}
+	t0 := time.Now()
+	cert, err := x509.ParseCertificate(entry.Entry.X509Cert.Raw)
+	entry.Source.Stats.ObserveParse(entry.Source.Source, time.Since(t0))
+	if err != nil {
+		metricEntriesUnparsed.WithLabelValues(entry.Source.Source).Inc()
+		return
+	}
+
+	values := mngr.newCertValues(cert, entry.Source)
+	matches := mngr.extraMatches(values, mngr.checkCertMatch(values))
+	mngr.evalShadow(cert, values, entry, len(matches) > 0)
+	if len(matches) == 0 {
+		return
+	}
+
+	ev := newRuleMatchEvent(matches, entry, cert)
+	for _, tag := range ev.Tags {
+		metricRuleHits.WithLabelValues(tag).Inc()
+	}
+	mngr.stats.Match(ev.Tags)
+	if matches[0].Rule.Class == RuleClassCanary {
+		mngr.tripCanary(ev, cert, entry)
+		return
+	}
+	if !mngr.Sampling.Sample(&ev) || !mngr.Dedup.Allow(mngr.outCtx, ev) {
+		return
+	}
+	mngr.enrich(&ev, cert, entry)
+	mngr.Throttle.Wait(mngr.outCtx)
+	mngr.route(ev)
+}
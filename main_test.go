@@ -0,0 +1,28 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseKeyValueList(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []keyValue
+	}{
+		{"", nil},
+		{"b=2,a=1,c=3", []keyValue{{"b", "2"}, {"a", "1"}, {"c", "3"}}},
+		{" apple=https://valid.apple.com/ct/log_list/current_log_list.json , x", []keyValue{{"apple", "https://valid.apple.com/ct/log_list/current_log_list.json"}}},
+		{"b=2,a=1,b=3", []keyValue{{"b", "3"}, {"a", "1"}}},
+		{"=1,a=", []keyValue{{"a", ""}}},
+		{"u=https://ct.example.net/list.json?a=b", []keyValue{{"u", "https://ct.example.net/list.json?a=b"}}},
+	}
+	for _, tt := range tests {
+		// Siempre el mismo orden, no el de un mapa
+		for range 10 {
+			if got := parseKeyValueList(tt.in); !slices.Equal(got, tt.want) {
+				t.Fatalf("parseKeyValueList(%q) = %q; want %q", tt.in, got, tt.want)
+			}
+		}
+	}
+}
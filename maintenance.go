@@ -0,0 +1,113 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+/* Modo mantenimiento */
+
+// Sinks locales: siguen recibiendo eventos en mantenimiento
+var localSinkKinds = map[string]bool{"stdout": true, "file": true, "feed": true}
+
+// Los locales por tipo y el histórico de coincidencias, sea SQLite o
+// Postgres: guardarlo no notifica a nadie
+func isLocalSink(s Sink) bool {
+	if _, ok := s.(MatchStore); ok {
+		return true
+	}
+	return localSinkKinds[sinkKind(s.Name())]
+}
+
+// Máximo de eventos suprimidos que se conservan
+const maxSuppressedEvents = 1000
+
+// Evento que se habría enviado a un sink externo
+type SuppressedEvent struct {
+	Sink  string     `json:"sink"`
+	Event MatchEvent `json:"event"`
+}
+
+type MaintenanceStatus struct {
+	Enabled    bool              `json:"enabled"`
+	Reason     string            `json:"reason,omitempty"`
+	Since      time.Time         `json:"since,omitzero"`
+	Suppressed int64             `json:"suppressed"` // total desde que se activó
+	Recent     []SuppressedEvent `json:"recent,omitempty"`
+}
+
+// Mientras está activo se sigue capturando y escribiendo en los sinks locales,
+// pero no se notifica a los externos; se guarda lo que se habría enviado.
+type Maintenance struct {
+	mu         sync.Mutex
+	enabled    bool
+	reason     string
+	since      time.Time
+	suppressed int64
+	recent     []SuppressedEvent
+}
+
+func (m *Maintenance) Set(enabled bool, reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if enabled == m.enabled {
+		m.reason = reason
+		return
+	}
+	if enabled {
+		log.Printf("WARNING: maintenance mode enabled: %s", reason)
+		m.since, m.suppressed, m.recent = time.Now().UTC(), 0, nil
+	} else {
+		log.Printf("maintenance mode disabled after %s, %d notifications suppressed",
+			time.Since(m.since).Round(time.Second), m.suppressed)
+	}
+	m.enabled, m.reason = enabled, reason
+}
+
+func (m *Maintenance) Enabled() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.enabled
+}
+
+// Registra el evento si debe suprimirse para el sink; devuelve true en ese caso
+func (m *Maintenance) Suppress(s Sink, ev MatchEvent) bool {
+	if isLocalSink(s) {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.enabled {
+		return false
+	}
+	m.suppressed++
+	if len(m.recent) == maxSuppressedEvents {
+		m.recent = m.recent[1:]
+	}
+	m.recent = append(m.recent, SuppressedEvent{Sink: s.Name(), Event: ev})
+	return true
+}
+
+func (m *Maintenance) Status() MaintenanceStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return MaintenanceStatus{
+		Enabled:    m.enabled,
+		Reason:     m.reason,
+		Since:      m.since,
+		Suppressed: m.suppressed,
+		Recent:     append([]SuppressedEvent(nil), m.recent...),
+	}
+}
+
+// Entrega el evento al dispatcher salvo que el modo mantenimiento lo impida
+func (mngr *CTLogsManager) deliver(d *sinkDispatcher, ev MatchEvent) {
+	if mngr.Maintenance.Suppress(d.sink, ev) {
+		return
+	}
+	if mngr.Redactor.Applies(d.sink) {
+		ev = mngr.Redactor.Apply(ev)
+	}
+	d.Submit(ev)
+}
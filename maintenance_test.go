@@ -0,0 +1,53 @@
+package main
+
+import "testing"
+
+// Sink o histórico del que solo importa el nombre
+type namedTestSink struct {
+	Sink
+	name string
+}
+
+func (s namedTestSink) Name() string { return s.name }
+
+type namedTestMatchStore struct {
+	MatchStore
+	name string
+}
+
+func (s namedTestMatchStore) Name() string { return s.name }
+
+func TestMaintenanceSuppress(t *testing.T) {
+	tests := []struct {
+		sink     Sink
+		suppress bool
+	}{
+		{namedTestSink{name: "stdout"}, false},
+		{namedTestSink{name: "file:/var/log/gctwatch.jsonl"}, false},
+		{namedTestSink{name: "feed"}, false},
+		{namedTestMatchStore{name: "sqlite:/var/lib/gctwatch/matches.db"}, false},
+		{namedTestMatchStore{name: "postgres:db.example.net"}, false},
+		{namedTestSink{name: "webhook:https://hooks.example.net/x"}, true},
+		{namedTestSink{name: "redis:cache.example.net:6379"}, true},
+		{namedTestSink{name: "sqlite:/tmp/impostor.db"}, true}, // el nombre no basta
+	}
+	m := &Maintenance{}
+	for _, tt := range tests {
+		if m.Suppress(tt.sink, MatchEvent{}) {
+			t.Errorf("%s suppressed with maintenance disabled", tt.sink.Name())
+		}
+	}
+	m.Set(true, "test")
+	want := 0
+	for _, tt := range tests {
+		if got := m.Suppress(tt.sink, MatchEvent{}); got != tt.suppress {
+			t.Errorf("Suppress(%s) = %v; want %v", tt.sink.Name(), got, tt.suppress)
+		}
+		if tt.suppress {
+			want++
+		}
+	}
+	if st := m.Status(); st.Suppressed != int64(want) || len(st.Recent) != want {
+		t.Errorf("status after suppressing %d events = %+v", want, st)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+/* Motor de preselección de las reglas de regex (-match-engine) */
+
+var metricMatchEngineFallbacks = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gctwatch_match_engine_fallbacks_total",
+	Help: "Certificados evaluados con todas las reglas porque -match-engine no pudo preseleccionarlas (non_ascii, error).",
+}, []string{"reason"})
+
+// Motor que compila todas las regex en una sola base y recorre cada valor
+// una vez, en lugar de probar las regexp una a una. Solo preselecciona: lo
+// que marca se confirma después con la regexp de la regla, así que el
+// resultado es el mismo que sin motor, aunque el motor sea más permisivo.
+type RuleEngine interface {
+	// Marca en hits las expresiones (por su posición al compilar) que
+	// pueden coincidir con value
+	Scan(value string, hits []bool) error
+}
+
+// Motores por nombre; hyperscan solo está compilado con -tags hyperscan.
+// Además del motor devuelve qué expresiones ha compilado: las que no
+// admite se evalúan siempre con regexp.
+var ruleEngines = map[string]func(exprs []string) (RuleEngine, []bool, error){}
+
+// Motor compilado para un conjunto de reglas
+type ruleFilter struct {
+	engine   RuleEngine
+	ids      map[*Rule]int // reglas en el motor -> posición de su expresión
+	n        int
+	fields   []string // campos de esas reglas
+	defaults bool     // alguna usa los campos por defecto (y subject con -match-subject-dn)
+}
+
+// Compila las reglas de regex de todos los conjuntos, en cualquier estado,
+// para no recompilar al cambiar de estado o caducar. nil si no hay ninguna
+// que compilar.
+func newRuleFilter(name string, sets ...RegexRules) (*ruleFilter, error) {
+	build, ok := ruleEngines[name]
+	if !ok {
+		if name == "hyperscan" {
+			return nil, fmt.Errorf("hyperscan matching not available in this build (rebuild with -tags hyperscan)")
+		}
+		return nil, fmt.Errorf("unknown match engine %q (hyperscan)", name)
+	}
+	var rules []*Rule
+	for _, set := range sets {
+		for _, tag := range slices.Sorted(maps.Keys(set)) {
+			if set[tag].Regexp != nil {
+				rules = append(rules, set[tag])
+			}
+		}
+	}
+	exprs := make([]string, len(rules))
+	for i, r := range rules {
+		exprs[i] = r.String()
+	}
+	if len(exprs) == 0 {
+		return nil, nil
+	}
+	engine, compiled, err := build(exprs)
+	if err != nil {
+		return nil, err
+	}
+	f := &ruleFilter{engine: engine, ids: make(map[*Rule]int), n: len(exprs)}
+	for i, r := range rules {
+		if !compiled[i] {
+			continue
+		}
+		f.ids[r] = i
+		fields := r.Fields
+		if fields == nil {
+			fields, f.defaults = defaultRuleFields, true
+		}
+		for _, field := range fields {
+			if !slices.Contains(f.fields, field) {
+				f.fields = append(f.fields, field)
+			}
+		}
+	}
+	log.Printf("match engine %s: %d of %d regex rules compiled (the rest are evaluated with regexp)", name, len(f.ids), len(rules))
+	if len(f.ids) == 0 {
+		return nil, nil
+	}
+	return f, nil
+}
+
+// Reglas del motor que no pueden coincidir con el certificado. nil (todas
+// pueden) si algún valor no es ASCII, porque las regexp de Go con (?i)
+// pliegan mayúsculas Unicode que el motor no ve, o si el motor falla.
+type ruleCandidates struct {
+	ids  map[*Rule]int
+	hits []bool
+}
+
+// Se calculan una vez por certificado para las reglas activas y las shadow
+func (v *certValues) Candidates(f *ruleFilter) *ruleCandidates {
+	if f == nil {
+		return nil
+	}
+	if v.filter != f {
+		v.filter, v.candidates = f, f.candidates(v)
+	}
+	return v.candidates
+}
+
+func (f *ruleFilter) candidates(v *certValues) *ruleCandidates {
+	fields := f.fields
+	if f.defaults && v.subjectDN && !slices.Contains(fields, FieldSubject) {
+		fields = append(fields[:len(fields):len(fields)], FieldSubject)
+	}
+	c := &ruleCandidates{ids: f.ids, hits: make([]bool, f.n)}
+	for _, field := range fields {
+		for _, s := range v.For(field) {
+			if !isASCII(s) {
+				metricMatchEngineFallbacks.WithLabelValues("non_ascii").Inc()
+				return nil
+			}
+			if err := f.engine.Scan(s, c.hits); err != nil {
+				metricMatchEngineFallbacks.WithLabelValues("error").Inc()
+				return nil
+			}
+		}
+	}
+	return c
+}
+
+// Si la regla está en el motor y no puede coincidir
+func (c *ruleCandidates) Skip(r *Rule) bool {
+	if c == nil {
+		return false
+	}
+	i, ok := c.ids[r]
+	return ok && !c.hits[i]
+}
+
+// Activa el motor de -match-engine con las reglas cargadas
+func (mngr *CTLogsManager) SetRuleEngine(name string) error {
+	mngr.rulesMu.RLock()
+	rules, shadow := mngr.rules, mngr.shadowRules
+	mngr.rulesMu.RUnlock()
+	f, err := newRuleFilter(name, rules, shadow)
+	if err != nil {
+		return err
+	}
+	mngr.rulesMu.Lock()
+	mngr.RuleEngine, mngr.ruleFilter = name, f
+	mngr.rulesMu.Unlock()
+	return nil
+}
+
+// Recompila el motor tras cambiar las reglas. Si falla se evalúan todas con
+// regexp hasta la siguiente recarga.
+func (mngr *CTLogsManager) refreshRuleFilter() {
+	mngr.rulesMu.RLock()
+	name, rules, shadow := mngr.RuleEngine, mngr.rules, mngr.shadowRules
+	mngr.rulesMu.RUnlock()
+	if name == "" {
+		return
+	}
+	f, err := newRuleFilter(name, rules, shadow)
+	if mngr.Health.Set("match engine", false, err) && err != nil {
+		log.Printf("WARNING: match engine %s: %v (evaluating every regexp)", name, err)
+	}
+	mngr.rulesMu.Lock()
+	mngr.ruleFilter = f
+	mngr.rulesMu.Unlock()
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,72 @@
+//go:build hyperscan
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/flier/gohs/hyperscan"
+)
+
+// Compilado con -tags hyperscan (necesita cgo y libhs, la biblioteca de
+// Hyperscan o de Vectorscan en ARM, con pkg-config)
+func init() {
+	ruleEngines["hyperscan"] = newHyperscanEngine
+}
+
+// Base de Hyperscan en modo bloque con todas las expresiones. Se compilan
+// en modo prefiltro, que admite construcciones que Hyperscan no sabe
+// evaluar exactamente a cambio de dar coincidencias de más (las confirma
+// la regexp). Las que ni así compila se quedan fuera.
+type hyperscanEngine struct {
+	db      hyperscan.BlockDatabase
+	scratch sync.Pool // *hyperscan.Scratch; cada scan necesita uno propio
+}
+
+func newHyperscanEngine(exprs []string) (RuleEngine, []bool, error) {
+	compiled := make([]bool, len(exprs))
+	for i := range compiled {
+		compiled[i] = true
+	}
+	for {
+		var patterns []*hyperscan.Pattern
+		for i, expr := range exprs {
+			if compiled[i] {
+				p := hyperscan.NewPattern(expr, hyperscan.SingleMatch|hyperscan.PrefilterMode|hyperscan.AllowEmpty)
+				p.Id = i
+				patterns = append(patterns, p)
+			}
+		}
+		if len(patterns) == 0 {
+			return nil, compiled, nil
+		}
+		// La base se libera sola cuando deja de usarse, tras una recarga
+		db, err := hyperscan.NewManagedBlockDatabase(patterns...)
+		var cerr *hyperscan.CompileError
+		switch {
+		case err == nil:
+			return &hyperscanEngine{db: db}, compiled, nil
+		case errors.As(err, &cerr) && cerr.Expression >= 0 && cerr.Expression < len(patterns):
+			compiled[patterns[cerr.Expression].Id] = false
+		default:
+			return nil, nil, fmt.Errorf("failed to compile hyperscan database: %w", err)
+		}
+	}
+}
+
+func (e *hyperscanEngine) Scan(value string, hits []bool) error {
+	s, _ := e.scratch.Get().(*hyperscan.Scratch)
+	if s == nil {
+		var err error
+		if s, err = hyperscan.NewManagedScratch(e.db); err != nil {
+			return fmt.Errorf("failed to allocate hyperscan scratch: %w", err)
+		}
+	}
+	defer e.scratch.Put(s)
+	return e.db.Scan([]byte(value), s, func(id uint, _, _ uint64, _ uint, _ any) error {
+		hits[id] = true
+		return nil
+	}, nil)
+}
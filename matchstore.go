@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* Histórico de coincidencias consultable */
+
+// Sink que guarda cada certificado coincidente (una fila por huella y tag) y
+// permite consultarlos después
+type MatchStore interface {
+	Sink
+	Query(ctx context.Context, q MatchQuery) ([]StoredMatch, error)
+	// Marca una coincidencia como verdadero o falso positivo ("" quita la marca)
+	Label(ctx context.Context, id int64, label, note string) (StoredMatch, error)
+	Precision(ctx context.Context, minFalsePositives int) (PrecisionReport, error)
+}
+
+// Abre el histórico a partir de su especificación: "sqlite:/ruta/matches.db"
+// para una sola instancia o "postgres://usuario@host/gctwatch" compartido
+func OpenMatchStore(spec string, network *Network) (MatchStore, error) {
+	switch {
+	case strings.HasPrefix(spec, "sqlite:"):
+		return OpenSQLiteMatchStore(strings.TrimPrefix(spec, "sqlite:"))
+	case strings.HasPrefix(spec, "postgres://"), strings.HasPrefix(spec, "postgresql://"):
+		return OpenPostgresMatchStore(spec, network)
+	}
+	return nil, fmt.Errorf("unknown match store %q (sqlite:<path>, postgres://...)", spec)
+}
+
+// Coincidencia guardada. Hits cuenta las veces que se ha visto (en otros logs
+// o tras la ventana de deduplicación); FirstSeen y LastSeen son de detección.
+type StoredMatch struct {
+	ID          int64     `json:"id"`
+	Kind        string    `json:"kind"` // match o shadow (regla en evaluación)
+	Fingerprint string    `json:"fingerprint_sha256"`
+	Tag         string    `json:"tag"`
+	Domain      string    `json:"domain"`
+	DNSNames    []string  `json:"dns_names"`
+	Issuer      string    `json:"issuer"`
+	Subject     string    `json:"subject"`
+	Serial      string    `json:"serial_number"`
+	NotBefore   time.Time `json:"not_before"`
+	NotAfter    time.Time `json:"not_after"`
+	LogURL      string    `json:"log_url"`
+	Index       int64     `json:"index"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+	Hits        int64     `json:"hits"`
+	Label       string    `json:"label,omitempty"` // tp o fp
+	LabelNote   string    `json:"label_note,omitempty"`
+	LabeledAt   time.Time `json:"labeled_at,omitzero"`
+}
+
+// Columnas de StoredMatch, en orden, para los SELECT y RETURNING
+const storedMatchColumns = `id, kind, fingerprint, tag, domain, dns_names, issuer, subject, serial, not_before, not_after,
+	log_url, log_index, first_seen, last_seen, hits, label, label_note, labeled_at`
+
+// Filtros de una consulta; los vacíos no filtran
+type MatchQuery struct {
+	Kind        string // match (por defecto), shadow o "*"
+	Tag         string
+	Domain      string // dominio registrado, o un nombre del certificado o un subdominio suyo
+	Fingerprint string
+	Issuer      string // subcadena
+	Label       string // tp, fp o none (sin marcar)
+	Since       time.Time
+	Until       time.Time
+	Limit       int
+}
+
+const (
+	defaultMatchQueryLimit = 100
+	maxMatchQueryLimit     = 10000
+)
+
+// Filtros como pares clave=valor (de -query o de la query string de /matches).
+// since y until admiten RFC 3339 o una duración hacia atrás (24h).
+func ParseMatchQuery(params map[string]string) (MatchQuery, error) {
+	q := MatchQuery{Kind: EventKindMatch, Limit: defaultMatchQueryLimit}
+	now := time.Now()
+	parseTime := func(k, v string) (time.Time, error) {
+		if d, err := time.ParseDuration(v); err == nil {
+			return now.Add(-d), nil
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return t, fmt.Errorf("invalid %s %q (RFC 3339 or duration)", k, v)
+		}
+		return t, nil
+	}
+	for k, v := range params {
+		var err error
+		switch k {
+		case "kind":
+			if v != EventKindMatch && v != EventKindShadow && v != "*" {
+				err = fmt.Errorf("invalid kind %q (match, shadow, *)", v)
+			}
+			q.Kind = v
+		case "tag":
+			q.Tag = v
+		case "domain":
+			q.Domain = strings.TrimSuffix(strings.ToLower(v), ".")
+		case "fingerprint":
+			q.Fingerprint = strings.ToLower(v)
+		case "issuer":
+			q.Issuer = v
+		case "label":
+			if v != LabelTruePositive && v != LabelFalsePositive && v != "none" {
+				err = fmt.Errorf("invalid label %q (tp, fp, none)", v)
+			}
+			q.Label = v
+		case "since":
+			q.Since, err = parseTime(k, v)
+		case "until":
+			q.Until, err = parseTime(k, v)
+		case "limit":
+			q.Limit, err = strconv.Atoi(v)
+			if err != nil || q.Limit < 1 || q.Limit > maxMatchQueryLimit {
+				err = fmt.Errorf("invalid limit %q (1-%d)", v, maxMatchQueryLimit)
+			}
+		default:
+			err = fmt.Errorf("unknown query filter %q (kind, tag, domain, fingerprint, issuer, label, since, until, limit)", k)
+		}
+		if err != nil {
+			return q, err
+		}
+	}
+	return q, nil
+}
+
+// Escapa los comodines de LIKE (con ESCAPE '\')
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// Cláusula WHERE (con marcadores ?) común a los almacenes SQL. namesClause
+// comprueba si algún nombre DNS es igual al primer argumento o cumple el LIKE
+// del segundo, según el tipo de columna de cada base de datos.
+func matchQueryWhere(q MatchQuery, namesClause string) (string, []any) {
+	var where []string
+	var args []any
+	add := func(clause string, values ...any) {
+		where, args = append(where, clause), append(args, values...)
+	}
+	if q.Kind != "" && q.Kind != "*" {
+		add("kind = ?", q.Kind)
+	}
+	if q.Tag != "" {
+		add("tag = ?", q.Tag)
+	}
+	if q.Fingerprint != "" {
+		add("fingerprint = ?", q.Fingerprint)
+	}
+	if q.Domain != "" {
+		add("(domain = ? OR "+namesClause+")", q.Domain, q.Domain, "%."+escapeLike(q.Domain))
+	}
+	if q.Issuer != "" {
+		add(`issuer LIKE ? ESCAPE '\'`, "%"+escapeLike(q.Issuer)+"%")
+	}
+	switch q.Label {
+	case "":
+	case "none":
+		add("label = ''")
+	default:
+		add("label = ?", q.Label)
+	}
+	if !q.Since.IsZero() {
+		add("last_seen >= ?", q.Since)
+	}
+	if !q.Until.IsZero() {
+		add("first_seen <= ?", q.Until)
+	}
+	if len(where) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(where, " AND "), args
+}
+
+func storedMatchFromEvent(ev MatchEvent) StoredMatch {
+	c := ev.Certificate
+	return StoredMatch{
+		Kind: ev.Kind, Fingerprint: c.FingerprintSHA256, Tag: ev.Tag, Domain: eventDomain(ev), DNSNames: c.DNSNames,
+		Issuer: c.Issuer, Subject: c.Subject, Serial: c.SerialNumber, NotBefore: c.NotBefore, NotAfter: c.NotAfter,
+		LogURL: ev.Log.URL, Index: ev.Index, FirstSeen: ev.Timestamp, LastSeen: ev.Timestamp, Hits: 1,
+	}
+}
+
+// Abre el histórico para un comando de línea (-query, -label, -precision)
+func withMatchStore(spec string, network *Network, fn func(MatchStore) error) error {
+	if spec == "" {
+		return fmt.Errorf("-query, -label and -precision need -match-store")
+	}
+	store, err := OpenMatchStore(spec, network)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	return fn(store)
+}
+
+// -query: imprime las coincidencias como JSON lines
+func queryMatches(store MatchStore, filters string, out io.Writer) error {
+	q, err := ParseMatchQuery(parseKeyValues(filters))
+	if err != nil {
+		return err
+	}
+	matches, err := store.Query(context.Background(), q)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(out)
+	for _, m := range matches {
+		enc.Encode(m)
+	}
+	return nil
+}
+
+// GET /matches?tag=...&domain=...&since=24h
+func (mngr *CTLogsManager) serveMatches(w http.ResponseWriter, r *http.Request) {
+	params := make(map[string]string)
+	for k, v := range r.URL.Query() {
+		params[k] = v[0]
+	}
+	q, err := ParseMatchQuery(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	matches, err := mngr.Matches.Query(r.Context(), q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(matches)
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+/* Histórico de coincidencias en PostgreSQL */
+
+// Migraciones en orden, registradas en schema_migrations. Equivalen a las de
+// SQLite con tipos nativos (timestamptz, text[]).
+var postgresMatchMigrations = []string{
+	`CREATE TABLE matches (
+		id          bigserial PRIMARY KEY,
+		kind        text NOT NULL DEFAULT 'match',
+		fingerprint text NOT NULL,
+		tag         text NOT NULL,
+		domain      text NOT NULL,
+		dns_names   text[] NOT NULL,
+		issuer      text NOT NULL,
+		subject     text NOT NULL,
+		serial      text NOT NULL,
+		not_before  timestamptz NOT NULL,
+		not_after   timestamptz NOT NULL,
+		log_url     text NOT NULL,
+		log_index   bigint NOT NULL,
+		first_seen  timestamptz NOT NULL,
+		last_seen   timestamptz NOT NULL,
+		hits        bigint NOT NULL DEFAULT 1,
+		UNIQUE (fingerprint, tag)
+	);
+	CREATE INDEX matches_domain ON matches (domain);
+	CREATE INDEX matches_tag_first_seen ON matches (tag, first_seen);
+	CREATE INDEX matches_first_seen ON matches (first_seen);
+	CREATE INDEX matches_dns_names ON matches USING gin (dns_names);`,
+}
+
+// Clave del advisory lock con el que las instancias se turnan al migrar
+const postgresMigrationLock = 0x67637477 // "gctw"
+
+// Histórico compartido por varias instancias. El pool se configura en la URL
+// (pool_max_conns, pool_min_conns, pool_max_conn_idle_time...); las
+// conexiones y la resolución de nombres pasan por la red controlada.
+type postgresMatchStore struct {
+	host string
+	pool *pgxpool.Pool
+}
+
+func OpenPostgresMatchStore(dsn string, network *Network) (*postgresMatchStore, error) {
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PostgreSQL URL: %w", err)
+	}
+	host := cfg.ConnConfig.Host
+	if err := network.Policy.Check(host); err != nil {
+		return nil, err
+	}
+	cfg.ConnConfig.DialFunc = network.DialContext
+	cfg.ConnConfig.LookupFunc = network.LookupHost
+	pool, err := pgxpool.NewWithConfig(context.Background(), cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open match store: %w", err)
+	}
+	s := &postgresMatchStore{host: net.JoinHostPort(host, strconv.Itoa(int(cfg.ConnConfig.Port))), pool: pool}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := s.migrate(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to migrate match store %s: %w", s.host, err)
+	}
+	return s, nil
+}
+
+// Todas las migraciones pendientes en una transacción (el DDL de PostgreSQL
+// es transaccional) bajo un advisory lock, por si arrancan varias instancias
+func (s *postgresMatchStore) migrate(ctx context.Context) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", postgresMigrationLock); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    integer PRIMARY KEY,
+		applied_at timestamptz NOT NULL DEFAULT now())`); err != nil {
+		return err
+	}
+	var version int
+	if err := tx.QueryRow(ctx, "SELECT coalesce(max(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+		return err
+	}
+	for i := version; i < len(postgresMatchMigrations); i++ {
+		if _, err := tx.Exec(ctx, postgresMatchMigrations[i]); err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", i+1); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+func (s *postgresMatchStore) Name() string { return "postgres:" + s.host }
+
+func (s *postgresMatchStore) Close() error {
+	s.pool.Close()
+	return nil
+}
+
+func (s *postgresMatchStore) Check() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return s.pool.Ping(ctx)
+}
+
+// Inserta o, si la huella ya está con ese tag (vista por otra instancia o en
+// otro log), actualiza last_seen y hits
+func (s *postgresMatchStore) Write(ctx context.Context, ev MatchEvent) error {
+	if ev.Kind != EventKindMatch && ev.Kind != EventKindShadow {
+		return nil
+	}
+	m := storedMatchFromEvent(ev)
+	names := m.DNSNames
+	if names == nil {
+		names = []string{}
+	}
+	_, err := s.pool.Exec(ctx, `INSERT INTO matches
+		(kind, fingerprint, tag, domain, dns_names, issuer, subject, serial, not_before, not_after, log_url, log_index, first_seen, last_seen)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		ON CONFLICT (fingerprint, tag) DO UPDATE SET last_seen = greatest(matches.last_seen, excluded.last_seen), hits = matches.hits + 1`,
+		m.Kind, m.Fingerprint, m.Tag, m.Domain, names, m.Issuer, m.Subject, m.Serial, m.NotBefore, m.NotAfter,
+		m.LogURL, m.Index, m.FirstSeen, m.LastSeen)
+	if err != nil {
+		return fmt.Errorf("failed to store match: %w", err)
+	}
+	return nil
+}
+
+// Sustituye los marcadores ? por $1, $2...
+func rebindPostgres(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (s *postgresMatchStore) Query(ctx context.Context, q MatchQuery) ([]StoredMatch, error) {
+	where, args := matchQueryWhere(q, `(dns_names @> ARRAY[?::text] OR EXISTS (SELECT 1 FROM unnest(dns_names) n WHERE lower(n) LIKE ? ESCAPE '\'))`)
+	query := "SELECT " + storedMatchColumns + " FROM matches" + where + " ORDER BY first_seen DESC, id DESC LIMIT ?"
+	args = append(args, max(q.Limit, 1))
+
+	rows, err := s.pool.Query(ctx, rebindPostgres(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query matches: %w", err)
+	}
+	out, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (StoredMatch, error) {
+		return scanPostgresMatch(row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query matches: %w", err)
+	}
+	if out == nil {
+		out = []StoredMatch{}
+	}
+	return out, nil
+}
+
+func scanPostgresMatch(row pgx.Row) (StoredMatch, error) {
+	var m StoredMatch
+	var labeled *time.Time
+	err := row.Scan(&m.ID, &m.Kind, &m.Fingerprint, &m.Tag, &m.Domain, &m.DNSNames, &m.Issuer, &m.Subject, &m.Serial,
+		&m.NotBefore, &m.NotAfter, &m.LogURL, &m.Index, &m.FirstSeen, &m.LastSeen, &m.Hits, &m.Label, &m.LabelNote, &labeled)
+	m.NotBefore, m.NotAfter, m.FirstSeen, m.LastSeen = m.NotBefore.UTC(), m.NotAfter.UTC(), m.FirstSeen.UTC(), m.LastSeen.UTC()
+	if labeled != nil {
+		m.LabeledAt = labeled.UTC()
+	}
+	return m, err
+}
+
+func (s *postgresMatchStore) Label(ctx context.Context, id int64, label, note string) (StoredMatch, error) {
+	var labeled *time.Time
+	if label != "" {
+		now := time.Now()
+		labeled = &now
+	} else {
+		note = ""
+	}
+	m, err := scanPostgresMatch(s.pool.QueryRow(ctx, "UPDATE matches SET label = $1, label_note = $2, labeled_at = $3 WHERE id = $4 RETURNING "+storedMatchColumns,
+		label, note, labeled, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return m, errMatchNotFound
+	}
+	if err != nil {
+		return m, fmt.Errorf("failed to label match: %w", err)
+	}
+	return m, nil
+}
+
+func (s *postgresMatchStore) Precision(ctx context.Context, minFalsePositives int) (PrecisionReport, error) {
+	report := newPrecisionReport()
+	rows, err := s.pool.Query(ctx, rulePrecisionQuery)
+	if err != nil {
+		return report, fmt.Errorf("failed to compute precision: %w", err)
+	}
+	rules, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (RulePrecision, error) {
+		var p RulePrecision
+		err := row.Scan(&p.Kind, &p.Tag, &p.Matches, &p.TruePositives, &p.FalsePositives)
+		p.compute()
+		return p, err
+	})
+	if err != nil {
+		return report, fmt.Errorf("failed to compute precision: %w", err)
+	}
+	report.Rules = append(report.Rules, rules...)
+	if minFalsePositives <= 0 {
+		return report, nil
+	}
+
+	rows, err = s.pool.Query(ctx, rebindPostgres(suppressionSuggestionQuery), minFalsePositives)
+	if err != nil {
+		return report, fmt.Errorf("failed to compute suppression suggestions: %w", err)
+	}
+	suggestions, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (SuppressionSuggestion, error) {
+		var sg SuppressionSuggestion
+		err := row.Scan(&sg.Tag, &sg.Domain, &sg.FalsePositives)
+		return sg, err
+	})
+	if err != nil {
+		return report, fmt.Errorf("failed to compute suppression suggestions: %w", err)
+	}
+	report.Suggestions = append(report.Suggestions, suggestions...)
+	return report, nil
+}
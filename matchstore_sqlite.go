@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+/* Histórico de coincidencias en SQLite */
+
+// Migraciones en orden; PRAGMA user_version guarda cuántas se han aplicado
+var sqliteMatchMigrations = []string{
+	`CREATE TABLE matches (
+		id          INTEGER PRIMARY KEY,
+		fingerprint TEXT NOT NULL,
+		tag         TEXT NOT NULL,
+		domain      TEXT NOT NULL,
+		dns_names   TEXT NOT NULL, -- array JSON
+		issuer      TEXT NOT NULL,
+		subject     TEXT NOT NULL,
+		serial      TEXT NOT NULL,
+		not_before  TEXT NOT NULL, -- RFC 3339 en UTC
+		not_after   TEXT NOT NULL,
+		log_url     TEXT NOT NULL,
+		log_index   INTEGER NOT NULL,
+		first_seen  TEXT NOT NULL,
+		last_seen   TEXT NOT NULL,
+		hits        INTEGER NOT NULL DEFAULT 1,
+		UNIQUE (fingerprint, tag)
+	);
+	CREATE INDEX matches_domain ON matches (domain);
+	CREATE INDEX matches_tag_first_seen ON matches (tag, first_seen);
+	CREATE INDEX matches_first_seen ON matches (first_seen);`,
+	`ALTER TABLE matches ADD COLUMN kind TEXT NOT NULL DEFAULT 'match';`,
+	`ALTER TABLE matches ADD COLUMN label TEXT NOT NULL DEFAULT '';
+	ALTER TABLE matches ADD COLUMN label_note TEXT NOT NULL DEFAULT '';
+	ALTER TABLE matches ADD COLUMN labeled_at TEXT NOT NULL DEFAULT '';`,
+}
+
+// Fichero SQLite local (sin cgo). Las fechas se guardan como texto RFC 3339
+// en UTC, que se ordena igual que el tiempo y se lee bien desde sqlite3.
+type sqliteMatchStore struct {
+	path string
+	db   *sql.DB
+}
+
+func OpenSQLiteMatchStore(path string) (*sqliteMatchStore, error) {
+	dsn := "file:" + (&url.URL{Path: path}).EscapedPath() + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open match store: %w", err)
+	}
+	// Un solo escritor: evita SQLITE_BUSY entre los workers del sink
+	db.SetMaxOpenConns(1)
+	s := &sqliteMatchStore{path: path, db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate match store %s: %w", path, err)
+	}
+	return s, nil
+}
+
+func (s *sqliteMatchStore) migrate() error {
+	var version int
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	for i := version; i < len(sqliteMatchMigrations); i++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(sqliteMatchMigrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqliteMatchStore) Name() string { return "sqlite:" + s.path }
+func (s *sqliteMatchStore) Close() error { return s.db.Close() }
+
+func sqlTime(t time.Time) string { return t.UTC().Format(time.RFC3339) }
+
+func (s *sqliteMatchStore) Write(ctx context.Context, ev MatchEvent) error {
+	if ev.Kind != EventKindMatch && ev.Kind != EventKindShadow {
+		return nil
+	}
+	m := storedMatchFromEvent(ev)
+	names, err := json.Marshal(m.DNSNames)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO matches
+		(kind, fingerprint, tag, domain, dns_names, issuer, subject, serial, not_before, not_after, log_url, log_index, first_seen, last_seen)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (fingerprint, tag) DO UPDATE SET last_seen = max(last_seen, excluded.last_seen), hits = hits + 1`,
+		m.Kind, m.Fingerprint, m.Tag, m.Domain, string(names), m.Issuer, m.Subject, m.Serial, sqlTime(m.NotBefore), sqlTime(m.NotAfter),
+		m.LogURL, m.Index, sqlTime(m.FirstSeen), sqlTime(m.LastSeen))
+	if err != nil {
+		return fmt.Errorf("failed to store match: %w", err)
+	}
+	return nil
+}
+
+// Coincidencias más recientes primero
+func (s *sqliteMatchStore) Query(ctx context.Context, q MatchQuery) ([]StoredMatch, error) {
+	where, args := matchQueryWhere(q, `EXISTS (SELECT 1 FROM json_each(dns_names) WHERE lower(value) = ? OR lower(value) LIKE ? ESCAPE '\')`)
+	query := "SELECT " + storedMatchColumns + " FROM matches" + where + " ORDER BY first_seen DESC, id DESC LIMIT ?"
+	args = append(args, max(q.Limit, 1))
+	for i, a := range args {
+		if t, ok := a.(time.Time); ok {
+			args[i] = sqlTime(t)
+		}
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query matches: %w", err)
+	}
+	defer rows.Close()
+	out := []StoredMatch{}
+	for rows.Next() {
+		m, err := scanSQLiteMatch(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query matches: %w", err)
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+func scanSQLiteMatch(row interface{ Scan(...any) error }) (StoredMatch, error) {
+	var m StoredMatch
+	var names, notBefore, notAfter, first, last, labeled string
+	if err := row.Scan(&m.ID, &m.Kind, &m.Fingerprint, &m.Tag, &m.Domain, &names, &m.Issuer, &m.Subject, &m.Serial,
+		&notBefore, &notAfter, &m.LogURL, &m.Index, &first, &last, &m.Hits, &m.Label, &m.LabelNote, &labeled); err != nil {
+		return m, err
+	}
+	json.Unmarshal([]byte(names), &m.DNSNames)
+	m.NotBefore, _ = time.Parse(time.RFC3339, notBefore)
+	m.NotAfter, _ = time.Parse(time.RFC3339, notAfter)
+	m.FirstSeen, _ = time.Parse(time.RFC3339, first)
+	m.LastSeen, _ = time.Parse(time.RFC3339, last)
+	m.LabeledAt, _ = time.Parse(time.RFC3339, labeled)
+	return m, nil
+}
+
+func (s *sqliteMatchStore) Label(ctx context.Context, id int64, label, note string) (StoredMatch, error) {
+	labeled := ""
+	if label != "" {
+		labeled = sqlTime(time.Now())
+	} else {
+		note = ""
+	}
+	m, err := scanSQLiteMatch(s.db.QueryRowContext(ctx, "UPDATE matches SET label = ?, label_note = ?, labeled_at = ? WHERE id = ? RETURNING "+storedMatchColumns,
+		label, note, labeled, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return m, errMatchNotFound
+	}
+	if err != nil {
+		return m, fmt.Errorf("failed to label match: %w", err)
+	}
+	return m, nil
+}
+
+func (s *sqliteMatchStore) Precision(ctx context.Context, minFalsePositives int) (PrecisionReport, error) {
+	report := newPrecisionReport()
+	rows, err := s.db.QueryContext(ctx, rulePrecisionQuery)
+	if err != nil {
+		return report, fmt.Errorf("failed to compute precision: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p RulePrecision
+		if err := rows.Scan(&p.Kind, &p.Tag, &p.Matches, &p.TruePositives, &p.FalsePositives); err != nil {
+			return report, fmt.Errorf("failed to compute precision: %w", err)
+		}
+		p.compute()
+		report.Rules = append(report.Rules, p)
+	}
+	if err := rows.Err(); err != nil || minFalsePositives <= 0 {
+		return report, err
+	}
+
+	rows, err = s.db.QueryContext(ctx, suppressionSuggestionQuery, minFalsePositives)
+	if err != nil {
+		return report, fmt.Errorf("failed to compute suppression suggestions: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sg SuppressionSuggestion
+		if err := rows.Scan(&sg.Tag, &sg.Domain, &sg.FalsePositives); err != nil {
+			return report, fmt.Errorf("failed to compute suppression suggestions: %w", err)
+		}
+		report.Suggestions = append(report.Suggestions, sg)
+	}
+	return report, rows.Err()
+}
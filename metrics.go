@@ -0,0 +1,63 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+/* Métricas */
+
+var (
+	metricOutboundRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gctwatch_outbound_http_requests_total",
+		Help: "Peticiones HTTP salientes de integraciones por host y resultado.",
+	}, []string{"host", "result"})
+	metricOutboundRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gctwatch_outbound_http_retries_total",
+		Help: "Reintentos de peticiones HTTP salientes por host.",
+	}, []string{"host"})
+	metricBreakerOpen = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gctwatch_outbound_circuit_open",
+		Help: "1 si el circuit breaker del host está abierto.",
+	}, []string{"host"})
+	metricEndpointLatency = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gctwatch_log_endpoint_latency_seconds",
+		Help: "Latencia media (EWMA) de cada endpoint de log.",
+	}, []string{"log", "endpoint"})
+	metricLogBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gctwatch_log_bytes_downloaded_total",
+		Help: "Bytes descargados de cada log (cuerpo de las respuestas).",
+	}, []string{"log"})
+	metricEventsSuppressed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gctwatch_events_suppressed_total",
+		Help: "Coincidencias descartadas antes de los sinks por duplicadas, suprimidas o muestreadas.",
+	}, []string{"reason"})
+	metricBandwidthToday = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gctwatch_bandwidth_today_bytes",
+		Help: "Bytes descargados de los logs en el día actual (UTC).",
+	})
+	metricEntriesFetched = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gctwatch_log_entries_fetched_total",
+		Help: "Entradas obtenidas de cada log.",
+	}, []string{"log"})
+	metricEntriesDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gctwatch_entries_dropped_total",
+		Help: "Entradas descartadas por tener OutputChan lleno.",
+	}, []string{"log"})
+	metricEntriesSkipped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gctwatch_entries_skipped_total",
+		Help: "Entradas que el log sirve mal y se han saltado tras reintentarlas.",
+	}, []string{"log"})
+	metricEntriesUnparsed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gctwatch_entries_unparsed_total",
+		Help: "Entradas cuyo certificado no se ha podido interpretar (no se comprueban las reglas).",
+	}, []string{"log"})
+	metricSTHErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gctwatch_sth_errors_total",
+		Help: "Errores al obtener el STH de cada log (incluye STH incoherentes).",
+	}, []string{"log"})
+	metricLogLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gctwatch_log_lag_entries",
+		Help: "Entradas del último STH de cada log pendientes de leer.",
+	}, []string{"log"})
+)
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+/* Política de red de salida */
+
+var ErrEgressDenied = errors.New("egress denied by network policy")
+
+// Lista blanca de hosts a los que el proceso puede conectarse.
+// En modo estricto cualquier conexión a un host no listado se rechaza y se registra.
+type EgressPolicy struct {
+	strict  bool
+	mu      sync.RWMutex
+	allowed map[string]bool // host exacto o "*.dominio"
+	seen    map[string]bool // hosts ya auditados
+}
+
+func NewEgressPolicy(strict bool, hosts []string) *EgressPolicy {
+	p := &EgressPolicy{strict: strict, allowed: make(map[string]bool), seen: make(map[string]bool)}
+	for _, h := range hosts {
+		p.Allow(h)
+	}
+	return p
+}
+
+// Añade un host (o URL) a la lista blanca
+func (p *EgressPolicy) Allow(host string) {
+	host = strings.TrimSpace(host)
+	if host == "" {
+		return
+	}
+	if u, err := url.Parse(host); err == nil && u.Host != "" {
+		host = u.Hostname()
+	}
+	p.mu.Lock()
+	p.allowed[strings.ToLower(host)] = true
+	p.mu.Unlock()
+}
+
+// Comprueba si se permite conectar con host
+func (p *EgressPolicy) Check(host string) error {
+	if p == nil || !p.strict {
+		return nil
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	p.mu.RLock()
+	ok := p.allowed[host]
+	for h := range p.allowed {
+		if ok {
+			break
+		}
+		if strings.HasPrefix(h, "*.") && strings.HasSuffix(host, h[1:]) {
+			ok = true
+		}
+	}
+	p.mu.RUnlock()
+	if !ok {
+		log.Printf("EGRESS DENIED: %s", host)
+		return fmt.Errorf("%s: %w", host, ErrEgressDenied)
+	}
+	p.mu.Lock()
+	if !p.seen[host] {
+		p.seen[host] = true
+		log.Printf("EGRESS ALLOWED: %s", host)
+	}
+	p.mu.Unlock()
+	return nil
+}
+
+// Comprueba el host de una URL
+func (p *EgressPolicy) CheckURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid URL %s: %w", raw, err)
+	}
+	return p.Check(u.Hostname())
+}
+
+// Verifica el host de la petición (además del dial, por si hay proxy de por medio)
+type policyTransport struct {
+	base   http.RoundTripper
+	policy *EgressPolicy
+}
+
+func (t *policyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.policy.Check(req.URL.Hostname()); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/* Notificaciones a chats: Matrix y Microsoft Teams */
+
+// Título y pares campo/valor comunes a todos los notificadores
+type notifyFact struct{ Name, Value string }
+
+func notifyContent(ev MatchEvent, l Locale) (string, []notifyFact) {
+	if ev.Kind == EventKindHeartbeat && ev.Heartbeat != nil {
+		hb := ev.Heartbeat
+		return l.Sprintf("gCTWatch heartbeat: %s", hb.Status), []notifyFact{
+			{l.T("Instance"), hb.Instance},
+			{l.T("Uptime"), (time.Duration(hb.UptimeSeconds) * time.Second).String()},
+			{l.T("Sources"), strconv.Itoa(hb.Sources)},
+			{l.T("Matches"), strconv.FormatInt(hb.Matches, 10)},
+		}
+	}
+	if ev.Kind == EventKindOps && ev.Ops != nil {
+		op := ev.Ops
+		return fmt.Sprintf("[%s] %s: %s", op.Severity, op.Type, op.Source), []notifyFact{
+			{l.T("Event"), op.Type},
+			{l.T("Source"), op.Source},
+			{l.T("Details"), op.Message},
+		}
+	}
+	c := ev.Certificate
+	facts := []notifyFact{
+		{"Tag", strings.Join(ev.AllTags(), ", ")},
+		{l.T("Names"), strings.Join(c.DNSNames, ", ")},
+		{l.T("Issuer"), c.Issuer},
+		{l.T("Valid"), c.NotBefore.Format(time.DateOnly) + " → " + c.NotAfter.Format(time.DateOnly)},
+		{l.T("Fingerprint"), c.FingerprintSHA256},
+		{"Log", fmt.Sprintf("%s #%d", ev.Log.URL, ev.Index)},
+	}
+	if ev.Rule != nil && ev.Rule.Severity != defaultRuleSeverity {
+		facts = append(facts, notifyFact{l.T("Severity"), ev.Rule.Severity})
+	}
+	if ev.Rule != nil && ev.Rule.Description != "" {
+		facts = append(facts, notifyFact{l.T("Rule"), ev.Rule.Description})
+	}
+	if e := ev.Enrichment; e != nil && e.Revocation != nil {
+		facts = append(facts, notifyFact{l.T("Revocation"), e.Revocation.Status})
+	}
+	if e := ev.Enrichment; e != nil && e.Zone != nil {
+		facts = append(facts, notifyFact{l.T("Zone"), l.Sprintf("%s in .%s", e.Zone.Status, e.Zone.Zone)})
+	}
+	if e := ev.Enrichment; e != nil && e.Issuance != nil && e.Issuance.Status != "automated" {
+		facts = append(facts, notifyFact{l.T("Issuance"), issuanceSummary(e.Issuance)})
+	}
+	if e := ev.Enrichment; e != nil && e.Score != nil {
+		facts = append(facts, notifyFact{l.T("Score"), scoreSummary(e.Score)})
+	}
+	if e := ev.Enrichment; e != nil && e.SafeBrowsing != nil && e.SafeBrowsing.Status == "flagged" {
+		facts = append(facts, notifyFact{"Safe Browsing", strings.Join(e.SafeBrowsing.Threats, ", ")})
+	}
+	if e := ev.Enrichment; e != nil && e.VirusTotal != nil && (e.VirusTotal.Malicious > 0 || e.VirusTotal.Suspicious > 0) {
+		facts = append(facts, notifyFact{"VirusTotal", virusTotalSummary(e.VirusTotal)})
+	}
+	return l.Sprintf("[%s] certificate for %s", ev.Tag, eventDomain(ev)), facts
+}
+
+func notifyLink(ev MatchEvent) string {
+	if e := ev.Enrichment; e != nil && e.CrtSh != nil {
+		return e.CrtSh.URL
+	}
+	return ""
+}
+
+func postJSON(ctx context.Context, client *http.Client, method, endpoint, token string, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return doPush(client, req)
+}
+
+// Mensaje a una sala de Matrix con el token de acceso de un usuario bot
+type matrixSink struct {
+	homeserver, room, token string
+	locale                  Locale
+	client                  *http.Client
+	txn                     atomic.Int64
+	epoch                   int64
+}
+
+func NewMatrixSink(homeserver, room, tokenFile string, client *http.Client) (*matrixSink, error) {
+	if homeserver == "" || room == "" {
+		return nil, fmt.Errorf("matrix homeserver and room are required")
+	}
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read matrix token: %w", err)
+	}
+	return &matrixSink{
+		homeserver: strings.TrimSuffix(homeserver, "/"), room: room,
+		token: strings.TrimSpace(string(token)), client: client, epoch: time.Now().UnixNano(), locale: defaultLocale,
+	}, nil
+}
+
+func (s *matrixSink) Name() string { return "matrix:" + s.room }
+func (s *matrixSink) Close() error { return nil }
+
+func (s *matrixSink) SetLocale(l Locale) { s.locale = l }
+
+func (s *matrixSink) Write(ctx context.Context, ev MatchEvent) error {
+	title, facts := notifyContent(ev, s.locale)
+	var plain, rich strings.Builder
+	plain.WriteString(title)
+	fmt.Fprintf(&rich, "<strong>%s</strong><ul>", html.EscapeString(title))
+	for _, f := range facts {
+		fmt.Fprintf(&plain, "\n%s: %s", f.Name, f.Value)
+		fmt.Fprintf(&rich, "<li><b>%s</b>: %s</li>", f.Name, html.EscapeString(f.Value))
+	}
+	rich.WriteString("</ul>")
+	if link := notifyLink(ev); link != "" {
+		plain.WriteString("\n" + link)
+		fmt.Fprintf(&rich, `<a href="%s">crt.sh</a>`, html.EscapeString(link))
+	}
+	// El ID de transacción hace idempotentes los reintentos del cliente HTTP
+	txn := fmt.Sprintf("gctwatch-%d-%d", s.epoch, s.txn.Add(1))
+	endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		s.homeserver, url.PathEscape(s.room), txn)
+	return postJSON(ctx, s.client, http.MethodPut, endpoint, s.token, map[string]string{
+		"msgtype":        "m.notice",
+		"body":           plain.String(),
+		"format":         "org.matrix.custom.html",
+		"formatted_body": rich.String(),
+	})
+}
+
+// Incoming webhook de Microsoft Teams con una Adaptive Card
+type teamsSink struct {
+	url    string
+	name   string
+	locale Locale
+	client *http.Client
+}
+
+func NewTeamsSink(endpoint string, client *http.Client) (*teamsSink, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid Teams webhook URL %q", endpoint)
+	}
+	// Igual que en los webhooks, la URL incluye el secreto
+	return &teamsSink{url: endpoint, name: "teams:" + u.Host, locale: defaultLocale, client: client}, nil
+}
+
+func (s *teamsSink) Name() string { return s.name }
+func (s *teamsSink) Close() error { return nil }
+
+func (s *teamsSink) SetLocale(l Locale) { s.locale = l }
+
+func (s *teamsSink) Write(ctx context.Context, ev MatchEvent) error {
+	title, facts := notifyContent(ev, s.locale)
+	cardFacts := make([]map[string]string, 0, len(facts))
+	for _, f := range facts {
+		cardFacts = append(cardFacts, map[string]string{"title": f.Name, "value": f.Value})
+	}
+	card := map[string]any{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"msteams": map[string]string{"width": "Full"},
+		"body": []any{
+			map[string]any{"type": "TextBlock", "text": title, "weight": "Bolder", "size": "Medium", "wrap": true},
+			map[string]any{"type": "FactSet", "facts": cardFacts},
+		},
+	}
+	if link := notifyLink(ev); link != "" {
+		card["actions"] = []any{map[string]string{"type": "Action.OpenUrl", "title": "crt.sh", "url": link}}
+	}
+	return postJSON(ctx, s.client, http.MethodPost, s.url, "", map[string]any{
+		"type": "message",
+		"attachments": []any{map[string]any{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content":     card,
+		}},
+	})
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+/* Eventos operacionales */
+
+// Tipos de evento operacional y su severidad (info, warning, critical)
+var opsEventTypes = map[string]string{
+	"log_failing":        "warning",  // un log deja de responder o devuelve errores
+	"log_recovered":      "info",     // vuelve a leerse
+	"log_suspended":      "critical", // deja de sondearse tras fallos seguidos (circuit breaker del log)
+	"log_resumed":        "info",
+	"mmd_exceeded":       "warning", // al día con el STH, la última entrada es más antigua que el MMD del log
+	"reader_behind":      "warning", // leemos entradas más antiguas que el MMD: checkpoint antiguo o cola atascada
+	"entry_age_ok":       "info",
+	"sth_inconsistency":  "critical", // STH que encoge, del futuro o más entradas de las pedidas
+	"circuit_open":       "warning",  // circuit breaker abierto para un host (log, sink, API)
+	"circuit_closed":     "info",
+	"checkpoint_failing": "warning",  // no se pueden guardar o cargar checkpoints
+	"lease_lost":         "warning",  // otra instancia ha tomado un log
+	"coverage_gap":       "critical", // entradas descartadas con la cola llena o que el log sirve mal: no se han analizado
+	"log_unmonitored":    "critical", // un log utilizable de la lista no se monitoriza (filtros, fallo al arrancar, nuevo)
+	"canary_hit":         "critical", // certificado para un dominio canario (ver canary.go)
+}
+
+// Tipos que pueden repetirse en cada sondeo: como mucho uno por origen en
+// este plazo. Los demás son cambios de estado y se publican siempre.
+var opsThrottled = map[string]bool{"sth_inconsistency": true, "coverage_gap": true}
+
+const opsThrottle = 5 * time.Minute
+
+const opsBusSize = 256
+
+var metricOpsEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gctwatch_ops_events_total",
+	Help: "Eventos operacionales publicados por tipo.",
+}, []string{"type"})
+
+var metricOpsDropped = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "gctwatch_ops_events_dropped_total",
+	Help: "Eventos operacionales descartados con el bus lleno.",
+})
+
+// Evento operacional; viaja en MatchEvent con kind "ops" y tag "ops:<type>",
+// así que se enruta, redacta y entrega igual que las coincidencias
+type OpsEvent struct {
+	Type     string `json:"type"`
+	Severity string `json:"severity"`
+	Source   string `json:"source"` // log, host o almacén afectado
+	Message  string `json:"message"`
+}
+
+// Bus de eventos operacionales. Los componentes publican sin bloquear; el
+// manager los entrega a los sinks. Un bus nil no publica nada.
+type EventBus struct {
+	types map[string]bool
+	ch    chan MatchEvent
+
+	mu   sync.Mutex
+	last map[string]time.Time // tipo y origen -> última publicación (solo opsThrottled)
+}
+
+// Bus para los tipos dados ("*" = todos); nil si no hay ninguno
+func NewEventBus(types []string) (*EventBus, error) {
+	if len(types) == 0 {
+		return nil, nil
+	}
+	b := &EventBus{types: make(map[string]bool), ch: make(chan MatchEvent, opsBusSize), last: make(map[string]time.Time)}
+	for _, t := range types {
+		switch _, ok := opsEventTypes[t]; {
+		case t == "*":
+			for t := range opsEventTypes {
+				b.types[t] = true
+			}
+		case ok:
+			b.types[t] = true
+		default:
+			return nil, fmt.Errorf("unknown ops event type %q (%s or *)", t, strings.Join(slices.Sorted(maps.Keys(opsEventTypes)), ", "))
+		}
+	}
+	return b, nil
+}
+
+func (b *EventBus) Publish(typ, source, format string, args ...any) {
+	if b == nil || !b.types[typ] {
+		return
+	}
+	now := time.Now()
+	if opsThrottled[typ] {
+		key := typ + " " + source
+		b.mu.Lock()
+		recent := now.Sub(b.last[key]) < opsThrottle
+		if !recent {
+			b.last[key] = now
+		}
+		b.mu.Unlock()
+		if recent {
+			return
+		}
+	}
+	metricOpsEvents.WithLabelValues(typ).Inc()
+	ev := NewOpsEvent(OpsEvent{Type: typ, Severity: opsEventTypes[typ], Source: source, Message: fmt.Sprintf(format, args...)})
+	ev.Timestamp = now.UTC()
+	select {
+	case b.ch <- ev:
+	default:
+		metricOpsDropped.Inc()
+	}
+}
+
+func NewOpsEvent(op OpsEvent) MatchEvent {
+	return MatchEvent{
+		SchemaVersion: MatchEventSchemaVersion,
+		Kind:          EventKindOps,
+		Timestamp:     time.Now().UTC(),
+		Tag:           "ops:" + op.Type,
+		Ops:           &op,
+	}
+}
+
+// Entrega los eventos del bus hasta que termina el tratamiento, vaciando
+// antes los pendientes
+func (mngr *CTLogsManager) runEvents() {
+	defer mngr.eventsWG.Done()
+	for {
+		select {
+		case ev := <-mngr.Events.ch:
+			mngr.route(ev)
+		case <-mngr.outCtx.Done():
+			for {
+				select {
+				case ev := <-mngr.Events.ch:
+					mngr.route(ev)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
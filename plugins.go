@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+/* Plugins de Go con matchers y sinks propios */
+
+var metricPluginErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gctwatch_plugin_errors_total",
+	Help: "Errores de los matchers de plugins por plugin (el certificado sigue con las coincidencias de las reglas).",
+}, []string{"plugin"})
+
+// Un plugin (-plugins) es un paquete main compilado con -buildmode=plugin
+// que exporta NewMatcher, NewSink o los dos:
+//
+//	func NewMatcher(config string) (any, error)
+//	func NewSink(config string) (any, error)
+//
+// Como un plugin no puede importar los tipos de gCTWatch, las interfaces
+// solo usan tipos de la biblioteca estándar y se comprueban por sus
+// métodos (PluginMatcher y PluginSink). config es lo indicado para el
+// plugin en -plugin-config (vacío si no hay nada).
+type Plugin struct {
+	Name    string // nombre del fichero sin .so
+	Matcher PluginMatcher
+	Sink    PluginSink
+}
+
+// Matcher de un plugin. Devuelve las coincidencias con el certificado, cada
+// una con tag y, opcionalmente, severity, description y name (el valor que
+// coincidió), como las de -lua-script. Puede implementar también io.Closer.
+type PluginMatcher interface {
+	Match(cert *x509.Certificate, logURL string) ([]map[string]string, error)
+}
+
+// Sink de un plugin. Recibe cada evento en JSON.
+type PluginSink interface {
+	Write(ctx context.Context, event []byte) error
+	Close() error
+}
+
+// Carga los plugins; configs es plugin=config
+func LoadPlugins(paths []string, configs map[string]string) ([]*Plugin, error) {
+	var plugins []*Plugin
+	for _, path := range paths {
+		p, err := loadPlugin(path, configs)
+		if err != nil {
+			closePlugins(plugins)
+			return nil, fmt.Errorf("plugin %s: %w", path, err)
+		}
+		plugins = append(plugins, p)
+	}
+	return plugins, nil
+}
+
+func loadPlugin(path string, configs map[string]string) (*Plugin, error) {
+	lookup, err := openPlugin(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &Plugin{Name: strings.TrimSuffix(filepath.Base(path), ".so")}
+	config := configs[p.Name]
+	newMatcher, err := pluginConstructor(lookup, "NewMatcher")
+	if err != nil {
+		return nil, err
+	}
+	if newMatcher != nil {
+		m, err := newMatcher(config)
+		if err != nil {
+			return nil, fmt.Errorf("NewMatcher: %w", err)
+		}
+		if p.Matcher, _ = m.(PluginMatcher); p.Matcher == nil {
+			return nil, fmt.Errorf("NewMatcher returned %T, without Match(*x509.Certificate, string) ([]map[string]string, error)", m)
+		}
+	}
+	newSink, err := pluginConstructor(lookup, "NewSink")
+	if err != nil {
+		p.Close()
+		return nil, err
+	}
+	if newSink != nil {
+		s, err := newSink(config)
+		if err != nil {
+			p.Close()
+			return nil, fmt.Errorf("NewSink: %w", err)
+		}
+		if p.Sink, _ = s.(PluginSink); p.Sink == nil {
+			p.Close()
+			return nil, fmt.Errorf("NewSink returned %T, without Write(context.Context, []byte) error and Close() error", s)
+		}
+	}
+	if p.Matcher == nil && p.Sink == nil {
+		return nil, fmt.Errorf("exports neither NewMatcher nor NewSink")
+	}
+	return p, nil
+}
+
+// Constructor exportado por el plugin; nil si no lo exporta
+func pluginConstructor(lookup func(string) (any, error), symbol string) (func(string) (any, error), error) {
+	sym, err := lookup(symbol)
+	if err != nil {
+		return nil, nil
+	}
+	f, ok := sym.(func(string) (any, error))
+	if !ok {
+		return nil, fmt.Errorf("%s is %T, not func(string) (any, error)", symbol, sym)
+	}
+	return f, nil
+}
+
+// Coincidencias del matcher. Un pánico del plugin se trata como un error
+// para no tirar el worker.
+func (p *Plugin) Match(v *certValues) (added []ruleMatch, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			added, err = nil, fmt.Errorf("panic: %v", r)
+		}
+		if err != nil {
+			metricPluginErrors.WithLabelValues(p.Name).Inc()
+		}
+	}()
+	logURL := ""
+	if v.source != nil {
+		logURL = v.source.Source
+	}
+	found, err := p.Matcher.Match(v.cert, logURL)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range found {
+		m, err := newExtraMatch(f["tag"], f["severity"], f["description"], f["name"], v)
+		if err != nil {
+			return nil, err
+		}
+		m.From = "plugin:" + p.Name
+		added = append(added, m)
+	}
+	return added, nil
+}
+
+// Cierra el matcher; el sink lo cierra su dispatcher como los demás
+func (p *Plugin) Close() error {
+	if c, ok := p.Matcher.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func closePlugins(plugins []*Plugin) {
+	for _, p := range plugins {
+		p.Close()
+		if p.Sink != nil {
+			p.Sink.Close()
+		}
+	}
+}
+
+// Sink de un plugin como Sink de gCTWatch
+type pluginSink struct {
+	name string
+	sink PluginSink
+}
+
+func (s *pluginSink) Name() string { return "plugin:" + s.name }
+func (s *pluginSink) Close() error { return s.sink.Close() }
+
+func (s *pluginSink) Write(ctx context.Context, ev MatchEvent) (err error) {
+	d, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return s.sink.Write(ctx, d)
+}
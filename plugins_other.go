@@ -0,0 +1,9 @@
+//go:build !((linux || darwin || freebsd) && cgo)
+
+package main
+
+import "fmt"
+
+func openPlugin(path string) (func(string) (any, error), error) {
+	return nil, fmt.Errorf("Go plugins are not supported on this platform or without cgo")
+}
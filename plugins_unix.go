@@ -0,0 +1,15 @@
+//go:build (linux || darwin || freebsd) && cgo
+
+package main
+
+import "plugin"
+
+// Los plugins tienen que compilarse con la misma versión de Go y las mismas
+// versiones de los módulos que comparten con gCTWatch
+func openPlugin(path string) (func(string) (any, error), error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return func(symbol string) (any, error) { return p.Lookup(symbol) }, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+/* Comprobaciones previas al arranque */
+
+type PreflightCheck struct {
+	Name     string
+	Critical bool // sin él no se puede arrancar ni siquiera degradado
+	Err      error
+}
+
+type Preflight struct {
+	checks []PreflightCheck
+}
+
+// Registra el resultado de una comprobación; devuelve true si ha ido bien
+func (p *Preflight) Check(name string, critical bool, err error) bool {
+	p.checks = append(p.checks, PreflightCheck{Name: name, Critical: critical, Err: err})
+	return err == nil
+}
+
+func (p *Preflight) CriticalFailed() bool {
+	for _, c := range p.checks {
+		if c.Err != nil && c.Critical {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Preflight) Failed() bool {
+	for _, c := range p.checks {
+		if c.Err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Preflight) Report(w io.Writer) {
+	fmt.Fprintln(w, "Preflight:")
+	for _, c := range p.checks {
+		switch {
+		case c.Err == nil:
+			fmt.Fprintf(w, "  [ OK ] %s\n", c.Name)
+		case c.Critical:
+			fmt.Fprintf(w, "  [FAIL] %s: %v\n", c.Name, c.Err)
+		default:
+			fmt.Fprintf(w, "  [WARN] %s: %v\n", c.Name, c.Err)
+		}
+	}
+}
+
+// Sinks que pueden comprobar su destino antes de arrancar
+type SinkChecker interface {
+	Check() error
+}
+
+// Comprueba que se puede escribir en el directorio de un fichero de estado
+func checkWritableDir(path string) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".preflight-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/hmac"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+/* Redacción de campos para sinks menos fiables */
+
+// Acciones sobre un campo
+const (
+	RedactHash     = "hash"     // HMAC-SHA256 (o SHA-256 sin clave), 32 caracteres hex
+	RedactTruncate = "truncate" // truncate:N conserva los N primeros caracteres
+	RedactDrop     = "drop"     // valor vacío
+)
+
+type redactRule struct {
+	path   []int // índices de campo desde MatchEvent
+	name   string
+	action string
+	n      int
+}
+
+// Aplica las reglas a los eventos de los sinks de Sinks (vacío = todos salvo
+// los locales, que conservan los datos completos)
+type Redactor struct {
+	rules []redactRule
+	Sinks []string
+	Key   []byte
+}
+
+// "certificate.dns_names=hash,certificate.serial_number=truncate:6"; los
+// campos se nombran como en el JSON del evento
+func ParseRedaction(spec string, sinks []string, key []byte) (*Redactor, error) {
+	r := &Redactor{Sinks: sinks, Key: key}
+	for field, action := range parseKeyValues(spec) {
+		rule := redactRule{name: field}
+		rule.action, _, _ = strings.Cut(action, ":")
+		t, err := redactPath(field, &rule.path)
+		if err != nil {
+			return nil, err
+		}
+		switch rule.action {
+		case RedactTruncate:
+			_, n, _ := strings.Cut(action, ":")
+			if rule.n, err = strconv.Atoi(n); err != nil || rule.n < 0 {
+				return nil, fmt.Errorf("invalid redaction %s=%s (truncate:N)", field, action)
+			}
+			fallthrough
+		case RedactHash:
+			if t.Kind() != reflect.String && (t.Kind() != reflect.Slice || t.Elem().Kind() != reflect.String) {
+				return nil, fmt.Errorf("cannot %s field %s: not a string", rule.action, field)
+			}
+		case RedactDrop:
+		default:
+			return nil, fmt.Errorf("unknown redaction %q for field %s (hash, truncate:N, drop)", action, field)
+		}
+		r.rules = append(r.rules, rule)
+	}
+	return r, nil
+}
+
+// Resuelve "a.b.c" por las etiquetas json; devuelve el tipo del campo final
+func redactPath(field string, path *[]int) (reflect.Type, error) {
+	t := reflect.TypeOf(MatchEvent{})
+	for _, part := range strings.Split(field, ".") {
+		if t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("unknown event field %s", field)
+		}
+		found := false
+		for i := 0; i < t.NumField(); i++ {
+			name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+			if name == part {
+				*path = append(*path, i)
+				t, found = t.Field(i).Type, true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown event field %s", field)
+		}
+	}
+	return t, nil
+}
+
+func (r *Redactor) Applies(s Sink) bool {
+	if r == nil || len(r.rules) == 0 {
+		return false
+	}
+	if len(r.Sinks) == 0 {
+		return !isLocalSink(s)
+	}
+	return routedTo(s.Name(), r.Sinks)
+}
+
+// Copia del evento con los campos redactados; el original no se modifica
+func (r *Redactor) Apply(ev MatchEvent) MatchEvent {
+	v := reflect.ValueOf(&ev).Elem()
+	for _, rule := range r.rules {
+		r.applyRule(v, rule)
+	}
+	return ev
+}
+
+func (r *Redactor) applyRule(v reflect.Value, rule redactRule) {
+	for _, i := range rule.path {
+		if v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return
+			}
+			// Copia del valor apuntado: el resto de sinks lo comparten
+			c := reflect.New(v.Type().Elem())
+			c.Elem().Set(v.Elem())
+			v.Set(c)
+			v = c.Elem()
+		}
+		v = v.Field(i)
+	}
+	switch {
+	case rule.action == RedactDrop:
+		v.SetZero()
+	case v.Kind() == reflect.String:
+		v.SetString(r.redact(v.String(), rule))
+	case v.Kind() == reflect.Slice && !v.IsNil():
+		out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).SetString(r.redact(v.Index(i).String(), rule))
+		}
+		v.Set(out)
+	}
+}
+
+func (r *Redactor) redact(s string, rule redactRule) string {
+	if s == "" {
+		return s
+	}
+	switch rule.action {
+	case RedactHash:
+		var sum []byte
+		if len(r.Key) > 0 {
+			m := hmac.New(cryptoProvider.NewHash, r.Key)
+			m.Write([]byte(s))
+			sum = m.Sum(nil)
+		} else {
+			sum = cryptoProvider.Hash([]byte(s))
+		}
+		return hex.EncodeToString(sum[:16])
+	case RedactTruncate:
+		if runes := []rune(s); len(runes) > rule.n {
+			return string(runes[:rule.n]) + "…"
+		}
+	}
+	return s
+}
@@ -0,0 +1,586 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	CertTransp "github.com/google/certificate-transparency-go"
+	ctx509 "github.com/google/certificate-transparency-go/x509"
+	"github.com/klauspost/compress/zstd"
+)
+
+/* gctwatch replay: las reglas de ahora sobre el archivo de segmentos */
+
+const (
+	replayStateFile     = "replay-state.json"
+	replayProgressEvery = time.Second      // en un terminal
+	replayLogEvery      = 10 * time.Second // fuera de un terminal, y el estado
+	replayBarWidth      = 30
+)
+
+type replayOptions struct {
+	Parallel        int    // segmentos leídos a la vez
+	Chronological   bool   // mezcla los logs por la marca de tiempo de las hojas
+	State           string // "" = replay-state.json en el archivo
+	Workers         int
+	BufferSize      int
+	ShutdownTimeout time.Duration
+	OnlyLogs        []string
+	ExcludeLogs     []string
+	HTTPAddr        string
+	ReportFile      string
+	Maintenance     bool
+}
+
+// Posición de cada segmento, para seguir donde se dejó. Sin borrarlo, otra
+// ejecución solo trata lo archivado después.
+type ReplayState struct {
+	Archive   string            `json:"archive"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	Segments  map[string]uint64 `json:"segments"` // logs/<log>/<primero> -> siguiente índice por tratar
+}
+
+// Un segmento por tratar
+type replayUnit struct {
+	key     string // en ReplayState
+	url     string
+	path    string
+	open    bool
+	sealed  *archiveSegment // índice de tramas, si está cerrado
+	entries uint64          // según el manifiesto o el índice
+	resume  uint64          // del estado
+
+	mu      sync.Mutex
+	tracker checkpointTracker // tramas entregadas a los workers
+	next    uint64            // índice siguiente a la última trama entregada
+}
+
+// Índice desde el que habría que seguir: el de la trama pendiente más
+// antigua
+func (u *replayUnit) position() uint64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.tracker.Committed(u.next)
+}
+
+type replayRun struct {
+	mngr    *CTLogsManager
+	dir     string
+	units   []*replayUnit
+	sources map[string]*CTLogSource
+	dec     *zstd.Decoder
+
+	total     atomic.Int64 // entradas de todos los segmentos
+	done      int64        // ya tratadas en ejecuciones anteriores
+	skipped   atomic.Int64 // que no se pueden interpretar
+	finished  atomic.Int64 // segmentos leídos por completo
+	failed    atomic.Int64
+	startedAt time.Time
+}
+
+// gctwatch [flags] replay <directorio>. Pasa las entradas del archivo
+// (-archive segments:) por las reglas y los sinks de los flags, leyendo
+// varios segmentos a la vez. Como explain, no abre checkpoints, spill ni
+// archivo; el archivo se lee sin tocarlo, así que puede ser el de una
+// instancia en marcha.
+func runReplay(f setupFlags, o replayOptions, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: gctwatch [flags] replay <segments archive directory>")
+	}
+	dir := strings.TrimPrefix(args[0], "segments:")
+	data, err := os.ReadFile(filepath.Join(dir, archiveManifestFile))
+	if err != nil {
+		return fmt.Errorf("%s is not a segments archive: %w", dir, err)
+	}
+	var manifest ArchiveManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("failed to parse archive manifest: %w", err)
+	}
+	if o.State == "" {
+		o.State = filepath.Join(dir, replayStateFile)
+	}
+	state, err := loadReplayState(o.State, dir)
+	if err != nil {
+		return err
+	}
+
+	f.checkpointStore, f.spillQueue, f.archive, f.ingestToken = "", "", "", ""
+	f.offline, f.noLogLists, f.ntpServer = true, true, "" // sin lista de logs ni comprobación del reloj
+	mngr, p := setup(f)
+	if mngr == nil || p.CriticalFailed() {
+		p.Report(os.Stderr)
+		return fmt.Errorf("cannot replay with critical setup failures")
+	}
+	if p.Failed() {
+		p.Report(os.Stderr)
+	}
+	mngr.OnlyLogs, mngr.ExcludeLogs = o.OnlyLogs, o.ExcludeLogs
+	mngr.Workers, mngr.ShutdownTimeout = o.Workers, o.ShutdownTimeout
+	mngr.OutputChan = make(chan SourcedEntry, o.BufferSize)
+	if o.Maintenance {
+		mngr.Maintenance.Set(true, "-maintenance flag")
+	}
+	dec, err := zstd.NewReader(nil)
+	if err != nil {
+		mngr.closeExplain()
+		return err
+	}
+	defer dec.Close()
+	r := &replayRun{mngr: mngr, dir: dir, sources: make(map[string]*CTLogSource), dec: dec}
+	if err := r.plan(manifest, state); err != nil {
+		mngr.closeExplain()
+		return err
+	}
+	if o.HTTPAddr != "" {
+		stop := mngr.StartAdminServer(o.HTTPAddr)
+		defer stop()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	mngr.StartStreaming()
+	r.startedAt = time.Now()
+	if o.Chronological {
+		log.Printf("replay: %d entries in %d segments of %d logs (%d already done), merged by leaf timestamp",
+			r.total.Load(), len(r.units), len(r.sources), r.done)
+	} else {
+		log.Printf("replay: %d entries in %d segments of %d logs (%d already done), %d segments at a time",
+			r.total.Load(), len(r.units), len(r.sources), r.done, o.Parallel)
+	}
+	progressDone := make(chan struct{})
+	progressStop := make(chan struct{})
+	go func() {
+		defer close(progressDone)
+		r.report(o.State, progressStop)
+	}()
+	if o.Chronological {
+		r.runChronological(ctx)
+	} else {
+		r.run(ctx, o.Parallel)
+	}
+	interrupted := ctx.Err() != nil
+	stop()
+	mngr.StopStreaming()
+	close(progressStop)
+	<-progressDone
+
+	if err := r.saveState(o.State); err != nil {
+		log.Printf("WARNING: %v", err)
+	}
+	report := mngr.ShutdownReport()
+	report.Log()
+	if o.ReportFile != "" {
+		if err := report.WriteFile(o.ReportFile); err != nil {
+			log.Printf("WARNING: %v", err)
+		}
+	}
+	if n := r.failed.Load(); n > 0 {
+		return fmt.Errorf("replay: %d segments could not be read", n)
+	}
+	if interrupted {
+		log.Printf("replay interrupted at %.1f%%; run it again to resume from %s", r.percent(), o.State)
+	}
+	return nil
+}
+
+func loadReplayState(path, dir string) (*ReplayState, error) {
+	state := &ReplayState{Archive: dir, Segments: make(map[string]uint64)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse replay state %s: %w", path, err)
+	}
+	if state.Segments == nil {
+		state.Segments = make(map[string]uint64)
+	}
+	return state, nil
+}
+
+// Segmentos de los logs seleccionados, con lo que ya se trató según el
+// estado
+func (r *replayRun) plan(m ArchiveManifest, state *ReplayState) error {
+	for _, ml := range m.Logs {
+		if !r.mngr.logSelected(ml.URL) {
+			continue
+		}
+		for _, ms := range ml.Segments {
+			path := filepath.Join(r.dir, filepath.FromSlash(ms.File))
+			key := strings.TrimSuffix(ms.File, filepath.Ext(ms.File))
+			u := &replayUnit{key: key, url: ml.URL, path: path, open: ms.Open, entries: ms.Entries, resume: state.Segments[key]}
+			if u.open {
+				// Cerrado desde que se escribió el manifiesto
+				if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+					u.path, u.open = strings.TrimSuffix(path, ".open")+".zst", false
+				}
+			}
+			if !u.open {
+				seg, err := readArchiveSegment(u.path)
+				if err != nil {
+					return err
+				}
+				u.sealed, u.entries = seg, seg.entries
+				for _, fr := range seg.frames {
+					end := fr.first + uint64(fr.count)
+					if u.resume > fr.first {
+						r.done += int64(min(end, u.resume) - fr.first)
+					}
+				}
+			} else if u.resume > ms.First {
+				r.done += int64(min(u.resume, ms.Last+1) - ms.First)
+			}
+			u.next = max(u.resume, ms.First)
+			r.total.Add(int64(u.entries))
+			r.units = append(r.units, u)
+		}
+		r.sources[ml.URL] = &CTLogSource{Source: ml.URL, Lists: []string{"archive"}, Stats: &FetchStats{}}
+	}
+	return nil
+}
+
+// Reparte los segmentos entre parallel lectores y espera a que terminen
+func (r *replayRun) run(ctx context.Context, parallel int) {
+	units := make(chan *replayUnit)
+	var wg sync.WaitGroup
+	for range max(parallel, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for u := range units {
+				if !r.finish(ctx, u, r.read(ctx, u)) {
+					return
+				}
+			}
+		}()
+	}
+	for _, u := range r.units {
+		select {
+		case units <- u:
+		case <-ctx.Done():
+		}
+	}
+	close(units)
+	wg.Wait()
+}
+
+// Cuenta un segmento terminado o fallido; false si se ha parado la lectura
+func (r *replayRun) finish(ctx context.Context, u *replayUnit, err error) bool {
+	if err == nil {
+		r.finished.Add(1)
+		return true
+	}
+	if ctx.Err() != nil {
+		return false
+	}
+	r.failed.Add(1)
+	log.Printf("WARNING: replay: %s: %v", u.path, err)
+	return true
+}
+
+// Entradas de una trama que quedan por tratar, en un lote nuevo del
+// segmento; ninguna si ya se trató entera
+func (u *replayUnit) batch(src *CTLogSource, start uint64, raw []CertTransp.LeafEntry, skipped *atomic.Int64) ([]CertTransp.LogEntry, *entryBatch) {
+	end := start + uint64(len(raw))
+	if end <= u.resume {
+		return nil, nil
+	}
+	var entries []CertTransp.LogEntry
+	for i := range raw {
+		idx := start + uint64(i)
+		if idx < u.resume {
+			continue
+		}
+		e, err := CertTransp.LogEntryFromLeaf(int64(idx), &raw[i])
+		if ctx509.IsFatal(err) {
+			metricEntriesUnparsed.WithLabelValues(src.Source).Inc()
+			skipped.Add(1)
+			continue
+		}
+		entries = append(entries, *e)
+	}
+	u.mu.Lock()
+	b := u.tracker.Add(max(start, u.resume), len(entries))
+	u.next = end
+	u.mu.Unlock()
+	return entries, b
+}
+
+// Pasa a los workers las entradas de una trama desde donde se quedó
+func (u *replayUnit) deliver(ctx context.Context, out chan<- SourcedEntry, src *CTLogSource, start uint64, raw []CertTransp.LeafEntry, skipped *atomic.Int64) error {
+	entries, b := u.batch(src, start, raw, skipped)
+	for _, e := range entries {
+		select {
+		case out <- SourcedEntry{Source: src, Entry: e, batch: b}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Lee el segmento trama a trama
+func (r *replayRun) read(ctx context.Context, u *replayUnit) error {
+	src := r.sources[u.url]
+	return r.frames(u, func(start uint64, raw []CertTransp.LeafEntry) error {
+		return u.deliver(ctx, r.mngr.OutputChan, src, start, raw, &r.skipped)
+	})
+}
+
+// Tramas del segmento en orden de índice, desde la primera que no se trató
+// entera
+func (r *replayRun) frames(u *replayUnit, fn func(start uint64, raw []CertTransp.LeafEntry) error) error {
+	if u.open {
+		index, raw, err := readOpenSegmentFile(u.path)
+		if err != nil {
+			return err
+		}
+		r.total.Add(int64(len(index)) - int64(u.entries))
+		// Tramas como las de un segmento cerrado: consecutivas y de 1000 como mucho
+		for i := 0; i < len(index); {
+			j := i + 1
+			for j < len(index) && j-i < archiveFrameEntries && index[j] == index[j-1]+1 {
+				j++
+			}
+			if err := fn(index[i], raw[i:j]); err != nil {
+				return err
+			}
+			i = j
+		}
+		return nil
+	}
+	f, err := os.Open(u.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for i, fr := range u.sealed.frames {
+		if fr.first+uint64(fr.count) <= u.resume {
+			continue
+		}
+		raw, err := u.sealed.frame(f, r.dec, i)
+		if err != nil {
+			return err
+		}
+		if err := fn(fr.first, raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Trama de un log preparada para la mezcla
+type replayFrame struct {
+	entries []CertTransp.LogEntry
+	batch   *entryBatch
+}
+
+// Un log en la mezcla cronológica, con la trama que se está entregando
+type replayCursor struct {
+	src    *CTLogSource
+	units  []*replayUnit // sus segmentos, por orden de índice
+	frames chan replayFrame
+	cur    replayFrame
+	pos    int
+}
+
+// Marca de tiempo de la hoja en cabeza
+func (c *replayCursor) head() uint64 {
+	if te := c.cur.entries[c.pos].Leaf.TimestampedEntry; te != nil {
+		return te.Timestamp
+	}
+	return 0
+}
+
+// Pasa a la siguiente trama con entradas; false si el log se ha acabado o
+// se ha parado la lectura
+func (c *replayCursor) advance(ctx context.Context) bool {
+	for {
+		select {
+		case fr, ok := <-c.frames:
+			if !ok {
+				return false
+			}
+			if len(fr.entries) > 0 {
+				c.cur, c.pos = fr, 0
+				return true
+			}
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// Como run, pero entregando las entradas de todos los logs (p.ej. los shards
+// de una familia) por orden de la marca de tiempo de la hoja. Cada log se lee
+// en su gorutina, segmento a segmento y con una trama por delante, y siempre
+// se entrega la más antigua de las cabezas. Dentro de un log se mantiene el
+// orden de índice, así que el resultado es aproximado: un log integra las
+// entradas en el orden en que le llegan, con hasta su MMD de desfase.
+func (r *replayRun) runChronological(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var cursors []*replayCursor
+	byURL := make(map[string]*replayCursor)
+	for _, u := range r.units {
+		c, ok := byURL[u.url]
+		if !ok {
+			c = &replayCursor{src: r.sources[u.url], frames: make(chan replayFrame, 1)}
+			byURL[u.url] = c
+			cursors = append(cursors, c)
+		}
+		c.units = append(c.units, u)
+	}
+	var wg sync.WaitGroup
+	for _, c := range cursors {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(c.frames)
+			for _, u := range c.units {
+				err := r.frames(u, func(start uint64, raw []CertTransp.LeafEntry) error {
+					entries, b := u.batch(c.src, start, raw, &r.skipped)
+					select {
+					case c.frames <- replayFrame{entries: entries, batch: b}:
+						return nil
+					case <-ctx.Done():
+						return ctx.Err()
+					}
+				})
+				if !r.finish(ctx, u, err) {
+					return
+				}
+			}
+		}()
+	}
+
+	var live []*replayCursor
+	for _, c := range cursors {
+		if c.advance(ctx) {
+			live = append(live, c)
+		}
+	}
+	out := r.mngr.OutputChan
+	for len(live) > 0 && ctx.Err() == nil {
+		// Pocos logs: basta con recorrer las cabezas. En un empate gana el
+		// primero del manifiesto.
+		m := 0
+		for i := 1; i < len(live); i++ {
+			if live[i].head() < live[m].head() {
+				m = i
+			}
+		}
+		c := live[m]
+		select {
+		case out <- SourcedEntry{Source: c.src, Entry: c.cur.entries[c.pos], batch: c.cur.batch}:
+		case <-ctx.Done():
+			continue
+		}
+		if c.pos++; c.pos == len(c.cur.entries) && !c.advance(ctx) {
+			live = slices.Delete(live, m, m+1)
+		}
+	}
+	cancel()
+	wg.Wait()
+}
+
+func (r *replayRun) processed() int64 {
+	return r.done + r.mngr.stats.EntriesProcessed.Load() + r.skipped.Load()
+}
+
+func (r *replayRun) percent() float64 {
+	total := r.total.Load()
+	if total == 0 {
+		return 100
+	}
+	return 100 * float64(r.processed()) / float64(total)
+}
+
+// Progreso con velocidad y tiempo restante: una barra que se reescribe si
+// stderr es un terminal, una línea de log si no. El estado se guarda a la
+// vez que las líneas de log.
+func (r *replayRun) report(statePath string, stop <-chan struct{}) {
+	tty := isTerminal(os.Stderr)
+	every := replayLogEvery
+	if tty {
+		every = replayProgressEvery
+	}
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	lastSave := time.Now()
+	for {
+		select {
+		case <-stop:
+			r.printProgress(os.Stderr, tty)
+			if tty {
+				fmt.Fprintln(os.Stderr)
+			}
+			return
+		case <-ticker.C:
+			r.printProgress(os.Stderr, tty)
+			if time.Since(lastSave) >= replayLogEvery {
+				if err := r.saveState(statePath); err != nil {
+					log.Printf("WARNING: %v", err)
+				}
+				lastSave = time.Now()
+			}
+		}
+	}
+}
+
+func (r *replayRun) printProgress(w io.Writer, tty bool) {
+	processed, total := r.processed(), r.total.Load()
+	rate := float64(processed-r.done) / time.Since(r.startedAt).Seconds()
+	eta := "-"
+	if rate > 0 && total > processed {
+		eta = (time.Duration(float64(total-processed)/rate) * time.Second).Round(time.Second).String()
+	} else if total <= processed {
+		eta = "0s"
+	}
+	pct := r.percent()
+	if !tty {
+		log.Printf("replay: %.1f%% (%d of %d entries, %d of %d segments), %.0f entries/s, ETA %s",
+			pct, processed, total, r.finished.Load(), len(r.units), rate, eta)
+		return
+	}
+	filled := min(int(pct/100*replayBarWidth), replayBarWidth)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", replayBarWidth-filled)
+	fmt.Fprintf(w, "\rreplay [%s] %5.1f%%  %d/%d  %.0f/s  ETA %-10s", bar, pct, processed, total, rate, eta)
+}
+
+// Guarda la posición de cada segmento de forma atómica
+func (r *replayRun) saveState(path string) error {
+	state := ReplayState{Archive: r.dir, UpdatedAt: time.Now().UTC(), Segments: make(map[string]uint64, len(r.units))}
+	for _, u := range r.units {
+		state.Segments[u.key] = u.position()
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write replay state: %w", err)
+	}
+	return nil
+}
+
+func isTerminal(f *os.File) bool {
+	st, err := f.Stat()
+	return err == nil && st.Mode()&os.ModeCharDevice != 0
+}
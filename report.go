@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"time"
+)
+
+/* Informe de parada */
+
+// Resumen de la ejecución al parar, para que una ejecución acotada (-duration)
+// deje constancia de lo que ha cubierto. Las posiciones son las finales, las
+// mismas que quedan en los checkpoints.
+type ShutdownReport struct {
+	StatsReport
+	StoppedAt      time.Time `json:"stopped_at"`
+	RuntimeSeconds float64   `json:"runtime_seconds"`
+	Dropped        int64     `json:"dropped"` // entradas descartadas con OutputChan lleno
+}
+
+// Llamar después de StopStreaming
+func (mngr *CTLogsManager) ShutdownReport() ShutdownReport {
+	r := ShutdownReport{StatsReport: mngr.StatsReport(), StoppedAt: time.Now().UTC()}
+	r.RuntimeSeconds = r.StoppedAt.Sub(r.StartedAt).Seconds()
+	for i := range r.Sources {
+		r.Sources[i].Position = mngr.sources[i].LastSize
+		r.Dropped += r.Sources[i].Dropped
+	}
+	return r
+}
+
+func (r ShutdownReport) Log() {
+	log.Printf("run summary: %s, %d entries processed, %d matches, %d entries dropped",
+		time.Duration(r.RuntimeSeconds*float64(time.Second)).Round(time.Second), r.EntriesProcessed, r.Matches, r.Dropped)
+	for _, tag := range slices.Sorted(maps.Keys(r.MatchesByTag)) {
+		log.Printf("  tag %s: %d matches", tag, r.MatchesByTag[tag])
+	}
+	for _, tag := range slices.Sorted(maps.Keys(r.ShadowByTag)) {
+		log.Printf("  shadow tag %s: %d matches", tag, r.ShadowByTag[tag])
+	}
+	for _, s := range r.Sources {
+		log.Printf("  log %s: position %d, %d entries fetched, %d parsed, %d dropped, %d errors",
+			s.URL, s.Position, s.Entries, s.Parsed, s.Dropped, s.Errors)
+	}
+	for _, s := range r.Sinks {
+		log.Printf("  sink %s: %d delivered, %d failed, %d dropped", s.Name, s.Delivered, s.Failed, s.Dropped)
+	}
+}
+
+func (r ShutdownReport) WriteFile(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write shutdown report: %w", err)
+	}
+	return nil
+}
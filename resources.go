@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"time"
+)
+
+/* Consumo de recursos del propio proceso */
+
+// En /metrics ya están los colectores estándar de Prometheus (go_* y
+// process_*: CPU, memoria residente, descriptores); esto es lo mismo para la API
+// de estadísticas.
+type ResourceReport struct {
+	CPUUserSeconds   float64 `json:"cpu_user_seconds"`
+	CPUSystemSeconds float64 `json:"cpu_system_seconds"`
+	MaxRSSBytes      int64   `json:"max_rss_bytes,omitempty"`
+	HeapAllocBytes   uint64  `json:"heap_alloc_bytes"`
+	HeapObjects      uint64  `json:"heap_objects"`
+	SysBytes         uint64  `json:"sys_bytes"` // memoria obtenida del sistema
+	Goroutines       int     `json:"goroutines"`
+	GCCycles         uint32  `json:"gc_cycles"`
+	GCPauseTotalMs   float64 `json:"gc_pause_total_ms"`
+	LastGCAt         string  `json:"last_gc_at,omitempty"`
+	OpenFDs          int     `json:"open_fds"` // -1 si no se puede saber
+}
+
+func resourceReport() ResourceReport {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	r := ResourceReport{
+		HeapAllocBytes: m.HeapAlloc,
+		HeapObjects:    m.HeapObjects,
+		SysBytes:       m.Sys,
+		Goroutines:     runtime.NumGoroutine(),
+		GCCycles:       m.NumGC,
+		GCPauseTotalMs: float64(m.PauseTotalNs) / 1e6,
+		OpenFDs:        openFDs(),
+	}
+	if m.LastGC > 0 {
+		r.LastGCAt = time.Unix(0, int64(m.LastGC)).UTC().Format(time.RFC3339)
+	}
+	r.CPUUserSeconds, r.CPUSystemSeconds, r.MaxRSSBytes = processUsage()
+	return r
+}
+
+// Descriptores abiertos (Linux; /dev/fd en BSD y macOS)
+func openFDs() int {
+	for _, dir := range []string{"/proc/self/fd", "/dev/fd"} {
+		if entries, err := os.ReadDir(dir); err == nil {
+			return len(entries)
+		}
+	}
+	return -1
+}
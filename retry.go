@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/* Cliente HTTP compartido con reintentos y circuit breaker por host */
+
+type RetryPolicy struct {
+	MaxRetries       int
+	BaseDelay        time.Duration
+	MaxDelay         time.Duration
+	BreakerThreshold int           // fallos seguidos que abren el circuito
+	BreakerCooldown  time.Duration // tiempo abierto antes de dejar pasar una prueba
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries:       3,
+	BaseDelay:        500 * time.Millisecond,
+	MaxDelay:         30 * time.Second,
+	BreakerThreshold: 5,
+	BreakerCooldown:  30 * time.Second,
+}
+
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+type hostBreaker struct {
+	failures  int
+	openUntil time.Time // cero = cerrado
+	probing   bool      // semiabierto: la prueba está en curso
+}
+
+type retryTransport struct {
+	base     http.RoundTripper
+	policy   RetryPolicy
+	mu       sync.Mutex
+	breakers map[string]*hostBreaker
+	events   *EventBus
+}
+
+func newRetryTransport(base http.RoundTripper, policy RetryPolicy, events *EventBus) *retryTransport {
+	return &retryTransport{base: base, policy: policy, breakers: make(map[string]*hostBreaker), events: events}
+}
+
+// Cerrado deja pasar todo. Abierto rechaza hasta que pasa el cooldown;
+// entonces queda semiabierto y deja pasar una sola prueba (probe = true), cuyo
+// resultado lo cierra o lo vuelve a abrir.
+func (t *retryTransport) allow(host string) (allowed, probe bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := t.breakers[host]
+	if b == nil || b.openUntil.IsZero() {
+		return true, false
+	}
+	if b.probing || time.Now().Before(b.openUntil) {
+		return false, false
+	}
+	b.probing = true
+	return true, true
+}
+
+// Abierto o semiabierto: no se sigue reintentando
+func (t *retryTransport) open(host string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := t.breakers[host]
+	return b != nil && !b.openUntil.IsZero()
+}
+
+// La prueba acabó sin resultado (cancelada, egress denegado): la siguiente
+// petición hará otra
+func (t *retryTransport) release(host string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if b := t.breakers[host]; b != nil {
+		b.probing = false
+	}
+}
+
+func (t *retryTransport) record(host string, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := t.breakers[host]
+	if b == nil {
+		b = &hostBreaker{}
+		t.breakers[host] = b
+	}
+	wasOpen := !b.openUntil.IsZero()
+	if ok {
+		b.failures = 0
+		b.openUntil = time.Time{}
+		b.probing = false
+		metricBreakerOpen.WithLabelValues(host).Set(0)
+		if wasOpen {
+			t.events.Publish("circuit_closed", host, "circuit breaker for %s closed", host)
+		}
+		return
+	}
+	b.failures++
+	// Falla la prueba: se vuelve a abrir
+	if b.failures >= t.policy.BreakerThreshold || b.probing {
+		b.openUntil = time.Now().Add(t.policy.BreakerCooldown)
+		b.probing = false
+		metricBreakerOpen.WithLabelValues(host).Set(1)
+		if !wasOpen {
+			t.events.Publish("circuit_open", host, "circuit breaker for %s open after %d consecutive failures", host, b.failures)
+		}
+	}
+}
+
+// Backoff exponencial con jitter completo
+func (t *retryTransport) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s > 0 {
+			return min(time.Duration(s)*time.Second, t.policy.MaxDelay)
+		}
+	}
+	d := min(t.policy.BaseDelay<<attempt, t.policy.MaxDelay)
+	return time.Duration(rand.Int64N(int64(d) + 1))
+}
+
+func retryable(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	allowed, probe := t.allow(host)
+	if !allowed {
+		metricOutboundRequests.WithLabelValues(host, "circuit_open").Inc()
+		return nil, fmt.Errorf("%s: %w", host, ErrCircuitOpen)
+	}
+	if probe {
+		// Tras record no hace nada; si la prueba se corta antes, la libera
+		defer t.release(host)
+	}
+	// Solo se reintenta si el cuerpo puede volver a enviarse
+	canRetry := req.Body == nil || req.GetBody != nil
+	for attempt := 0; ; attempt++ {
+		r := req
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = req.Clone(req.Context())
+			r.Body = body
+		}
+		resp, err := t.base.RoundTrip(r)
+		if err != nil && (errors.Is(err, ErrEgressDenied) || req.Context().Err() != nil) {
+			return nil, err
+		}
+		failed := err != nil || retryable(resp)
+		if !failed {
+			t.record(host, true)
+			metricOutboundRequests.WithLabelValues(host, strconv.Itoa(resp.StatusCode)).Inc()
+			return resp, nil
+		}
+		t.record(host, false)
+		result := "error"
+		if err == nil {
+			result = strconv.Itoa(resp.StatusCode)
+		}
+		metricOutboundRequests.WithLabelValues(host, result).Inc()
+		if !canRetry || attempt >= t.policy.MaxRetries || t.open(host) {
+			return resp, err
+		}
+		wait := t.backoff(attempt, resp)
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+		metricOutboundRetries.WithLabelValues(host).Inc()
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+	}
+}
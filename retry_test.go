@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Transporte que responde con el estado actual y cuenta las peticiones; con
+// hold, cada petición espera a que se cierre
+type fakeHostTransport struct {
+	status atomic.Int32
+	calls  atomic.Int32
+	hold   chan struct{}
+}
+
+func (f *fakeHostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.calls.Add(1)
+	if f.hold != nil {
+		<-f.hold
+	}
+	w := httptest.NewRecorder()
+	w.WriteHeader(int(f.status.Load()))
+	return w.Result(), nil
+}
+
+func newTestRetryTransport(base http.RoundTripper) *retryTransport {
+	return newRetryTransport(base, RetryPolicy{BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, BreakerThreshold: 2, BreakerCooldown: 50 * time.Millisecond}, nil)
+}
+
+func testRoundTrip(t *retryTransport) error {
+	req, _ := http.NewRequest(http.MethodGet, "https://api.example.net/", nil)
+	resp, err := t.RoundTrip(req)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode >= 500 {
+			err = errors.New(resp.Status)
+		}
+	}
+	return err
+}
+
+func TestRetryBreakerHalfOpen(t *testing.T) {
+	base := &fakeHostTransport{}
+	base.status.Store(http.StatusServiceUnavailable)
+	rt := newTestRetryTransport(base)
+
+	// Dos fallos abren el circuito y mientras dura el cooldown no sale nada
+	testRoundTrip(rt)
+	testRoundTrip(rt)
+	calls := base.calls.Load()
+	if err := testRoundTrip(rt); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("request with the breaker open = %v; want ErrCircuitOpen", err)
+	}
+	if base.calls.Load() != calls {
+		t.Fatal("request sent with the breaker open")
+	}
+
+	// Pasado el cooldown solo sale una prueba aunque lleguen muchas a la vez
+	time.Sleep(60 * time.Millisecond)
+	base.status.Store(http.StatusOK)
+	base.hold = make(chan struct{})
+	calls = base.calls.Load()
+	var wg sync.WaitGroup
+	var rejected atomic.Int32
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if errors.Is(testRoundTrip(rt), ErrCircuitOpen) {
+				rejected.Add(1)
+			}
+		}()
+	}
+	// La prueba no acaba hasta que se han rechazado las demás
+	deadline := time.Now().Add(5 * time.Second)
+	for rejected.Load() < 19 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	close(base.hold)
+	wg.Wait()
+	base.hold = nil
+	if sent := base.calls.Load() - calls; sent != 1 || rejected.Load() != 19 {
+		t.Fatalf("half-open breaker sent %d requests and rejected %d; want 1 probe and 19 rejected", sent, rejected.Load())
+	}
+
+	// La prueba fue bien: cerrado
+	if err := testRoundTrip(rt); err != nil {
+		t.Fatalf("request after a successful probe = %v", err)
+	}
+
+	// Una prueba fallida lo vuelve a abrir sin reintentar
+	base.status.Store(http.StatusServiceUnavailable)
+	testRoundTrip(rt)
+	testRoundTrip(rt)
+	time.Sleep(60 * time.Millisecond)
+	calls = base.calls.Load()
+	testRoundTrip(rt)
+	if sent := base.calls.Load() - calls; sent != 1 {
+		t.Errorf("failed probe sent %d requests; want 1", sent)
+	}
+	if err := testRoundTrip(rt); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("request after a failed probe = %v; want ErrCircuitOpen", err)
+	}
+}
+
+// Una prueba cortada antes de tener respuesta deja paso a la siguiente
+func TestRetryBreakerProbeReleased(t *testing.T) {
+	base := &fakeHostTransport{}
+	base.status.Store(http.StatusServiceUnavailable)
+	rt := newTestRetryTransport(base)
+	testRoundTrip(rt)
+	testRoundTrip(rt)
+	time.Sleep(60 * time.Millisecond)
+
+	denied := newTestRetryTransport(roundTripFunc(func(*http.Request) (*http.Response, error) {
+		return nil, ErrEgressDenied
+	}))
+	denied.breakers = rt.breakers
+	if err := testRoundTrip(denied); !errors.Is(err, ErrEgressDenied) {
+		t.Fatalf("probe = %v; want ErrEgressDenied", err)
+	}
+	base.status.Store(http.StatusOK)
+	if err := testRoundTrip(rt); err != nil {
+		t.Errorf("request after an interrupted probe = %v; want a new probe", err)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
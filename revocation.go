@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+/* Estado de revocación (OCSP, con CRL como respaldo) */
+
+const (
+	maxOCSPResponseBytes = 1 << 20
+	maxCRLBytes          = 64 << 20
+	defaultCRLCacheTTL   = time.Hour // si la CRL no trae NextUpdate
+)
+
+// Motivos de revocación (RFC 5280, 5.3.1)
+var revocationReasons = map[int]string{
+	0: "unspecified", 1: "keyCompromise", 2: "cACompromise", 3: "affiliationChanged",
+	4: "superseded", 5: "cessationOfOperation", 6: "certificateHold",
+	8: "removeFromCRL", 9: "privilegeWithdrawn", 10: "aACompromise",
+}
+
+type crlCacheEntry struct {
+	revoked map[string]x509.RevocationListEntry // por número de serie
+	expires time.Time
+}
+
+type revocationEnricher struct {
+	client *http.Client
+
+	mu   sync.Mutex
+	crls map[string]*crlCacheEntry
+}
+
+func NewRevocationEnricher(client *http.Client) *revocationEnricher {
+	return &revocationEnricher{client: client, crls: make(map[string]*crlCacheEntry)}
+}
+
+func (r *revocationEnricher) Name() string { return "revocation" }
+
+func (r *revocationEnricher) Enrich(ctx context.Context, ev *MatchEvent, in EnrichInput) error {
+	rev := &Revocation{Status: ocspStatus(ocsp.Unknown), CheckedAt: time.Now().UTC()}
+	ev.Enrichment.Revocation = rev
+	if in.Issuer == nil {
+		rev.Error = "issuer not available"
+		return nil
+	}
+	var errs []error
+	if len(in.Cert.OCSPServer) > 0 {
+		err := r.checkOCSP(ctx, rev, in.Cert, in.Issuer)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	for _, url := range in.Cert.CRLDistributionPoints {
+		err := r.checkCRL(ctx, rev, url, in.Cert, in.Issuer)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		rev.Error = "no OCSP responder or CRL distribution point"
+		return nil
+	}
+	rev.Status = "error"
+	rev.Error = errs[len(errs)-1].Error()
+	return errs[len(errs)-1]
+}
+
+func ocspStatus(s int) string {
+	switch s {
+	case ocsp.Good:
+		return "good"
+	case ocsp.Revoked:
+		return "revoked"
+	}
+	return "unknown"
+}
+
+func (r *revocationEnricher) checkOCSP(ctx context.Context, rev *Revocation, cert, issuer *x509.Certificate) error {
+	reqBody, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build OCSP request: %w", err)
+	}
+	var lastErr error
+	for _, server := range cert.OCSPServer {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, server, bytes.NewReader(reqBody))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		req.Header.Set("Content-Type", "application/ocsp-request")
+		req.Header.Set("Accept", "application/ocsp-response")
+		data, err := r.get(req, maxOCSPResponseBytes)
+		if err != nil {
+			lastErr = fmt.Errorf("OCSP %s: %w", server, err)
+			continue
+		}
+		resp, err := ocsp.ParseResponseForCert(data, cert, issuer)
+		if err != nil {
+			lastErr = fmt.Errorf("OCSP %s: invalid response: %w", server, err)
+			continue
+		}
+		rev.Method, rev.Status = "ocsp", ocspStatus(resp.Status)
+		if resp.Status == ocsp.Revoked {
+			rev.RevokedAt = resp.RevokedAt.UTC()
+			rev.Reason = revocationReasons[resp.RevocationReason]
+		}
+		return nil
+	}
+	return lastErr
+}
+
+func (r *revocationEnricher) checkCRL(ctx context.Context, rev *Revocation, url string, cert, issuer *x509.Certificate) error {
+	entry, err := r.loadCRL(ctx, url, issuer)
+	if err != nil {
+		return fmt.Errorf("CRL %s: %w", url, err)
+	}
+	rev.Method, rev.Status = "crl", "good"
+	if e, ok := entry.revoked[cert.SerialNumber.String()]; ok {
+		rev.Status = "revoked"
+		rev.RevokedAt = e.RevocationTime.UTC()
+		rev.Reason = revocationReasons[e.ReasonCode]
+	}
+	return nil
+}
+
+// CRL verificada con el emisor y cacheada hasta su NextUpdate
+func (r *revocationEnricher) loadCRL(ctx context.Context, url string, issuer *x509.Certificate) (*crlCacheEntry, error) {
+	r.mu.Lock()
+	cached, ok := r.crls[url]
+	r.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	data, err := r.get(req, maxCRLBytes)
+	if err != nil {
+		return nil, err
+	}
+	crl, err := x509.ParseRevocationList(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CRL: %w", err)
+	}
+	if err := crl.CheckSignatureFrom(issuer); err != nil {
+		return nil, fmt.Errorf("CRL not signed by issuer: %w", err)
+	}
+	entry := &crlCacheEntry{revoked: make(map[string]x509.RevocationListEntry), expires: crl.NextUpdate}
+	if entry.expires.IsZero() {
+		entry.expires = time.Now().Add(defaultCRLCacheTTL)
+	}
+	for _, e := range crl.RevokedCertificateEntries {
+		entry.revoked[e.SerialNumber.String()] = e
+	}
+	r.mu.Lock()
+	r.crls[url] = entry
+	r.mu.Unlock()
+	return entry, nil
+}
+
+func (r *revocationEnricher) get(req *http.Request, max int64) ([]byte, error) {
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("HTTP %s", resp.Status)
+	}
+	return readLimited(resp.Body, max)
+}
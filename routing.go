@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+/* Enrutado de eventos por tag y horario */
+
+// Franja horaria en una zona concreta. Si From > To la franja cruza la medianoche.
+type Schedule struct {
+	Timezone string   `json:"timezone"` // p.ej. "Europe/Madrid"; vacío = UTC
+	Days     []string `json:"days"`     // "mon".."sun"; vacío = todos
+	From     string   `json:"from"`     // "09:00"
+	To       string   `json:"to"`       // "18:00"
+
+	loc      *time.Location
+	days     map[time.Weekday]bool
+	from, to int // minutos desde medianoche
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (s *Schedule) compile() error {
+	var err error
+	if s.loc, err = time.LoadLocation(s.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone %q: %w", s.Timezone, err)
+	}
+	s.days = make(map[time.Weekday]bool)
+	for _, d := range s.Days {
+		wd, ok := weekdays[strings.ToLower(d)[:min(3, len(d))]]
+		if !ok {
+			return fmt.Errorf("invalid day %q", d)
+		}
+		s.days[wd] = true
+	}
+	if s.from, err = parseClock(s.From); err != nil {
+		return err
+	}
+	s.to, err = parseClock(s.To)
+	return err
+}
+
+// Indica si t cae dentro de la franja
+func (s *Schedule) Active(t time.Time) bool {
+	t = t.In(s.loc)
+	m := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	if s.from <= s.to {
+		return (len(s.days) == 0 || s.days[day]) && m >= s.from && m < s.to
+	}
+	// Franja nocturna: la parte tras la medianoche pertenece al día anterior
+	if m >= s.from {
+		return len(s.days) == 0 || s.days[day]
+	}
+	if m < s.to {
+		return len(s.days) == 0 || s.days[(day+6)%7]
+	}
+	return false
+}
+
+// Regla de enrutado: los eventos de Tags van a Sinks dentro del horario
+// y a OffHoursSinks fuera de él (vacío = silencio).
+type Route struct {
+	Tags          []string  `json:"tags"` // "*" = cualquiera; "ops:*" = prefijo
+	Sinks         []string  `json:"sinks"`
+	Schedule      *Schedule `json:"schedule,omitempty"`
+	OffHoursSinks []string  `json:"off_hours_sinks,omitempty"`
+}
+
+type Router struct {
+	Routes []Route
+}
+
+func LoadRoutes(path string, verifier *SignatureVerifier) (*Router, error) {
+	data, err := readVerified(path, verifier)
+	if err != nil {
+		return nil, err
+	}
+	var routes []Route
+	if err := json.Unmarshal(data, &routes); err != nil {
+		return nil, fmt.Errorf("failed to parse routes %s: %w", path, err)
+	}
+	for i := range routes {
+		if s := routes[i].Schedule; s != nil {
+			if err := s.compile(); err != nil {
+				return nil, fmt.Errorf("route %d: %w", i, err)
+			}
+		}
+	}
+	return &Router{Routes: routes}, nil
+}
+
+// Sinks destino de los tags de un evento: la unión de las reglas que incluyen
+// alguno. matched=false si ninguna regla aplica (en ese caso el evento va a
+// todos los sinks).
+func (r *Router) Targets(tags []string, now time.Time) (sinks []string, matched bool) {
+	if r == nil {
+		return nil, false
+	}
+	for _, rt := range r.Routes {
+		if !routeHasAnyTag(rt, tags) {
+			continue
+		}
+		matched = true
+		if rt.Schedule == nil || rt.Schedule.Active(now) {
+			sinks = append(sinks, rt.Sinks...)
+		} else {
+			sinks = append(sinks, rt.OffHoursSinks...)
+		}
+	}
+	return sinks, matched
+}
+
+func routeHasTag(rt Route, tag string) bool {
+	for _, t := range rt.Tags {
+		if t == tag || strings.HasSuffix(t, "*") && strings.HasPrefix(tag, strings.TrimSuffix(t, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+func routeHasAnyTag(rt Route, tags []string) bool {
+	return slices.ContainsFunc(tags, func(tag string) bool { return routeHasTag(rt, tag) })
+}
+
+// Entrega un evento a los sinks que le corresponden según el router
+func (mngr *CTLogsManager) route(ev MatchEvent) {
+	targets, matched := mngr.Router.Targets(ev.AllTags(), time.Now())
+	for _, d := range mngr.dispatchers {
+		if !matched || (len(targets) > 0 && routedTo(d.sink.Name(), targets)) {
+			mngr.deliver(d, ev)
+		}
+	}
+}
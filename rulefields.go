@@ -0,0 +1,211 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+/* Campos del certificado a los que se aplican las reglas */
+
+// Campos que puede indicar una regla en "fields"
+const (
+	FieldCN        = "cn"         // CN del sujeto
+	FieldSAN       = "san"        // cada SAN DNS
+	FieldSubject   = "subject"    // DN completo del sujeto
+	FieldIssuer    = "issuer"     // DN completo del emisor
+	FieldIssuerOrg = "issuer_org" // cada organización (O) del emisor
+	FieldOrg       = "org"        // cada organización (O) del sujeto
+	FieldDomain    = "domain"     // dominio registrable (eTLD+1) de cada nombre
+	FieldSubdomain = "subdomain"  // lo que queda a la izquierda del dominio registrable
+	FieldSuffix    = "suffix"     // sufijo público de cada nombre
+	FieldSkeleton  = "skeleton"   // esqueleto ASCII de cada nombre IDN (homógrafos)
+)
+
+var ruleFields = []string{FieldCN, FieldSAN, FieldSubject, FieldIssuer, FieldIssuerOrg, FieldOrg, FieldDomain, FieldSubdomain, FieldSuffix, FieldSkeleton}
+
+// Campos de una regla sin "fields" (las de la forma corta)
+var defaultRuleFields = []string{FieldCN, FieldSAN}
+
+func checkRuleFields(fields []string) error {
+	for _, f := range fields {
+		if !slices.Contains(ruleFields, f) {
+			return fmt.Errorf("invalid rule field %q (cn, san, subject, issuer, issuer_org, org, domain, subdomain, suffix, skeleton)", f)
+		}
+	}
+	return nil
+}
+
+// "type" del formato anterior a los campos equivalentes
+var ruleTypeFields = map[string][]string{
+	"name":        nil,
+	"issuer":      {FieldIssuer},
+	"issuer_org":  {FieldIssuerOrg},
+	"subject_org": {FieldOrg},
+}
+
+// Severidades de una regla, de menor a mayor
+var ruleSeverities = []string{"low", "medium", "high", "critical"}
+
+const defaultRuleSeverity = "medium"
+
+// Valores de un certificado por campo, calculados al pedirlos por primera
+// vez. Solo lo usa el worker que trata la entrada.
+type certValues struct {
+	cert      *x509.Certificate
+	source    *CTLogSource
+	subjectDN bool
+	byField   map[string][]string
+	cel       map[string]any // variables de las reglas CEL
+
+	filter     *ruleFilter // con el que se calcularon candidates
+	candidates *ruleCandidates
+}
+
+func (mngr *CTLogsManager) newCertValues(cert *x509.Certificate, source *CTLogSource) *certValues {
+	return &certValues{cert: cert, source: source, subjectDN: mngr.MatchSubjectDN, byField: make(map[string][]string, 2)}
+}
+
+func (v *certValues) For(field string) []string {
+	if values, ok := v.byField[field]; ok {
+		return values
+	}
+	var values []string
+	add := func(s string) {
+		if s != "" && !slices.Contains(values, s) {
+			values = append(values, s)
+		}
+	}
+	switch field {
+	case FieldCN:
+		add(v.cert.Subject.CommonName)
+	case FieldSAN:
+		for _, name := range v.cert.DNSNames {
+			add(name)
+		}
+	case FieldSubject:
+		add(v.cert.Subject.String())
+	case FieldIssuer:
+		add(v.cert.Issuer.String())
+	case FieldIssuerOrg:
+		for _, o := range v.cert.Issuer.Organization {
+			add(o)
+		}
+	case FieldOrg:
+		for _, o := range v.cert.Subject.Organization {
+			add(o)
+		}
+	case FieldDomain, FieldSubdomain, FieldSuffix, FieldSkeleton:
+		for _, name := range v.names() {
+			add(namePart(name, field))
+		}
+	}
+	v.byField[field] = values
+	return values
+}
+
+// CN y SAN DNS
+func (v *certValues) names() []string {
+	return slices.Concat(v.For(FieldCN), v.For(FieldSAN))
+}
+
+// Campos que salen de cada nombre; la coincidencia es el nombre entero
+var nameFields = []string{FieldDomain, FieldSubdomain, FieldSuffix, FieldSkeleton}
+
+func namePart(name, field string) string {
+	if field == FieldSkeleton {
+		return homographSkeleton(name)
+	}
+	sub, domain, suffix, _ := splitDomainName(name)
+	switch field {
+	case FieldDomain:
+		return domain
+	case FieldSubdomain:
+		return sub
+	}
+	return suffix
+}
+
+// Partes de un nombre DNS según la lista de sufijos públicos (incluidos los
+// privados, como github.io): login.paypal.com.evil.xyz es el subdominio
+// login.paypal.com del dominio registrable evil.xyz, con sufijo xyz. ok=false
+// si no es un nombre DNS (un CN libre, una IP) o es un sufijo público.
+func splitDomainName(name string) (subdomain, domain, suffix string, ok bool) {
+	name = strings.TrimSuffix(strings.TrimPrefix(strings.ToLower(name), "*."), ".")
+	if !strings.Contains(name, ".") || strings.ContainsAny(name, " /:") || net.ParseIP(name) != nil {
+		return "", "", "", false
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(name)
+	if err != nil {
+		return "", "", "", false
+	}
+	suffix, _ = publicsuffix.PublicSuffix(domain)
+	return strings.TrimSuffix(strings.TrimSuffix(name, domain), "."), domain, suffix, true
+}
+
+// Valor de las coincidencias que no dependen de un campo (CEL, script): el
+// primer nombre del certificado
+func (v *certValues) firstName() string {
+	if names := v.names(); len(names) > 0 {
+		return names[0]
+	}
+	return ""
+}
+
+// Primer valor del certificado que cumple la regla. Sin campos se miran los
+// nombres y, con -match-subject-dn, el DN del sujeto. Con domain, subdomain,
+// suffix o skeleton el valor es el nombre del que sale lo que coincide. Una
+// regla CEL se aplica al certificado entero; el valor es su CN o su primer
+// nombre.
+func (r *Rule) Match(v *certValues) (string, bool) {
+	if r.Expr != nil {
+		matched, err := r.Expr.Eval(v)
+		if err != nil {
+			metricRuleEvalErrors.WithLabelValues(r.tag).Inc()
+			return "", false
+		}
+		if !matched {
+			return "", false
+		}
+		return v.firstName(), true
+	}
+	fields := r.Fields
+	if fields == nil {
+		fields = defaultRuleFields
+		if v.subjectDN {
+			fields = append(fields[:len(fields):len(fields)], FieldSubject)
+		}
+	}
+	for _, f := range fields {
+		if slices.Contains(nameFields, f) {
+			for _, name := range v.names() {
+				if part := namePart(name, f); part != "" && r.matchValue(part) {
+					return name, true
+				}
+			}
+			continue
+		}
+		for _, s := range v.For(f) {
+			if r.matchValue(s) {
+				return s, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Si un valor cumple la regex, contiene alguna de las palabras clave o
+// imita a alguno de los dominios protegidos
+func (r *Rule) matchValue(s string) bool {
+	switch {
+	case r.Keywords != nil:
+		return r.Keywords.MatchString(s)
+	case r.Typosquat != nil:
+		return r.Typosquat.MatchString(s)
+	}
+	return r.MatchString(s)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"fmt"
+	"path"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+/* Reglas con expresiones CEL */
+
+// Coste máximo de una evaluación; una expresión que lo supera no coincide
+const celCostLimit = 100000
+
+var metricRuleEvalErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gctwatch_rule_eval_errors_total",
+	Help: "Errores al evaluar reglas CEL por tag (el certificado no coincide).",
+}, []string{"tag"})
+
+// Certificado tal como lo ven las expresiones (cert.sans, cert.not_after...)
+type celCert struct {
+	CN        string    `cel:"cn"`
+	SANs      []string  `cel:"sans"`
+	Domains   []string  `cel:"domains"`   // dominios registrables de los nombres
+	Skeletons []string  `cel:"skeletons"` // esqueletos ASCII de los nombres IDN
+	Subject   string    `cel:"subject"`
+	Issuer    string    `cel:"issuer"`
+	IssuerOrg []string  `cel:"issuer_org"`
+	Org       []string  `cel:"org"`
+	Serial    string    `cel:"serial"`
+	NotBefore time.Time `cel:"not_before"`
+	NotAfter  time.Time `cel:"not_after"`
+	KeyType   string    `cel:"key_type"` // RSA, ECDSA, Ed25519
+	KeyBits   int       `cel:"key_bits"`
+	IsCA      bool      `cel:"is_ca"`
+}
+
+// Log de origen (log.url, log.lists)
+type celLog struct {
+	URL   string   `cel:"url"`
+	Lists []string `cel:"lists"`
+}
+
+// El entorno es el mismo para todas las reglas
+var celEnv = sync.OnceValues(func() (*cel.Env, error) {
+	certType, logType := reflect.TypeFor[celCert](), reflect.TypeFor[celLog]()
+	return cel.NewEnv(
+		ext.NativeTypes(certType, logType, ext.ParseStructTags(true)),
+		ext.Strings(),
+		cel.Variable("cert", cel.ObjectType(celTypeName(certType))),
+		cel.Variable("log", cel.ObjectType(celTypeName(logType))),
+		cel.Variable("now", cel.TimestampType),
+	)
+})
+
+// Nombre que da NativeTypes a un tipo de Go: último elemento del paquete y tipo
+func celTypeName(t reflect.Type) string {
+	return path.Base(t.PkgPath()) + "." + t.Name()
+}
+
+// Regla con "expr" en lugar de "regex", p.ej.
+// cert.sans.exists(s, s.matches('\\.corp\\.example$')) && !('Corp CA' in cert.issuer_org)
+type celRule struct {
+	source  string
+	program cel.Program
+}
+
+func compileCELRule(expr string) (*celRule, error) {
+	env, err := celEnv()
+	if err != nil {
+		return nil, err
+	}
+	ast, iss := env.Compile(expr)
+	if iss.Err() != nil {
+		return nil, fmt.Errorf("invalid expression: %w", iss.Err())
+	}
+	if ast.OutputType() != cel.BoolType {
+		return nil, fmt.Errorf("expression must return bool, not %s", ast.OutputType())
+	}
+	prg, err := env.Program(ast, cel.EvalOptions(cel.OptOptimize), cel.CostLimit(celCostLimit))
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression: %w", err)
+	}
+	return &celRule{source: expr, program: prg}, nil
+}
+
+func (c *celRule) Eval(v *certValues) (bool, error) {
+	out, _, err := c.program.Eval(v.celVars())
+	if err != nil {
+		return false, err
+	}
+	matched, ok := out.Value().(bool)
+	return ok && matched, nil
+}
+
+// Variables de las expresiones, calculadas una vez por certificado
+func (v *certValues) celVars() map[string]any {
+	if v.cel != nil {
+		return v.cel
+	}
+	cert := v.cert
+	c := &celCert{
+		CN: cert.Subject.CommonName, SANs: cert.DNSNames,
+		Subject: cert.Subject.String(), Issuer: cert.Issuer.String(),
+		Domains: v.For(FieldDomain), Skeletons: v.For(FieldSkeleton), IssuerOrg: cert.Issuer.Organization, Org: cert.Subject.Organization,
+		Serial: cert.SerialNumber.Text(16), NotBefore: cert.NotBefore, NotAfter: cert.NotAfter,
+		KeyType: cert.PublicKeyAlgorithm.String(), IsCA: cert.IsCA,
+	}
+	switch k := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		c.KeyBits = k.N.BitLen()
+	case *ecdsa.PublicKey:
+		c.KeyBits = k.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		c.KeyBits = 256
+	}
+	l := &celLog{}
+	if v.source != nil {
+		l.URL, l.Lists = v.source.Source, v.source.Lists
+	}
+	v.cel = map[string]any{"cert": c, "log": l, "now": time.Now()}
+	return v.cel
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+/* Ciclo de vida de las reglas */
+
+// Estados de una regla. Expired no se configura: se deriva de Expires.
+const (
+	RuleDraft    = "draft"    // se evalúa como regla shadow (solo se cuenta y se guarda)
+	RuleActive   = "active"   // notifica
+	RuleDisabled = "disabled" // no se evalúa
+	RuleExpired  = "expired"  // pasada su fecha de caducidad
+)
+
+// Periodicidad con la que se comprueban las caducidades
+const ruleExpiryCheck = time.Minute
+
+var metricRules = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "gctwatch_rules",
+	Help: "Reglas cargadas por estado (draft, active, disabled, expired).",
+}, []string{"status"})
+
+// Regla tal como se configura. En el formato 1 (mapa tag -> regla) puede ser
+// la expresión sola (activa, sobre los nombres, sin caducidad) o un objeto;
+// en el 2 ({"version": 2, "rules": [...]}) siempre es un objeto con su tag.
+type RuleConfig struct {
+	Tag         string    `json:"tag,omitempty"` // solo en el formato 2
+	Regex       string    `json:"regex,omitempty"`
+	Expr        string    `json:"expr,omitempty"`      // expresión CEL en lugar de regex (ver rules_cel.go)
+	Keywords    []string  `json:"keywords,omitempty"`  // términos literales en lugar de regex (ver ahocorasick.go)
+	Typosquat   []string  `json:"typosquat,omitempty"` // dominios protegidos: nombres a pocas ediciones (ver typosquat.go)
+	Distance    int       `json:"distance,omitempty"`  // ediciones para typosquat; 1 por defecto
+	Fields      []string  `json:"fields,omitempty"`    // cn, san, subject, issuer, issuer_org, org; vacío = cn y san
+	Type        string    `json:"type,omitempty"`      // formato 1: name, issuer, issuer_org o subject_org
+	Class       string    `json:"class,omitempty"`     // canary para dominios que nunca deberían tener certificados
+	Severity    string    `json:"severity,omitempty"`  // low, medium (por defecto), high o critical
+	Description string    `json:"description,omitempty"`
+	References  []string  `json:"references,omitempty"` // URLs de tickets, informes...
+	Status      string    `json:"status,omitempty"`     // active por defecto
+	Expires     time.Time `json:"expires,omitzero"`     // cero = sin caducidad
+}
+
+// Formato 2 del fichero de reglas
+type RulesDocument struct {
+	Version int          `json:"version"`
+	Rules   []RuleConfig `json:"rules"`
+}
+
+func (c *RuleConfig) UnmarshalJSON(data []byte) error {
+	var expr string
+	if err := json.Unmarshal(data, &expr); err == nil {
+		*c = RuleConfig{Regex: expr}
+		return nil
+	}
+	type plain RuleConfig
+	return json.Unmarshal(data, (*plain)(c))
+}
+
+// Regla compilada
+type Rule struct {
+	*regexp.Regexp                   // nil en las reglas CEL, de palabras clave y typosquat
+	Expr           *celRule          // nil en las de regex
+	Keywords       *keywordMatcher   // nil salvo en las de palabras clave
+	Typosquat      *typosquatMatcher // nil salvo en las typosquat
+	Fields         []string          // nil = los de por defecto
+	Class          string
+	Info           RuleInfo // se copia en las coincidencias
+	Status         string
+	Expires        time.Time
+	tag            string
+}
+
+// Expresión de la regla, para GET /rules
+func (r *Rule) Source() (regex, expr string) {
+	switch {
+	case r.Expr != nil:
+		return "", r.Expr.source
+	case r.Keywords != nil, r.Typosquat != nil:
+		return "", ""
+	}
+	return r.String(), ""
+}
+
+// Estado efectivo en el instante dado
+func (r *Rule) State(now time.Time) string {
+	if r.Status != RuleDisabled && !r.Expires.IsZero() && !now.Before(r.Expires) {
+		return RuleExpired
+	}
+	return r.Status
+}
+
+// Reglas en alguno de los estados dados
+func (rules RegexRules) inState(now time.Time, states ...string) map[string]*Rule {
+	out := make(map[string]*Rule)
+	for tag, r := range rules {
+		if slices.Contains(states, r.State(now)) {
+			out[tag] = r
+		}
+	}
+	return out
+}
+
+// Sustituye las reglas en caliente
+func (mngr *CTLogsManager) SetRules(rules RegexRules) {
+	mngr.rulesMu.Lock()
+	mngr.rules = rules
+	mngr.rulesMu.Unlock()
+	mngr.refreshRules()
+	mngr.refreshRuleFilter()
+}
+
+// Reglas shadow de -shadow-rules; se evalúan las activas y las draft
+func (mngr *CTLogsManager) SetShadowRules(rules RegexRules) {
+	mngr.rulesMu.Lock()
+	mngr.shadowRules = rules
+	mngr.rulesMu.Unlock()
+	mngr.refreshRules()
+	mngr.refreshRuleFilter()
+}
+
+// Recalcula las reglas que se evalúan según su estado y registra los cambios
+// de estado (nuevas, eliminadas, caducadas o con otro estado configurado)
+func (mngr *CTLogsManager) refreshRules() {
+	now := time.Now()
+	mngr.rulesMu.Lock()
+	defer mngr.rulesMu.Unlock()
+	mngr.filtering = mngr.rules.inState(now, RuleActive)
+	mngr.shadowing = mngr.rules.inState(now, RuleDraft)
+	maps.Copy(mngr.shadowing, mngr.shadowRules.inState(now, RuleActive, RuleDraft))
+
+	states := make(map[string]string, len(mngr.rules))
+	counts := map[string]int{RuleDraft: 0, RuleActive: 0, RuleDisabled: 0, RuleExpired: 0}
+	for _, tag := range slices.Sorted(maps.Keys(mngr.rules)) {
+		state := mngr.rules[tag].State(now)
+		states[tag] = state
+		counts[state]++
+		prev, known := mngr.ruleStates[tag]
+		switch {
+		case mngr.ruleStates == nil:
+			if state != RuleActive {
+				log.Printf("rule %s: %s", tag, state)
+			}
+		case !known:
+			log.Printf("rule %s: added (%s)", tag, state)
+		case prev != state:
+			log.Printf("rule %s: %s -> %s", tag, prev, state)
+		}
+	}
+	for _, tag := range slices.Sorted(maps.Keys(mngr.ruleStates)) {
+		if _, ok := states[tag]; !ok {
+			log.Printf("rule %s: removed", tag)
+		}
+	}
+	mngr.ruleStates = states
+	for state, n := range counts {
+		metricRules.WithLabelValues(state).Set(float64(n))
+	}
+}
+
+// Desactiva las reglas al llegar su fecha de caducidad
+func (mngr *CTLogsManager) watchRuleExpiry() {
+	defer mngr.wg.Done()
+	t := time.NewTicker(ruleExpiryCheck)
+	defer t.Stop()
+	for {
+		select {
+		case <-mngr.context.Done():
+			return
+		case <-t.C:
+			mngr.refreshRules()
+		}
+	}
+}
+
+// Estado de cada regla para GET /rules
+type RuleReport struct {
+	Tag       string    `json:"tag"`
+	Regex     string    `json:"regex,omitempty"`
+	Expr      string    `json:"expr,omitempty"`
+	Keywords  int       `json:"keywords,omitempty"`  // número de términos
+	Typosquat []string  `json:"typosquat,omitempty"` // dominios protegidos
+	Distance  int       `json:"distance,omitempty"`
+	Fields    []string  `json:"fields,omitempty"`
+	Class     string    `json:"class,omitempty"`
+	Info      RuleInfo  `json:"info"`
+	Status    string    `json:"status"`            // efectivo
+	Config    string    `json:"configured_status"` // el configurado
+	Expires   time.Time `json:"expires,omitzero"`
+	Shadow    bool      `json:"shadow,omitempty"` // de -shadow-rules
+}
+
+func (mngr *CTLogsManager) RulesReport() []RuleReport {
+	now := time.Now()
+	mngr.rulesMu.RLock()
+	defer mngr.rulesMu.RUnlock()
+	out := []RuleReport{}
+	add := func(rules RegexRules, shadow bool) {
+		for _, tag := range slices.Sorted(maps.Keys(rules)) {
+			r := rules[tag]
+			fields := r.Fields
+			if fields == nil && r.Expr == nil {
+				fields = defaultRuleFields
+			}
+			regex, expr := r.Source()
+			rep := RuleReport{Tag: tag, Regex: regex, Expr: expr, Keywords: r.Keywords.Len(), Fields: fields, Class: r.Class, Info: r.Info, Status: r.State(now), Config: r.Status, Expires: r.Expires, Shadow: shadow}
+			if r.Typosquat != nil {
+				rep.Typosquat, rep.Distance = r.Typosquat.Domains(), r.Typosquat.distance
+			}
+			out = append(out, rep)
+		}
+	}
+	add(mngr.rules, false)
+	add(mngr.shadowRules, true)
+	return out
+}
+
+// Reglas en el formato 1 o en el 2, según tengan "version"
+func parseRules(data []byte) (RegexRules, error) {
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("failed to parse rules: %w", err)
+	}
+	var version int
+	if v, ok := probe["version"]; !ok || json.Unmarshal(v, &version) != nil {
+		var raw RegexConfig
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("failed to parse rules: %w", err)
+		}
+		return compileRules(raw)
+	}
+	if version != 2 {
+		return nil, fmt.Errorf("unsupported rules version %d (2)", version)
+	}
+	var doc RulesDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse rules: %w", err)
+	}
+	raw := make(RegexConfig, len(doc.Rules))
+	for i, c := range doc.Rules {
+		if c.Tag == "" {
+			return nil, fmt.Errorf("rule %d has no tag", i)
+		}
+		if _, dup := raw[c.Tag]; dup {
+			return nil, fmt.Errorf("duplicate rule tag %s", c.Tag)
+		}
+		raw[c.Tag] = c
+	}
+	return compileRules(raw)
+}
+
+func compileRules(raw RegexConfig) (RegexRules, error) {
+	compiled := make(RegexRules)
+	for tag, c := range raw {
+		var re *regexp.Regexp
+		var expr *celRule
+		var keywords *keywordMatcher
+		var typosquat *typosquatMatcher
+		var err error
+		switch {
+		case c.Typosquat != nil && (c.Regex != "" || c.Expr != "" || c.Keywords != nil):
+			return nil, fmt.Errorf("rule %s: typosquat cannot be combined with regex, expr or keywords", tag)
+		case c.Typosquat != nil:
+			if typosquat, err = newTyposquatMatcher(c.Typosquat, c.Distance); err != nil {
+				return nil, fmt.Errorf("rule %s: %w", tag, err)
+			}
+		case c.Distance != 0:
+			return nil, fmt.Errorf("rule %s: distance only applies to typosquat rules", tag)
+		case c.Keywords != nil && (c.Regex != "" || c.Expr != ""):
+			return nil, fmt.Errorf("rule %s: keywords cannot be combined with regex or expr", tag)
+		case c.Keywords != nil:
+			if keywords, err = newKeywordMatcher(c.Keywords); err != nil {
+				return nil, fmt.Errorf("rule %s: %w", tag, err)
+			}
+		case c.Expr != "" && (c.Regex != "" || c.Type != "" || c.Fields != nil):
+			return nil, fmt.Errorf("rule %s: expr cannot be combined with regex, type or fields", tag)
+		case c.Expr != "":
+			if expr, err = compileCELRule(c.Expr); err != nil {
+				return nil, fmt.Errorf("rule %s: %w", tag, err)
+			}
+		default:
+			if re, err = regexp.Compile(c.Regex); err != nil {
+				return nil, fmt.Errorf("error compilando regex para %s: %w", tag, err)
+			}
+		}
+		switch c.Status {
+		case "":
+			c.Status = RuleActive
+		case RuleDraft, RuleActive, RuleDisabled:
+		default:
+			return nil, fmt.Errorf("invalid status %q for rule %s (draft, active, disabled)", c.Status, tag)
+		}
+		if c.Type != "" {
+			fields, ok := ruleTypeFields[c.Type]
+			if !ok || c.Fields != nil {
+				return nil, fmt.Errorf("rule %s: invalid type %q (name, issuer, issuer_org, subject_org; or use fields)", tag, c.Type)
+			}
+			c.Fields = fields
+		}
+		if err := checkRuleFields(c.Fields); err != nil {
+			return nil, fmt.Errorf("rule %s: %w", tag, err)
+		}
+		if err := checkRuleClass(c.Class); err != nil {
+			return nil, fmt.Errorf("rule %s: %w", tag, err)
+		}
+		switch {
+		case c.Severity == "" && c.Class == RuleClassCanary:
+			c.Severity = "critical"
+		case c.Severity == "":
+			c.Severity = defaultRuleSeverity
+		case !slices.Contains(ruleSeverities, c.Severity):
+			return nil, fmt.Errorf("rule %s: invalid severity %q (low, medium, high, critical)", tag, c.Severity)
+		}
+		compiled[tag] = &Rule{
+			Regexp: re, Expr: expr, Keywords: keywords, Typosquat: typosquat, Fields: c.Fields, Class: c.Class, Status: c.Status, Expires: c.Expires, tag: tag,
+			Info: RuleInfo{Severity: c.Severity, Description: c.Description, References: c.References},
+		}
+	}
+	return compiled, nil
+}
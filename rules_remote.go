@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+/* Reglas remotas (REST con long polling) */
+
+const (
+	DefaultMaxRulesBytes = 16 << 20
+	remoteRulesWait      = 55 * time.Second // por debajo del timeout del cliente compartido
+	remoteRulesRetry     = 30 * time.Second
+)
+
+// Servicio central de reglas. GET devuelve el mismo formato que rules.json
+// con un ETag; con If-None-Match y ?wait= el servidor puede retener la
+// petición hasta que haya cambios (long polling) o responder 304.
+type RemoteRules struct {
+	URL    string
+	Token  string // bearer opcional
+	Client *http.Client
+	// Si hay verificador, la respuesta debe traer la firma en X-Signature
+	// (fichero .minisig o .sig codificado en base64)
+	Verifier *SignatureVerifier
+	// Copia de la última respuesta válida (con su firma), para arrancar si
+	// el servicio no responde; vacío = sin caché
+	Cache string
+
+	etag string
+}
+
+func NewRemoteRules(rawURL, tokenFile string, client *http.Client) (*RemoteRules, error) {
+	if _, err := url.Parse(rawURL); err != nil {
+		return nil, fmt.Errorf("invalid rules URL: %w", err)
+	}
+	r := &RemoteRules{URL: rawURL, Client: client}
+	if tokenFile != "" {
+		token, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rules token: %w", err)
+		}
+		r.Token = strings.TrimSpace(string(token))
+	}
+	return r, nil
+}
+
+// Pide las reglas; devuelve nil sin error si no han cambiado
+func (r *RemoteRules) Fetch(ctx context.Context, wait time.Duration) (RegexRules, error) {
+	u, _ := url.Parse(r.URL)
+	if wait > 0 && r.etag != "" {
+		q := u.Query()
+		q.Set("wait", fmt.Sprintf("%ds", int(wait.Seconds())))
+		u.RawQuery = q.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if r.etag != "" {
+		req.Header.Set("If-None-Match", r.etag)
+	}
+	if r.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.Token)
+	}
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch rules: %w", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return nil, nil
+	case http.StatusOK:
+	default:
+		return nil, fmt.Errorf("failed to fetch rules: %s", resp.Status)
+	}
+	data, err := readLimited(resp.Body, DefaultMaxRulesBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules: %w", err)
+	}
+	var sig []byte
+	if r.Verifier != nil {
+		sig, err = base64.StdEncoding.DecodeString(resp.Header.Get("X-Signature"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid rules signature header: %w", err)
+		}
+		if err := r.Verifier.Verify(data, sig); err != nil {
+			return nil, fmt.Errorf("remote rules rejected: %w", err)
+		}
+	}
+	rules, err := parseRules(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("remote rules are empty")
+	}
+	r.etag = resp.Header.Get("ETag")
+	if r.Cache != "" {
+		if err := r.saveCache(data, sig); err != nil {
+			log.Printf("WARNING: failed to cache remote rules: %v", err)
+		}
+	}
+	return rules, nil
+}
+
+func (r *RemoteRules) saveCache(data, sig []byte) error {
+	if err := os.MkdirAll(filepath.Dir(r.Cache), 0o700); err != nil {
+		return err
+	}
+	if r.Verifier != nil {
+		if err := writeFileAtomic(r.Cache+r.Verifier.SigExt(), sig); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(r.Cache, data)
+}
+
+// Sigue el servicio de reglas hasta que se pare el manager
+func (mngr *CTLogsManager) watchRemoteRules(r *RemoteRules) {
+	defer mngr.wg.Done()
+	for mngr.context.Err() == nil {
+		rules, err := r.Fetch(mngr.context, remoteRulesWait)
+		if mngr.context.Err() != nil {
+			return
+		}
+		if mngr.Health.Set("rules:remote", false, err) && err != nil {
+			log.Printf("WARNING: remote rules %s: %v (keeping current rules)", r.URL, err)
+		}
+		if err != nil {
+			select {
+			case <-mngr.context.Done():
+			case <-time.After(remoteRulesRetry):
+			}
+			continue
+		}
+		if rules != nil {
+			mngr.SetRules(rules)
+			log.Printf("rules updated from %s: %d rules", r.URL, len(rules))
+		}
+	}
+}
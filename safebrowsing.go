@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* Reputación del dominio: Google Safe Browsing y Web Risk */
+
+const (
+	safeBrowsingURL  = "https://safebrowsing.googleapis.com/v4/threatMatches:find"
+	webRiskURL       = "https://webrisk.googleapis.com/v1/uris:search"
+	safeBrowsingMax  = 50000 // dominios en caché
+	safeBrowsingBody = 1 << 20
+)
+
+// Tipos de amenaza consultados (comunes a las dos APIs)
+var safeBrowsingThreats = []string{"MALWARE", "SOCIAL_ENGINEERING", "UNWANTED_SOFTWARE"}
+
+// Veredicto sobre el dominio registrado en el momento de la detección
+type SafeBrowsing struct {
+	Status    string    `json:"status"`            // flagged o clean
+	Threats   []string  `json:"threats,omitempty"` // p.ej. SOCIAL_ENGINEERING
+	Service   string    `json:"service"`           // safebrowsing o webrisk
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+type safeBrowsingEntry struct {
+	verdict SafeBrowsing
+	expires time.Time
+}
+
+// Consulta el dominio registrado de cada coincidencia en la Lookup API de
+// Safe Browsing o en Web Risk (uso comercial) y guarda el veredicto en caché:
+// los dominios marcados durante lo que indique la API (como mucho ttl) y los
+// limpios durante ttl, para no gastar cuota con las ráfagas de un dominio.
+type safeBrowsingEnricher struct {
+	service string
+	key     string
+	ttl     time.Duration
+	client  *http.Client
+
+	mu    sync.Mutex
+	cache map[string]safeBrowsingEntry
+}
+
+func NewSafeBrowsingEnricher(service, keyFile string, ttl time.Duration, client *http.Client) (*safeBrowsingEnricher, error) {
+	if service != "safebrowsing" && service != "webrisk" {
+		return nil, fmt.Errorf("unknown reputation service %q (safebrowsing, webrisk)", service)
+	}
+	key, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s API key: %w", service, err)
+	}
+	return &safeBrowsingEnricher{
+		service: service, key: strings.TrimSpace(string(key)), ttl: ttl, client: client,
+		cache: make(map[string]safeBrowsingEntry),
+	}, nil
+}
+
+func (s *safeBrowsingEnricher) Name() string { return s.service }
+
+// URL de la API, para la política de red
+func (s *safeBrowsingEnricher) Endpoint() string {
+	if s.service == "webrisk" {
+		return webRiskURL
+	}
+	return safeBrowsingURL
+}
+
+func (s *safeBrowsingEnricher) Enrich(ctx context.Context, ev *MatchEvent, in EnrichInput) error {
+	domain := eventDomain(*ev)
+	if domain == "" {
+		return nil
+	}
+	now := time.Now()
+	s.mu.Lock()
+	e, ok := s.cache[domain]
+	s.mu.Unlock()
+	if ok && now.Before(e.expires) {
+		v := e.verdict
+		ev.Enrichment.SafeBrowsing = &v
+		return nil
+	}
+	lookup := s.lookupSafeBrowsing
+	if s.service == "webrisk" {
+		lookup = s.lookupWebRisk
+	}
+	threats, cacheFor, err := lookup(ctx, "http://"+domain+"/")
+	if err != nil {
+		return err
+	}
+	v := SafeBrowsing{Status: "clean", Service: s.service, CheckedAt: now.UTC()}
+	if len(threats) > 0 {
+		v.Status, v.Threats = "flagged", threats
+	} else {
+		cacheFor = s.ttl
+	}
+	ev.Enrichment.SafeBrowsing = &v
+	s.store(domain, safeBrowsingEntry{verdict: v, expires: now.Add(cacheFor)})
+	return nil
+}
+
+func (s *safeBrowsingEnricher) store(domain string, e safeBrowsingEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.cache) >= safeBrowsingMax {
+		now := time.Now()
+		for k, old := range s.cache {
+			if now.After(old.expires) {
+				delete(s.cache, k)
+			}
+		}
+		// Si todo sigue vigente se vacía: es una caché, no el registro
+		if len(s.cache) >= safeBrowsingMax {
+			clear(s.cache)
+		}
+	}
+	s.cache[domain] = e
+}
+
+func (s *safeBrowsingEnricher) do(req *http.Request, v any) error {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		// La clave va en la query string: que no acabe en los logs
+		if ue, ok := err.(*url.Error); ok {
+			ue.URL = s.Endpoint()
+		}
+		return fmt.Errorf("failed to query %s: %w", s.service, err)
+	}
+	defer resp.Body.Close()
+	data, err := readLimited(resp.Body, safeBrowsingBody)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to query %s: %s: %s", s.service, resp.Status, bytes.TrimSpace(data))
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid %s response: %w", s.service, err)
+	}
+	return nil
+}
+
+func (s *safeBrowsingEnricher) lookupSafeBrowsing(ctx context.Context, u string) ([]string, time.Duration, error) {
+	body, err := json.Marshal(map[string]any{
+		"client": map[string]string{"clientId": "gctwatch", "clientVersion": cefDeviceVersion},
+		"threatInfo": map[string]any{
+			"threatTypes":      safeBrowsingThreats,
+			"platformTypes":    []string{"ANY_PLATFORM"},
+			"threatEntryTypes": []string{"URL"},
+			"threatEntries":    []map[string]string{{"url": u}},
+		},
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, safeBrowsingURL+"?key="+url.QueryEscape(s.key), bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	var res struct {
+		Matches []struct {
+			ThreatType    string `json:"threatType"`
+			CacheDuration string `json:"cacheDuration"` // "300s"
+		} `json:"matches"`
+	}
+	if err := s.do(req, &res); err != nil {
+		return nil, 0, err
+	}
+	var threats []string
+	cacheFor := s.ttl
+	for _, m := range res.Matches {
+		threats = append(threats, m.ThreatType)
+		if d, err := time.ParseDuration(m.CacheDuration); err == nil && d < cacheFor {
+			cacheFor = d
+		}
+	}
+	slices.Sort(threats)
+	return slices.Compact(threats), cacheFor, nil
+}
+
+func (s *safeBrowsingEnricher) lookupWebRisk(ctx context.Context, u string) ([]string, time.Duration, error) {
+	q := url.Values{"key": {s.key}, "uri": {u}, "threatTypes": safeBrowsingThreats}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, webRiskURL+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	var res struct {
+		Threat struct {
+			ThreatTypes []string  `json:"threatTypes"`
+			ExpireTime  time.Time `json:"expireTime"`
+		} `json:"threat"`
+	}
+	if err := s.do(req, &res); err != nil {
+		return nil, 0, err
+	}
+	cacheFor := s.ttl
+	if d := time.Until(res.Threat.ExpireTime); d > 0 && d < cacheFor {
+		cacheFor = d
+	}
+	return res.Threat.ThreatTypes, cacheFor, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+/* Muestreo de tags de alto volumen */
+
+var metricRuleHits = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gctwatch_rule_hits_total",
+	Help: "Coincidencias por tag, antes de muestreo, deduplicación y supresión.",
+}, []string{"tag"})
+
+// Fracción de coincidencias que se entrega por tag (el resto solo cuenta en
+// métricas). Sin entrada para el tag se entregan todas.
+type Sampler map[string]float64
+
+// "tag=0.01,otro=0.1"
+func ParseSampleRates(s string) (Sampler, error) {
+	out := Sampler{}
+	for tag, v := range parseKeyValues(s) {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate <= 0 || rate > 1 {
+			return nil, fmt.Errorf("invalid sample rate for tag %s: %q (must be in (0, 1])", tag, v)
+		}
+		out[tag] = rate
+	}
+	return out, nil
+}
+
+// Decide si el evento se entrega y anota la fracción en SampleRate. La
+// decisión depende de la huella: un certificado que aparece en varios logs (o
+// en varias instancias) se muestrea siempre igual.
+func (s Sampler) Sample(ev *MatchEvent) bool {
+	rate, ok := s[ev.Tag]
+	if !ok || rate >= 1 {
+		return true
+	}
+	ev.SampleRate = rate
+	var x float64
+	if fp := ev.Certificate.FingerprintSHA256; fp != "" {
+		h := cryptoProvider.Hash([]byte(ev.Tag + ":" + fp))
+		x = float64(binary.BigEndian.Uint64(h[:8])) / math.MaxUint64
+	} else {
+		x = rand.Float64()
+	}
+	if x < rate {
+		return true
+	}
+	metricEventsSuppressed.WithLabelValues("sampled").Inc()
+	return false
+}
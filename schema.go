@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+/* JSON Schema generado a partir de los tipos de salida */
+
+const matchEventSchemaID = "https://github.com/Chapuzas-SA/gCTWatch/schema/match_event.schema.json"
+
+// Esquema (draft 2020-12) de MatchEvent
+func MatchEventSchema() ([]byte, error) {
+	s := jsonSchemaFor(reflect.TypeOf(MatchEvent{}))
+	s["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	s["$id"] = matchEventSchemaID
+	s["title"] = "MatchEvent"
+	props := s["properties"].(map[string]any)
+	props["schema_version"] = map[string]any{"const": MatchEventSchemaVersion}
+	props["kind"] = map[string]any{"enum": []string{EventKindMatch, EventKindHeartbeat, EventKindOps}}
+	return json.MarshalIndent(s, "", "  ")
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func jsonSchemaFor(t reflect.Type) map[string]any {
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Pointer:
+		s := jsonSchemaFor(t.Elem())
+		return map[string]any{"anyOf": []any{s, map[string]any{"type": "null"}}}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		// Los slices nil se serializan como null
+		return map[string]any{"type": []string{"array", "null"}, "items": jsonSchemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": []string{"object", "null"}, "additionalProperties": jsonSchemaFor(t.Elem())}
+	case reflect.Interface:
+		return map[string]any{}
+	case reflect.Struct:
+		props := make(map[string]any)
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			props[name] = jsonSchemaFor(f.Type)
+			if !strings.Contains(opts, "omitempty") && !strings.Contains(opts, "omitzero") {
+				required = append(required, name)
+			}
+		}
+		s := map[string]any{"type": "object", "properties": props}
+		if len(required) > 0 {
+			s["required"] = required
+		}
+		return s
+	}
+	panic(fmt.Sprintf("jsonSchemaFor: unsupported type %s", t))
+}
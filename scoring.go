@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+/* Puntuación de las coincidencias con modelos externos */
+
+const (
+	defaultScoreTimeout = 2 * time.Second
+	scoreBody           = 64 << 10
+)
+
+var metricScoreDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "gctwatch_score_duration_seconds",
+	Help:    "Tiempo de cada puntuación por backend.",
+	Buckets: prometheus.ExponentialBuckets(0.001, 4, 8),
+}, []string{"backend"})
+
+// Resultado del modelo
+type Score struct {
+	Value   float64 `json:"value"`           // 0 (legítimo) a 1 (phishing)
+	Label   string  `json:"label,omitempty"` // si el modelo clasifica, p.ej. phishing
+	Backend string  `json:"backend"`         // http u onnx
+	Model   string  `json:"model,omitempty"` // versión del modelo, si la da
+}
+
+// Backend de puntuación. Los equipos de detección cambian el modelo sin
+// tocar las reglas: un servicio HTTP propio o un modelo ONNX local.
+type Scorer interface {
+	Name() string
+	Score(ctx context.Context, ev *MatchEvent, f ScoreFeatures) (*Score, error)
+	Close() error
+}
+
+// Backends por prefijo de -scorer; onnx solo está compilado con -tags onnx
+var scoreBackends = map[string]func(target string, network *Network) (Scorer, error){
+	"http":  newHTTPScorer,
+	"https": newHTTPScorer,
+}
+
+// Abre el backend de -scorer: http(s)://... u onnx:/ruta/modelo.onnx
+func OpenScorer(spec string, network *Network) (Scorer, error) {
+	kind, target, _ := strings.Cut(spec, ":")
+	open, ok := scoreBackends[kind]
+	if !ok {
+		if kind == "onnx" {
+			return nil, fmt.Errorf("ONNX scoring not available in this build (rebuild with -tags onnx)")
+		}
+		return nil, fmt.Errorf("unknown scorer %q (http(s)://<url> or onnx:<model>)", spec)
+	}
+	if kind == "http" || kind == "https" {
+		target = spec
+	}
+	return open(target, network)
+}
+
+// Características léxicas del nombre que coincidió. Es la entrada de los
+// modelos ONNX (en este orden, como tensor float32 [1, 10]) y se envía
+// también a los servicios HTTP, que pueden usarlas o calcular las suyas.
+type ScoreFeatures struct {
+	Name       string  `json:"name"`
+	Length     float32 `json:"length"`
+	Labels     float32 `json:"labels"`
+	Digits     float32 `json:"digits"`
+	Hyphens    float32 `json:"hyphens"`
+	Entropy    float32 `json:"entropy"` // de Shannon, en bits por carácter
+	Punycode   float32 `json:"punycode"`
+	DNSNames   float32 `json:"dns_names"`
+	Wildcard   float32 `json:"wildcard"`
+	Validity   float32 `json:"validity_days"`
+	DomainSize float32 `json:"domain_length"` // del dominio registrado
+}
+
+func (f ScoreFeatures) Vector() []float32 {
+	return []float32{f.Length, f.Labels, f.Digits, f.Hyphens, f.Entropy, f.Punycode, f.DNSNames, f.Wildcard, f.Validity, f.DomainSize}
+}
+
+func scoreFeatures(ev *MatchEvent) ScoreFeatures {
+	c := ev.Certificate
+	name := ev.MatchedName
+	if !strings.Contains(name, ".") || strings.Contains(name, "=") {
+		name = c.Subject
+		if len(c.DNSNames) > 0 {
+			name = c.DNSNames[0]
+		}
+	}
+	name = strings.ToLower(name)
+	f := ScoreFeatures{Name: name, DNSNames: float32(len(c.DNSNames)), DomainSize: float32(len(eventDomain(*ev)))}
+	if strings.HasPrefix(name, "*.") {
+		f.Wildcard, name = 1, name[2:]
+	}
+	f.Length = float32(len(name))
+	f.Labels = float32(strings.Count(name, ".") + 1)
+	f.Punycode = float32(strings.Count(name, "xn--"))
+	counts := make(map[rune]int)
+	for _, r := range name {
+		counts[r]++
+		switch {
+		case r >= '0' && r <= '9':
+			f.Digits++
+		case r == '-':
+			f.Hyphens++
+		}
+	}
+	runes := utf8.RuneCountInString(name)
+	for _, n := range counts {
+		p := float64(n) / float64(runes)
+		f.Entropy -= float32(p * math.Log2(p))
+	}
+	if !c.NotBefore.IsZero() {
+		f.Validity = float32(c.NotAfter.Sub(c.NotBefore).Hours() / 24)
+	}
+	return f
+}
+
+// Enriquecedor que pide la puntuación con un tiempo máximo. Si el backend
+// falla o tarda, la coincidencia sigue sin puntuación.
+type scoreEnricher struct {
+	scorer  Scorer
+	timeout time.Duration
+}
+
+func NewScoreEnricher(scorer Scorer, timeout time.Duration) *scoreEnricher {
+	if timeout <= 0 {
+		timeout = defaultScoreTimeout
+	}
+	return &scoreEnricher{scorer: scorer, timeout: timeout}
+}
+
+func (e *scoreEnricher) Name() string { return "score:" + e.scorer.Name() }
+
+func (e *scoreEnricher) Enrich(ctx context.Context, ev *MatchEvent, in EnrichInput) error {
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+	t0 := time.Now()
+	s, err := e.scorer.Score(ctx, ev, scoreFeatures(ev))
+	metricScoreDuration.WithLabelValues(e.scorer.Name()).Observe(time.Since(t0).Seconds())
+	if err != nil {
+		return err
+	}
+	if math.IsNaN(s.Value) || s.Value < 0 || s.Value > 1 {
+		return fmt.Errorf("score %v out of range [0, 1]", s.Value)
+	}
+	ev.Enrichment.Score = s
+	return nil
+}
+
+// Para notificaciones, p.ej. "0.93 (phishing)"
+func scoreSummary(s *Score) string {
+	out := strconv.FormatFloat(s.Value, 'f', 2, 64)
+	if s.Label != "" {
+		out += " (" + s.Label + ")"
+	}
+	return out
+}
+
+// Servicio HTTP: recibe POST con {"event": ..., "features": ...} y responde
+// {"score": 0.93, "label": "phishing", "model": "v3"}. Usa el cliente
+// compartido, así que un servicio caído abre el circuit breaker de su host y
+// las coincidencias siguientes no esperan al timeout.
+type httpScorer struct {
+	url    string
+	client *http.Client
+}
+
+func newHTTPScorer(endpoint string, network *Network) (Scorer, error) {
+	if err := network.Policy.CheckURL(endpoint); err != nil {
+		return nil, err
+	}
+	return &httpScorer{url: endpoint, client: network.Client()}, nil
+}
+
+func (s *httpScorer) Name() string { return "http" }
+func (s *httpScorer) Close() error { return nil }
+
+func (s *httpScorer) Score(ctx context.Context, ev *MatchEvent, f ScoreFeatures) (*Score, error) {
+	body, err := json.Marshal(map[string]any{"event": ev, "features": f})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scorer: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := readLimited(resp.Body, scoreBody)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to query scorer: %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	var res struct {
+		Score *float64 `json:"score"`
+		Label string   `json:"label"`
+		Model string   `json:"model"`
+	}
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, fmt.Errorf("invalid scorer response: %w", err)
+	}
+	if res.Score == nil {
+		return nil, fmt.Errorf("invalid scorer response: no score")
+	}
+	return &Score{Value: *res.Score, Label: res.Label, Backend: "http", Model: res.Model}, nil
+}
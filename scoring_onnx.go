@@ -0,0 +1,97 @@
+//go:build onnx
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// Compilado con -tags onnx (necesita cgo). La biblioteca de ONNX Runtime se
+// carga al abrir el modelo: la de ONNXRUNTIME_LIB o la del sistema.
+func init() {
+	scoreBackends["onnx"] = newONNXScorer
+}
+
+// Modelo local con una entrada float32 [1, 10] (ScoreFeatures.Vector) y una
+// salida float32 [1, 1] con la probabilidad o [1, 2] con las de cada clase
+// (se toma la segunda, la de phishing)
+type onnxScorer struct {
+	model string
+
+	mu      sync.Mutex // los tensores son de la sesión: una ejecución cada vez
+	session *ort.AdvancedSession
+	input   *ort.Tensor[float32]
+	output  *ort.Tensor[float32]
+}
+
+func newONNXScorer(path string, _ *Network) (Scorer, error) {
+	if lib := os.Getenv("ONNXRUNTIME_LIB"); lib != "" {
+		ort.SetSharedLibraryPath(lib)
+	}
+	if !ort.IsInitialized() {
+		if err := ort.InitializeEnvironment(); err != nil {
+			return nil, fmt.Errorf("failed to load ONNX Runtime: %w", err)
+		}
+	}
+	inputs, outputs, err := ort.GetInputOutputInfo(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ONNX model %s: %w", path, err)
+	}
+	if len(inputs) != 1 || len(outputs) == 0 {
+		return nil, fmt.Errorf("ONNX model %s must have one input and at least one output", path)
+	}
+	classes := int64(1)
+	if dims := outputs[0].Dimensions; len(dims) == 2 && dims[1] == 2 {
+		classes = 2
+	}
+	s := &onnxScorer{model: filepath.Base(path)}
+	if s.input, err = ort.NewEmptyTensor[float32](ort.NewShape(1, int64(len(ScoreFeatures{}.Vector())))); err != nil {
+		return nil, err
+	}
+	if s.output, err = ort.NewEmptyTensor[float32](ort.NewShape(1, classes)); err != nil {
+		s.input.Destroy()
+		return nil, err
+	}
+	s.session, err = ort.NewAdvancedSession(path, []string{inputs[0].Name}, []string{outputs[0].Name},
+		[]ort.Value{s.input}, []ort.Value{s.output}, nil)
+	if err != nil {
+		s.input.Destroy()
+		s.output.Destroy()
+		return nil, fmt.Errorf("failed to load ONNX model %s: %w", path, err)
+	}
+	if md, err := s.session.GetModelMetadata(); err == nil {
+		if v, err := md.GetVersion(); err == nil && v > 0 {
+			s.model += ":" + strconv.FormatInt(v, 10)
+		}
+		md.Destroy()
+	}
+	return s, nil
+}
+
+func (s *onnxScorer) Name() string { return "onnx" }
+
+func (s *onnxScorer) Score(ctx context.Context, ev *MatchEvent, f ScoreFeatures) (*Score, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copy(s.input.GetData(), f.Vector())
+	if err := s.session.Run(); err != nil {
+		return nil, fmt.Errorf("ONNX model %s: %w", s.model, err)
+	}
+	out := s.output.GetData()
+	return &Score{Value: float64(out[len(out)-1]), Backend: "onnx", Model: s.model}, nil
+}
+
+func (s *onnxScorer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.input.Destroy()
+	s.output.Destroy()
+	return s.session.Destroy()
+}
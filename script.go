@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+/* Script Lua con lógica propia de coincidencia y enriquecimiento */
+
+// Tiempo máximo de cada llamada al script; si lo supera cuenta como error
+const scriptTimeout = time.Second
+
+var metricScriptErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gctwatch_script_errors_total",
+	Help: "Errores de las funciones del script Lua (-lua-script).",
+}, []string{"function"})
+
+// Script de -lua-script. Puede definir dos funciones globales:
+//
+//	match(cert, log, tags)  se llama con cada certificado, después de las
+//	                        reglas (tags son las que coincidieron)
+//	enrich(event)           se llama con cada coincidencia antes de enrutarla
+//
+// cert y log tienen los mismos campos que en las reglas CEL (las fechas en
+// segundos Unix) y event es el evento tal como sale en JSON. Solo están las
+// bibliotecas base, string, table y math, más log(msg) para escribir en el
+// log del watcher.
+//
+// Cada worker usa su propio estado de Lua, así que las variables globales
+// que modifique el script no se comparten ni se conservan entre llamadas.
+type LuaScript struct {
+	path      string
+	proto     *lua.FunctionProto
+	hasMatch  bool
+	hasEnrich bool
+	states    sync.Pool // *lua.LState con el script ya cargado
+}
+
+func LoadLuaScript(path string) (*LuaScript, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	chunk, err := parse.Parse(f, path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid script: %w", err)
+	}
+	proto, err := lua.Compile(chunk, path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid script: %w", err)
+	}
+	s := &LuaScript{path: path, proto: proto}
+	L, err := s.newState()
+	if err != nil {
+		return nil, err
+	}
+	s.hasMatch = L.GetGlobal("match").Type() == lua.LTFunction
+	s.hasEnrich = L.GetGlobal("enrich").Type() == lua.LTFunction
+	s.states.Put(L)
+	if !s.hasMatch && !s.hasEnrich {
+		return nil, fmt.Errorf("script %s defines neither match nor enrich", path)
+	}
+	return s, nil
+}
+
+func (s *LuaScript) newState() (*lua.LState, error) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range []string{"dofile", "loadfile"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+	L.SetGlobal("log", L.NewFunction(func(L *lua.LState) int {
+		log.Printf("script %s: %s", s.path, L.CheckString(1))
+		return 0
+	}))
+	L.Push(L.NewFunctionFromProto(s.proto))
+	if err := L.PCall(0, 0, nil); err != nil {
+		L.Close()
+		return nil, fmt.Errorf("failed to load script: %w", err)
+	}
+	return L, nil
+}
+
+// Si el script define enrich
+func (s *LuaScript) Enriches() bool { return s.hasEnrich }
+
+// Llama a la función fn con los argumentos que construye args y pasa el
+// resultado a ret antes de devolver el estado
+func (s *LuaScript) call(ctx context.Context, fn string, args func(L *lua.LState) []lua.LValue, ret func(v lua.LValue) error) error {
+	L, _ := s.states.Get().(*lua.LState)
+	if L == nil {
+		var err error
+		if L, err = s.newState(); err != nil {
+			metricScriptErrors.WithLabelValues(fn).Inc()
+			return err
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, scriptTimeout)
+	defer cancel()
+	L.SetContext(ctx)
+	err := L.CallByParam(lua.P{Fn: L.GetGlobal(fn), NRet: 1, Protect: true}, args(L)...)
+	L.RemoveContext()
+	if err != nil {
+		// Un estado interrumpido a medias no se reutiliza
+		L.Close()
+		metricScriptErrors.WithLabelValues(fn).Inc()
+		if apiErr, ok := err.(*lua.ApiError); ok {
+			return fmt.Errorf("%s: %s", fn, apiErr.Object) // sin la traza de la pila
+		}
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	v := L.Get(-1)
+	L.Pop(1)
+	err = ret(v)
+	s.states.Put(L)
+	if err != nil {
+		metricScriptErrors.WithLabelValues(fn).Inc()
+		return fmt.Errorf("%s: %w", fn, err)
+	}
+	return nil
+}
+
+// Aplica match a un certificado. El resultado nil o true deja las
+// coincidencias de las reglas como están y false descarta el certificado
+// aunque haya reglas que coincidan. Un tag, una tabla
+// {tag=..., severity=..., description=..., name=...} o una lista de ellos
+// añaden coincidencias (name es el valor que coincidió; por defecto el
+// primer nombre del certificado). Si el script falla se mantienen las de
+// las reglas.
+func (s *LuaScript) Match(v *certValues, matches []ruleMatch) ([]ruleMatch, error) {
+	if s == nil || !s.hasMatch {
+		return matches, nil
+	}
+	vars := v.celVars()
+	out := matches
+	err := s.call(context.Background(), "match", func(L *lua.LState) []lua.LValue {
+		tags := L.NewTable()
+		for _, m := range matches {
+			tags.Append(lua.LString(m.Tag))
+		}
+		return []lua.LValue{luaCert(L, vars["cert"].(*celCert)), luaLog(L, vars["log"].(*celLog)), tags}
+	}, func(ret lua.LValue) error {
+		switch ret {
+		case lua.LNil, lua.LTrue:
+			return nil
+		case lua.LFalse:
+			out = nil
+			return nil
+		}
+		added, err := scriptMatches(ret, v)
+		if err != nil {
+			return err
+		}
+		for i := range added {
+			added[i].From = "script"
+		}
+		out = mergeMatches(matches, added)
+		return nil
+	})
+	if err != nil {
+		return matches, err
+	}
+	return out, nil
+}
+
+// Coincidencias que devuelve match: un tag, una tabla o una lista
+func scriptMatches(ret lua.LValue, v *certValues) ([]ruleMatch, error) {
+	t, ok := ret.(*lua.LTable)
+	if !ok || t.RawGetString("tag") != lua.LNil {
+		m, err := scriptMatch(ret, v)
+		if err != nil {
+			return nil, err
+		}
+		return []ruleMatch{m}, nil
+	}
+	var out []ruleMatch
+	for i := 1; i <= t.Len(); i++ {
+		m, err := scriptMatch(t.RawGetInt(i), v)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+func scriptMatch(ret lua.LValue, v *certValues) (ruleMatch, error) {
+	switch r := ret.(type) {
+	case lua.LString:
+		return newExtraMatch(string(r), "", "", "", v)
+	case *lua.LTable:
+		return newExtraMatch(luaString(r, "tag"), luaString(r, "severity"), luaString(r, "description"), luaString(r, "name"), v)
+	}
+	return ruleMatch{}, fmt.Errorf("unexpected result %s (nil, boolean, tag, table or list)", ret.Type())
+}
+
+func luaString(t *lua.LTable, key string) string {
+	if s, ok := t.RawGetString(key).(lua.LString); ok {
+		return string(s)
+	}
+	return ""
+}
+
+func luaStrings(L *lua.LState, values []string) *lua.LTable {
+	t := L.CreateTable(len(values), 0)
+	for _, s := range values {
+		t.Append(lua.LString(s))
+	}
+	return t
+}
+
+func luaCert(L *lua.LState, c *celCert) *lua.LTable {
+	t := L.CreateTable(0, 14)
+	t.RawSetString("cn", lua.LString(c.CN))
+	t.RawSetString("sans", luaStrings(L, c.SANs))
+	t.RawSetString("domains", luaStrings(L, c.Domains))
+	t.RawSetString("skeletons", luaStrings(L, c.Skeletons))
+	t.RawSetString("subject", lua.LString(c.Subject))
+	t.RawSetString("issuer", lua.LString(c.Issuer))
+	t.RawSetString("issuer_org", luaStrings(L, c.IssuerOrg))
+	t.RawSetString("org", luaStrings(L, c.Org))
+	t.RawSetString("serial", lua.LString(c.Serial))
+	t.RawSetString("not_before", lua.LNumber(c.NotBefore.Unix()))
+	t.RawSetString("not_after", lua.LNumber(c.NotAfter.Unix()))
+	t.RawSetString("key_type", lua.LString(c.KeyType))
+	t.RawSetString("key_bits", lua.LNumber(c.KeyBits))
+	t.RawSetString("is_ca", lua.LBool(c.IsCA))
+	return t
+}
+
+func luaLog(L *lua.LState, l *celLog) *lua.LTable {
+	t := L.CreateTable(0, 2)
+	t.RawSetString("url", lua.LString(l.URL))
+	t.RawSetString("lists", luaStrings(L, l.Lists))
+	return t
+}
+
+// Valor decodificado de JSON como valor de Lua
+func luaFromJSON(L *lua.LState, v any) lua.LValue {
+	switch v := v.(type) {
+	case string:
+		return lua.LString(v)
+	case float64:
+		return lua.LNumber(v)
+	case bool:
+		return lua.LBool(v)
+	case []any:
+		t := L.CreateTable(len(v), 0)
+		for _, e := range v {
+			t.Append(luaFromJSON(L, e))
+		}
+		return t
+	case map[string]any:
+		t := L.CreateTable(0, len(v))
+		for k, e := range v {
+			t.RawSetString(k, luaFromJSON(L, e))
+		}
+		return t
+	}
+	return lua.LNil
+}
+
+// Enriquecedor con la función enrich del script. Devuelve nil o una tabla
+// de campos con valores simples (texto, número o booleano), que se añaden
+// al evento en enrichment.script como texto.
+type scriptEnricher struct {
+	script *LuaScript
+}
+
+func NewScriptEnricher(script *LuaScript) *scriptEnricher {
+	return &scriptEnricher{script: script}
+}
+
+func (e *scriptEnricher) Name() string { return "script" }
+
+func (e *scriptEnricher) Enrich(ctx context.Context, ev *MatchEvent, in EnrichInput) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	var event map[string]any
+	if err := json.Unmarshal(data, &event); err != nil {
+		return err
+	}
+	return e.script.call(ctx, "enrich", func(L *lua.LState) []lua.LValue {
+		return []lua.LValue{luaFromJSON(L, event)}
+	}, func(ret lua.LValue) error {
+		if ret == lua.LNil {
+			return nil
+		}
+		t, ok := ret.(*lua.LTable)
+		if !ok {
+			return fmt.Errorf("unexpected result %s (nil or table)", ret.Type())
+		}
+		fields := make(map[string]string)
+		var err error
+		t.ForEach(func(k, v lua.LValue) {
+			switch v.(type) {
+			case lua.LString, lua.LNumber, lua.LBool:
+				fields[k.String()] = v.String()
+			default:
+				err = fmt.Errorf("field %s: unsupported type %s", k, v.Type())
+			}
+		})
+		if err != nil {
+			return err
+		}
+		if len(fields) > 0 {
+			ev.Enrichment.Script = fields
+		}
+		return nil
+	})
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+/* Selección interactiva de logs (-select) */
+
+// Muestra los logs inicializados con su tamaño y deja solo los elegidos. Se
+// lee una línea de in, así que también admite una selección por tubería
+// (echo 1,3-5 | gctwatch -select).
+func (mngr *CTLogsManager) SelectLogs(in io.Reader, out io.Writer) error {
+	if len(mngr.sources) == 0 {
+		return fmt.Errorf("no usable logs to select from")
+	}
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tentries\tMMD\tlists\tlog")
+	for i, s := range mngr.sources {
+		fmt.Fprintf(tw, "%d\t%d\t%s\t%s\t%s\n", i+1, s.LastSize, s.MMD, strings.Join(s.Lists, ","), s.Source)
+	}
+	tw.Flush()
+	sc := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, "Logs to monitor (e.g. 1,3-5; empty = all): ")
+		if !sc.Scan() {
+			if err := sc.Err(); err != nil {
+				return fmt.Errorf("failed to read log selection: %w", err)
+			}
+			return fmt.Errorf("no log selection given")
+		}
+		picked, err := parseSelection(sc.Text(), len(mngr.sources))
+		if err != nil {
+			fmt.Fprintln(out, err)
+			continue
+		}
+		if picked == nil {
+			return nil
+		}
+		var sources []CTLogSource
+		for i := range mngr.sources {
+			if picked[i] {
+				sources = append(sources, mngr.sources[i])
+			}
+		}
+		log.Printf("log selection: %d of %d logs selected", len(sources), len(mngr.sources))
+		mngr.sources = sources
+		return nil
+	}
+}
+
+// "1,3-5 7" -> índices desde 0; vacío o "all" = nil (todos)
+func parseSelection(s string, n int) (map[int]bool, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "all" || s == "*" {
+		return nil, nil
+	}
+	picked := make(map[int]bool)
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		from, to, isRange := strings.Cut(part, "-")
+		a, err := strconv.Atoi(from)
+		b := a
+		if err == nil && isRange {
+			b, err = strconv.Atoi(to)
+		}
+		if err != nil || a < 1 || b > n || a > b {
+			return nil, fmt.Errorf("invalid selection %q (numbers from 1 to %d)", part, n)
+		}
+		for i := a; i <= b; i++ {
+			picked[i-1] = true
+		}
+	}
+	return picked, nil
+}
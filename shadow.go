@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+/* Reglas en evaluación (shadow) */
+
+var metricShadowHits = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gctwatch_shadow_rule_hits_total",
+	Help: "Coincidencias de reglas en evaluación; live indica si alguna regla activa coincidió también.",
+}, []string{"tag", "live"})
+
+// Los tags en evaluación no pueden repetir los activos: comparten el
+// histórico y las métricas por tag
+func checkShadowRules(shadow, active RegexRules) error {
+	for tag := range shadow {
+		if _, ok := active[tag]; ok {
+			return fmt.Errorf("shadow rule %s has the same tag as an active rule (use a new name, e.g. %s-v2)", tag, tag)
+		}
+	}
+	return nil
+}
+
+// Evalúa todas las reglas en evaluación (-shadow-rules y las draft), no solo
+// la primera que coincide, para medir cada una. Las coincidencias solo se
+// cuentan y, con histórico, se guardan como eventos "shadow"; nunca llegan a
+// los sinks.
+func (mngr *CTLogsManager) evalShadow(cert *x509.Certificate, values *certValues, entry SourcedEntry, live bool) {
+	// El mapa se sustituye entero al recargar, nunca se modifica
+	mngr.rulesMu.RLock()
+	shadowing, filter := mngr.shadowing, mngr.ruleFilter
+	mngr.rulesMu.RUnlock()
+	var converted *CertificateJSON
+	candidates := values.Candidates(filter)
+	for tag, rule := range shadowing {
+		if candidates.Skip(rule) {
+			continue
+		}
+		matched, ok := rule.Match(values)
+		if !ok {
+			continue
+		}
+		mngr.stats.ShadowMatch(tag)
+		metricShadowHits.WithLabelValues(tag, strconv.FormatBool(live)).Inc()
+		if mngr.matchesDispatcher == nil {
+			continue
+		}
+		if converted == nil {
+			c := ConvertCertificate(cert)
+			converted = &c
+		}
+		ev := NewMatchEvent(tag, entry, *converted)
+		ev.Kind = EventKindShadow
+		ev.MatchedName = matched
+		info := rule.Info
+		ev.Rule = &info
+		mngr.matchesDispatcher.Submit(ev)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+/* Firma de reglas y configuración */
+
+var ErrUnsigned = errors.New("signature required but missing")
+
+// Verifica ficheros firmados con minisign (clave "RW...") o con una clave PEM
+// (firma en crudo o en base64, por ejemplo de `openssl pkeyutl -sign`).
+type SignatureVerifier struct {
+	minisignID [8]byte
+	key        crypto.PublicKey
+	minisign   bool
+}
+
+func LoadSignatureVerifier(path string) (*SignatureVerifier, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Contains(data, []byte("-----BEGIN")) {
+		key, err := parsePublicKeyPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signing key %s: %w", path, err)
+		}
+		return &SignatureVerifier{key: key}, nil
+	}
+	// minisign: comentario opcional y la clave en base64 ("Ed" + id + clave)
+	raw, err := base64.StdEncoding.DecodeString(lastLine(string(data)))
+	if err != nil || len(raw) != 42 || string(raw[:2]) != "Ed" {
+		return nil, fmt.Errorf("invalid minisign public key %s", path)
+	}
+	v := &SignatureVerifier{key: ed25519.PublicKey(raw[10:]), minisign: true}
+	copy(v.minisignID[:], raw[2:10])
+	return v, nil
+}
+
+// Extensión del fichero de firma junto al fichero firmado
+func (v *SignatureVerifier) SigExt() string {
+	if v.minisign {
+		return ".minisig"
+	}
+	return ".sig"
+}
+
+func (v *SignatureVerifier) Verify(data, sig []byte) error {
+	if len(sig) == 0 {
+		return ErrUnsigned
+	}
+	if !v.minisign {
+		if dec, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig))); err == nil {
+			sig = dec
+		}
+		return cryptoProvider.Verify(v.key, data, sig)
+	}
+	return v.verifyMinisign(data, sig)
+}
+
+// Formato minisign: comentario, firma, comentario de confianza y firma global
+func (v *SignatureVerifier) verifyMinisign(data, sigFile []byte) error {
+	lines := strings.Split(strings.TrimSpace(string(sigFile)), "\n")
+	if len(lines) < 4 {
+		return fmt.Errorf("invalid minisign signature")
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || len(sig) != 74 {
+		return fmt.Errorf("invalid minisign signature")
+	}
+	if !bytes.Equal(sig[2:10], v.minisignID[:]) {
+		return fmt.Errorf("signature made with another key (id %X)", sig[2:10])
+	}
+	msg := data
+	switch string(sig[:2]) {
+	case "Ed":
+	case "ED": // prehash BLAKE2b-512
+		sum := blake2b.Sum512(data)
+		msg = sum[:]
+	default:
+		return fmt.Errorf("unsupported minisign algorithm %q", sig[:2])
+	}
+	if err := cryptoProvider.Verify(v.key, msg, sig[10:]); err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	trusted, ok := strings.CutPrefix(strings.TrimRight(lines[2], "\r"), "trusted comment: ")
+	if !ok {
+		return fmt.Errorf("invalid minisign trusted comment")
+	}
+	global, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil {
+		return fmt.Errorf("invalid minisign global signature")
+	}
+	if err := cryptoProvider.Verify(v.key, append(sig[10:74:74], trusted...), global); err != nil {
+		return fmt.Errorf("invalid trusted comment signature: %w", err)
+	}
+	return nil
+}
+
+// Lee un fichero verificando su firma (path + .minisig/.sig) si hay verificador
+func readVerified(path string, v *SignatureVerifier) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil || v == nil {
+		return data, err
+	}
+	sig, err := os.ReadFile(path + v.SigExt())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := v.Verify(data, sig); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return data, nil
+}
+
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
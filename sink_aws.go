@@ -0,0 +1,172 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+/* Salida a AWS: cola SQS o topic SNS */
+
+// Envía cada evento como un mensaje con los atributos kind, tag y log, para
+// filtrar suscripciones SNS o consumidores sin decodificar el cuerpo. El
+// cuerpo solo admite texto: las codificaciones binarias van en base64 (con el
+// atributo content_encoding). En colas y topics FIFO el grupo es el tag y la
+// deduplicación usa el mismo ID estable que NATS.
+type awsSink struct {
+	name    string
+	fifo    bool
+	enc     Encoder
+	check   func(ctx context.Context) error
+	publish func(ctx context.Context, body string, attrs map[string]string, group, dedup string) error
+}
+
+// Credenciales con la cadena estándar del SDK (variables de entorno, perfil
+// de ~/.aws, SSO, rol de la instancia o de la tarea)
+func loadAWSConfig(ctx context.Context, region string, network *Network) (aws.Config, error) {
+	// Cliente del SDK (ya reintenta con backoff y admite AWS_CA_BUNDLE) sobre
+	// el dialer con la política de red
+	client := awshttp.NewBuildableClient().WithTransportOptions(func(tr *http.Transport) {
+		tr.DialContext = network.DialContext
+	})
+	opts := []func(*config.LoadOptions) error{config.WithHTTPClient(client)}
+	if region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+	return cfg, nil
+}
+
+// Cola SQS por URL: https://sqs.<región>.amazonaws.com/<cuenta>/<cola>. La
+// región solo hace falta si no se deduce del host (endpoints de VPC).
+func NewSQSSink(queueURL, region string, enc Encoder, network *Network) (*awsSink, error) {
+	u, err := url.Parse(queueURL)
+	var parts []string
+	if err == nil {
+		parts = strings.Split(strings.Trim(u.Path, "/"), "/")
+	}
+	if err != nil || u.Scheme != "https" || u.Host == "" || len(parts) != 2 {
+		return nil, fmt.Errorf("invalid SQS queue URL %q (https://sqs.<region>.amazonaws.com/<account>/<queue>)", queueURL)
+	}
+	if err := network.Policy.CheckURL(queueURL); err != nil {
+		return nil, err
+	}
+	if host := strings.Split(u.Hostname(), "."); region == "" && len(host) > 2 && host[0] == "sqs" {
+		region = host[1]
+	}
+	cfg, err := loadAWSConfig(context.Background(), region, network)
+	if err != nil {
+		return nil, err
+	}
+	client := sqs.NewFromConfig(cfg, func(o *sqs.Options) {
+		o.BaseEndpoint = aws.String(u.Scheme + "://" + u.Host)
+	})
+	s := &awsSink{name: "sqs:" + parts[1], fifo: strings.HasSuffix(parts[1], ".fifo"), enc: enc}
+	s.check = func(ctx context.Context) error {
+		_, err := client.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+			QueueUrl: aws.String(queueURL), AttributeNames: []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNameQueueArn},
+		})
+		return err
+	}
+	s.publish = func(ctx context.Context, body string, attrs map[string]string, group, dedup string) error {
+		in := &sqs.SendMessageInput{QueueUrl: aws.String(queueURL), MessageBody: aws.String(body), MessageAttributes: map[string]sqstypes.MessageAttributeValue{}}
+		for k, v := range attrs {
+			in.MessageAttributes[k] = sqstypes.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(v)}
+		}
+		if group != "" {
+			in.MessageGroupId, in.MessageDeduplicationId = aws.String(group), aws.String(dedup)
+		}
+		_, err := client.SendMessage(ctx, in)
+		return err
+	}
+	return s, nil
+}
+
+// Topic SNS por ARN: arn:aws:sns:<región>:<cuenta>:<topic>
+func NewSNSSink(topicARN string, enc Encoder, network *Network) (*awsSink, error) {
+	parts := strings.Split(topicARN, ":")
+	if len(parts) != 6 || parts[0] != "arn" || parts[2] != "sns" || parts[3] == "" || parts[5] == "" {
+		return nil, fmt.Errorf("invalid SNS topic ARN %q (arn:aws:sns:<region>:<account>:<topic>)", topicARN)
+	}
+	region := parts[3]
+	if err := network.Policy.Check("sns." + region + ".amazonaws.com"); err != nil {
+		return nil, err
+	}
+	cfg, err := loadAWSConfig(context.Background(), region, network)
+	if err != nil {
+		return nil, err
+	}
+	client := sns.NewFromConfig(cfg)
+	s := &awsSink{name: "sns:" + parts[5], fifo: strings.HasSuffix(parts[5], ".fifo"), enc: enc}
+	s.check = func(ctx context.Context) error {
+		_, err := client.GetTopicAttributes(ctx, &sns.GetTopicAttributesInput{TopicArn: aws.String(topicARN)})
+		return err
+	}
+	s.publish = func(ctx context.Context, body string, attrs map[string]string, group, dedup string) error {
+		in := &sns.PublishInput{TopicArn: aws.String(topicARN), Message: aws.String(body), MessageAttributes: map[string]snstypes.MessageAttributeValue{}}
+		for k, v := range attrs {
+			in.MessageAttributes[k] = snstypes.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(v)}
+		}
+		if group != "" {
+			in.MessageGroupId, in.MessageDeduplicationId = aws.String(group), aws.String(dedup)
+		}
+		_, err := client.Publish(ctx, in)
+		return err
+	}
+	return s, nil
+}
+
+func (s *awsSink) Name() string { return s.name }
+func (s *awsSink) Close() error { return nil }
+
+// Comprueba credenciales, permisos y que el destino existe
+func (s *awsSink) Check() error {
+	if err := s.check(context.Background()); err != nil {
+		return fmt.Errorf("%s: %w", s.name, err)
+	}
+	return nil
+}
+
+func (s *awsSink) Write(ctx context.Context, ev MatchEvent) error {
+	data, err := s.enc.Encode(ev)
+	if err != nil {
+		return err
+	}
+	attrs := map[string]string{"kind": ev.Kind, "content_type": s.enc.ContentType()}
+	body := string(data)
+	// JSON con el registro de esquemas también lleva la cabecera binaria
+	if _, framed := s.enc.(*registryEncoder); framed || s.enc.Name() != "json" {
+		body = base64.StdEncoding.EncodeToString(data)
+		attrs["content_encoding"] = "base64"
+	}
+	// Los atributos no pueden ir vacíos
+	if ev.Tag != "" {
+		attrs["tag"] = ev.Tag
+	}
+	if ev.Log.URL != "" {
+		attrs["log"] = ev.Log.URL
+	}
+	var group, dedup string
+	if s.fifo {
+		group, dedup = cmp.Or(ev.Tag, ev.Kind), eventMsgID(ev)
+	}
+	if err := s.publish(ctx, body, attrs, group, dedup); err != nil {
+		return fmt.Errorf("failed to send to %s: %w", s.name, err)
+	}
+	return nil
+}
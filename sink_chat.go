@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/time/rate"
+)
+
+/* Alertas a chats por webhook: Slack, Discord y Telegram */
+
+const (
+	defaultChatRate = 20 // mensajes por minuto y canal
+	chatBurst       = 5
+)
+
+var metricChatSuppressed = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gctwatch_chat_suppressed_total",
+	Help: "Alertas no enviadas a un canal de chat por superar su límite de mensajes.",
+}, []string{"sink"})
+
+// Alerta compacta: una línea de título y pocos campos
+type chatAlert struct {
+	Title, Link string
+	Facts       []notifyFact
+}
+
+func chatContent(ev MatchEvent, l Locale) chatAlert {
+	if ev.Kind != EventKindMatch && ev.Kind != EventKindShadow {
+		title, facts := notifyContent(ev, l)
+		return chatAlert{Title: title, Facts: facts}
+	}
+	a := chatAlert{
+		Title: l.Sprintf("Certificate for %s", eventDomain(ev)),
+		Link:  notifyLink(ev),
+		Facts: []notifyFact{
+			{"Tag", strings.Join(ev.AllTags(), ", ")},
+			{l.T("Issuer"), ev.Certificate.Issuer},
+			{"Log", fmt.Sprintf("%s #%d", ev.Log.URL, ev.Index)},
+		},
+	}
+	if ev.Rule != nil && ev.Rule.Severity != defaultRuleSeverity {
+		a.Facts = append(a.Facts, notifyFact{l.T("Severity"), ev.Rule.Severity})
+	}
+	if e := ev.Enrichment; e != nil && e.Zone != nil {
+		a.Facts = append(a.Facts, notifyFact{l.T("Zone"), e.Zone.Status})
+	}
+	if e := ev.Enrichment; e != nil && e.Issuance != nil && e.Issuance.Status != "automated" {
+		a.Facts = append(a.Facts, notifyFact{l.T("Issuance"), issuanceSummary(e.Issuance)})
+	}
+	if e := ev.Enrichment; e != nil && e.Score != nil {
+		a.Facts = append(a.Facts, notifyFact{l.T("Score"), scoreSummary(e.Score)})
+	}
+	if e := ev.Enrichment; e != nil && e.SafeBrowsing != nil && e.SafeBrowsing.Status == "flagged" {
+		a.Facts = append(a.Facts, notifyFact{"Safe Browsing", strings.Join(e.SafeBrowsing.Threats, ", ")})
+	}
+	if e := ev.Enrichment; e != nil && e.VirusTotal != nil && (e.VirusTotal.Malicious > 0 || e.VirusTotal.Suspicious > 0) {
+		a.Facts = append(a.Facts, notifyFact{"VirusTotal", virusTotalSummary(e.VirusTotal)})
+	}
+	return a
+}
+
+// Canal de chat con filtro de tags propio y límite de mensajes. Lo que pasa
+// del límite se descarta (no se reintenta, el chat no es el registro) y se
+// indica en el siguiente mensaje.
+type chatSink struct {
+	name       string
+	tags       []string // vacío = todos
+	locale     Locale
+	limiter    *rate.Limiter
+	suppressed atomic.Int64
+	send       func(ctx context.Context, a chatAlert) error
+}
+
+func newChatSink(name string, send func(context.Context, chatAlert) error) *chatSink {
+	s := &chatSink{name: name, locale: defaultLocale, send: send}
+	s.SetRate(defaultChatRate)
+	return s
+}
+
+func (s *chatSink) Name() string { return s.name }
+func (s *chatSink) Close() error { return nil }
+
+func (s *chatSink) SetLocale(l Locale) { s.locale = l }
+
+// Mensajes por minuto; 0 = sin límite
+func (s *chatSink) SetRate(perMinute float64) {
+	s.limiter = rate.NewLimiter(rate.Inf, 0)
+	if perMinute > 0 {
+		s.limiter = rate.NewLimiter(rate.Limit(perMinute/60), chatBurst)
+	}
+}
+
+func (s *chatSink) Write(ctx context.Context, ev MatchEvent) error {
+	if len(s.tags) > 0 && !routeHasAnyTag(Route{Tags: s.tags}, ev.AllTags()) {
+		return nil
+	}
+	if !s.limiter.Allow() {
+		s.suppressed.Add(1)
+		metricChatSuppressed.WithLabelValues(s.name).Inc()
+		return nil
+	}
+	a := chatContent(ev, s.locale)
+	if n := s.suppressed.Swap(0); n > 0 {
+		a.Facts = append(a.Facts, notifyFact{s.locale.T("Suppressed"), s.locale.Sprintf("%d alerts over the rate limit since the last message", n)})
+	}
+	return s.send(ctx, a)
+}
+
+func chatEndpoint(kind, endpoint string) (*url.URL, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return nil, fmt.Errorf("invalid %s webhook URL %q", kind, endpoint)
+	}
+	return u, nil
+}
+
+// Recorta a n runas para los límites de longitud de cada servicio
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:n-1]) + "…"
+}
+
+// Incoming webhook de Slack, con el texto en mrkdwn
+func NewSlackSink(channel, endpoint string, client *http.Client) (*chatSink, error) {
+	if _, err := chatEndpoint("Slack", endpoint); err != nil {
+		return nil, err
+	}
+	esc := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	return newChatSink("slack:"+channel, func(ctx context.Context, a chatAlert) error {
+		var b strings.Builder
+		fmt.Fprintf(&b, "*%s*", esc.Replace(a.Title))
+		for _, f := range a.Facts {
+			fmt.Fprintf(&b, "\n*%s:* %s", f.Name, esc.Replace(f.Value))
+		}
+		if a.Link != "" {
+			fmt.Fprintf(&b, "\n<%s|crt.sh>", a.Link)
+		}
+		return postJSON(ctx, client, http.MethodPost, endpoint, "", map[string]any{
+			"text": b.String(), "unfurl_links": false,
+		})
+	}), nil
+}
+
+// Webhook de un canal de Discord, como embed
+func NewDiscordSink(channel, endpoint string, client *http.Client) (*chatSink, error) {
+	if _, err := chatEndpoint("Discord", endpoint); err != nil {
+		return nil, err
+	}
+	return newChatSink("discord:"+channel, func(ctx context.Context, a chatAlert) error {
+		fields := make([]map[string]any, 0, len(a.Facts))
+		for _, f := range a.Facts {
+			fields = append(fields, map[string]any{"name": f.Name, "value": truncateRunes(f.Value, 1024), "inline": f.Name != "Log"})
+		}
+		embed := map[string]any{"title": truncateRunes(a.Title, 256), "fields": fields}
+		if a.Link != "" {
+			embed["url"] = a.Link
+		}
+		return postJSON(ctx, client, http.MethodPost, endpoint, "", map[string]any{
+			"embeds":           []any{embed},
+			"allowed_mentions": map[string]any{"parse": []string{}},
+		})
+	}), nil
+}
+
+const telegramAPI = "https://api.telegram.org"
+
+// Mensaje de un bot de Telegram a un chat (ID numérico o @canal)
+func NewTelegramSink(channel, chatID, tokenFile string, client *http.Client) (*chatSink, error) {
+	if chatID == "" {
+		return nil, fmt.Errorf("telegram chat ID is required")
+	}
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read telegram token: %w", err)
+	}
+	endpoint := fmt.Sprintf("%s/bot%s/sendMessage", telegramAPI, strings.TrimSpace(string(token)))
+	return newChatSink("telegram:"+channel, func(ctx context.Context, a chatAlert) error {
+		var b strings.Builder
+		fmt.Fprintf(&b, "<b>%s</b>", html.EscapeString(a.Title))
+		for _, f := range a.Facts {
+			fmt.Fprintf(&b, "\n<b>%s:</b> %s", f.Name, html.EscapeString(f.Value))
+		}
+		if a.Link != "" {
+			fmt.Fprintf(&b, "\n<a href=\"%s\">crt.sh</a>", html.EscapeString(a.Link))
+		}
+		err := postJSON(ctx, client, http.MethodPost, endpoint, "", map[string]any{
+			"chat_id": chatID, "text": truncateRunes(b.String(), 4096),
+			"parse_mode": "HTML", "disable_web_page_preview": true,
+		})
+		// El token va en la ruta: que no acabe en los logs
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			ue.URL = telegramAPI + "/bot<token>/sendMessage"
+		}
+		return err
+	}), nil
+}
+
+// Canales de -slack-webhooks, -discord-webhooks y -telegram-chats: canal=destino
+func parseChatChannels(spec string) ([][2]string, error) {
+	var out [][2]string
+	for _, kv := range splitList(spec) {
+		name, target, ok := strings.Cut(kv, "=")
+		if !ok || name == "" || target == "" {
+			return nil, fmt.Errorf("invalid chat channel %q (name=target)", kv)
+		}
+		out = append(out, [2]string{name, target})
+	}
+	return out, nil
+}
+
+// -chat-tags: canal=tag1|tag2 separados por comas
+func parseChatTags(spec string) map[string][]string {
+	out := make(map[string][]string)
+	for name, tags := range parseKeyValues(spec) {
+		out[name] = strings.Split(tags, "|")
+	}
+	return out
+}
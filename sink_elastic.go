@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+/* Sink de Elasticsearch/OpenSearch (API _bulk) */
+
+// Ajustes y mapping de la plantilla de índice; las cadenas que no aparecen se
+// indexan como keyword
+//
+//go:embed schema/elasticsearch_template.json
+var elasticTemplate []byte
+
+// Documento indexado: el evento con @timestamp (campo de tiempo por defecto en
+// Kibana) y el dominio registrado
+type elasticDoc struct {
+	Timestamp time.Time `json:"@timestamp"`
+	Domain    string    `json:"domain,omitempty"`
+	MatchEvent
+}
+
+type elasticItem struct {
+	id, index string
+	doc       []byte
+}
+
+// Indexa las coincidencias por lotes. El _id es tag + huella, así que los
+// reintentos y las instancias duplicadas no crean documentos repetidos. El
+// índice admite {date} (el día UTC de la detección, 2006.01.02).
+type elasticSink struct {
+	base        *url.URL // sin credenciales
+	name        string
+	index       string
+	user, pass  string
+	apiKey      string
+	compression string
+	client      *http.Client
+	batch       *batcher[elasticItem]
+	Template    bool // instala la plantilla de índice en Check
+}
+
+func NewElasticSink(endpoint, index, apiKeyFile, compression string, client *http.Client, size int, interval time.Duration) (*elasticSink, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid Elasticsearch URL %q", endpoint)
+	}
+	// Elasticsearch y OpenSearch solo descomprimen gzip
+	if compression != "" && compression != CompressNone && compression != CompressGzip {
+		return nil, fmt.Errorf("unsupported Elasticsearch compression %q (none, gzip)", compression)
+	}
+	if index == "" || strings.ContainsAny(strings.ReplaceAll(index, "{date}", ""), `*?"<>|/\, #:{}`) {
+		return nil, fmt.Errorf("invalid Elasticsearch index %q", index)
+	}
+	s := &elasticSink{index: index, compression: compression, client: client}
+	if u.User != nil {
+		s.user = u.User.Username()
+		s.pass, _ = u.User.Password()
+		u.User = nil
+	}
+	if apiKeyFile != "" {
+		data, err := os.ReadFile(apiKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Elasticsearch API key: %w", err)
+		}
+		s.apiKey = strings.TrimSpace(string(data))
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	s.base, s.name = u, "elasticsearch:"+u.Host
+	s.batch = newBatcher(size, interval, s.bulk)
+	return s, nil
+}
+
+func (s *elasticSink) Name() string { return s.name }
+func (s *elasticSink) Close() error { return s.batch.Close() }
+
+// Nombre de la plantilla y patrón de índices que cubre
+func (s *elasticSink) templateName() (string, string) {
+	prefix, _, _ := strings.Cut(s.index, "{date}")
+	return strings.TrimRight(prefix, "-_.") + "-template", prefix + "*"
+}
+
+// Instala (o actualiza) la plantilla de índice; sirve además de comprobación
+// de conexión y credenciales
+func (s *elasticSink) Check() error {
+	if !s.Template {
+		return nil
+	}
+	var tmpl map[string]any
+	if err := json.Unmarshal(elasticTemplate, &tmpl); err != nil {
+		return err
+	}
+	name, pattern := s.templateName()
+	body, err := json.Marshal(map[string]any{
+		"index_patterns": []string{pattern},
+		"priority":       200,
+		"template":       tmpl,
+		"_meta":          map[string]any{"managed_by": "gctwatch", "schema_version": MatchEventSchemaVersion},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := s.request(context.Background(), http.MethodPut, "/_index_template/"+url.PathEscape(name), "application/json", body)
+	if err != nil {
+		return err
+	}
+	if err := doPush(s.client, req); err != nil {
+		return fmt.Errorf("failed to install Elasticsearch index template: %w", err)
+	}
+	return nil
+}
+
+func (s *elasticSink) Write(ctx context.Context, ev MatchEvent) error {
+	if ev.Kind != EventKindMatch {
+		return nil
+	}
+	doc, err := json.Marshal(elasticDoc{Timestamp: ev.Timestamp, Domain: eventDomain(ev), MatchEvent: ev})
+	if err != nil {
+		return err
+	}
+	index := strings.ReplaceAll(s.index, "{date}", ev.Timestamp.UTC().Format("2006.01.02"))
+	return s.batch.Add(ctx, elasticItem{id: ev.Tag + ":" + ev.Certificate.FingerprintSHA256, index: index, doc: doc})
+}
+
+func (s *elasticSink) request(ctx context.Context, method, path, contentType string, body []byte) (*http.Request, error) {
+	body, encoding, err := compressBody(s.compression, body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.base.String()+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	switch {
+	case s.apiKey != "":
+		req.Header.Set("Authorization", "ApiKey "+s.apiKey)
+	case s.user != "":
+		req.SetBasicAuth(s.user, s.pass)
+	}
+	return req, nil
+}
+
+type elasticBulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+func (s *elasticSink) bulk(ctx context.Context, items []elasticItem) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, it := range items {
+		enc.Encode(map[string]any{"index": map[string]string{"_index": it.index, "_id": it.id}})
+		buf.Write(it.doc)
+		buf.WriteByte('\n')
+	}
+	req, err := s.request(ctx, http.MethodPost, "/_bulk", "application/x-ndjson", buf.Bytes())
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("HTTP %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	var out elasticBulkResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<20)).Decode(&out); err != nil {
+		return fmt.Errorf("invalid bulk response: %w", err)
+	}
+	if !out.Errors {
+		return nil
+	}
+	// Con 429 se reenvía el lote entero (el _id evita duplicados); el resto de
+	// errores son del propio documento y no se reintentan
+	failed, first := 0, ""
+	for _, item := range out.Items {
+		for _, r := range item {
+			if r.Status == http.StatusTooManyRequests {
+				return fmt.Errorf("bulk request throttled: %s", r.Error.Reason)
+			}
+			if r.Status/100 != 2 {
+				if failed++; first == "" {
+					first = r.Error.Type + ": " + r.Error.Reason
+				}
+			}
+		}
+	}
+	return fmt.Errorf("%w: %d of %d documents not indexed (%s)", errBatchRejected, failed, len(items), first)
+}
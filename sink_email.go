@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+)
+
+/* Alertas por correo (SMTP), inmediatas o en resumen periódico */
+
+const (
+	smtpTimeout     = 30 * time.Second
+	maxDigestEvents = 1000 // por correo; un resumen mayor se parte
+)
+
+// Plantillas por defecto. Los datos son emailData; cada evento es el mapa de
+// flattenEvent, igual que en las plantillas de webhook. Los textos pasan por
+// t y label para salir en el idioma del sink (ver templateFuncs).
+const (
+	defaultEmailSubject = `[gCTWatch] {{if .Digest}}{{.Count}} {{t "matches"}}{{range .Groups}} · {{.Tag}} ({{len .Events}}){{end}}{{else}}{{with index .Events 0}}[{{.tag}}] {{.domain}}{{end}}{{end}}`
+	defaultEmailBody    = `{{if .Digest}}{{printf (t "%d matches from %s to %s.") .Count (.Since.Format "2006-01-02 15:04") (.Until.Format "2006-01-02 15:04 MST")}}
+{{end}}{{range .Groups}}
+== {{.Tag}} ({{len .Events}})
+{{range .Events}}
+{{.domain}}
+  {{label "Names"}}{{.dns_names}}
+  {{label "Issuer"}}{{.issuer}}
+{{if .not_before}}  {{label "Valid"}}{{.not_before}} - {{.not_after}}
+{{end}}  {{label "Fingerprint"}}{{.fingerprint_sha256}}
+  {{label "Log"}}{{.log_url}} #{{.index}}
+{{with .link}}  {{label "crt.sh"}}{{.}}
+{{end}}{{end}}{{end}}`
+)
+
+type emailGroup struct {
+	Tag    string
+	Events []map[string]any
+}
+
+type emailData struct {
+	Digest       bool
+	Count        int
+	Since, Until time.Time
+	Events       []map[string]any // en orden de detección
+	Groups       []emailGroup     // por tag, de más a menos eventos
+}
+
+func newEmailData(evs []MatchEvent, digest bool) emailData {
+	d := emailData{Digest: digest, Count: len(evs), Since: evs[0].Timestamp, Until: evs[len(evs)-1].Timestamp}
+	byTag := make(map[string]int)
+	for _, ev := range evs {
+		flat := flattenEvent(ev)
+		d.Events = append(d.Events, flat)
+		i, ok := byTag[ev.Tag]
+		if !ok {
+			i = len(d.Groups)
+			byTag[ev.Tag] = i
+			d.Groups = append(d.Groups, emailGroup{Tag: ev.Tag})
+		}
+		d.Groups[i].Events = append(d.Groups[i].Events, flat)
+	}
+	slices.SortStableFunc(d.Groups, func(a, b emailGroup) int {
+		return cmp.Or(cmp.Compare(len(b.Events), len(a.Events)), cmp.Compare(a.Tag, b.Tag))
+	})
+	return d
+}
+
+// Configuración del sink de correo a partir de los flags
+type EmailConfig struct {
+	Addr         string // host[:puerto]
+	TLS          string // starttls (por defecto), tls (implícito) o none
+	CAFile       string
+	User         string
+	PasswordFile string
+	From         string
+	To           []string
+	Subject      string        // plantilla text/template; vacío = por defecto
+	BodyFile     string        // fichero text/template; vacío = por defecto
+	Digest       time.Duration // 0 = un correo por coincidencia
+}
+
+// Envía las coincidencias por SMTP: una por correo o, con Digest, un resumen
+// agrupado por tag en cada intervalo. Cada envío abre su propia conexión.
+type emailSink struct {
+	addr, host    string
+	mode          string
+	tls           *tls.Config
+	auth          smtp.Auth
+	from          string
+	to            []string
+	subject, body *template.Template
+	locale        Locale
+	network       *Network
+	batch         *batcher[MatchEvent] // nil en modo inmediato
+}
+
+func NewEmailSink(cfg EmailConfig, network *Network) (*emailSink, error) {
+	s := &emailSink{mode: cfg.TLS, locale: defaultLocale, network: network}
+	if s.mode == "" {
+		s.mode = "starttls"
+	}
+	port := map[string]string{"starttls": "587", "tls": "465", "none": "25"}[s.mode]
+	if port == "" {
+		return nil, fmt.Errorf("unknown SMTP TLS mode %q (starttls, tls, none)", cfg.TLS)
+	}
+	host, p, err := net.SplitHostPort(cfg.Addr)
+	if err != nil {
+		host, p = cfg.Addr, port
+	}
+	if host == "" {
+		return nil, fmt.Errorf("invalid SMTP address %q", cfg.Addr)
+	}
+	s.host, s.addr = host, net.JoinHostPort(host, p)
+	if s.mode != "none" {
+		s.tls = &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+		if cfg.CAFile != "" {
+			pem, err := os.ReadFile(cfg.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read SMTP CA: %w", err)
+			}
+			s.tls.RootCAs = x509.NewCertPool()
+			if !s.tls.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates in SMTP CA %s", cfg.CAFile)
+			}
+		}
+	}
+	if cfg.User != "" {
+		password, err := os.ReadFile(cfg.PasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SMTP password: %w", err)
+		}
+		// PlainAuth se niega a enviar la contraseña sin TLS salvo a localhost
+		s.auth = smtp.PlainAuth("", cfg.User, strings.TrimSpace(string(password)), host)
+	}
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP sender %q: %w", cfg.From, err)
+	}
+	s.from = from.Address
+	if len(cfg.To) == 0 {
+		return nil, fmt.Errorf("at least one SMTP recipient is required")
+	}
+	for _, to := range cfg.To {
+		a, err := mail.ParseAddress(to)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SMTP recipient %q: %w", to, err)
+		}
+		s.to = append(s.to, a.Address)
+	}
+	subject := cmp.Or(cfg.Subject, defaultEmailSubject)
+	if s.subject, err = template.New("subject").Funcs(s.locale.templateFuncs()).Option("missingkey=zero").Parse(subject); err != nil {
+		return nil, fmt.Errorf("invalid email subject template: %w", err)
+	}
+	body := defaultEmailBody
+	if cfg.BodyFile != "" {
+		data, err := os.ReadFile(cfg.BodyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read email body template: %w", err)
+		}
+		body = string(data)
+	}
+	if s.body, err = template.New("body").Funcs(s.locale.templateFuncs()).Option("missingkey=zero").Parse(body); err != nil {
+		return nil, fmt.Errorf("invalid email body template: %w", err)
+	}
+	if cfg.Digest > 0 {
+		s.batch = newBatcher(maxDigestEvents, cfg.Digest, func(ctx context.Context, evs []MatchEvent) error {
+			return s.send(ctx, newEmailData(evs, true))
+		})
+	}
+	return s, nil
+}
+
+func (s *emailSink) Name() string { return "email:" + s.addr }
+
+// Se llama al configurar, antes del primer envío
+func (s *emailSink) SetLocale(l Locale) {
+	s.locale = l
+	s.subject.Funcs(l.templateFuncs())
+	s.body.Funcs(l.templateFuncs())
+}
+
+func (s *emailSink) Close() error {
+	if s.batch != nil {
+		return s.batch.Close()
+	}
+	return nil
+}
+
+func (s *emailSink) Write(ctx context.Context, ev MatchEvent) error {
+	if ev.Kind != EventKindMatch {
+		return nil
+	}
+	if s.batch != nil {
+		return s.batch.Add(ctx, ev)
+	}
+	return s.send(ctx, newEmailData([]MatchEvent{ev}, false))
+}
+
+// Comprueba la conexión, el TLS y la autenticación sin enviar nada
+func (s *emailSink) Check() error {
+	c, err := s.dial(context.Background())
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return c.Quit()
+}
+
+func (s *emailSink) dial(ctx context.Context) (*smtp.Client, error) {
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+	conn, err := s.network.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SMTP %s: %w", s.addr, err)
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	if s.mode == "tls" {
+		tc := tls.Client(conn, s.tls)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("TLS handshake with SMTP %s failed: %w", s.addr, err)
+		}
+		conn = tc
+	}
+	c, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to greet SMTP %s: %w", s.addr, err)
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		c.Hello(hostname)
+	}
+	if s.mode == "starttls" {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			c.Close()
+			return nil, fmt.Errorf("SMTP %s does not support STARTTLS (use -smtp-tls none for a local relay)", s.addr)
+		}
+		if err := c.StartTLS(s.tls); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("STARTTLS with SMTP %s failed: %w", s.addr, err)
+		}
+	}
+	if s.auth != nil {
+		if err := c.Auth(s.auth); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+	return c, nil
+}
+
+func (s *emailSink) render(d emailData) ([]byte, error) {
+	var subject, body bytes.Buffer
+	if err := s.subject.Execute(&subject, d); err != nil {
+		return nil, fmt.Errorf("failed to render email subject: %w", err)
+	}
+	if err := s.body.Execute(&body, d); err != nil {
+		return nil, fmt.Errorf("failed to render email body: %w", err)
+	}
+	id := make([]byte, 12)
+	rand.Read(id)
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(s.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", strings.Join(strings.Fields(subject.String()), " ")))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), s.host)
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp := quotedprintable.NewWriter(&msg)
+	qp.Write(bytes.ReplaceAll(body.Bytes(), []byte("\n"), []byte("\r\n")))
+	qp.Close()
+	return msg.Bytes(), nil
+}
+
+func (s *emailSink) send(ctx context.Context, d emailData) error {
+	msg, err := s.render(d)
+	if err != nil {
+		return err
+	}
+	c, err := s.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if err := c.Mail(s.from); err != nil {
+		return fmt.Errorf("SMTP sender rejected: %w", err)
+	}
+	for _, to := range s.to {
+		if err := c.Rcpt(to); err != nil {
+			return fmt.Errorf("SMTP recipient %s rejected: %w", to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return c.Quit()
+}
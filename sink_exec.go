@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+/* Comando externo por coincidencia */
+
+const (
+	defaultExecTimeout = 30 * time.Second
+	execWaitDelay      = 5 * time.Second // tras matarlo, para que los hijos suelten la salida
+	execOutput         = 4 << 10         // salida que se guarda para el error
+)
+
+var metricExecDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "gctwatch_exec_duration_seconds",
+	Help:    "Duración del comando de -exec por resultado (ok, error, timeout).",
+	Buckets: prometheus.ExponentialBuckets(0.01, 4, 8),
+}, []string{"result"})
+
+// Ejecuta el comando con sh -c por cada coincidencia, con el evento en JSON
+// por la entrada estándar, para enganchar scripts de respuesta existentes.
+// Se ejecutan tantos a la vez como workers tenga el sink (-sink-concurrency
+// exec=N); si un comando tarda más de timeout se mata y cuenta como error.
+type execSink struct {
+	command string
+	timeout time.Duration
+}
+
+func NewExecSink(command string, timeout time.Duration) (*execSink, error) {
+	if strings.TrimSpace(command) == "" {
+		return nil, fmt.Errorf("empty exec command")
+	}
+	if timeout <= 0 {
+		timeout = defaultExecTimeout
+	}
+	return &execSink{command: command, timeout: timeout}, nil
+}
+
+// exec:<programa>, sin los argumentos (pueden llevar secretos)
+func (s *execSink) Name() string {
+	return "exec:" + filepath.Base(strings.Fields(s.command)[0])
+}
+
+func (s *execSink) Close() error { return nil }
+
+func (s *execSink) Write(ctx context.Context, ev MatchEvent) error {
+	if ev.Kind != EventKindMatch {
+		return nil
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", s.command)
+	cmd.WaitDelay = execWaitDelay
+	setProcessGroup(cmd)
+	cmd.Stdin = bytes.NewReader(append(data, '\n'))
+	cmd.Env = append(os.Environ(),
+		"GCTWATCH_TAG="+ev.Tag,
+		"GCTWATCH_TAGS="+strings.Join(ev.AllTags(), ","),
+		"GCTWATCH_MATCHED_NAME="+ev.MatchedName,
+		"GCTWATCH_DOMAIN="+eventDomain(ev),
+		"GCTWATCH_LOG="+ev.Log.URL,
+		"GCTWATCH_INDEX="+strconv.FormatInt(ev.Index, 10),
+		"GCTWATCH_FINGERPRINT="+ev.Certificate.FingerprintSHA256,
+	)
+	out := &limitedBuffer{max: execOutput}
+	cmd.Stdout, cmd.Stderr = out, out
+	t0 := time.Now()
+	err = cmd.Run()
+	result := "ok"
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		result, err = "timeout", fmt.Errorf("command timed out after %s", s.timeout)
+	case err != nil:
+		result = "error"
+		if msg := bytes.TrimSpace(out.Bytes()); len(msg) > 0 {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+	}
+	metricExecDuration.WithLabelValues(result).Observe(time.Since(t0).Seconds())
+	return err
+}
+
+// Guarda los primeros max bytes y descarta el resto sin fallar, para que el
+// comando no se bloquee escribiendo
+type limitedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if n := b.max - b.Len(); n > 0 {
+		b.Buffer.Write(p[:min(n, len(p))])
+	}
+	return len(p), nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+/* Publicación en un broker MQTT */
+
+const (
+	defaultMQTTTopic = "gctwatch/{kind}/{tag}"
+	mqttTimeout      = 10 * time.Second
+)
+
+// Publica cada evento en un topic por tag con la QoS indicada. Con QoS 1 o 2
+// se espera la confirmación del broker; con 0 basta con escribirlo en la
+// conexión. El cliente se reconecta solo si el broker cae.
+type mqttSink struct {
+	name   string
+	topic  string // con {kind} y {tag}
+	qos    byte
+	client mqtt.Client
+	enc    Encoder
+}
+
+func NewMQTTSink(broker, topic string, qos int, user, passwordFile, caFile, clientID string, enc Encoder, network *Network) (*mqttSink, error) {
+	u, err := url.Parse(broker)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid MQTT broker %q (mqtt://host:1883, mqtts://host:8883)", broker)
+	}
+	if qos < 0 || qos > 2 {
+		return nil, fmt.Errorf("invalid MQTT QoS %d (0, 1, 2)", qos)
+	}
+	if strings.ContainsAny(strings.NewReplacer("{kind}", "", "{tag}", "").Replace(topic), "+#") {
+		return nil, fmt.Errorf("invalid MQTT topic %q: wildcards are not allowed", topic)
+	}
+	port := u.Port()
+	var tlsConfig *tls.Config
+	switch u.Scheme {
+	case "mqtt", "tcp":
+		if port == "" {
+			port = "1883"
+		}
+	case "mqtts", "ssl", "tls":
+		if port == "" {
+			port = "8883"
+		}
+		tlsConfig = &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+		if caFile != "" {
+			pem, err := os.ReadFile(caFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read MQTT CA: %w", err)
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates in MQTT CA %s", caFile)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown MQTT scheme %q (mqtt, mqtts)", u.Scheme)
+	}
+	if err := network.Policy.Check(u.Hostname()); err != nil {
+		return nil, err
+	}
+	addr := net.JoinHostPort(u.Hostname(), port)
+
+	opts := mqtt.NewClientOptions().
+		AddBroker("tcp://" + addr).
+		SetClientID(clientID).
+		SetCleanSession(true).
+		SetConnectTimeout(mqttTimeout).
+		SetWriteTimeout(mqttTimeout).
+		SetAutoReconnect(true).
+		SetMaxReconnectInterval(time.Minute).
+		// Conexiones por el dialer controlado (política de red, familia IP)
+		SetCustomOpenConnectionFn(func(*url.URL, mqtt.ClientOptions) (net.Conn, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), mqttTimeout)
+			defer cancel()
+			conn, err := network.DialContext(ctx, "tcp", addr)
+			if err != nil || tlsConfig == nil {
+				return conn, err
+			}
+			tc := tls.Client(conn, tlsConfig)
+			if err := tc.HandshakeContext(ctx); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return tc, nil
+		})
+	if user != "" {
+		password, err := os.ReadFile(passwordFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read MQTT password: %w", err)
+		}
+		opts.SetUsername(user).SetPassword(strings.TrimSpace(string(password)))
+	}
+	s := &mqttSink{name: "mqtt:" + addr, topic: topic, qos: byte(qos), client: mqtt.NewClient(opts), enc: enc}
+	token := s.client.Connect()
+	if !token.WaitTimeout(mqttTimeout) {
+		s.client.Disconnect(0)
+		return nil, fmt.Errorf("failed to connect to MQTT %s: timeout", addr)
+	}
+	if err := token.Error(); err != nil {
+		return nil, fmt.Errorf("failed to connect to MQTT %s: %w", addr, err)
+	}
+	return s, nil
+}
+
+func (s *mqttSink) Name() string { return s.name }
+
+func (s *mqttSink) Close() error {
+	s.client.Disconnect(uint(mqttTimeout / time.Millisecond))
+	return nil
+}
+
+func (s *mqttSink) Check() error {
+	if !s.client.IsConnectionOpen() {
+		return fmt.Errorf("not connected to %s", s.name)
+	}
+	return nil
+}
+
+// Un nivel de topic no puede tener '/' ni comodines
+var mqttLevelEscaper = strings.NewReplacer("/", "_", "+", "_", "#", "_")
+
+func (s *mqttSink) topicFor(ev MatchEvent) string {
+	tag := mqttLevelEscaper.Replace(ev.Tag)
+	if tag == "" {
+		tag = "_"
+	}
+	return strings.NewReplacer("{kind}", ev.Kind, "{tag}", tag).Replace(s.topic)
+}
+
+func (s *mqttSink) Write(ctx context.Context, ev MatchEvent) error {
+	data, err := s.enc.Encode(ev)
+	if err != nil {
+		return err
+	}
+	topic := s.topicFor(ev)
+	token := s.client.Publish(topic, s.qos, false, data)
+	select {
+	case <-token.Done():
+	case <-ctx.Done():
+		return fmt.Errorf("failed to publish to MQTT %s: %w", topic, ctx.Err())
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("failed to publish to MQTT %s: %w", topic, err)
+	}
+	return nil
+}
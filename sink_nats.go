@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+/* Publicación en NATS JetStream */
+
+const (
+	defaultNATSSubject  = "gctwatch.{kind}.{tag}"
+	defaultNATSStream   = "GCTWATCH"
+	natsPublishAttempts = 5
+	natsTimeout         = 10 * time.Second
+)
+
+// Conexiones de nats.go por el dialer controlado (política de red, familia IP)
+type natsDialer struct{ network *Network }
+
+func (d natsDialer) Dial(network, addr string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), natsTimeout)
+	defer cancel()
+	return d.network.DialContext(ctx, network, addr)
+}
+
+// Publica cada evento en un subject de JetStream y espera la confirmación
+// del stream. Los reintentos llevan el mismo Nats-Msg-Id, así que la ventana
+// de deduplicación del stream descarta los duplicados: entrega al menos una
+// vez y, dentro de la ventana, exactamente una.
+type natsSink struct {
+	name    string
+	subject string // con {kind} y {tag}
+	stream  string
+	nc      *nats.Conn
+	js      jetstream.JetStream
+	enc     Encoder
+}
+
+func NewNATSSink(servers, subject, stream, credsFile, caFile string, enc Encoder, network *Network) (*natsSink, error) {
+	for _, s := range strings.Split(servers, ",") {
+		u, err := url.Parse(strings.TrimSpace(s))
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid NATS server %q (nats://host:4222, tls://host:4222)", s)
+		}
+		if err := network.Policy.Check(u.Hostname()); err != nil {
+			return nil, err
+		}
+	}
+	if strings.ContainsAny(stream, ". *>") {
+		return nil, fmt.Errorf("invalid NATS stream name %q", stream)
+	}
+	opts := []nats.Option{
+		nats.Name("gctwatch"),
+		nats.SetCustomDialer(natsDialer{network}),
+		nats.Timeout(natsTimeout),
+		nats.MaxReconnects(-1),
+	}
+	if credsFile != "" {
+		opts = append(opts, nats.UserCredentials(credsFile))
+	}
+	if caFile != "" {
+		opts = append(opts, nats.RootCAs(caFile))
+	}
+	nc, err := nats.Connect(servers, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS %s: %w", servers, err)
+	}
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("failed to open JetStream: %w", err)
+	}
+	return &natsSink{name: "nats:" + stream, subject: subject, stream: stream, nc: nc, js: js, enc: enc}, nil
+}
+
+func (s *natsSink) Name() string { return s.name }
+
+func (s *natsSink) Close() error {
+	s.nc.Close()
+	return nil
+}
+
+// Comprueba que existe el stream; si no, lo crea con los subjects de la
+// plantilla (cada {kind} o {tag} es un comodín)
+func (s *natsSink) Check() error {
+	ctx, cancel := context.WithTimeout(context.Background(), natsTimeout)
+	defer cancel()
+	_, err := s.js.Stream(ctx, s.stream)
+	if errors.Is(err, jetstream.ErrStreamNotFound) {
+		wildcard := strings.NewReplacer("{kind}", "*", "{tag}", "*").Replace(s.subject)
+		_, err = s.js.CreateStream(ctx, jetstream.StreamConfig{Name: s.stream, Subjects: []string{wildcard}})
+		if err == nil {
+			log.Printf("created NATS stream %s for %s", s.stream, wildcard)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("NATS stream %s: %w", s.stream, err)
+	}
+	return nil
+}
+
+// Un token de subject no puede tener '.', espacios ni comodines
+var natsTokenEscaper = strings.NewReplacer(".", "_", " ", "_", "*", "_", ">", "_", "\t", "_")
+
+func (s *natsSink) subjectFor(ev MatchEvent) string {
+	tag := natsTokenEscaper.Replace(ev.Tag)
+	if tag == "" {
+		tag = "_"
+	}
+	return strings.NewReplacer("{kind}", ev.Kind, "{tag}", tag).Replace(s.subject)
+}
+
+// ID de deduplicación (NATS, colas FIFO): estable para una coincidencia (log,
+// índice y tag), de modo que también se descarta si la entrada se reprocesa
+// tras un reinicio
+func eventMsgID(ev MatchEvent) string {
+	if ev.Kind != EventKindMatch && ev.Kind != EventKindShadow {
+		return rand.Text()
+	}
+	h := cryptoProvider.Hash([]byte(ev.Kind + "\x00" + ev.Log.URL + "\x00" + strconv.FormatInt(ev.Index, 10) + "\x00" + ev.Tag))
+	return hex.EncodeToString(h[:16])
+}
+
+func (s *natsSink) Write(ctx context.Context, ev MatchEvent) error {
+	data, err := s.enc.Encode(ev)
+	if err != nil {
+		return err
+	}
+	msg := nats.NewMsg(s.subjectFor(ev))
+	msg.Data = data
+	msg.Header.Set("Content-Type", s.enc.ContentType())
+	msg.Header.Set("Gctwatch-Kind", ev.Kind)
+	msg.Header.Set("Gctwatch-Tag", ev.Tag)
+	id := eventMsgID(ev)
+	backoff := 500 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		pctx, cancel := context.WithTimeout(ctx, natsTimeout)
+		_, err = s.js.PublishMsg(pctx, msg, jetstream.WithMsgID(id), jetstream.WithExpectStream(s.stream))
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if attempt == natsPublishAttempts {
+			return fmt.Errorf("failed to publish to NATS %s: %w", msg.Subject, err)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to publish to NATS %s: %w", msg.Subject, err)
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
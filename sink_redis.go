@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+/* Salida a Redis: pub/sub y streams */
+
+const defaultRedisStreamMaxLen = 100000
+
+// Publica cada evento con PUBLISH en un canal y/o lo añade con XADD a un
+// stream. Pub/sub no guarda nada (solo lo reciben los suscriptores
+// conectados); el stream conserva los últimos maxLen eventos (recorte
+// aproximado) para que los consumidores puedan seguirlo con XREAD o grupos.
+type redisSink struct {
+	client  *redis.Client
+	addr    string
+	channel string // con {kind} y {tag}; vacío = sin PUBLISH
+	stream  string // vacío = sin XADD
+	maxLen  int64
+	enc     Encoder
+}
+
+func NewRedisSink(url, channel, stream string, maxLen int64, enc Encoder, network *Network) (*redisSink, error) {
+	if channel == "" && stream == "" {
+		return nil, fmt.Errorf("redis sink needs a channel or a stream")
+	}
+	client, err := newRedisClient(url, network)
+	if err != nil {
+		return nil, err
+	}
+	return &redisSink{client: client, addr: client.Options().Addr, channel: channel, stream: stream, maxLen: maxLen, enc: enc}, nil
+}
+
+func (s *redisSink) Name() string { return "redis:" + s.addr }
+func (s *redisSink) Close() error { return s.client.Close() }
+
+func (s *redisSink) Check() error {
+	return s.client.Ping(context.Background()).Err()
+}
+
+func (s *redisSink) Write(ctx context.Context, ev MatchEvent) error {
+	data, err := s.enc.Encode(ev)
+	if err != nil {
+		return err
+	}
+	if s.stream != "" {
+		err := s.client.XAdd(ctx, &redis.XAddArgs{
+			Stream: s.stream,
+			MaxLen: s.maxLen,
+			Approx: true,
+			Values: []any{"kind", ev.Kind, "tag", ev.Tag, "content_type", s.enc.ContentType(), "data", data},
+		}).Err()
+		if err != nil {
+			return fmt.Errorf("failed to add to redis stream %s: %w", s.stream, err)
+		}
+	}
+	if s.channel != "" {
+		channel := strings.NewReplacer("{kind}", ev.Kind, "{tag}", ev.Tag).Replace(s.channel)
+		if err := s.client.Publish(ctx, channel, data).Err(); err != nil {
+			return fmt.Errorf("failed to publish to redis channel %s: %w", channel, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+/* Sinks tabulares: Google Sheets y CSV por HTTP */
+
+// Columnas de cada fila
+var matchRowHeader = []string{
+	"timestamp", "tag", "domain", "dns_names", "issuer", "not_before", "not_after",
+	"serial", "fingerprint_sha256", "log", "index", "crtsh",
+}
+
+func matchRow(ev MatchEvent) []string {
+	c := ev.Certificate
+	crtsh := ""
+	if ev.Enrichment != nil && ev.Enrichment.CrtSh != nil {
+		crtsh = ev.Enrichment.CrtSh.URL
+	}
+	return []string{
+		ev.Timestamp.Format(time.RFC3339), ev.Tag, eventDomain(ev), strings.Join(c.DNSNames, " "), c.Issuer,
+		c.NotBefore.Format(time.RFC3339), c.NotAfter.Format(time.RFC3339),
+		c.SerialNumber, c.FingerprintSHA256, ev.Log.URL, strconv.FormatInt(ev.Index, 10), crtsh,
+	}
+}
+
+// Acumula elementos y los envía por lotes (cada BatchSize o cada Interval).
+// Un fallo del envío periódico se devuelve en la siguiente escritura para que
+// el dispatcher lo refleje en el estado del sink; los elementos se conservan
+// hasta maxPendingBatches lotes, salvo si el destino los rechaza
+// (errBatchRejected), porque reenviarlos no cambiaría el resultado.
+type batcher[T any] struct {
+	BatchSize int
+	Interval  time.Duration
+	flush     func(ctx context.Context, rows []T) error
+
+	mu      sync.Mutex
+	rows    []T
+	lastErr error
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+const maxPendingBatches = 20
+
+var errBatchRejected = errors.New("batch rejected")
+
+func newBatcher[T any](size int, interval time.Duration, flush func(context.Context, []T) error) *batcher[T] {
+	b := &batcher[T]{BatchSize: max(size, 1), Interval: interval, flush: flush, stop: make(chan struct{}), done: make(chan struct{})}
+	go b.loop()
+	return b
+}
+
+func (b *batcher[T]) loop() {
+	defer close(b.done)
+	if b.Interval <= 0 {
+		<-b.stop
+		return
+	}
+	ticker := time.NewTicker(b.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+			b.mu.Lock()
+			b.lastErr = b.flushLocked(context.Background())
+			b.mu.Unlock()
+		}
+	}
+}
+
+func (b *batcher[T]) flushLocked(ctx context.Context) error {
+	if len(b.rows) == 0 {
+		return nil
+	}
+	err := b.flush(ctx, b.rows)
+	if errors.Is(err, errBatchRejected) {
+		b.rows = nil
+		return err
+	}
+	if err != nil {
+		if limit := maxPendingBatches * b.BatchSize; len(b.rows) > limit {
+			log.Printf("WARNING: dropping %d pending rows", len(b.rows)-limit)
+			b.rows = b.rows[len(b.rows)-limit:]
+		}
+		return err
+	}
+	b.rows = nil
+	return nil
+}
+
+func (b *batcher[T]) Add(ctx context.Context, row T) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rows = append(b.rows, row)
+	err := b.lastErr
+	b.lastErr = nil
+	if len(b.rows) >= b.BatchSize {
+		err = b.flushLocked(ctx)
+	}
+	return err
+}
+
+func (b *batcher[T]) Close() error {
+	close(b.stop)
+	<-b.done
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.flushLocked(context.Background())
+}
+
+// Añade filas a una hoja de Google Sheets con una cuenta de servicio
+type sheetSink struct {
+	id, rng string
+	client  *http.Client
+	batch   *batcher[[]string]
+}
+
+func NewSheetSink(spreadsheetID, rng, credentialsFile string, base *http.Client, size int, interval time.Duration) (*sheetSink, error) {
+	data, err := os.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account credentials: %w", err)
+	}
+	conf, err := google.JWTConfigFromJSON(data, "https://www.googleapis.com/auth/spreadsheets")
+	if err != nil {
+		return nil, fmt.Errorf("invalid service account credentials: %w", err)
+	}
+	// Token y peticiones por el cliente de red controlado
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, base)
+	s := &sheetSink{id: spreadsheetID, rng: rng, client: conf.Client(ctx)}
+	s.batch = newBatcher(size, interval, s.append)
+	return s, nil
+}
+
+func (s *sheetSink) Name() string { return "sheets:" + s.id }
+func (s *sheetSink) Close() error { return s.batch.Close() }
+
+func (s *sheetSink) Write(ctx context.Context, ev MatchEvent) error {
+	if ev.Kind != EventKindMatch {
+		return nil
+	}
+	return s.batch.Add(ctx, matchRow(ev))
+}
+
+func (s *sheetSink) append(ctx context.Context, rows [][]string) error {
+	u := fmt.Sprintf("https://sheets.googleapis.com/v4/spreadsheets/%s/values/%s:append?valueInputOption=RAW&insertDataOption=INSERT_ROWS",
+		url.PathEscape(s.id), url.PathEscape(s.rng))
+	body, err := json.Marshal(map[string]any{"values": rows})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doPush(s.client, req)
+}
+
+// POST de bloques CSV (con cabecera) a un endpoint
+type csvPushSink struct {
+	url    string
+	client *http.Client
+	batch  *batcher[[]string]
+}
+
+func NewCSVPushSink(endpoint string, client *http.Client, size int, interval time.Duration) *csvPushSink {
+	s := &csvPushSink{url: endpoint, client: client}
+	s.batch = newBatcher(size, interval, s.push)
+	return s
+}
+
+func (s *csvPushSink) Name() string { return "csv:" + s.url }
+func (s *csvPushSink) Close() error { return s.batch.Close() }
+
+func (s *csvPushSink) Write(ctx context.Context, ev MatchEvent) error {
+	if ev.Kind != EventKindMatch {
+		return nil
+	}
+	return s.batch.Add(ctx, matchRow(ev))
+}
+
+func (s *csvPushSink) push(ctx context.Context, rows [][]string) error {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(matchRowHeader)
+	w.WriteAll(rows)
+	if err := w.Error(); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/csv; charset=utf-8")
+	return doPush(s.client, req)
+}
+
+// Envía la petición y trata cualquier respuesta no 2xx como error
+func doPush(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("HTTP %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	return nil
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* Syslog (RFC 5424) y CEF para SIEM */
+
+// Facilities por nombre (RFC 5424, 6.2.1)
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "daemon": 3, "auth": 4, "syslog": 5, "authpriv": 10,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// Severidades syslog
+const (
+	syslogCritical = 2
+	syslogError    = 3
+	syslogWarning  = 4
+	syslogInfo     = 6
+)
+
+// SD-ID de los datos estructurados. 32473 es el número de empresa reservado
+// para ejemplos (RFC 5612); no hay uno registrado para gCTWatch.
+const syslogSDID = "gctwatch@32473"
+
+const syslogWriteTimeout = 10 * time.Second
+
+// Envía cada evento como un mensaje syslog RFC 5424 por UDP, TCP o TLS. Con
+// formato "cef" el mensaje es una línea CEF (ArcSight, QRadar...); con
+// "rfc5424" lleva los campos principales como datos estructurados y el evento
+// JSON como mensaje. En TCP y TLS la conexión se mantiene y se reabre si falla.
+type syslogSink struct {
+	scheme, addr, host string
+	format             string
+	facility           int
+	octetCounting      bool // RFC 6587 3.4.1; si no, un mensaje por línea
+	tls                *tls.Config
+	network            *Network
+	hostname, procID   string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	closed chan struct{} // se cierra cuando el receptor cierra la conexión
+}
+
+func NewSyslogSink(addr, format, facility, framing, caFile string, network *Network) (*syslogSink, error) {
+	u, err := url.Parse(addr)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid syslog address %q (udp://host:514, tcp://host:514, tls://host:6514)", addr)
+	}
+	s := &syslogSink{scheme: u.Scheme, host: u.Hostname(), format: format, network: network, procID: strconv.Itoa(os.Getpid())}
+	port := u.Port()
+	switch u.Scheme {
+	case "udp", "tcp":
+		if port == "" {
+			port = "514"
+		}
+	case "tls":
+		if port == "" {
+			port = "6514"
+		}
+		s.tls = &tls.Config{ServerName: s.host, MinVersion: tls.VersionTLS12}
+		if caFile != "" {
+			pem, err := os.ReadFile(caFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read syslog CA: %w", err)
+			}
+			s.tls.RootCAs = x509.NewCertPool()
+			if !s.tls.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates in syslog CA %s", caFile)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown syslog transport %q (udp, tcp, tls)", u.Scheme)
+	}
+	s.addr = net.JoinHostPort(s.host, port)
+	if format != "cef" && format != "rfc5424" {
+		return nil, fmt.Errorf("unknown syslog format %q (cef, rfc5424)", format)
+	}
+	var ok bool
+	if s.facility, ok = syslogFacilities[facility]; !ok {
+		return nil, fmt.Errorf("unknown syslog facility %q", facility)
+	}
+	switch framing {
+	case "octet":
+		s.octetCounting = true
+	case "lf":
+	default:
+		return nil, fmt.Errorf("unknown syslog framing %q (octet, lf)", framing)
+	}
+	hostname, _ := os.Hostname()
+	s.hostname = syslogHeaderField(hostname)
+	return s, nil
+}
+
+func (s *syslogSink) Name() string { return "syslog:" + s.scheme + "://" + s.addr }
+
+// Comprueba que se puede conectar (en UDP solo resuelve la dirección)
+func (s *syslogSink) Check() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connect(context.Background())
+}
+
+func (s *syslogSink) connect(ctx context.Context) error {
+	if s.conn != nil {
+		if s.scheme == "udp" || s.alive() {
+			return nil
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, syslogWriteTimeout)
+	defer cancel()
+	network := s.scheme
+	if network == "tls" {
+		network = "tcp"
+	}
+	conn, err := s.network.DialContext(ctx, network, s.addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to syslog %s: %w", s.addr, err)
+	}
+	if s.tls != nil {
+		tc := tls.Client(conn, s.tls)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return fmt.Errorf("TLS handshake with syslog %s failed: %w", s.addr, err)
+		}
+		conn = tc
+	}
+	s.conn = conn
+	if s.scheme != "udp" {
+		closed := make(chan struct{})
+		s.closed = closed
+		go func() {
+			io.Copy(io.Discard, conn)
+			close(closed)
+		}()
+	}
+	return nil
+}
+
+// El receptor no envía nada: la lectura en segundo plano solo termina cuando
+// cierra la conexión, y lo que se escribiera después se perdería
+func (s *syslogSink) alive() bool {
+	select {
+	case <-s.closed:
+		return false
+	default:
+		return true
+	}
+}
+
+func (s *syslogSink) Write(ctx context.Context, ev MatchEvent) error {
+	msg, err := s.format5424(ev)
+	if err != nil {
+		return err
+	}
+	if s.scheme != "udp" {
+		if s.octetCounting {
+			msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+		} else {
+			msg = append(msg, '\n')
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Un reintento con conexión nueva: el receptor puede haber cerrado la anterior
+	for attempt := 0; ; attempt++ {
+		if err = s.connect(ctx); err == nil {
+			s.conn.SetWriteDeadline(time.Now().Add(syslogWriteTimeout))
+			if _, err = s.conn.Write(msg); err == nil {
+				return nil
+			}
+			s.conn.Close()
+			s.conn = nil
+			err = fmt.Errorf("failed to send to syslog %s: %w", s.addr, err)
+		}
+		if attempt == 1 || s.scheme == "udp" {
+			return err
+		}
+	}
+}
+
+func (s *syslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG
+func (s *syslogSink) format5424(ev MatchEvent) ([]byte, error) {
+	severity := syslogWarning
+	switch {
+	case ev.Kind == EventKindHeartbeat:
+		severity = syslogInfo
+		if ev.Heartbeat != nil && ev.Heartbeat.Status == HealthDown {
+			severity = syslogError
+		}
+	case ev.Ops != nil:
+		severity = map[string]int{"info": syslogInfo, "warning": syslogWarning, "critical": syslogCritical}[ev.Ops.Severity]
+	case ev.Rule != nil:
+		severity = map[string]int{"low": syslogInfo, "medium": syslogWarning, "high": syslogError, "critical": syslogCritical}[ev.Rule.Severity]
+	}
+	var sd, msg string
+	if s.format == "cef" {
+		sd, msg = "-", formatCEF(ev)
+	} else {
+		d, err := json.Marshal(ev)
+		if err != nil {
+			return nil, err
+		}
+		sd, msg = syslogSD(ev), string(d)
+	}
+	ts := ev.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	return fmt.Appendf(nil, "<%d>1 %s %s gctwatch %s %s %s %s", s.facility*8+severity,
+		ts.UTC().Format("2006-01-02T15:04:05.000Z07:00"), s.hostname, s.procID, syslogHeaderField(ev.Kind), sd, msg), nil
+}
+
+// [gctwatch@32473 tag="..." domain="..." ...]
+func syslogSD(ev MatchEvent) string {
+	params := [][2]string{{"kind", ev.Kind}, {"tag", ev.Tag}}
+	if op := ev.Ops; op != nil {
+		params = append(params, [2]string{"severity", op.Severity}, [2]string{"source", op.Source})
+	}
+	if ev.Kind == EventKindMatch {
+		c := ev.Certificate
+		params = append(params, [2]string{"domain", eventDomain(ev)}, [2]string{"fingerprint", c.FingerprintSHA256},
+			[2]string{"issuer", c.Issuer}, [2]string{"log", ev.Log.URL}, [2]string{"index", strconv.FormatInt(ev.Index, 10)})
+	}
+	esc := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+	var b strings.Builder
+	b.WriteString("[" + syslogSDID)
+	for _, p := range params {
+		if p[1] != "" {
+			fmt.Fprintf(&b, ` %s="%s"`, p[0], esc.Replace(p[1]))
+		}
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+// Campo de cabecera: ASCII imprimible sin espacios, "-" si está vacío
+func syslogHeaderField(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return -1
+		}
+		return r
+	}, s)
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+/* CEF */
+
+// Versión del producto en la cabecera CEF (la del módulo si se compiló con
+// go install, si no "dev")
+var cefDeviceVersion = func() string {
+	if bi, ok := debug.ReadBuildInfo(); ok && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+		return bi.Main.Version
+	}
+	return "dev"
+}()
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+)
+
+// Extensiones CEF en orden; las vacías se omiten
+type cefExtensions struct{ b strings.Builder }
+
+func (e *cefExtensions) add(key, value string) {
+	if value == "" {
+		return
+	}
+	if e.b.Len() > 0 {
+		e.b.WriteByte(' ')
+	}
+	e.b.WriteString(key + "=" + cefExtensionEscaper.Replace(value))
+}
+
+// Campo personalizado (cs1, cn1...) con su etiqueta
+func (e *cefExtensions) custom(key, label, value string) {
+	if value != "" {
+		e.add(key+"Label", label)
+		e.add(key, value)
+	}
+}
+
+func cefMillis(t time.Time) string { return strconv.FormatInt(t.UnixMilli(), 10) }
+
+// CEF:0|Chapuzas-SA|gCTWatch|versión|firma|nombre|severidad|extensiones
+// La firma es "match:<tag>" (una por regla, para correlar en el SIEM),
+// "ops:<tipo>" o "heartbeat"; severidad de 0 a 10.
+func formatCEF(ev MatchEvent) string {
+	var signature, name string
+	var severity int
+	var ext cefExtensions
+	ext.add("rt", cefMillis(ev.Timestamp))
+	switch ev.Kind {
+	case EventKindHeartbeat:
+		signature, name, severity = "heartbeat", "gCTWatch heartbeat", 1
+		if hb := ev.Heartbeat; hb != nil {
+			if hb.Status == HealthDown {
+				severity = 5
+			}
+			ext.add("dvchost", hb.Instance)
+			ext.custom("cs1", "status", hb.Status)
+			ext.custom("cn1", "matches", strconv.FormatInt(hb.Matches, 10))
+			ext.custom("cn2", "entriesProcessed", strconv.FormatInt(hb.EntriesProcessed, 10))
+			ext.custom("cn3", "uptimeSeconds", strconv.FormatInt(hb.UptimeSeconds, 10))
+		}
+	case EventKindOps:
+		if op := ev.Ops; op != nil {
+			signature, name = "ops:"+op.Type, "gCTWatch "+strings.ReplaceAll(op.Type, "_", " ")
+			severity = map[string]int{"info": 3, "warning": 6, "critical": 9}[op.Severity]
+			ext.add("msg", op.Message)
+			ext.custom("cs1", "source", op.Source)
+			ext.custom("cs2", "severity", op.Severity)
+		}
+	default:
+		c := ev.Certificate
+		signature, name, severity = "match:"+ev.Tag, "Certificate matched rule "+ev.Tag, 7
+		if ev.Rule != nil {
+			severity = map[string]int{"low": 3, "medium": 7, "high": 8, "critical": 10}[ev.Rule.Severity]
+		}
+		ext.add("cat", "certificate-transparency")
+		ext.add("dhost", eventDomain(ev))
+		ext.add("msg", c.Subject)
+		ext.custom("cs1", "rule", ev.Tag)
+		ext.custom("cs2", "fingerprintSha256", c.FingerprintSHA256)
+		ext.custom("cs3", "issuer", c.Issuer)
+		ext.custom("cs4", "ctLog", ev.Log.URL)
+		ext.custom("cs5", "dnsNames", strings.Join(c.DNSNames, ","))
+		ext.custom("cs6", "serialNumber", c.SerialNumber)
+		ext.custom("cn1", "logIndex", strconv.FormatInt(ev.Index, 10))
+		if !c.NotBefore.IsZero() {
+			ext.custom("deviceCustomDate1", "notBefore", cefMillis(c.NotBefore))
+			ext.custom("deviceCustomDate2", "notAfter", cefMillis(c.NotAfter))
+		}
+		if e := ev.Enrichment; e != nil {
+			if e.Revocation != nil {
+				ext.custom("flexString1", "revocation", e.Revocation.Status)
+			}
+			if e.Zone != nil {
+				ext.custom("flexString2", "zoneStatus", e.Zone.Status)
+			}
+			if e.CrtSh != nil {
+				ext.add("requestUrl", e.CrtSh.URL)
+			}
+		}
+	}
+	return fmt.Sprintf("CEF:0|Chapuzas-SA|gCTWatch|%s|%s|%s|%d|%s", cefHeaderEscaper.Replace(cefDeviceVersion),
+		cefHeaderEscaper.Replace(signature), cefHeaderEscaper.Replace(name), severity, ext.b.String())
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+/* Salidas de eventos */
+
+// Destino de los eventos de coincidencia
+type Sink interface {
+	Name() string
+	Write(ctx context.Context, ev MatchEvent) error
+	Close() error
+}
+
+// Salida estándar, una línea JSON por evento
+type stdoutSink struct{ mu sync.Mutex }
+
+func (s *stdoutSink) Name() string { return "stdout" }
+func (s *stdoutSink) Close() error { return nil }
+
+func (s *stdoutSink) Write(ctx context.Context, ev MatchEvent) error {
+	d, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = fmt.Println(string(d))
+	return err
+}
+
+// Fichero JSON lines, opcionalmente comprimido. Se abre en modo append:
+// tanto gzip como zstd admiten concatenar flujos.
+type fileSink struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+	w    flushWriter
+}
+
+func NewFileSink(path, compression string) (*fileSink, error) {
+	if err := checkCompression(compression); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open output file: %w", err)
+	}
+	w, err := newCompressWriter(compression, f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &fileSink{path: path, f: f, w: w}, nil
+}
+
+func (s *fileSink) Name() string { return "file:" + s.path }
+
+func (s *fileSink) Check() error {
+	_, err := s.f.Stat()
+	return err
+}
+
+func (s *fileSink) Write(ctx context.Context, ev MatchEvent) error {
+	d, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.w.Write(append(d, '\n')); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
+
+func (s *fileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.w.Close(); err != nil {
+		s.f.Close()
+		return err
+	}
+	return s.f.Close()
+}
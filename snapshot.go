@@ -0,0 +1,93 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/certificate-transparency-go/loglist3"
+)
+
+/* Lista de logs empaquetada para modo offline */
+
+// Se actualiza con "make loglist-snapshot" antes de compilar una versión
+//
+//go:embed snapshot/log_list.json
+var bundledLogList []byte
+
+func loadBundledLogList() (*loglist3.LogList, error) {
+	ll, err := loglist3.NewFromJSON(bundledLogList)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse bundled log list: %w", err)
+	}
+	if age := time.Since(ll.LogListTimestamp); len(ll.Operators) > 0 && age > 90*24*time.Hour {
+		log.Printf("WARNING: bundled log list is %d days old", int(age.Hours()/24))
+	}
+	return ll, nil
+}
+
+// Logs usables de la lista empaquetada, para el preflight. Sin ninguno,
+// -offline solo vigila los de -extra-logs.
+func (mngr *CTLogsManager) checkBundledLogList() (int, error) {
+	ll, err := loadBundledLogList()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, c := range mergeLogLists([]string{"bundled"}, []*loglist3.LogList{ll}, mngr.MergePolicy) {
+		if mngr.candidateUsable(c) {
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, fmt.Errorf("bundled log list has no usable logs (rebuild after make loglist-snapshot, or add -extra-logs)")
+	}
+	return n, nil
+}
+
+// Comprueba una lista descargada antes de empaquetarla ("make
+// loglist-snapshot"): firma de <path>.sig con la clave de la lista principal y
+// al menos un log
+func verifyLogListFile(path, keyPath string) (int, error) {
+	key, err := loadLogListKey(keyPath)
+	if err != nil {
+		return 0, err
+	}
+	list, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	sig, err := os.ReadFile(path + ".sig")
+	if err != nil {
+		return 0, fmt.Errorf("log list signature missing: %w", err)
+	}
+	if err := cryptoProvider.Verify(key, list, sig); err != nil {
+		return 0, fmt.Errorf("log list signature invalid: %w", err)
+	}
+	ll, err := loglist3.NewFromJSON(list)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse log list: %w", err)
+	}
+	n := 0
+	for _, op := range ll.Operators {
+		n += len(op.Logs)
+	}
+	if n == 0 {
+		return 0, fmt.Errorf("log list has no logs")
+	}
+	return n, nil
+}
+
+// Logs indicados a mano (fuera de cualquier lista)
+func extraLogCandidates(urls []string) []*logCandidate {
+	var out []*logCandidate
+	for _, u := range urls {
+		if u == "" {
+			continue
+		}
+		out = append(out, &logCandidate{id: u, url: u, desc: u, lists: []string{"extra"}})
+	}
+	return out
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testLogList = `{"version":"1","log_list_timestamp":"2026-10-01T00:00:00Z","operators":[{"name":"Example","email":["ct@example.net"],"logs":[{"description":"Example 2026h2","log_id":"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=","key":"AAAA","url":"https://ct.example.net/2026h2/","mmd":86400}]}]}`
+
+// Escribe list y su firma con una clave nueva; devuelve la ruta de la lista y
+// la de la clave pública
+func writeTestSignedLogList(t *testing.T, list string) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte(list))
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listPath, keyPath := filepath.Join(dir, "log_list.json"), filepath.Join(dir, "key.pem")
+	for path, data := range map[string][]byte{
+		listPath:          []byte(list),
+		listPath + ".sig": sig,
+		keyPath:           pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}),
+	} {
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return listPath, keyPath
+}
+
+func TestVerifyLogListFile(t *testing.T) {
+	listPath, keyPath := writeTestSignedLogList(t, testLogList)
+	if n, err := verifyLogListFile(listPath, keyPath); err != nil || n != 1 {
+		t.Fatalf("verifyLogListFile = %d, %v; want 1 log", n, err)
+	}
+
+	// Lista modificada después de firmar
+	if err := os.WriteFile(listPath, []byte(testLogList+" "), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifyLogListFile(listPath, keyPath); err == nil {
+		t.Error("tampered log list verified")
+	}
+
+	// Firmada por otra clave
+	_, otherKey := writeTestSignedLogList(t, testLogList)
+	listPath, _ = writeTestSignedLogList(t, testLogList)
+	if _, err := verifyLogListFile(listPath, otherKey); err == nil {
+		t.Error("log list verified with another key")
+	}
+
+	// Sin firma
+	if err := os.Remove(listPath + ".sig"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifyLogListFile(listPath, keyPath); err == nil {
+		t.Error("log list without signature verified")
+	}
+
+	// Firmada pero vacía, como la de relleno
+	listPath, keyPath = writeTestSignedLogList(t, `{"version":"0","log_list_timestamp":"1970-01-01T00:00:00Z","operators":[]}`)
+	if _, err := verifyLogListFile(listPath, keyPath); err == nil {
+		t.Error("signed log list without logs accepted")
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	CertTransp "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/x509"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	bolt "go.etcd.io/bbolt"
+)
+
+/* Cola en disco para las entradas que no caben en OutputChan */
+
+const (
+	DefaultSpillMax = 1000000
+	spillReplayRead = 256 // entradas leídas de disco por transacción
+)
+
+var boltSpillBucket = []byte("spill")
+
+var (
+	metricSpillEntries = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gctwatch_spill_entries",
+		Help: "Entradas en la cola en disco pendientes de tratar.",
+	})
+	metricSpilled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gctwatch_spilled_entries_total",
+		Help: "Entradas desviadas a la cola en disco con OutputChan lleno.",
+	}, []string{"log"})
+)
+
+// Lo que el tratamiento necesita de una entrada: el certificado y la cadena
+type spilledEntry struct {
+	Log   string   `json:"log"`
+	Index int64    `json:"index"`
+	Cert  []byte   `json:"cert,omitempty"` // nil en precertificados
+	Chain [][]byte `json:"chain,omitempty"`
+}
+
+// Con OutputChan lleno las entradas se guardan en un bucket de bbolt, en orden
+// de llegada, y se reinyectan en cuanto hay hueco en lugar de descartarse. Las
+// entradas siguen pendientes para el checkpoint hasta que se tratan. La cola
+// no sincroniza a disco: tras una caída lo que falte se vuelve a leer desde
+// el checkpoint. Lo que queda al parar se trata en el siguiente arranque.
+type SpillQueue struct {
+	db   *bolt.DB
+	path string
+	max  int
+
+	mu      sync.Mutex
+	count   int
+	batches map[uint64]*entryBatch // lote de cada entrada guardada en esta ejecución
+	wake    chan struct{}
+}
+
+// Abre la cola a partir de su especificación, "bolt:/ruta/spill.db"
+func OpenSpillQueue(spec string, max int) (*SpillQueue, error) {
+	path, ok := strings.CutPrefix(spec, "bolt:")
+	if !ok {
+		return nil, fmt.Errorf("unknown spill queue %q (bolt:<path>)", spec)
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second, NoSync: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spill queue %s: %w", path, err)
+	}
+	q := &SpillQueue{db: db, path: path, max: max, batches: make(map[uint64]*entryBatch), wake: make(chan struct{}, 1)}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(boltSpillBucket)
+		if err != nil {
+			return err
+		}
+		q.count = b.Stats().KeyN
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize spill queue %s: %w", path, err)
+	}
+	if q.count > 0 {
+		log.Printf("spill queue %s: %d entries left from a previous run", path, q.count)
+	}
+	metricSpillEntries.Set(float64(q.count))
+	return q, nil
+}
+
+func (q *SpillQueue) Name() string { return "bolt:" + q.path }
+
+func (q *SpillQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.count
+}
+
+// Guarda las entradas en una sola transacción. Devuelve cuántas caben; el
+// resto (cola llena o error de disco) queda para descartar.
+func (q *SpillQueue) Push(entries []SourcedEntry) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := min(len(entries), q.max-q.count)
+	if n <= 0 {
+		return 0, nil
+	}
+	keys := make([]uint64, 0, n)
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltSpillBucket)
+		for _, e := range entries[:n] {
+			se := spilledEntry{Log: e.Source.Source, Index: e.Entry.Index}
+			if e.Entry.X509Cert != nil {
+				se.Cert = e.Entry.X509Cert.Raw
+			}
+			for _, c := range e.Entry.Chain {
+				se.Chain = append(se.Chain, c.Data)
+			}
+			data, err := json.Marshal(se)
+			if err != nil {
+				return err
+			}
+			seq, _ := b.NextSequence()
+			if err := b.Put(binary.BigEndian.AppendUint64(nil, seq), data); err != nil {
+				return err
+			}
+			keys = append(keys, seq)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to write spill queue: %w", err)
+	}
+	for i, seq := range keys {
+		q.batches[seq] = entries[i].batch
+		metricSpilled.WithLabelValues(entries[i].Source.Source).Inc()
+	}
+	q.count += n
+	metricSpillEntries.Set(float64(q.count))
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return n, nil
+}
+
+// Reinyecta las entradas guardadas en out, en orden, hasta que se cancela
+// ctx. Las de logs que ya no se monitorizan se descartan.
+func (q *SpillQueue) Replay(ctx context.Context, out chan<- SourcedEntry, sources map[string]*CTLogSource) {
+	for {
+		keys, entries, err := q.read(sources)
+		if err != nil {
+			log.Printf("WARNING: spill queue %s: %v", q.path, err)
+		}
+		for i, e := range entries {
+			select {
+			case out <- e:
+			case <-ctx.Done():
+				q.remove(keys[:i])
+				return
+			}
+		}
+		q.remove(keys)
+		if len(keys) > 0 {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// Primeras entradas de la cola. keys incluye las descartadas, para borrarlas.
+func (q *SpillQueue) read(sources map[string]*CTLogSource) (keys []uint64, entries []SourcedEntry, err error) {
+	err = q.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltSpillBucket).Cursor()
+		for k, v := c.First(); k != nil && len(keys) < spillReplayRead; k, v = c.Next() {
+			seq := binary.BigEndian.Uint64(k)
+			keys = append(keys, seq)
+			var se spilledEntry
+			if err := json.Unmarshal(v, &se); err != nil {
+				continue
+			}
+			source, ok := sources[se.Log]
+			if !ok {
+				continue
+			}
+			e := SourcedEntry{Source: source, Entry: CertTransp.LogEntry{Index: se.Index}}
+			if se.Cert != nil {
+				e.Entry.X509Cert = &x509.Certificate{Raw: se.Cert}
+			}
+			for _, c := range se.Chain {
+				e.Entry.Chain = append(e.Entry.Chain, CertTransp.ASN1Cert{Data: c})
+			}
+			q.mu.Lock()
+			e.batch = q.batches[seq]
+			q.mu.Unlock()
+			entries = append(entries, e)
+		}
+		return nil
+	})
+	return keys, entries, err
+}
+
+func (q *SpillQueue) remove(keys []uint64) {
+	if len(keys) == 0 {
+		return
+	}
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltSpillBucket)
+		for _, seq := range keys {
+			if err := b.Delete(binary.BigEndian.AppendUint64(nil, seq)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("WARNING: spill queue %s: %v", q.path, err)
+	}
+	q.mu.Lock()
+	for _, seq := range keys {
+		delete(q.batches, seq)
+	}
+	q.count = max(q.count-len(keys), 0)
+	metricSpillEntries.Set(float64(q.count))
+	q.mu.Unlock()
+}
+
+func (q *SpillQueue) Close() error {
+	return q.db.Close()
+}
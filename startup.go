@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+)
+
+/* Inicialización de fuentes en paralelo */
+
+var errUnusableLog = errors.New("not usable (fake, retired, rejected, expired or MMD > 24h)")
+
+// Inicializa los candidatos con un pool acotado y un plazo global, conservando
+// el orden de la lista. Informa del resultado de cada log y del total.
+func (mngr *CTLogsManager) initLogSources(candidates []*logCandidate) {
+	ctx, cancel := context.WithTimeout(mngr.context, mngr.InitTimeout)
+	defer cancel()
+
+	results := make([]*CTLogSource, len(candidates))
+	errs := make([]error, len(candidates))
+	sem := make(chan struct{}, max(mngr.InitConcurrency, 1))
+	var wg sync.WaitGroup
+	for i, c := range candidates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+			results[i], errs[i] = mngr.initLogSource(ctx, c)
+		}()
+	}
+	wg.Wait()
+
+	var unusable, failed int
+	for i, c := range candidates {
+		if !errors.Is(errs[i], errUnusableLog) {
+			mngr.coverage.initResult(c.url, errs[i])
+		}
+		switch err := errs[i]; {
+		case err == nil:
+			mngr.sources = append(mngr.sources, *results[i])
+			log.Printf("log %s: starting at %d", c.url, results[i].LastSize)
+		case errors.Is(err, errUnusableLog):
+			unusable++
+		case errors.Is(err, context.DeadlineExceeded):
+			failed++
+			log.Printf("WARNING: log %s: init timed out after %s", c.url, mngr.InitTimeout)
+		default:
+			failed++
+			log.Printf("WARNING: log %s: init failed: %v", c.url, err)
+		}
+	}
+	log.Printf("initialized %d of %d logs (%d unusable, %d failed)", len(mngr.sources), len(candidates), unusable, failed)
+}
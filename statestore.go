@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* Almacén de estado para deduplicación, supresión y primeras apariciones */
+
+// Clave-valor con caducidad. Con Redis varias instancias comparten el estado;
+// memoria y bbolt sirven para una sola instancia sin dependencias externas.
+type StateStore interface {
+	Name() string
+	// Guarda la clave si no existe (o ha caducado); devuelve true si la ha creado.
+	// ttl 0 = sin caducidad.
+	SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Close() error
+}
+
+// Abre el almacén a partir de su especificación:
+// "memory", "bolt:/ruta/state.db" o "redis://host:6379/0"
+func OpenStateStore(spec string, network *Network) (StateStore, error) {
+	switch {
+	case spec == "" || spec == "memory":
+		return NewMemoryStore(), nil
+	case strings.HasPrefix(spec, "bolt:"):
+		return OpenBoltStore(strings.TrimPrefix(spec, "bolt:"))
+	case strings.HasPrefix(spec, "redis://"), strings.HasPrefix(spec, "rediss://"):
+		return OpenRedisStore(spec, network)
+	}
+	return nil, fmt.Errorf("unknown state store %q (memory, bolt:<path>, redis://...)", spec)
+}
+
+type memoryEntry struct {
+	value   []byte
+	expires time.Time // cero = sin caducidad
+}
+
+func (e memoryEntry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && now.After(e.expires)
+}
+
+// En memoria; se pierde al reiniciar
+type memoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	writes  int
+}
+
+func NewMemoryStore() *memoryStore {
+	return &memoryStore{entries: make(map[string]memoryEntry)}
+}
+
+func (s *memoryStore) Name() string { return "memory" }
+func (s *memoryStore) Close() error { return nil }
+
+func (s *memoryStore) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok && !e.expired(now) {
+		return false, nil
+	}
+	e := memoryEntry{value: value}
+	if ttl > 0 {
+		e.expires = now.Add(ttl)
+	}
+	s.entries[key] = e
+	// Limpieza periódica de caducadas
+	if s.writes++; s.writes%10000 == 0 {
+		for k, e := range s.entries {
+			if e.expired(now) {
+				delete(s.entries, k)
+			}
+		}
+	}
+	return true, nil
+}
+
+func (s *memoryStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok || e.expired(time.Now()) {
+		return nil, false, nil
+	}
+	return e.value, true, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+/* Almacén de estado en bbolt (fichero local) */
+
+var boltStateBucket = []byte("state")
+
+const boltSweepInterval = time.Hour
+
+// Cada valor lleva delante la caducidad en nanosegundos Unix (0 = sin caducidad)
+type boltStore struct {
+	db   *bolt.DB
+	path string
+	stop chan struct{}
+	done chan struct{}
+}
+
+func OpenBoltStore(path string) (*boltStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state store %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltStateBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize state store %s: %w", path, err)
+	}
+	s := &boltStore{db: db, path: path, stop: make(chan struct{}), done: make(chan struct{})}
+	go s.sweepLoop()
+	return s, nil
+}
+
+func (s *boltStore) Name() string { return "bolt:" + s.path }
+
+func boltExpired(v []byte, now time.Time) bool {
+	if len(v) < 8 {
+		return true
+	}
+	exp := int64(binary.BigEndian.Uint64(v[:8]))
+	return exp != 0 && now.UnixNano() > exp
+}
+
+func (s *boltStore) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	created := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltStateBucket)
+		now := time.Now()
+		if v := b.Get([]byte(key)); v != nil && !boltExpired(v, now) {
+			return nil
+		}
+		buf := make([]byte, 8+len(value))
+		if ttl > 0 {
+			binary.BigEndian.PutUint64(buf, uint64(now.Add(ttl).UnixNano()))
+		}
+		copy(buf[8:], value)
+		created = true
+		return b.Put([]byte(key), buf)
+	})
+	return created, err
+}
+
+func (s *boltStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	var out []byte
+	found := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(boltStateBucket).Get([]byte(key))
+		if v == nil || boltExpired(v, time.Now()) {
+			return nil
+		}
+		out, found = append([]byte(nil), v[8:]...), true
+		return nil
+	})
+	return out, found, err
+}
+
+// Borra las claves caducadas
+func (s *boltStore) sweepLoop() {
+	defer close(s.done)
+	ticker := time.NewTicker(boltSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			err := s.db.Update(func(tx *bolt.Tx) error {
+				c := tx.Bucket(boltStateBucket).Cursor()
+				now := time.Now()
+				for k, v := c.First(); k != nil; k, v = c.Next() {
+					if boltExpired(v, now) {
+						if err := c.Delete(); err != nil {
+							return err
+						}
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				log.Printf("WARNING: state store sweep: %v", err)
+			}
+		}
+	}
+}
+
+func (s *boltStore) Close() error {
+	close(s.stop)
+	<-s.done
+	return s.db.Close()
+}
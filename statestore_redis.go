@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+/* Almacén de estado en Redis (compartido entre instancias) */
+
+const redisKeyPrefix = "gctwatch:"
+
+type redisStore struct {
+	client *redis.Client
+	addr   string
+}
+
+// Cliente Redis que conecta a través de la red controlada (política de egress)
+func newRedisClient(url string, network *Network) (*redis.Client, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %w", err)
+	}
+	host, _, err := net.SplitHostPort(opts.Addr)
+	if err != nil {
+		host = opts.Addr
+	}
+	if err := network.Policy.Check(host); err != nil {
+		return nil, err
+	}
+	opts.Dialer = redisDialer(network, opts.TLSConfig)
+	return redis.NewClient(opts), nil
+}
+
+// Sustituye al dialer de go-redis, que es el que aplica TLSConfig: con
+// rediss:// el cifrado se pone aquí sobre la conexión de la red controlada
+func redisDialer(network *Network, cfg *tls.Config) func(ctx context.Context, netw, addr string) (net.Conn, error) {
+	return func(ctx context.Context, netw, addr string) (net.Conn, error) {
+		conn, err := network.Dialer.DialContext(ctx, netw, addr)
+		if err != nil || cfg == nil {
+			return conn, err
+		}
+		tc := tls.Client(conn, cfg)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("TLS handshake with %s failed: %w", addr, err)
+		}
+		return tc, nil
+	}
+}
+
+func OpenRedisStore(url string, network *Network) (*redisStore, error) {
+	client, err := newRedisClient(url, network)
+	if err != nil {
+		return nil, err
+	}
+	return &redisStore{client: client, addr: client.Options().Addr}, nil
+}
+
+func (s *redisStore) Name() string { return "redis:" + s.addr }
+func (s *redisStore) Close() error { return s.client.Close() }
+
+func (s *redisStore) Check() error {
+	return s.client.Ping(context.Background()).Err()
+}
+
+func (s *redisStore) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	return s.client.SetNX(ctx, redisKeyPrefix+key, value, ttl).Result()
+}
+
+func (s *redisStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	v, err := s.client.Get(ctx, redisKeyPrefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return v, true, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testRedisNetwork() *Network {
+	return &Network{Policy: NewEgressPolicy(false, nil), Dialer: &NetDialer{Timeout: 5 * time.Second}}
+}
+
+// Primer byte que recibe un servidor TCP sin TLS
+func firstByteListener(t *testing.T) (string, <-chan byte) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	first := make(chan byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		b := make([]byte, 1)
+		if _, err := conn.Read(b); err == nil {
+			first <- b[0]
+		}
+	}()
+	return ln.Addr().String(), first
+}
+
+func TestRedisDialTLS(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// rediss:// con un servidor TLS: la conexión devuelta está cifrada
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	addr := srv.Listener.Addr().String()
+	client, err := newRedisClient("rediss://"+addr, testRedisNetwork())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	opts := client.Options()
+	if opts.TLSConfig == nil {
+		t.Fatal("rediss:// parsed without TLS config")
+	}
+	opts.TLSConfig.RootCAs = srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+	conn, err := opts.Dialer(ctx, "tcp", addr)
+	if err != nil {
+		t.Fatalf("rediss:// dial: %v", err)
+	}
+	tc, ok := conn.(*tls.Conn)
+	if !ok || !tc.ConnectionState().HandshakeComplete {
+		t.Errorf("rediss:// dial returned %T without a completed handshake", conn)
+	}
+	conn.Close()
+
+	// rediss:// contra un servidor en claro: lo primero que sale es un
+	// ClientHello (registro TLS 0x16), nunca un comando
+	addr, first := firstByteListener(t)
+	client, err = newRedisClient("rediss://"+addr, testRedisNetwork())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	dialCtx, dialCancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	defer dialCancel()
+	if conn, err := client.Options().Dialer(dialCtx, "tcp", addr); err == nil {
+		conn.Close()
+		t.Error("rediss:// dial to a plaintext server succeeded")
+	}
+	select {
+	case b := <-first:
+		if b != 0x16 {
+			t.Errorf("rediss:// sent first byte %#x; want a TLS handshake record (0x16)", b)
+		}
+	case <-time.After(time.Second):
+		t.Error("rediss:// dial sent nothing; want a TLS handshake")
+	}
+
+	// redis:// sigue en claro
+	addr, _ = firstByteListener(t)
+	client, err = newRedisClient("redis://"+addr, testRedisNetwork())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	conn, err = client.Options().Dialer(ctx, "tcp", addr)
+	if err != nil {
+		t.Fatalf("redis:// dial: %v", err)
+	}
+	if _, ok := conn.(*tls.Conn); ok {
+		t.Error("redis:// dial returned a TLS connection")
+	}
+	conn.Close()
+}
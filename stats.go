@@ -0,0 +1,61 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/* Contadores internos del pipeline */
+
+type Stats struct {
+	StartedAt        time.Time
+	EntriesProcessed atomic.Int64
+	Matches          atomic.Int64
+	lastEntryAt      atomic.Int64 // unix nanos
+	tagMatches       tagCounters
+	shadowMatches    tagCounters
+}
+
+// Contadores por tag
+type tagCounters struct{ m sync.Map } // tag -> *atomic.Int64
+
+func (c *tagCounters) Inc(tag string) {
+	n, _ := c.m.LoadOrStore(tag, new(atomic.Int64))
+	n.(*atomic.Int64).Add(1)
+}
+
+func (c *tagCounters) Snapshot() map[string]int64 {
+	out := make(map[string]int64)
+	c.m.Range(func(k, v any) bool {
+		out[k.(string)] = v.(*atomic.Int64).Load()
+		return true
+	})
+	return out
+}
+
+// Un certificado que coincide con las reglas de tags: cuenta una vez en
+// Matches y una en cada tag
+func (s *Stats) Match(tags []string) {
+	s.Matches.Add(1)
+	for _, tag := range tags {
+		s.tagMatches.Inc(tag)
+	}
+}
+
+func (s *Stats) TagMatches() map[string]int64       { return s.tagMatches.Snapshot() }
+func (s *Stats) ShadowMatch(tag string)             { s.shadowMatches.Inc(tag) }
+func (s *Stats) ShadowTagMatches() map[string]int64 { return s.shadowMatches.Snapshot() }
+
+func (s *Stats) EntrySeen() {
+	s.EntriesProcessed.Add(1)
+	s.lastEntryAt.Store(time.Now().UnixNano())
+}
+
+func (s *Stats) LastEntryAt() time.Time {
+	n := s.lastEntryAt.Load()
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n).UTC()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/time/rate"
+)
+
+/* Límite global de coincidencias entregadas a los sinks */
+
+var metricThrottleWait = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "gctwatch_emit_throttle_wait_seconds_total",
+	Help: "Tiempo que los workers han esperado por el límite de -emit-rate antes de entregar coincidencias.",
+})
+
+// Reparte las coincidencias a un ritmo constante, independiente de lo rápido
+// que se lean los logs: tras ponerse al día con un log atrasado, las bases de
+// datos y webhooks no reciben la ráfaga de golpe. Los workers esperan antes de
+// enrutar, así que la espera se acumula en OutputChan y de ahí pasa a
+// -backpressure (con drop, una ráfaga larga acaba en entradas descartadas).
+// Los eventos canario, los latidos y los operacionales no se limitan.
+type EmitThrottle struct {
+	limiter *rate.Limiter
+}
+
+// nil si perSecond <= 0 (sin límite)
+func NewEmitThrottle(perSecond float64, burst int) *EmitThrottle {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &EmitThrottle{limiter: rate.NewLimiter(rate.Limit(perSecond), max(burst, 1))}
+}
+
+// Espera turno. Si ctx se cancela (al parar) vuelve sin esperar más: el
+// evento se entrega igualmente.
+func (t *EmitThrottle) Wait(ctx context.Context) {
+	if t == nil {
+		return
+	}
+	t0 := time.Now()
+	t.limiter.Wait(ctx)
+	if d := time.Since(t0); d > time.Millisecond {
+		metricThrottleWait.Add(d.Seconds())
+	}
+}
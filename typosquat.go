@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+/* Typosquatting: nombres a pocas ediciones de un dominio protegido */
+
+// Dominio protegido al que imita un nombre, en el evento
+type Typosquat struct {
+	Target    string `json:"target"`    // dominio protegido
+	Distance  int    `json:"distance"`  // ediciones entre las etiquetas (0 si solo cambia el sufijo)
+	Technique string `json:"technique"` // ver Typo*
+}
+
+// Cómo se ha llegado del dominio protegido al nombre
+const (
+	TypoOmission      = "omission"      // falta un carácter: paypl.com
+	TypoInsertion     = "insertion"     // sobra un carácter: paypail.com
+	TypoRepetition    = "repetition"    // sobra un carácter repetido: paypall.com
+	TypoHyphenation   = "hyphenation"   // sobra un guion: pay-pal.com
+	TypoTransposition = "transposition" // dos caracteres seguidos intercambiados: papyal.com
+	TypoBitflip       = "bitflip"       // un carácter a un bit de distancia: paypql.com
+	TypoReplacement   = "replacement"   // un carácter cambiado por otro: paypai.com
+	TypoSuffix        = "suffix"        // misma etiqueta con otro sufijo: paypal.co
+	TypoEdits         = "edits"         // más de una edición
+)
+
+const maxTyposquatDistance = 3
+
+type typosquatTarget struct {
+	domain string // paypal.com
+	label  string // paypal
+	suffix string // com
+}
+
+// Compara la etiqueta del dominio registrable de un nombre (paypal en
+// login.paypal.com.evil.net no cuenta: ahí el registrable es evil.net) con
+// las de los dominios protegidos, con la distancia de Damerau-Levenshtein
+// restringida (inserción, borrado, sustitución y transposición de dos
+// caracteres seguidos). Es de solo lectura, como keywordMatcher.
+type typosquatMatcher struct {
+	targets  []typosquatTarget
+	distance int
+}
+
+// distance 0 es 1. Cada dominio tiene que ser registrable (paypal.com, no
+// www.paypal.com) y su etiqueta más larga que el doble de la distancia, o
+// coincidiría con casi cualquier nombre corto.
+func newTyposquatMatcher(domains []string, distance int) (*typosquatMatcher, error) {
+	if len(domains) == 0 {
+		return nil, fmt.Errorf("empty typosquat domain list")
+	}
+	if distance == 0 {
+		distance = 1
+	}
+	if distance < 1 || distance > maxTyposquatDistance {
+		return nil, fmt.Errorf("invalid typosquat distance %d (1-%d)", distance, maxTyposquatDistance)
+	}
+	m := &typosquatMatcher{distance: distance}
+	for _, d := range domains {
+		sub, domain, suffix, ok := splitDomainName(d)
+		if !ok || sub != "" {
+			return nil, fmt.Errorf("typosquat target %q is not a registrable domain", d)
+		}
+		label := strings.TrimSuffix(domain, "."+suffix)
+		if len(label) <= 2*distance {
+			return nil, fmt.Errorf("typosquat target %q too short for distance %d", d, distance)
+		}
+		m.targets = append(m.targets, typosquatTarget{domain: domain, label: label, suffix: suffix})
+	}
+	return m, nil
+}
+
+// Dominio protegido más cercano al nombre, dentro de la distancia. Los
+// nombres de uno de los dominios protegidos (o de sus subdominios) no
+// coinciden.
+func (m *typosquatMatcher) Find(name string) (*Typosquat, bool) {
+	_, domain, suffix, ok := splitDomainName(name)
+	if !ok {
+		return nil, false
+	}
+	label := strings.TrimSuffix(domain, "."+suffix)
+	var best *Typosquat
+	for _, t := range m.targets {
+		if domain == t.domain {
+			return nil, false
+		}
+		if abs(len(label)-len(t.label)) > m.distance {
+			continue
+		}
+		d := osaDistance(label, t.label, m.distance)
+		if d > m.distance || (best != nil && d >= best.Distance) {
+			continue
+		}
+		best = &Typosquat{Target: t.domain, Distance: d, Technique: typoTechnique(label, t.label, d)}
+	}
+	return best, best != nil
+}
+
+// Dominios protegidos, para GET /rules
+func (m *typosquatMatcher) Domains() []string {
+	out := make([]string, len(m.targets))
+	for i, t := range m.targets {
+		out[i] = t.domain
+	}
+	return out
+}
+
+func (m *typosquatMatcher) MatchString(name string) bool {
+	_, ok := m.Find(name)
+	return ok
+}
+
+// Distancia de Damerau-Levenshtein restringida (optimal string alignment)
+// entre a y b, por bytes. Deja de calcular en cuanto supera limit y
+// devuelve limit+1.
+func osaDistance(a, b string, limit int) int {
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+			rowMin = min(rowMin, cur[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return min(prev[len(b)], limit+1)
+}
+
+// Técnica con la que se pasa de target a label, a distancia d
+func typoTechnique(label, target string, d int) string {
+	switch {
+	case d == 0:
+		return TypoSuffix
+	case d > 1:
+		return TypoEdits
+	case len(label) < len(target):
+		return TypoOmission
+	}
+	i := 0
+	for i < len(target) && label[i] == target[i] {
+		i++
+	}
+	if len(label) > len(target) {
+		switch c := label[i]; {
+		case c == '-':
+			return TypoHyphenation
+		case i > 0 && label[i-1] == c, i+1 < len(label) && label[i+1] == c:
+			return TypoRepetition
+		}
+		return TypoInsertion
+	}
+	if i+1 < len(label) && label[i] == target[i+1] && label[i+1] == target[i] && label[i+2:] == target[i+2:] {
+		return TypoTransposition
+	}
+	if x := label[i] ^ target[i]; x&(x-1) == 0 {
+		return TypoBitflip
+	}
+	return TypoReplacement
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,129 @@
+package main
+
+import "testing"
+
+func TestOSADistance(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		limit int
+		want  int
+	}{
+		{"paypal", "paypal", 3, 0},
+		{"papyal", "paypal", 3, 1}, // transposición
+		{"apypal", "paypal", 3, 1}, // transposición al principio
+		{"paypla", "paypal", 3, 1}, // transposición al final
+		{"paypl", "paypal", 3, 1},  // omisión
+		{"aypal", "paypal", 3, 1},  // omisión del primero
+		{"paypail", "paypal", 3, 1},
+		{"paypai", "paypal", 3, 1}, // sustitución
+		{"", "abc", 3, 3},
+		{"abc", "", 3, 3},
+		{"ca", "abc", 3, 3}, // OSA no edita dos veces la misma subcadena (Damerau completo daría 2)
+		{"pyapla", "paypal", 3, 2},
+		// Umbral: la distancia exacta hasta limit, limit+1 por encima
+		{"paypxx", "paypal", 2, 2},
+		{"paypxx", "paypal", 1, 2},
+		{"payxxx", "paypal", 2, 3},
+		{"xxxxxx", "paypal", 2, 3},
+		{"xxxxxxxxxxx", "paypal", 3, 4},
+	}
+	for _, tt := range tests {
+		if got := osaDistance(tt.a, tt.b, tt.limit); got != tt.want {
+			t.Errorf("osaDistance(%q, %q, %d) = %d; want %d", tt.a, tt.b, tt.limit, got, tt.want)
+		}
+		if got := osaDistance(tt.b, tt.a, tt.limit); got != tt.want {
+			t.Errorf("osaDistance(%q, %q, %d) = %d; want %d (not symmetric)", tt.b, tt.a, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestTypoTechnique(t *testing.T) {
+	tests := []struct {
+		label, target string
+		want          string
+	}{
+		{"paypal", "paypal", TypoSuffix},
+		{"papyal", "paypal", TypoTransposition},
+		{"apypal", "paypal", TypoTransposition},
+		{"paypla", "paypal", TypoTransposition},
+		{"paypl", "paypal", TypoOmission},
+		{"aypal", "paypal", TypoOmission},
+		{"paypail", "paypal", TypoInsertion},
+		{"xpaypal", "paypal", TypoInsertion},
+		{"paypall", "paypal", TypoRepetition},
+		{"ppaypal", "paypal", TypoRepetition},
+		{"pay-pal", "paypal", TypoHyphenation},
+		{"paypql", "paypal", TypoBitflip}, // a (0x61) -> q (0x71)
+		{"paypai", "paypal", TypoReplacement},
+		{"pyapla", "paypal", TypoEdits},
+	}
+	for _, tt := range tests {
+		d := osaDistance(tt.label, tt.target, maxTyposquatDistance)
+		if got := typoTechnique(tt.label, tt.target, d); got != tt.want {
+			t.Errorf("typoTechnique(%q, %q, %d) = %q; want %q", tt.label, tt.target, d, got, tt.want)
+		}
+	}
+}
+
+func TestTyposquatFind(t *testing.T) {
+	m, err := newTyposquatMatcher([]string{"paypal.com", "example.org"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		target string // "" = sin coincidencia
+		dist   int
+	}{
+		{"paypal.com", "", 0},
+		{"login.paypal.com", "", 0}, // del dominio protegido
+		{"paypal.co", "paypal.com", 0},
+		{"login.paypa1.com", "paypal.com", 1},
+		{"papyal.net", "paypal.com", 1},
+		{"pyapla.com", "", 0}, // distancia 2, por encima del umbral
+		{"paypal.com.evil.net", "", 0},
+		{"exampel.org", "example.org", 1},
+		{"unrelated.com", "", 0},
+	}
+	for _, tt := range tests {
+		got, ok := m.Find(tt.name)
+		if ok != (tt.target != "") {
+			t.Errorf("Find(%q) = %+v, %v; want target %q", tt.name, got, ok, tt.target)
+			continue
+		}
+		if ok && (got.Target != tt.target || got.Distance != tt.dist) {
+			t.Errorf("Find(%q) = %+v; want target %q at distance %d", tt.name, got, tt.target, tt.dist)
+		}
+	}
+
+	// El mismo nombre dentro del umbral con distance 2
+	m2, err := newTyposquatMatcher([]string{"paypal.com"}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := m2.Find("pyapla.com"); !ok || got.Distance != 2 || got.Technique != TypoEdits {
+		t.Errorf("Find(pyapla.com) with distance 2 = %+v, %v", got, ok)
+	}
+}
+
+func TestNewTyposquatMatcherErrors(t *testing.T) {
+	tests := []struct {
+		domains  []string
+		distance int
+	}{
+		{nil, 1},
+		{[]string{"paypal.com"}, 4},
+		{[]string{"paypal.com"}, -1},
+		{[]string{"www.paypal.com"}, 1}, // no registrable
+		{[]string{"ab.com"}, 1},         // etiqueta demasiado corta para la distancia
+		{[]string{"abcd.com"}, 2},
+	}
+	for _, tt := range tests {
+		if _, err := newTyposquatMatcher(tt.domains, tt.distance); err == nil {
+			t.Errorf("newTyposquatMatcher(%q, %d) accepted", tt.domains, tt.distance)
+		}
+	}
+	if _, err := newTyposquatMatcher([]string{"abc.com"}, 0); err != nil {
+		t.Errorf("three-letter label at the default distance: %v", err)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+/* Reputación del dominio: VirusTotal (API v3) */
+
+const (
+	virusTotalURL     = "https://www.virustotal.com/api/v3/domains/"
+	defaultVTRate     = 4 // consultas por minuto, el límite de la API pública
+	virusTotalMax     = 50000
+	virusTotalBody    = 4 << 20 // la respuesta trae también whois y DNS
+	virusTotalTimeout = 10 * time.Second
+)
+
+// Resumen del informe de VirusTotal sobre el dominio registrado
+type VirusTotal struct {
+	Status       string    `json:"status"` // malicious, suspicious, clean o unknown (VirusTotal no lo conoce)
+	Malicious    int       `json:"malicious"`
+	Suspicious   int       `json:"suspicious"`
+	Harmless     int       `json:"harmless"`
+	Undetected   int       `json:"undetected"`
+	Reputation   int       `json:"reputation"`
+	Categories   []string  `json:"categories,omitempty"` // de los distintos proveedores, sin repetir
+	LastAnalysis time.Time `json:"last_analysis,omitzero"`
+	CheckedAt    time.Time `json:"checked_at"`
+}
+
+type virusTotalEntry struct {
+	report  VirusTotal
+	expires time.Time
+}
+
+// Consulta el informe del dominio registrado de cada coincidencia. La cuota
+// de VirusTotal es muy corta, así que los informes se guardan en caché ttl y,
+// si se supera el límite de consultas, la coincidencia sigue sin informe en
+// lugar de frenar el pipeline; por eso conviene limitarlo a los tags graves.
+type virusTotalEnricher struct {
+	key     string
+	ttl     time.Duration
+	limiter *rate.Limiter
+	client  *http.Client
+
+	mu    sync.Mutex
+	cache map[string]virusTotalEntry
+}
+
+func NewVirusTotalEnricher(keyFile string, perMinute float64, ttl time.Duration, client *http.Client) (*virusTotalEnricher, error) {
+	key, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read VirusTotal API key: %w", err)
+	}
+	limiter := rate.NewLimiter(rate.Inf, 0)
+	if perMinute > 0 {
+		limiter = rate.NewLimiter(rate.Limit(perMinute/60), 1)
+	}
+	return &virusTotalEnricher{
+		key: strings.TrimSpace(string(key)), ttl: ttl, limiter: limiter, client: client,
+		cache: make(map[string]virusTotalEntry),
+	}, nil
+}
+
+func (v *virusTotalEnricher) Name() string     { return "virustotal" }
+func (v *virusTotalEnricher) Endpoint() string { return virusTotalURL }
+
+func (v *virusTotalEnricher) Enrich(ctx context.Context, ev *MatchEvent, in EnrichInput) error {
+	domain := eventDomain(*ev)
+	if domain == "" {
+		return nil
+	}
+	now := time.Now()
+	v.mu.Lock()
+	e, ok := v.cache[domain]
+	v.mu.Unlock()
+	if ok && now.Before(e.expires) {
+		r := e.report
+		ev.Enrichment.VirusTotal = &r
+		return nil
+	}
+	if !v.limiter.Allow() {
+		return nil
+	}
+	r, err := v.lookup(ctx, domain)
+	if err != nil {
+		return err
+	}
+	r.CheckedAt = now.UTC()
+	ev.Enrichment.VirusTotal = &r
+	v.store(domain, virusTotalEntry{report: r, expires: now.Add(v.ttl)})
+	return nil
+}
+
+func (v *virusTotalEnricher) store(domain string, e virusTotalEntry) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if len(v.cache) >= virusTotalMax {
+		now := time.Now()
+		for k, old := range v.cache {
+			if now.After(old.expires) {
+				delete(v.cache, k)
+			}
+		}
+		if len(v.cache) >= virusTotalMax {
+			clear(v.cache)
+		}
+	}
+	v.cache[domain] = e
+}
+
+func (v *virusTotalEnricher) lookup(ctx context.Context, domain string) (VirusTotal, error) {
+	ctx, cancel := context.WithTimeout(ctx, virusTotalTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, virusTotalURL+url.PathEscape(domain), nil)
+	if err != nil {
+		return VirusTotal{}, err
+	}
+	req.Header.Set("x-apikey", v.key)
+	req.Header.Set("Accept", "application/json")
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return VirusTotal{}, fmt.Errorf("failed to query VirusTotal: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := readLimited(resp.Body, virusTotalBody)
+	if err != nil {
+		return VirusTotal{}, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return VirusTotal{Status: "unknown"}, nil
+	default:
+		return VirusTotal{}, fmt.Errorf("failed to query VirusTotal: %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	var res struct {
+		Data struct {
+			Attributes struct {
+				Stats struct {
+					Malicious  int `json:"malicious"`
+					Suspicious int `json:"suspicious"`
+					Harmless   int `json:"harmless"`
+					Undetected int `json:"undetected"`
+				} `json:"last_analysis_stats"`
+				Reputation   int               `json:"reputation"`
+				Categories   map[string]string `json:"categories"` // proveedor → categoría
+				LastAnalysis int64             `json:"last_analysis_date"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &res); err != nil {
+		return VirusTotal{}, fmt.Errorf("invalid VirusTotal response: %w", err)
+	}
+	a := res.Data.Attributes
+	r := VirusTotal{
+		Status:    "clean",
+		Malicious: a.Stats.Malicious, Suspicious: a.Stats.Suspicious,
+		Harmless: a.Stats.Harmless, Undetected: a.Stats.Undetected,
+		Reputation: a.Reputation,
+	}
+	switch {
+	case r.Malicious > 0:
+		r.Status = "malicious"
+	case r.Suspicious > 0:
+		r.Status = "suspicious"
+	}
+	if a.LastAnalysis > 0 {
+		r.LastAnalysis = time.Unix(a.LastAnalysis, 0).UTC()
+	}
+	for _, c := range a.Categories {
+		r.Categories = append(r.Categories, strings.ToLower(c))
+	}
+	slices.Sort(r.Categories)
+	r.Categories = slices.Compact(r.Categories)
+	return r, nil
+}
+
+// "3 malicious, 1 suspicious" para las alertas
+func virusTotalSummary(vt *VirusTotal) string {
+	var parts []string
+	if vt.Malicious > 0 {
+		parts = append(parts, fmt.Sprintf("%d malicious", vt.Malicious))
+	}
+	if vt.Suspicious > 0 {
+		parts = append(parts, fmt.Sprintf("%d suspicious", vt.Suspicious))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+/* Webhook HTTP genérico con plantillas de payload */
+
+// Plantillas integradas. "flat" es un objeto de un nivel con los campos de
+// flattenEvent, que es lo que mejor mapean Zapier, Make o n8n; IFTTT (Maker
+// Webhooks) solo admite value1..value3.
+var builtinWebhookTemplates = map[string]string{
+	"flat":   `{{json .}}`,
+	"zapier": `{{json .}}`,
+	"ifttt":  `{"value1":{{json .domain}},"value2":{{json .tag}},"value3":{{json .link}}}`,
+}
+
+// Campos del evento en un solo nivel (las listas se unen con comas), para
+// plataformas sin código que no navegan objetos anidados
+func flattenEvent(ev MatchEvent) map[string]any {
+	c := ev.Certificate
+	out := map[string]any{
+		"kind": ev.Kind, "timestamp": ev.Timestamp.Format(time.RFC3339), "tag": ev.Tag, "tags": strings.Join(ev.AllTags(), ","),
+		"domain": eventDomain(ev), "dns_names": strings.Join(c.DNSNames, ","),
+		"subject": c.Subject, "issuer": c.Issuer, "serial": c.SerialNumber,
+		"fingerprint_sha256": c.FingerprintSHA256, "log_url": ev.Log.URL, "index": ev.Index,
+		"link": "",
+	}
+	if !c.NotBefore.IsZero() {
+		out["not_before"] = c.NotBefore.Format(time.RFC3339)
+		out["not_after"] = c.NotAfter.Format(time.RFC3339)
+	}
+	if e := ev.Enrichment; e != nil {
+		if e.CrtSh != nil {
+			out["link"] = e.CrtSh.URL
+		}
+		if e.Revocation != nil {
+			out["revocation_status"] = e.Revocation.Status
+		}
+		if e.Zone != nil {
+			out["zone_status"] = e.Zone.Status
+		}
+		if e.SafeBrowsing != nil {
+			out["safebrowsing_status"] = e.SafeBrowsing.Status
+			out["safebrowsing_threats"] = strings.Join(e.SafeBrowsing.Threats, ",")
+		}
+		if e.VirusTotal != nil {
+			out["virustotal_status"] = e.VirusTotal.Status
+			out["virustotal_malicious"] = e.VirusTotal.Malicious
+		}
+	}
+	if hb := ev.Heartbeat; hb != nil {
+		out["instance"], out["status"] = hb.Instance, hb.Status
+	}
+	if op := ev.Ops; op != nil {
+		out["ops_type"], out["severity"], out["source"], out["message"] = op.Type, op.Severity, op.Source, op.Message
+	}
+	return out
+}
+
+// Carga una plantilla integrada por nombre o un fichero text/template. Los
+// datos son los de flattenEvent y la función json serializa un valor.
+func loadWebhookTemplate(spec string) (*template.Template, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	text, ok := builtinWebhookTemplates[spec]
+	if !ok {
+		data, err := os.ReadFile(spec)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read webhook template: %w", err)
+		}
+		text = string(data)
+	}
+	funcs := template.FuncMap{"json": func(v any) (string, error) {
+		d, err := json.Marshal(v)
+		return string(d), err
+	}}
+	t, err := template.New(spec).Funcs(funcs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook template %s: %w", spec, err)
+	}
+	return t, nil
+}
+
+// Cabeceras de la firma y de la entrega
+const (
+	webhookSignatureHeader = "X-GCTWatch-Signature" // sha256=<hex>
+	webhookTimestampHeader = "X-GCTWatch-Timestamp" // segundos Unix
+	webhookDeliveryHeader  = "X-GCTWatch-Delivery"  // igual en los reintentos
+)
+
+// POST de cada evento a una URL. Sin plantilla se envía el MatchEvent completo.
+// Los reintentos con backoff ante 429/5xx y errores de red los hace el cliente
+// HTTP compartido (-http-retries).
+type webhookSink struct {
+	url         string
+	name        string
+	client      *http.Client
+	tmpl        *template.Template
+	compression string
+	Secret      []byte // vacío = sin firma
+}
+
+func NewWebhookSink(endpoint, templateSpec, compression string, client *http.Client) (*webhookSink, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid webhook URL %q", endpoint)
+	}
+	if err := checkCompression(compression); err != nil {
+		return nil, err
+	}
+	tmpl, err := loadWebhookTemplate(templateSpec)
+	if err != nil {
+		return nil, err
+	}
+	// La URL suele llevar el secreto (Zapier, IFTTT): el nombre solo usa el host
+	return &webhookSink{url: endpoint, name: "webhook:" + u.Host, client: client, tmpl: tmpl, compression: compression}, nil
+}
+
+func (s *webhookSink) Name() string { return s.name }
+func (s *webhookSink) Close() error { return nil }
+
+func (s *webhookSink) payload(ev MatchEvent) ([]byte, error) {
+	if s.tmpl == nil {
+		return json.Marshal(ev)
+	}
+	var buf bytes.Buffer
+	if err := s.tmpl.Execute(&buf, flattenEvent(ev)); err != nil {
+		return nil, fmt.Errorf("failed to render webhook template: %w", err)
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("webhook template %s did not produce valid JSON", s.tmpl.Name())
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *webhookSink) Write(ctx context.Context, ev MatchEvent) error {
+	body, err := s.payload(ev)
+	if err != nil {
+		return err
+	}
+	body, encoding, err := compressBody(s.compression, body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	req.Header.Set(webhookDeliveryHeader, rand.Text())
+	if len(s.Secret) > 0 {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(webhookTimestampHeader, ts)
+		req.Header.Set(webhookSignatureHeader, "sha256="+webhookSignature(s.Secret, ts, body))
+	}
+	return doPush(s.client, req)
+}
+
+// HMAC-SHA256 de "<timestamp>.<cuerpo>", con el cuerpo tal como se envía
+// (comprimido si procede). Incluir el timestamp permite rechazar repeticiones.
+func webhookSignature(secret []byte, ts string, body []byte) string {
+	m := hmac.New(cryptoProvider.NewHash, secret)
+	m.Write([]byte(ts + "."))
+	m.Write(body)
+	return hex.EncodeToString(m.Sum(nil))
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+/* Ajuste automático de WindowSize (AIMD) */
+
+const DefaultWindowSize = 1000
+
+var metricWindowSize = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "gctwatch_window_size",
+	Help: "Entradas pedidas por get-entries a cada log.",
+}, []string{"log"})
+
+// Crece de forma aditiva mientras los lotes llegan completos y rápidos, y se
+// reduce de forma multiplicativa ante errores o latencias altas. Si el log
+// devuelve menos de lo pedido se adopta su tope: pedir más solo gasta ancho de banda.
+type WindowController struct {
+	Min, Max      uint64
+	Step          uint64        // incremento aditivo
+	TargetLatency time.Duration // por encima se reduce
+}
+
+var DefaultWindowController = WindowController{Min: 16, Max: 4096, Step: 64, TargetLatency: 2 * time.Second}
+
+// Ajusta la ventana de la fuente tras un get-entries de requested entradas
+func (c *WindowController) Adjust(source *CTLogSource, requested uint64, returned int, latency time.Duration, err error) {
+	if c == nil {
+		return
+	}
+	w := source.WindowSize
+	switch {
+	case err != nil:
+		w /= 2
+	case requested < w:
+		// Al día: el lote no dice nada de la capacidad del log
+		return
+	case uint64(returned) < requested:
+		w = uint64(returned)
+	case latency > c.TargetLatency:
+		w = w * 3 / 4
+	default:
+		w += c.Step
+	}
+	w = min(max(w, c.Min), c.Max)
+	if w != source.WindowSize {
+		source.WindowSize = w
+		metricWindowSize.WithLabelValues(source.Source).Set(float64(w))
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/x509"
 	"encoding/asn1"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"net"
 	"net/url"
@@ -17,6 +18,8 @@ type CertificateJSON struct {
 	//RawSubject              string `json:"raw_subject"`
 	//RawIssuer               string `json:"raw_issuer"`
 
+	FingerprintSHA256 string `json:"fingerprint_sha256"` // hex
+
 	Signature          string `json:"signature"` // base64
 	SignatureAlgorithm string `json:"signature_algorithm"`
 
@@ -134,6 +137,7 @@ func ConvertCertificate(cert *x509.Certificate) CertificateJSON {
 		//RawSubjectPublicKeyInfo:     toHex(cert.RawSubjectPublicKeyInfo),
 		//RawSubject:                  toHex(cert.RawSubject),
 		//RawIssuer:                   toHex(cert.RawIssuer),
+		FingerprintSHA256:           hex.EncodeToString(cryptoProvider.Hash(cert.Raw)),
 		Signature:                   toHex(cert.Signature),
 		SignatureAlgorithm:          cert.SignatureAlgorithm.String(),
 		PublicKeyAlgorithm:          cert.PublicKeyAlgorithm.String(),
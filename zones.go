@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/* Referencia cruzada con ficheros de zona (CZDS) */
+
+// Cada cuánto se comprueba si han cambiado los ficheros de zona
+const zoneReloadCheck = time.Hour
+
+// Estado del dominio registrado en el fichero de zona de su TLD
+type ZoneStatus struct {
+	Status string `json:"status"`           // delegated o not_delegated
+	Zone   string `json:"zone"`             // zona consultada, p.ej. "com"
+	Serial uint32 `json:"serial,omitempty"` // SOA del fichero cargado
+}
+
+// Nombres delegados (con registros NS) de una zona. Se guarda un hash de 64
+// bits por nombre, ordenado, para que zonas como .com quepan en memoria; la
+// probabilidad de un falso "delegated" es despreciable.
+type zoneData struct {
+	apex   string
+	serial uint32
+	names  []uint64
+	file   string
+	mtime  time.Time
+}
+
+func zoneHash(name string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return h.Sum64()
+}
+
+func (z *zoneData) delegated(name string) bool {
+	_, found := slices.BinarySearch(z.names, zoneHash(name))
+	return found
+}
+
+type zoneSet struct {
+	byApex map[string]*zoneData
+	byFile map[string]*zoneData
+}
+
+// Marca el dominio registrado de cada coincidencia como delegado o no en los
+// ficheros de zona cargados (RFC 1035, como los de CZDS, opcionalmente .gz).
+// Los ficheros se cargan en segundo plano y se recargan al cambiar; mientras
+// tanto, o si ningún fichero cubre el TLD, no se añade nada.
+type zoneEnricher struct {
+	patterns  []string
+	zones     atomic.Pointer[zoneSet]
+	loading   atomic.Bool
+	checkedAt atomic.Int64 // UnixNano de la última comprobación
+}
+
+func NewZoneEnricher(patterns []string) (*zoneEnricher, error) {
+	z := &zoneEnricher{patterns: patterns}
+	files, err := z.files()
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no zone files match %s", strings.Join(patterns, ", "))
+	}
+	z.loading.Store(true)
+	go z.reload()
+	return z, nil
+}
+
+func (z *zoneEnricher) Name() string { return "zones" }
+
+func (z *zoneEnricher) files() ([]string, error) {
+	var out []string
+	for _, p := range z.patterns {
+		m, err := filepath.Glob(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid zone file pattern %q: %w", p, err)
+		}
+		out = append(out, m...)
+	}
+	return out, nil
+}
+
+func (z *zoneEnricher) Enrich(ctx context.Context, ev *MatchEvent, in EnrichInput) error {
+	if last := z.checkedAt.Load(); last != 0 && time.Since(time.Unix(0, last)) > zoneReloadCheck && z.loading.CompareAndSwap(false, true) {
+		go z.reload()
+	}
+	set := z.zones.Load()
+	if set == nil {
+		return nil
+	}
+	domain := eventDomain(*ev)
+	// La zona más específica que contiene el dominio (co.uk antes que uk)
+	labels := strings.Split(domain, ".")
+	for i := 1; i < len(labels); i++ {
+		zd, ok := set.byApex[strings.Join(labels[i:], ".")]
+		if !ok {
+			continue
+		}
+		status := "not_delegated"
+		if zd.delegated(domain) {
+			status = "delegated"
+		}
+		ev.Enrichment.Zone = &ZoneStatus{Status: status, Zone: zd.apex, Serial: zd.serial}
+		return nil
+	}
+	return nil
+}
+
+// Carga los ficheros nuevos o modificados; los que fallan conservan la versión anterior
+func (z *zoneEnricher) reload() {
+	defer func() {
+		z.checkedAt.Store(time.Now().UnixNano())
+		z.loading.Store(false)
+	}()
+	files, err := z.files()
+	if err != nil {
+		log.Printf("WARNING: zone files: %v", err)
+		return
+	}
+	prev := z.zones.Load()
+	next := &zoneSet{byApex: make(map[string]*zoneData), byFile: make(map[string]*zoneData)}
+	changed := prev == nil
+	for _, path := range files {
+		fi, err := os.Stat(path)
+		if err != nil {
+			log.Printf("WARNING: zone file %s: %v", path, err)
+			continue
+		}
+		zd := (*zoneData)(nil)
+		if prev != nil {
+			zd = prev.byFile[path]
+		}
+		if zd == nil || !zd.mtime.Equal(fi.ModTime()) {
+			t0 := time.Now()
+			loaded, err := loadZoneFile(path)
+			if err != nil {
+				log.Printf("WARNING: zone file %s: %v", path, err)
+			} else {
+				zd, changed = loaded, true
+				zd.mtime = fi.ModTime()
+				log.Printf("zone %s: %d delegated names (serial %d) from %s in %s",
+					zd.apex, len(zd.names), zd.serial, path, time.Since(t0).Round(time.Millisecond))
+			}
+		}
+		if zd == nil {
+			continue
+		}
+		if other, dup := next.byApex[zd.apex]; dup {
+			log.Printf("WARNING: zone %s in both %s and %s; using %s", zd.apex, other.file, path, path)
+		}
+		next.byApex[zd.apex], next.byFile[path] = zd, zd
+	}
+	if changed || len(next.byFile) != len(prev.byFile) {
+		z.zones.Store(next)
+	}
+}
+
+func loadZoneFile(path string) (*zoneData, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	zd, err := parseZone(r)
+	if err != nil {
+		return nil, err
+	}
+	zd.file = path
+	return zd, nil
+}
+
+// Nombre en minúsculas, sin punto final y relativo al origen si no es absoluto
+func zoneName(name, origin string) string {
+	name = strings.ToLower(name)
+	switch {
+	case name == "@":
+		return origin
+	case strings.HasSuffix(name, "."):
+		return strings.TrimSuffix(name, ".")
+	case origin != "":
+		return name + "." + origin
+	}
+	return name
+}
+
+var zoneClasses = map[string]bool{"in": true, "ch": true, "hs": true, "cs": true}
+
+// Formato maestro de RFC 1035: solo interesan el SOA (apex y serial) y los
+// NS por debajo del apex (delegaciones)
+func parseZone(r io.Reader) (*zoneData, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	zd := &zoneData{}
+	var origin, owner string
+	var pending []string // registro entre paréntesis
+	for sc.Scan() {
+		line := sc.Text()
+		if i := strings.IndexByte(line, ';'); i >= 0 {
+			line = line[:i]
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if pending != nil || strings.Contains(line, "(") {
+			pending = append(pending, line)
+			if !strings.Contains(line, ")") {
+				continue
+			}
+			line = strings.NewReplacer("(", " ", ")", " ").Replace(strings.Join(pending, " "))
+			pending = nil
+		}
+		fields := strings.Fields(line)
+		if strings.HasPrefix(fields[0], "$") {
+			if strings.EqualFold(fields[0], "$ORIGIN") && len(fields) > 1 {
+				origin = zoneName(fields[1], "")
+			}
+			continue
+		}
+		// Sin nombre al principio de la línea: el del registro anterior
+		if line[0] != ' ' && line[0] != '\t' {
+			owner = zoneName(fields[0], origin)
+			fields = fields[1:]
+		}
+		// [TTL] [clase] tipo, en cualquier orden TTL/clase
+		for len(fields) > 0 {
+			if _, err := strconv.ParseUint(fields[0], 10, 32); err == nil || zoneClasses[strings.ToLower(fields[0])] {
+				fields = fields[1:]
+				continue
+			}
+			break
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "SOA":
+			if zd.apex == "" {
+				zd.apex = owner
+				if origin == "" {
+					origin = owner
+				}
+				if len(fields) > 3 {
+					serial, _ := strconv.ParseUint(fields[3], 10, 32)
+					zd.serial = uint32(serial)
+				}
+			}
+		case "NS":
+			if owner != zd.apex {
+				zd.names = append(zd.names, zoneHash(owner))
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if zd.apex == "" {
+		return nil, fmt.Errorf("no SOA record")
+	}
+	slices.Sort(zd.names)
+	zd.names = slices.Compact(zd.names)
+	return zd, nil
+}